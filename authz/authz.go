@@ -0,0 +1,94 @@
+// Package authz derives authorization policies from OpenAPI specs at runtime,
+// for programs that would rather not generate code ahead of time. It exposes
+// the same parser the openapi-authz command uses.
+//
+//	//go:embed openapi.yaml
+//	var spec []byte
+//
+//	cfg, err := authz.ParseConfigFromBytes(spec, authz.Options{})
+package authz
+
+import (
+	"io"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+	"github.com/chr1sbest/openapi-authz/internal/parser"
+)
+
+type (
+	Config         = model.Config
+	RouteKey       = model.RouteKey
+	AuthPolicy     = model.AuthPolicy
+	APIKey         = model.APIKey
+	SchemeType     = model.SchemeType
+	AuthMode       = model.AuthMode
+	Warning        = model.Warning
+	Source         = model.Source
+	SecurityScheme = model.SecurityScheme
+	OAuthFlow      = model.OAuthFlow
+	Options        = parser.Options
+	ClaimsMapping  = parser.ClaimsMapping
+	SchemeClaims   = parser.SchemeClaims
+	ScopeRewrite   = parser.ScopeRewrite
+	ConflictError  = parser.ConflictError
+)
+
+const (
+	AuthPublic   = model.AuthPublic
+	AuthOptional = model.AuthOptional
+	AuthRequired = model.AuthRequired
+
+	SchemeBearer        = model.SchemeBearer
+	SchemeBasic         = model.SchemeBasic
+	SchemeAPIKey        = model.SchemeAPIKey
+	SchemeOAuth2        = model.SchemeOAuth2
+	SchemeOpenIDConnect = model.SchemeOpenIDConnect
+	SchemeMutualTLS     = model.SchemeMutualTLS
+
+	RouterChi      = parser.RouterChi
+	RouterGin      = parser.RouterGin
+	RouterEcho     = parser.RouterEcho
+	RouterFiber    = parser.RouterFiber
+	RouterGorilla  = parser.RouterGorilla
+	RouterServeMux = parser.RouterServeMux
+
+	TrailingSlashStrip = parser.TrailingSlashStrip
+	DuplicatesMerge    = parser.DuplicatesMerge
+	DuplicatesError    = parser.DuplicatesError
+
+	DeprecatedAllow = parser.DeprecatedAllow
+	DeprecatedDeny  = parser.DeprecatedDeny
+	DeprecatedScope = parser.DeprecatedScope
+
+	ModeStrict  = parser.ModeStrict
+	ModeLenient = parser.ModeLenient
+
+	RootSecurityOverride = parser.RootSecurityOverride
+	RootSecurityMerge    = parser.RootSecurityMerge
+
+	FallbackError       = parser.FallbackError
+	FallbackRequireAuth = parser.FallbackRequireAuth
+	FallbackPublic      = parser.FallbackPublic
+)
+
+// ParseConfig reads one or more spec files or URLs and merges their
+// policies. See Options for optional behaviour.
+func ParseConfig(paths []string, opts Options) (*Config, error) {
+	return parser.ParseConfigsWithOptions(paths, opts)
+}
+
+// ParseConfigFromBytes parses a spec held in memory. Both YAML and JSON are
+// accepted; relative file references resolve against the working directory.
+func ParseConfigFromBytes(data []byte, opts Options) (*Config, error) {
+	return parser.ParseConfigFromBytes(data, opts)
+}
+
+// ParseConfigFromReader parses a spec read from r.
+func ParseConfigFromReader(r io.Reader, opts Options) (*Config, error) {
+	return parser.ParseConfigFromReader(r, opts)
+}
+
+// LoadClaimsMapping reads a claims mapping file for Options.ClaimsMapping.
+func LoadClaimsMapping(path string) (*ClaimsMapping, error) {
+	return parser.LoadClaimsMapping(path)
+}
@@ -0,0 +1,44 @@
+package authz
+
+import (
+	"text/template"
+
+	"github.com/chr1sbest/openapi-authz/internal/generator"
+)
+
+type (
+	TemplateData   = generator.TemplateData
+	TemplateRoute  = generator.TemplateRoute
+	TemplateScheme = generator.TemplateScheme
+)
+
+// TemplateOptions configures ExecuteTemplate. Package and Version become
+// TemplateData.Package and TemplateData.Version, and Funcs adds functions
+// for the template to call, replacing built-in ones of the same name.
+type TemplateOptions struct {
+	Package string
+	Version string
+	Funcs   template.FuncMap
+}
+
+// ExecuteTemplate executes the text/template text, named name in errors,
+// with the TemplateData of cfg, like the -template flag of the openapi-authz
+// command. Templates can call the functions of TemplateFuncs.
+func ExecuteTemplate(name, text string, cfg *Config, opts TemplateOptions) ([]byte, error) {
+	return generator.GenerateTemplate(name, text, opts.Package, cfg, generator.Options{
+		Version:       opts.Version,
+		TemplateFuncs: opts.Funcs,
+	})
+}
+
+// TemplateFuncs returns a new map of the functions built into
+// ExecuteTemplate, documented in the README.
+func TemplateFuncs() template.FuncMap {
+	return generator.TemplateFuncs()
+}
+
+// FormatSource removes unused imports from the Go file src and formats it
+// like gofmt, for templates that produce Go code.
+func FormatSource(src []byte) ([]byte, error) {
+	return generator.FormatSource(src)
+}
@@ -4,36 +4,387 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
 
+	"github.com/chr1sbest/openapi-authz/internal/export"
 	"github.com/chr1sbest/openapi-authz/internal/generator"
 	"github.com/chr1sbest/openapi-authz/internal/parser"
 )
 
+// stringList is a flag.Value that collects every occurrence of a repeated
+// flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// writeFiles writes the files of an export: a single file to out, or several
+// into the directory out, which is created if needed.
+func writeFiles(out string, files []export.File) error {
+	if len(files) == 1 {
+		return os.WriteFile(out, files[0].Data, 0o644)
+	}
+	if err := os.MkdirAll(out, 0o755); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(out, f.Name), f.Data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// version returns the module version openapi-authz was built from: the
+// tag for go install ...@version, or "(devel)" for local builds.
+func version() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// withSuffix gives the Go file path p the name suffix, replacing its .go
+// extension: for "_gen.go", "authpolicy.go" becomes "authpolicy_gen.go".
+// The suffix goes before the _test.go of a test file, as for the file of
+// -tests, so "conformance_test.go" becomes "conformance_gen_test.go".
+func withSuffix(p, suffix string) string {
+	if suffix == "" {
+		return p
+	}
+	base, test := strings.CutSuffix(p, "_test.go")
+	if test {
+		p = base + ".go"
+	}
+	if !strings.HasSuffix(p, suffix) {
+		p = strings.TrimSuffix(p, ".go") + suffix
+	}
+	if test {
+		p = strings.TrimSuffix(p, ".go") + "_test.go"
+	}
+	return p
+}
+
+// partPath returns the path of the file holding the policies of group
+// split off the Go file out, named after out with the group inserted before
+// its first dot: "authpolicy.gen.go" becomes "authpolicy.users.gen.go".
+// Keeping the group out of the last "_" element means it can never look
+// like a _test, GOOS or GOARCH suffix to the go tool.
+func partPath(out, group string) string {
+	dir, file := filepath.Split(out)
+	name, ext, ok := strings.Cut(file, ".")
+	if !ok {
+		ext = "go"
+	}
+	return filepath.Join(dir, name+"."+group+"."+ext)
+}
+
+// targetRouters maps generation targets to the router whose route pattern
+// syntax their middleware looks policies up by.
+var targetRouters = map[string]string{
+	generator.TargetGin:      parser.RouterGin,
+	generator.TargetEcho:     parser.RouterEcho,
+	generator.TargetFiber:    parser.RouterFiber,
+	generator.TargetGorilla:  parser.RouterGorilla,
+	generator.TargetServeMux: parser.RouterServeMux,
+}
+
 func main() {
-	in := flag.String("in", "", "Path to OpenAPI YAML file")
-	out := flag.String("out", "", "Path to output Go file")
-	pkg := flag.String("pkg", "httproutes", "Package name for generated code")
+	if len(os.Args) > 1 && os.Args[1] == "bundle" {
+		runBundle(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "reverse" {
+		runReverse(os.Args[2:])
+		return
+	}
+
+	var in, overlays, includePaths, excludePaths, renames stringList
+	flag.Var(&in, "in", "Path or http(s) URL of the OpenAPI YAML/JSON file, or - for stdin (repeatable)")
+	out := flag.String("out", "", "Path to output Go file, or the output file or directory of -format")
+	format := flag.String("format", "go", "Output format: go, or an export format ("+strings.Join(export.Formats(), ", ")+")")
+	rolesClaim := flag.String("roles-claim", "roles", "JWT claim listing the caller's roles, for export formats that read claims")
+	jwtIssuer := flag.String("jwt-issuer", "", "Issuer of the JWTs gateway export formats validate")
+	jwtAudience := flag.String("jwt-audience", "", "Comma-separated audiences of the JWTs gateway export formats validate, or the API identifier of -format auth0")
+	realm := flag.String("realm", "", "Realm identity provider export formats provision (e.g. the Keycloak realm)")
+	scopesClaim := flag.String("scopes-claim", "scope", "JWT claim holding the caller's space-separated scopes, for export formats that read claims")
+	pkg := flag.String("pkg", "httproutes", "Package name for generated code, or of -format rego (default openapi_authz)")
+	grpcService := flag.String("grpc-service", "", "Fully-qualified gRPC service operationIds map to for -target grpc or connect (e.g. users.v1.UserService)")
+	target := flag.String("target", generator.TargetMap, "Generated output: map (policy map only), middleware for gin, echo, fiber, gorilla or servemux (implies the matching -router), grpc or connect interceptors, or a graphql directive")
+	allowRemoteRefs := flag.Bool("allow-remote-refs", false, "Resolve $ref pointers to http(s) URLs")
+	remoteTimeout := flag.Duration("remote-timeout", 30*time.Second, "Timeout for each remote $ref fetch")
+	remoteCacheDir := flag.String("remote-cache-dir", "", "Directory used to cache remote $ref documents")
+	remoteCacheTTL := flag.Duration("remote-cache-ttl", 0, "How long cached remote documents stay fresh (0 = forever)")
+	inAuthHeader := flag.String("in-auth-header", "", `Header sent when -in is a URL ("Name: value", or a bare Authorization value)`)
+	bearerSchemes := flag.String("bearer-schemes", "BearerAuth", "Comma-separated security scheme names treated as bearer-token auth")
+	serverBasePath := flag.Bool("server-base-path", false, "Prefix route keys with the base path of the spec's servers")
+	router := flag.String("router", "chi", "Router whose path pattern syntax route keys use (chi, gin, echo, fiber, gorilla, servemux)")
+	trailingSlash := flag.String("trailing-slash", "", "Trailing slash handling for route keys (strip, or empty to keep paths as declared)")
+	caseInsensitive := flag.Bool("case-insensitive-paths", false, "Lower-case route keys and generate a case-insensitive LookupPolicy")
+	duplicates := flag.String("duplicates", "merge", "How to handle spec paths that collapse to the same route (merge, error)")
+	deprecated := flag.String("deprecated", "allow", "Policy for deprecated operations (allow, deny, scope)")
+	deprecatedScope := flag.String("deprecated-scope", "", "Extra scope required by deprecated operations with -deprecated=scope")
+	strict := flag.Bool("strict", false, "Fail on undeclared or unsupported security schemes and duplicate paths")
+	lenient := flag.Bool("lenient", false, "Report undeclared or unsupported security schemes and duplicate paths as warnings")
+	fallback := flag.String("fallback", "", "Policy for operations without a supported security requirement: error, require-auth or public (default error, require-auth with -lenient)")
+	flag.Var(&overlays, "overlay", "Path of an OpenAPI Overlay applied to the spec before deriving policies (repeatable)")
+	flag.Var(&includePaths, "include-path", "Glob of spec paths to derive policies for, e.g. /api/v1/** (repeatable)")
+	flag.Var(&excludePaths, "exclude-path", "Glob of spec paths to skip, e.g. /internal/** (repeatable)")
+	rootSecurity := flag.String("root-security", "", "How operation security combines with root security: override (default) or merge")
+	profile := flag.String("profile", "", "Environment profile whose x-env overrides apply (e.g. prod)")
+	jobs := flag.Int("jobs", 0, "Number of specs parsed concurrently (0 = GOMAXPROCS)")
+	claimsMapping := flag.String("claims-mapping", "", "YAML file mapping security schemes and scopes to roles and scopes")
+	constants := flag.Bool("constants", false, "Generate Role and Scope constants for every role and scope in the spec")
+	typedConstants := flag.Bool("typed-constants", false, "Generate Role and Scope types with a constant per role and scope in the spec (implies -constants)")
+	claimsHelpers := flag.Bool("claims", false, "Generate the Claims interface and HasAnyRole/HasAllScopes helpers with -target map")
+	exemptPreflight := flag.Bool("exempt-preflight", false, "Let CORS preflight requests through the middleware of router targets without authorization")
+	tests := flag.Bool("tests", false, "Also write a _test.go file next to -out asserting each route's policy")
+	buildTag := flag.String("build-tag", "", `Build constraint written as a //go:build line in generated Go files (e.g. "!generate")`)
+	fileSuffix := flag.String("file-suffix", "", `Name suffix of generated Go files (e.g. "_gen.go"), replacing the .go extension of -out and -conformance`)
+	templatePath := flag.String("template", "", "text/template file executed with the parsed policies in place of the built-in Go output; output to a .go file is gofmt-formatted")
+	matcher := flag.Bool("matcher", false, "Generate MatchRoute and MatchPolicy, which match concrete request paths (e.g. /users/42) to route patterns")
+	registry := flag.Bool("registry", false, "Generate a PolicyRegistry, Registry, with Get, Routes and PublicRoutes methods, and unexport the Policies map unless -policies-var names it")
+	policiesVar := flag.String("policies-var", "", "Name of the generated Policies variable")
+	middlewareFunc := flag.String("middleware-func", "", "Name of the generated AuthPolicyMiddleware function of router targets")
+	flag.Var(&renames, "rename", "Rename a generated top-level identifier, as Old=New (e.g. AuthPolicy=V2Policy) (repeatable)")
+	nameSuffix := flag.String("name-suffix", "", "Suffix appended to every generated top-level identifier not otherwise renamed, so files from several specs can share a package (e.g. V2)")
+	lookup := flag.String("lookup", generator.LookupMap, "How LookupPolicy finds policies: map (index Policies) or switch (switch on method and path, generating LookupPolicy for every target)")
+	split := flag.String("split", "", "Split the routes of Policies into a file per group next to -out: tag (first OpenAPI tag) or path (first path segment)")
+	printVersion := flag.Bool("version", false, "Print the openapi-authz version and exit")
+	conformance := flag.String("conformance", "", "Also write a RunConformance harness, which replays every route against a router, to this _test.go file")
 	flag.Parse()
 
-	if *in == "" || *out == "" {
+	if *printVersion {
+		fmt.Println("openapi-authz", version())
+		return
+	}
+
+	if len(in) == 0 || *out == "" {
 		fmt.Fprintln(os.Stderr, "-in and -out are required")
 		os.Exit(1)
 	}
 
-	cfg, err := parser.ParseConfig(*in)
+	if *format != "go" && *target != generator.TargetMap {
+		fmt.Fprintln(os.Stderr, "-target only applies to -format go")
+		os.Exit(1)
+	}
+	if *format != "go" && (*tests || *conformance != "" || *buildTag != "" || *fileSuffix != "" || *split != "") {
+		fmt.Fprintln(os.Stderr, "-tests, -conformance, -build-tag, -file-suffix and -split only apply to -format go")
+		os.Exit(1)
+	}
+	if *templatePath != "" && (*format != "go" || *target != generator.TargetMap || *split != "") {
+		fmt.Fprintln(os.Stderr, "-template replaces the built-in output, so -format, -target and -split do not apply")
+		os.Exit(1)
+	}
+	if *lookup != generator.LookupMap && (*format != "go" || *templatePath != "" || *split != "") {
+		fmt.Fprintln(os.Stderr, "-lookup only applies to the built-in -format go output without -split")
+		os.Exit(1)
+	}
+	names := make(map[string]string)
+	for _, r := range renames {
+		old, name, ok := strings.Cut(r, "=")
+		if !ok || old == "" || name == "" {
+			fmt.Fprintf(os.Stderr, "-rename %q: want Old=New\n", r)
+			os.Exit(1)
+		}
+		names[old] = name
+	}
+	if *policiesVar != "" {
+		names["Policies"] = *policiesVar
+	}
+	if *middlewareFunc != "" {
+		names["AuthPolicyMiddleware"] = *middlewareFunc
+	}
+	if (len(names) > 0 || *nameSuffix != "" || *registry) && (*format != "go" || *templatePath != "") {
+		fmt.Fprintln(os.Stderr, "-registry, -policies-var, -middleware-func, -rename and -name-suffix only apply to the built-in -format go output")
+		os.Exit(1)
+	}
+	if *fileSuffix != "" && (!strings.HasSuffix(*fileSuffix, ".go") || strings.HasSuffix(*fileSuffix, "_test.go")) {
+		fmt.Fprintln(os.Stderr, "-file-suffix must end in .go and not _test.go")
+		os.Exit(1)
+	}
+	// The harness imports testing, which only test files may.
+	if *conformance != "" && !strings.HasSuffix(*conformance, "_test.go") {
+		fmt.Fprintln(os.Stderr, "-conformance must name a _test.go file")
+		os.Exit(1)
+	}
+
+	if r, ok := targetRouters[*target]; ok {
+		routerSet := false
+		flag.Visit(func(f *flag.Flag) { routerSet = routerSet || f.Name == "router" })
+		if routerSet && *router != r {
+			fmt.Fprintf(os.Stderr, "-target %s needs -router %s\n", *target, r)
+			os.Exit(1)
+		}
+		*router = r
+	}
+
+	var mode string
+	switch {
+	case *strict && *lenient:
+		fmt.Fprintln(os.Stderr, "-strict and -lenient are mutually exclusive")
+		os.Exit(1)
+	case *strict:
+		mode = parser.ModeStrict
+	case *lenient:
+		mode = parser.ModeLenient
+	}
+
+	var claims *parser.ClaimsMapping
+	if *claimsMapping != "" {
+		var err error
+		if claims, err = parser.LoadClaimsMapping(*claimsMapping); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	cfg, err := parser.ParseConfigsWithOptions(in, parser.Options{
+		AllowRemoteRefs:      *allowRemoteRefs,
+		RemoteTimeout:        *remoteTimeout,
+		RemoteCacheDir:       *remoteCacheDir,
+		RemoteCacheTTL:       *remoteCacheTTL,
+		SpecAuthHeader:       *inAuthHeader,
+		BearerSchemes:        splitList(*bearerSchemes),
+		ServerBasePath:       *serverBasePath,
+		Router:               *router,
+		TrailingSlash:        *trailingSlash,
+		CaseInsensitivePaths: *caseInsensitive,
+		Duplicates:           *duplicates,
+		DeprecatedMode:       *deprecated,
+		DeprecatedScope:      *deprecatedScope,
+		Mode:                 mode,
+		Fallback:             *fallback,
+		ClaimsMapping:        claims,
+		Overlays:             overlays,
+		IncludePaths:         includePaths,
+		ExcludePaths:         excludePaths,
+		RootSecurity:         *rootSecurity,
+		Profile:              *profile,
+		Concurrency:          *jobs,
+	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "parse spec: %v\n", err)
 		os.Exit(1)
 	}
+	for _, w := range cfg.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+
+	if *format != "go" {
+		var exportPkg string
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "pkg" {
+				exportPkg = *pkg
+			}
+		})
+		files, err := export.Export(*format, cfg, export.Options{
+			Package:     exportPkg,
+			RolesClaim:  *rolesClaim,
+			ScopesClaim: *scopesClaim,
+			JWTIssuer:   *jwtIssuer,
+			JWTAudience: splitList(*jwtAudience),
+			Realm:       *realm,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "export: %v\n", err)
+			os.Exit(1)
+		}
+		if err := writeFiles(*out, files); err != nil {
+			fmt.Fprintf(os.Stderr, "write output: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	code, err := generator.Generate(*pkg, cfg)
+	genOpts := generator.Options{
+		Target:          *target,
+		GRPCService:     *grpcService,
+		Constants:       *constants,
+		TypedConstants:  *typedConstants,
+		Claims:          *claimsHelpers,
+		ExemptPreflight: *exemptPreflight,
+		Version:         version(),
+		BuildTag:        *buildTag,
+		Lookup:          *lookup,
+		Matcher:         *matcher,
+		Registry:        *registry,
+		Names:           names,
+		NameSuffix:      *nameSuffix,
+	}
+	var code []byte
+	var parts []generator.Part
+	if *templatePath != "" {
+		text, readErr := os.ReadFile(*templatePath)
+		if readErr != nil {
+			fmt.Fprintf(os.Stderr, "read template: %v\n", readErr)
+			os.Exit(1)
+		}
+		code, err = generator.GenerateTemplate(filepath.Base(*templatePath), string(text), *pkg, cfg, genOpts)
+		if err == nil && strings.HasSuffix(withSuffix(*out, *fileSuffix), ".go") {
+			code, err = generator.FormatSource(code)
+		}
+	} else if *split != "" {
+		code, parts, err = generator.GenerateSplit(*pkg, cfg, genOpts, *split)
+	} else {
+		code, err = generator.GenerateWithOptions(*pkg, cfg, genOpts)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "generate code: %v\n", err)
 		os.Exit(1)
 	}
 
+	*out = withSuffix(*out, *fileSuffix)
 	if err := os.WriteFile(*out, code, 0o644); err != nil {
 		fmt.Fprintf(os.Stderr, "write output: %v\n", err)
 		os.Exit(1)
 	}
+	for _, part := range parts {
+		if err := os.WriteFile(partPath(*out, part.Group), part.Source, 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "write output: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *tests {
+		test, err := generator.GenerateTest(*pkg, cfg, genOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "generate test: %v\n", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(strings.TrimSuffix(*out, ".go")+"_test.go", test, 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "write output: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *conformance != "" {
+		harness, err := generator.GenerateConformance(*pkg, genOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "generate conformance harness: %v\n", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(withSuffix(*conformance, *fileSuffix), harness, 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "write output: %v\n", err)
+			os.Exit(1)
+		}
+	}
 }
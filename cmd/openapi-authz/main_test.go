@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestWithSuffix(t *testing.T) {
+	for _, tc := range []struct {
+		path, suffix, want string
+	}{
+		{"authpolicy.go", "", "authpolicy.go"},
+		{"authpolicy.go", "_gen.go", "authpolicy_gen.go"},
+		{"authpolicy_gen.go", "_gen.go", "authpolicy_gen.go"},
+		{"authpolicy.go", ".gen.go", "authpolicy.gen.go"},
+		{"conformance_test.go", "_gen.go", "conformance_gen_test.go"},
+		{"conformance_gen_test.go", "_gen.go", "conformance_gen_test.go"},
+		{"conformance_test.go", ".gen.go", "conformance.gen_test.go"},
+	} {
+		if got := withSuffix(tc.path, tc.suffix); got != tc.want {
+			t.Errorf("withSuffix(%q, %q) = %q, want %q", tc.path, tc.suffix, got, tc.want)
+		}
+	}
+}
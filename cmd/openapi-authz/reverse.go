@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/chr1sbest/openapi-authz/internal/reverse"
+)
+
+// runReverse implements `openapi-authz reverse`, which reads a hand-written
+// Go policy map and writes an OpenAPI Overlay stating its routes' security.
+func runReverse(args []string) {
+	fs := flag.NewFlagSet("reverse", flag.ExitOnError)
+	in := fs.String("in", "", "Path of the Go file declaring the policy map")
+	out := fs.String("out", "-", "Path of the overlay, or - for stdout")
+	varName := fs.String("var", "", "Name of the policy map variable (default: the file's only package-level map)")
+	scheme := fs.String("scheme", reverse.DefaultScheme, "Security scheme every requirement names")
+	fs.Parse(args)
+
+	if *in == "" {
+		fmt.Fprintln(os.Stderr, "-in is required")
+		os.Exit(1)
+	}
+
+	src, err := os.ReadFile(*in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read policy map: %v\n", err)
+		os.Exit(1)
+	}
+	cfg, err := reverse.ParsePolicies(*in, src, *varName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "parse policy map: %v\n", err)
+		os.Exit(1)
+	}
+	for _, w := range cfg.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+	overlay, err := reverse.Overlay(cfg, *scheme, *in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "write overlay: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *out == "-" {
+		os.Stdout.Write(overlay)
+		return
+	}
+	if err := os.WriteFile(*out, overlay, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "write output: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,176 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// apiGatewayAuthorizer is the security scheme name of the JWT authorizer.
+const apiGatewayAuthorizer = "jwt"
+
+// apiGatewayDenyScope is the authorization scope denied routes require.
+// Tokens are never issued with it, so the authorizer rejects every request
+// to those routes.
+const apiGatewayDenyScope = "openapi-authz:deny"
+
+// exportAPIGateway renders an OpenAPI document for an API Gateway HTTP API
+// whose routes are protected by a JWT authorizer. The authorizer requires
+// a token holding at least one of a route's authorization scopes, so
+// scopes are only listed when every requirement set of the route is a
+// single scope. Every other route requiring authentication gets a token
+// check alone, and each operation records its full policy in an
+// x-openapi-authz extension for the service to enforce. Denied routes
+// require apiGatewayDenyScope rather than being left out, which would let
+// a parameter route matching their path take their requests.
+func exportAPIGateway(cfg *model.Config, opts Options) ([]File, error) {
+	if opts.JWTIssuer == "" || len(opts.JWTAudience) == 0 {
+		return nil, errors.New("the apigateway format needs a JWT issuer and audience")
+	}
+
+	paths := make(map[string]map[string]any)
+	for _, key := range sortedRoutes(cfg.Policies) {
+		p := cfg.Policies[key]
+		op := map[string]any{"x-openapi-authz": newServicePolicy(p)}
+		if p.OperationID != "" {
+			op["operationId"] = p.OperationID
+		}
+		if p.Deny || p.Mode() == model.AuthRequired {
+			op["security"] = []any{map[string]any{apiGatewayAuthorizer: apiGatewayScopes(p)}}
+		} else {
+			op["security"] = []any{}
+		}
+
+		path := apiGatewayPath(key.Path)
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		paths[path][strings.ToLower(key.Method)] = op
+	}
+
+	doc := map[string]any{
+		"openapi": "3.0.1",
+		"info":    map[string]any{"title": "openapi-authz", "version": "1.0"},
+		"paths":   paths,
+		"components": map[string]any{"securitySchemes": map[string]any{
+			apiGatewayAuthorizer: map[string]any{
+				"type":  "oauth2",
+				"flows": map[string]any{},
+				"x-amazon-apigateway-authorizer": map[string]any{
+					"type":           "jwt",
+					"identitySource": "$request.header.Authorization",
+					"jwtConfiguration": map[string]any{
+						"issuer":   opts.JWTIssuer,
+						"audience": opts.JWTAudience,
+					},
+				},
+			},
+		}},
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []File{{Name: "openapi.json", Data: append(data, '\n')}}, nil
+}
+
+// exportAPIGatewayTerraform renders Terraform configuration for the AWS
+// provider that adds the routes of an existing API Gateway HTTP API: a JWT
+// authorizer, and a route per policy sending requests to one integration.
+// Routes requiring authentication use the authorizer with the scopes
+// apiGatewayScopes allows, and the others none, like the apigateway
+// format. Denied routes require apiGatewayDenyScope.
+func exportAPIGatewayTerraform(cfg *model.Config, opts Options) ([]File, error) {
+	if opts.JWTIssuer == "" || len(opts.JWTAudience) == 0 {
+		return nil, errors.New("the apigateway-terraform format needs a JWT issuer and audience")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by openapi-authz; DO NOT EDIT.\n\n")
+	buf.WriteString("variable \"api_id\" {\n")
+	buf.WriteString("  description = \"ID of the API Gateway HTTP API\"\n")
+	buf.WriteString("  type        = string\n")
+	buf.WriteString("}\n\n")
+	buf.WriteString("variable \"integration_id\" {\n")
+	buf.WriteString("  description = \"ID of the integration routes send requests to\"\n")
+	buf.WriteString("  type        = string\n")
+	buf.WriteString("}\n\n")
+
+	audience := make([]string, len(opts.JWTAudience))
+	for i, aud := range opts.JWTAudience {
+		audience[i] = hclString(aud)
+	}
+	buf.WriteString("resource \"aws_apigatewayv2_authorizer\" \"jwt\" {\n")
+	buf.WriteString("  api_id           = var.api_id\n")
+	buf.WriteString("  name             = \"openapi-authz\"\n")
+	buf.WriteString("  authorizer_type  = \"JWT\"\n")
+	buf.WriteString("  identity_sources = [\"$request.header.Authorization\"]\n\n")
+	buf.WriteString("  jwt_configuration {\n")
+	fmt.Fprintf(&buf, "    issuer   = %s\n", hclString(opts.JWTIssuer))
+	fmt.Fprintf(&buf, "    audience = [%s]\n", strings.Join(audience, ", "))
+	buf.WriteString("  }\n")
+	buf.WriteString("}\n")
+
+	names := make(map[string]bool)
+	for _, key := range sortedRoutes(cfg.Policies) {
+		p := cfg.Policies[key]
+		attrs := [][2]string{
+			{"api_id", "var.api_id"},
+			{"route_key", hclString(key.Method + " " + apiGatewayPath(key.Path))},
+			{"target", `"integrations/${var.integration_id}"`},
+		}
+		if p.Deny || p.Mode() == model.AuthRequired {
+			attrs = append(attrs, [2]string{"authorization_type", `"JWT"`}, [2]string{"authorizer_id", "aws_apigatewayv2_authorizer.jwt.id"})
+			if scopes := apiGatewayScopes(p); len(scopes) > 0 {
+				quoted := make([]string, len(scopes))
+				for i, scope := range scopes {
+					quoted[i] = hclString(scope)
+				}
+				attrs = append(attrs, [2]string{"authorization_scopes", "[" + strings.Join(quoted, ", ") + "]"})
+			}
+		} else {
+			attrs = append(attrs, [2]string{"authorization_type", `"NONE"`})
+		}
+
+		// Attributes are aligned like terraform fmt does.
+		width := 0
+		for _, attr := range attrs {
+			width = max(width, len(attr[0]))
+		}
+		fmt.Fprintf(&buf, "\nresource \"aws_apigatewayv2_route\" %q {\n", uniqueName(names, routeIdent(key)))
+		for _, attr := range attrs {
+			fmt.Fprintf(&buf, "  %-*s = %s\n", width, attr[0], attr[1])
+		}
+		buf.WriteString("}\n")
+	}
+	return []File{{Name: "apigateway.tf", Data: buf.Bytes()}}, nil
+}
+
+// apiGatewayPath returns path with its parameters written as API Gateway
+// expects, such as {id}.
+func apiGatewayPath(path string) string {
+	return replaceRouteParams(path, func(param string) string {
+		return "{" + strings.Trim(param, "{}:") + "}"
+	})
+}
+
+// apiGatewayScopes returns the authorization scopes of p: one per
+// requirement set when each is a single scope, and none otherwise. A
+// denied p has apiGatewayDenyScope alone.
+func apiGatewayScopes(p model.AuthPolicy) []string {
+	if p.Deny {
+		return []string{apiGatewayDenyScope}
+	}
+	scopes := []string{}
+	for _, req := range append([]model.AuthPolicy{p}, p.Alternatives...) {
+		if len(req.Roles) > 0 || len(req.Scopes) != 1 {
+			return []string{}
+		}
+		scopes = append(scopes, req.Scopes[0])
+	}
+	return scopes
+}
@@ -0,0 +1,52 @@
+package export
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+type auth0ResourceServer struct {
+	Name       string       `json:"name"`
+	Identifier string       `json:"identifier"`
+	SigningAlg string       `json:"signing_alg"`
+	Scopes     []auth0Scope `json:"scopes"`
+}
+
+type auth0Scope struct {
+	Value       string `json:"value"`
+	Description string `json:"description"`
+}
+
+// exportAuth0 renders an Auth0 resource server, as the Deploy CLI
+// (a0deploy) reads it from its resource-servers directory, whose
+// identifier is the JWT audience and whose scopes are those the spec
+// names. Auth0 requires a description for every scope, so scopes the spec
+// does not describe are described by the routes that need them, or by
+// their name. Roles are left out: Auth0 grants them scopes as permissions
+// rather than putting them in tokens.
+func exportAuth0(cfg *model.Config, opts Options) ([]File, error) {
+	if len(opts.JWTAudience) != 1 {
+		return nil, errors.New("the auth0 format needs exactly one JWT audience, the API identifier")
+	}
+	server := auth0ResourceServer{
+		Name:       opts.JWTAudience[0],
+		Identifier: opts.JWTAudience[0],
+		SigningAlg: "RS256",
+		Scopes:     []auth0Scope{},
+	}
+	_, scopes := idpRolesAndScopes(cfg)
+	for _, scope := range scopes {
+		description := scope.description()
+		if description == "" {
+			description = scope.Name
+		}
+		server.Scopes = append(server.Scopes, auth0Scope{Value: scope.Name, Description: description})
+	}
+	data, err := json.MarshalIndent(server, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []File{{Name: "resource-server.json", Data: append(data, '\n')}}, nil
+}
@@ -0,0 +1,122 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// casbinModel enforces policy.csv. Requests are (sub, obj, act): the
+// caller's subject, or "" when anonymous, the request path and the method.
+// Each policy row holds a rule evaluated for the caller, so a row can
+// require a role and several scopes together. Roles and scopes are granted
+// with g rows, scopes prefixed with "scope:". The first matching row
+// decides, so rows of more specific routes come first.
+const casbinModel = `# Code generated by openapi-authz; DO NOT EDIT.
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub_rule, obj, act, eft
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = priority(p.eft) || deny
+
+[matchers]
+m = keyMatch2(r.obj, p.obj) && r.act == p.act && eval(p.sub_rule)
+`
+
+// exportCasbin renders a Casbin model and a policy.csv with a row per
+// route and requirement set. Paths use keyMatch2's ":param" syntax. Denied
+// routes, and routes shadowing another, end with a deny row so that
+// requests their rules reject do not fall through to a less specific
+// route's rows.
+func exportCasbin(cfg *model.Config, _ Options) ([]File, error) {
+	shadowing := make(map[model.RouteKey]bool)
+	for key := range cfg.Policies {
+		for _, other := range shadowingRoutes(key, cfg.Policies) {
+			shadowing[other] = true
+		}
+	}
+
+	var policy bytes.Buffer
+	policy.WriteString("# Code generated by openapi-authz; DO NOT EDIT.\n")
+	w := csv.NewWriter(&policy)
+	for _, key := range routesByPrecedence(cfg.Policies) {
+		p := cfg.Policies[key]
+		obj := replaceRouteParams(key.Path, func(param string) string {
+			return ":" + strings.Trim(param, "{}:")
+		})
+
+		var rules []string
+		switch {
+		case p.Deny:
+		case p.Mode() == model.AuthPublic:
+			rules = append(rules, "true")
+		default:
+			if p.Mode() == model.AuthOptional {
+				rules = append(rules, "r.sub == ''")
+			}
+			for _, req := range append([]model.AuthPolicy{p}, p.Alternatives...) {
+				if rule := casbinRule(req); !slices.Contains(rules, rule) {
+					rules = append(rules, rule)
+				}
+			}
+		}
+		for _, rule := range rules {
+			if err := w.Write([]string{"p", rule, obj, key.Method, "allow"}); err != nil {
+				return nil, err
+			}
+		}
+		if p.Deny || shadowing[key] {
+			if err := w.Write([]string{"p", "true", obj, key.Method, "deny"}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+
+	return []File{
+		{Name: "model.conf", Data: []byte(casbinModel)},
+		{Name: "policy.csv", Data: policy.Bytes()},
+	}, nil
+}
+
+// casbinRule returns the rule requiring any of p's roles and all of its
+// scopes, or any authenticated caller when it names neither.
+func casbinRule(p model.AuthPolicy) string {
+	var conds []string
+	if len(p.Roles) > 0 {
+		roles := make([]string, len(p.Roles))
+		for i, role := range p.Roles {
+			roles[i] = fmt.Sprintf("g(r.sub, %s)", casbinString(role))
+		}
+		cond := strings.Join(roles, " || ")
+		if len(roles) > 1 && len(p.Scopes) > 0 {
+			cond = "(" + cond + ")"
+		}
+		conds = append(conds, cond)
+	}
+	for _, scope := range p.Scopes {
+		conds = append(conds, fmt.Sprintf("g(r.sub, %s)", casbinString("scope:"+scope)))
+	}
+	if len(conds) == 0 {
+		return "r.sub != ''"
+	}
+	return strings.Join(conds, " && ")
+}
+
+// casbinString quotes s as a single-quoted matcher string.
+func casbinString(s string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", `\'`) + "'"
+}
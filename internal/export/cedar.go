@@ -0,0 +1,115 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// exportCedar renders a Cedar policy set and the schema it is written
+// against. Requests are authorized with the HTTP method as the action, the
+// route pattern as a Route resource, and either a User principal, whose
+// roles and scopes attributes hold its claims, or an Anonymous one.
+func exportCedar(cfg *model.Config, _ Options) ([]File, error) {
+	var policies bytes.Buffer
+	policies.WriteString("// Code generated by openapi-authz; DO NOT EDIT.\n")
+
+	var methods []string
+	for _, key := range sortedRoutes(cfg.Policies) {
+		p := cfg.Policies[key]
+		if !slices.Contains(methods, key.Method) {
+			methods = append(methods, key.Method)
+		}
+		scope := fmt.Sprintf("action == Action::%s,\n  resource == Route::%s", cedarString(key.Method), cedarString(key.Path))
+		id := key.Method + " " + key.Path
+
+		switch {
+		case p.Deny:
+			fmt.Fprintf(&policies, "\n@id(%s)\nforbid (\n  principal,\n  %s\n);\n", cedarString(id), scope)
+		case p.Mode() == model.AuthPublic:
+			fmt.Fprintf(&policies, "\n@id(%s)\npermit (\n  principal,\n  %s\n);\n", cedarString(id), scope)
+		default:
+			n := 0
+			next := func() string {
+				n++
+				if n == 1 {
+					return cedarString(id)
+				}
+				return cedarString(fmt.Sprintf("%s (%d)", id, n))
+			}
+			if p.Mode() == model.AuthOptional {
+				fmt.Fprintf(&policies, "\n@id(%s)\npermit (\n  principal is Anonymous,\n  %s\n);\n", next(), scope)
+			}
+			var written []string
+			for _, req := range append([]model.AuthPolicy{p}, p.Alternatives...) {
+				cond := cedarCondition(req)
+				if slices.Contains(written, cond) {
+					continue
+				}
+				written = append(written, cond)
+				fmt.Fprintf(&policies, "\n@id(%s)\npermit (\n  principal is User,\n  %s\n)%s;\n", next(), scope, cond)
+			}
+		}
+	}
+
+	var schema bytes.Buffer
+	schema.WriteString("// Code generated by openapi-authz; DO NOT EDIT.\n")
+	schema.WriteString("entity User = {\n  roles: Set<String>,\n  scopes: Set<String>,\n};\n")
+	schema.WriteString("entity Anonymous;\n")
+	schema.WriteString("entity Route;\n")
+	slices.Sort(methods)
+	for _, method := range methods {
+		fmt.Fprintf(&schema, "action %s appliesTo {\n  principal: [User, Anonymous],\n  resource: [Route],\n};\n", cedarString(method))
+	}
+
+	return []File{
+		{Name: "policies.cedar", Data: policies.Bytes()},
+		{Name: "schema.cedarschema", Data: schema.Bytes()},
+	}, nil
+}
+
+// cedarCondition returns the when clause requiring any of p's roles and all
+// of its scopes, or "" when it names neither.
+func cedarCondition(p model.AuthPolicy) string {
+	var conds []string
+	if len(p.Roles) > 0 {
+		conds = append(conds, fmt.Sprintf("principal.roles.containsAny([%s])", cedarList(p.Roles)))
+	}
+	if len(p.Scopes) > 0 {
+		conds = append(conds, fmt.Sprintf("principal.scopes.containsAll([%s])", cedarList(p.Scopes)))
+	}
+	if len(conds) == 0 {
+		return ""
+	}
+	return "\nwhen { " + strings.Join(conds, " && ") + " }"
+}
+
+// cedarString quotes s as a Cedar string literal.
+func cedarString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u{%x}`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func cedarList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = cedarString(item)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,257 @@
+package export
+
+import (
+	"reflect"
+	"regexp"
+	"slices"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// envoyJWTPayload is the jwt_authn payload_in_metadata key the RBAC filter
+// reads claims from.
+const envoyJWTPayload = "jwt_payload"
+
+type envoyHTTPFilter struct {
+	Name        string          `yaml:"name"`
+	TypedConfig envoyRBACConfig `yaml:"typed_config"`
+}
+
+type envoyRBACConfig struct {
+	Type  string         `yaml:"@type"`
+	Rules envoyRBACRules `yaml:"rules"`
+}
+
+type envoyRBACRules struct {
+	Action   string                     `yaml:"action"`
+	Policies map[string]envoyRBACPolicy `yaml:"policies"`
+}
+
+type envoyRBACPolicy struct {
+	Permissions []any `yaml:"permissions"`
+	Principals  []any `yaml:"principals"`
+}
+
+// exportEnvoyRBAC renders an ALLOW-action RBAC HTTP filter with one policy
+// per route. Permissions match the method and path; principals match the
+// claims of the JWT verified by an earlier jwt_authn filter, which must set
+// payload_in_metadata to "jwt_payload". Requests no policy allows, including
+// those to routes whose policy is Deny, are rejected. A permission excludes
+// the paths of the routes that shadow its own, so a parameter route does not
+// allow requests meant for a more specific route.
+func exportEnvoyRBAC(cfg *model.Config, opts Options) ([]File, error) {
+	policies := make(map[string]envoyRBACPolicy, len(cfg.Policies))
+	for _, key := range sortedRoutes(cfg.Policies) {
+		policy := cfg.Policies[key]
+		if policy.Deny {
+			continue
+		}
+		policies[key.Method+" "+key.Path] = envoyRBACPolicy{
+			Permissions: []any{envoyRoute(key, shadowingRoutes(key, cfg.Policies))},
+			Principals:  envoyPrincipals(policy, opts),
+		}
+	}
+
+	data, err := marshalYAML(envoyHTTPFilter{
+		Name: "envoy.filters.http.rbac",
+		TypedConfig: envoyRBACConfig{
+			Type:  "type.googleapis.com/envoy.extensions.filters.http.rbac.v3.RBAC",
+			Rules: envoyRBACRules{Action: "ALLOW", Policies: policies},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []File{{Name: "rbac.yaml", Data: data}}, nil
+}
+
+// envoyRoute returns a permission matching the method and path of key but
+// none of the paths of the routes in shadowing.
+func envoyRoute(key model.RouteKey, shadowing []model.RouteKey) map[string]any {
+	rules := []any{
+		map[string]any{"header": map[string]any{
+			"name":         ":method",
+			"string_match": map[string]any{"exact": key.Method},
+		}},
+		envoyPath(key.Path),
+	}
+	if len(shadowing) > 0 {
+		paths := make([]any, len(shadowing))
+		for i, other := range shadowing {
+			paths[i] = envoyPath(other.Path)
+		}
+		rules = append(rules, map[string]any{"not_rule": map[string]any{"or_rules": map[string]any{"rules": paths}}})
+	}
+	return map[string]any{"and_rules": map[string]any{"rules": rules}}
+}
+
+// envoyPath returns a permission matching the concrete paths of the route
+// pattern path.
+func envoyPath(path string) map[string]any {
+	return map[string]any{"url_path": map[string]any{
+		"path": map[string]any{"safe_regex": map[string]any{"regex": pathRegex(path)}},
+	}}
+}
+
+// envoyPrincipals returns the principals allowed by policy: any caller for
+// public and optional-auth policies, otherwise callers satisfying the
+// policy or one of its alternatives.
+func envoyPrincipals(policy model.AuthPolicy, opts Options) []any {
+	if policy.Mode() != model.AuthRequired {
+		return []any{map[string]any{"any": true}}
+	}
+	principals := []any{envoyPrincipal(policy, opts)}
+	for _, alt := range policy.Alternatives {
+		principal := envoyPrincipal(alt, opts)
+		if !slices.ContainsFunc(principals, func(p any) bool { return reflect.DeepEqual(p, principal) }) {
+			principals = append(principals, principal)
+		}
+	}
+	return principals
+}
+
+// envoyPrincipal matches a caller holding any of p's roles and all of its
+// scopes, or any authenticated caller when p names neither.
+func envoyPrincipal(p model.AuthPolicy, opts Options) map[string]any {
+	var ids []any
+	if len(p.Roles) > 0 {
+		roles := make([]any, len(p.Roles))
+		for i, role := range p.Roles {
+			roles[i] = envoyClaim(opts.rolesClaim(), map[string]any{
+				"list_match": map[string]any{"one_of": map[string]any{"string_match": map[string]any{"exact": role}}},
+			})
+		}
+		if len(roles) == 1 {
+			ids = append(ids, roles[0])
+		} else {
+			ids = append(ids, map[string]any{"or_ids": map[string]any{"ids": roles}})
+		}
+	}
+	for _, scope := range p.Scopes {
+		ids = append(ids, envoyClaim(opts.scopesClaim(), map[string]any{
+			"string_match": map[string]any{"safe_regex": map[string]any{"regex": "(^| )" + regexp.QuoteMeta(scope) + "( |$)"}},
+		}))
+	}
+
+	switch len(ids) {
+	case 0:
+		return map[string]any{"metadata": map[string]any{
+			"filter": "envoy.filters.http.jwt_authn",
+			"path":   []any{map[string]any{"key": envoyJWTPayload}},
+			"value":  map[string]any{"present_match": true},
+		}}
+	case 1:
+		return ids[0].(map[string]any)
+	default:
+		return map[string]any{"and_ids": map[string]any{"ids": ids}}
+	}
+}
+
+// envoyClaim matches the JWT claim named claim against value.
+func envoyClaim(claim string, value map[string]any) map[string]any {
+	return map[string]any{"metadata": map[string]any{
+		"filter": "envoy.filters.http.jwt_authn",
+		"path":   []any{map[string]any{"key": envoyJWTPayload}, map[string]any{"key": claim}},
+		"value":  value,
+	}}
+}
+
+// envoyMetadataNamespace is the filter metadata namespace routes carry
+// their policy in, and that ext_authz forwards to the authorization
+// service.
+const envoyMetadataNamespace = "openapi_authz"
+
+// envoyRouteMetadata is the policy of a route as the authorization service
+// receives it in the CheckRequest's route_metadata_context.
+type envoyRouteMetadata struct {
+	Method       string               `yaml:"method,omitempty"`
+	Path         string               `yaml:"path,omitempty"`
+	OperationID  string               `yaml:"operation_id,omitempty"`
+	RequireAuth  bool                 `yaml:"require_auth"`
+	OptionalAuth bool                 `yaml:"optional_auth,omitempty"`
+	Roles        []string             `yaml:"roles,omitempty"`
+	Scopes       []string             `yaml:"scopes,omitempty"`
+	Conditions   []string             `yaml:"conditions,omitempty"`
+	OwnerParam   string               `yaml:"owner_param,omitempty"`
+	Alternatives []envoyRouteMetadata `yaml:"alternatives,omitempty"`
+}
+
+func newEnvoyRouteMetadata(key model.RouteKey, p model.AuthPolicy) envoyRouteMetadata {
+	m := envoyRouteMetadata{
+		Method:       key.Method,
+		Path:         key.Path,
+		OperationID:  p.OperationID,
+		RequireAuth:  p.RequireAuth,
+		OptionalAuth: p.OptionalAuth,
+		Roles:        p.Roles,
+		Scopes:       p.Scopes,
+		Conditions:   p.Conditions,
+		OwnerParam:   p.OwnerParam,
+	}
+	for _, alt := range p.Alternatives {
+		m.Alternatives = append(m.Alternatives, envoyRouteMetadata{
+			RequireAuth: alt.RequireAuth,
+			Roles:       alt.Roles,
+			Scopes:      alt.Scopes,
+		})
+	}
+	return m
+}
+
+// exportEnvoyExtAuthz renders an ext_authz HTTP filter that calls the gRPC
+// cluster "ext_authz", and routes that carry their policy as metadata for
+// it. Public routes disable the filter and denied routes respond 403
+// directly. Routes forward to the cluster "backend"; both cluster names are
+// placeholders for the deployment's own.
+func exportEnvoyExtAuthz(cfg *model.Config, _ Options) ([]File, error) {
+	filter, err := marshalYAML(map[string]any{
+		"name": "envoy.filters.http.ext_authz",
+		"typed_config": map[string]any{
+			"@type":                             "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthz",
+			"transport_api_version":             "V3",
+			"grpc_service":                      map[string]any{"envoy_grpc": map[string]any{"cluster_name": "ext_authz"}},
+			"route_metadata_context_namespaces": []string{envoyMetadataNamespace},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := routesByPrecedence(cfg.Policies)
+
+	routes := make([]any, 0, len(keys))
+	for _, key := range keys {
+		policy := cfg.Policies[key]
+		route := map[string]any{
+			"name": key.Method + " " + key.Path,
+			"match": map[string]any{
+				"safe_regex": map[string]any{"regex": pathRegex(key.Path)},
+				"headers":    []any{map[string]any{"name": ":method", "string_match": map[string]any{"exact": key.Method}}},
+			},
+			"metadata": map[string]any{"filter_metadata": map[string]any{
+				envoyMetadataNamespace: newEnvoyRouteMetadata(key, policy),
+			}},
+		}
+		if policy.Deny {
+			route["direct_response"] = map[string]any{"status": 403}
+		} else {
+			route["route"] = map[string]any{"cluster": "backend"}
+		}
+		if policy.Mode() == model.AuthPublic && !policy.Deny {
+			route["typed_per_filter_config"] = map[string]any{"envoy.filters.http.ext_authz": map[string]any{
+				"@type":    "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+				"disabled": true,
+			}}
+		}
+		routes = append(routes, route)
+	}
+	routeData, err := marshalYAML(map[string]any{"routes": routes})
+	if err != nil {
+		return nil, err
+	}
+
+	return []File{
+		{Name: "ext_authz.yaml", Data: filter},
+		{Name: "routes.yaml", Data: routeData},
+	}, nil
+}
@@ -0,0 +1,449 @@
+// Package export renders a parsed Config in formats consumed outside of Go,
+// such as proxy configuration, so enforcement elsewhere can be derived from
+// the same spec as the generated policy map.
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// Export formats.
+const (
+	// FormatEnvoyRBAC renders an Envoy RBAC HTTP filter.
+	FormatEnvoyRBAC = "envoy-rbac"
+	// FormatEnvoyExtAuthz renders an Envoy ext_authz HTTP filter and routes
+	// carrying each policy as metadata.
+	FormatEnvoyExtAuthz = "envoy-ext-authz"
+	// FormatRego renders an OPA Rego package with an allow rule per route,
+	// and tests for it.
+	FormatRego = "rego"
+	// FormatOPABundle renders the policies as an OPA data document and a
+	// generic Rego evaluator for it.
+	FormatOPABundle = "opa-bundle"
+	// FormatCedar renders Cedar policies and their schema.
+	FormatCedar = "cedar"
+	// FormatCasbin renders a Casbin model and policy.csv.
+	FormatCasbin = "casbin"
+	// FormatSpiceDB renders a SpiceDB schema with a permission per route,
+	// and the relationships it needs.
+	FormatSpiceDB = "spicedb"
+	// FormatAPIGateway renders an OpenAPI document for an AWS API Gateway
+	// HTTP API with a JWT authorizer.
+	FormatAPIGateway = "apigateway"
+	// FormatAPIGatewayTerraform renders Terraform configuration for the
+	// routes and JWT authorizer of an AWS API Gateway HTTP API.
+	FormatAPIGatewayTerraform = "apigateway-terraform"
+	// FormatKong renders Kong declarative configuration with jwt and acl
+	// plugins per route.
+	FormatKong = "kong"
+	// FormatTraefik renders Traefik dynamic configuration with a router
+	// per route and ForwardAuth middleware.
+	FormatTraefik = "traefik"
+	// FormatNginx renders nginx locations checked with auth_request.
+	FormatNginx = "nginx"
+	// FormatJSON renders every policy and security scheme as JSON.
+	FormatJSON = "json"
+	// FormatMarkdown documents every route and its requirements in Markdown.
+	FormatMarkdown = "markdown"
+	// FormatHTML renders a standalone, filterable HTML report.
+	FormatHTML = "html"
+	// FormatCSV renders a CSV matrix of routes by roles and scopes.
+	FormatCSV = "csv"
+	// FormatTypeScript renders a TypeScript module with the policy map.
+	FormatTypeScript = "typescript"
+	// FormatPython renders a Python module with the policy map.
+	FormatPython = "python"
+	// FormatKeycloak renders a Keycloak realm partial import with the
+	// roles and client scopes the spec names.
+	FormatKeycloak = "keycloak"
+	// FormatAuth0 renders an Auth0 resource server with the scopes the
+	// spec names.
+	FormatAuth0 = "auth0"
+	// FormatOkta renders Terraform configuration for the scopes, claim and
+	// access policy rules of an Okta authorization server.
+	FormatOkta = "okta"
+	// FormatPostman renders a Postman collection with a request per route
+	// carrying its credentials and requirements.
+	FormatPostman = "postman"
+)
+
+// Options controls how policies are rendered. The zero value uses the
+// defaults documented on each field.
+type Options struct {
+	// Package names the package of formats that declare one, such as Rego
+	// ("openapi_authz" by default).
+	Package string
+
+	// RolesClaim names the JWT claim that lists the caller's roles
+	// ("roles" by default).
+	RolesClaim string
+
+	// ScopesClaim names the JWT claim that holds the caller's
+	// space-separated scopes ("scope" by default).
+	ScopesClaim string
+
+	// JWTIssuer and JWTAudience configure JWT validation for gateway
+	// formats that validate tokens themselves.
+	JWTIssuer   string
+	JWTAudience []string
+
+	// Realm names the realm identity provider formats provision, such as
+	// the Keycloak realm. It is left out when empty.
+	Realm string
+}
+
+func (o Options) pkg() string {
+	if o.Package == "" {
+		return "openapi_authz"
+	}
+	return o.Package
+}
+
+func (o Options) rolesClaim() string {
+	if o.RolesClaim == "" {
+		return "roles"
+	}
+	return o.RolesClaim
+}
+
+func (o Options) scopesClaim() string {
+	if o.ScopesClaim == "" {
+		return "scope"
+	}
+	return o.ScopesClaim
+}
+
+// File is one file of an export. Name is a base file name, used when a
+// format writes more than one file.
+type File struct {
+	Name string
+	Data []byte
+}
+
+type exporter func(cfg *model.Config, opts Options) ([]File, error)
+
+var formats = map[string]exporter{
+	FormatEnvoyRBAC:           exportEnvoyRBAC,
+	FormatEnvoyExtAuthz:       exportEnvoyExtAuthz,
+	FormatRego:                exportRego,
+	FormatOPABundle:           exportOPABundle,
+	FormatCedar:               exportCedar,
+	FormatCasbin:              exportCasbin,
+	FormatSpiceDB:             exportSpiceDB,
+	FormatAPIGateway:          exportAPIGateway,
+	FormatAPIGatewayTerraform: exportAPIGatewayTerraform,
+	FormatKong:                exportKong,
+	FormatTraefik:             exportTraefik,
+	FormatNginx:               exportNginx,
+	FormatJSON:                exportJSON,
+	FormatMarkdown:            exportMarkdown,
+	FormatHTML:                exportHTML,
+	FormatCSV:                 exportMatrix,
+	FormatTypeScript:          exportTypeScript,
+	FormatPython:              exportPython,
+	FormatKeycloak:            exportKeycloak,
+	FormatAuth0:               exportAuth0,
+	FormatOkta:                exportOkta,
+	FormatPostman:             exportPostman,
+}
+
+// Formats returns the names of the supported formats, sorted.
+func Formats() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Export renders the policies of cfg in format.
+func Export(format string, cfg *model.Config, opts Options) ([]File, error) {
+	export, ok := formats[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q (want one of %s)", format, strings.Join(Formats(), ", "))
+	}
+	return export(cfg, opts)
+}
+
+// marshalYAML encodes v as YAML indented by two spaces, as proxy and
+// gateway configuration usually is.
+func marshalYAML(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// hclString quotes s as an HCL string literal for the Terraform formats.
+// HCL only knows the escapes \n, \r, \t, \", \\ and \u, so other control
+// characters are written as \u escapes, and the template sequences HCL would
+// otherwise interpolate are doubled.
+func hclString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i, r := range s {
+		switch {
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '"':
+			b.WriteString(`\"`)
+		case r == '\\':
+			b.WriteString(`\\`)
+		case (r == '$' || r == '%') && strings.HasPrefix(s[i+1:], "{"):
+			b.WriteRune(r)
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// sortedRoutes returns the keys of policies sorted by path and method.
+func sortedRoutes(policies map[model.RouteKey]model.AuthPolicy) []model.RouteKey {
+	keys := make([]model.RouteKey, 0, len(policies))
+	for k := range policies {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Path == keys[j].Path {
+			return keys[i].Method < keys[j].Method
+		}
+		return keys[i].Path < keys[j].Path
+	})
+	return keys
+}
+
+// routeParam matches a path template parameter, in either the OpenAPI
+// "{id}" or the ":id" syntax. A ":id" parameter starts a segment, so the
+// colon of a custom method such as /users:batchGet is literal. Its first
+// submatch is the parameter without the preceding slash.
+var routeParam = regexp.MustCompile(`\{[^{}/]+\}|(?:^|/)(:[^/]+)`)
+
+// routeParams returns the start and end of each parameter of path.
+func routeParams(path string) [][2]int {
+	var locs [][2]int
+	for _, m := range routeParam.FindAllStringSubmatchIndex(path, -1) {
+		if m[2] >= 0 {
+			m = m[2:]
+		}
+		locs = append(locs, [2]int{m[0], m[1]})
+	}
+	return locs
+}
+
+// replaceRouteParams returns path with each parameter, such as "{id}" or
+// ":id", replaced by repl(param).
+func replaceRouteParams(path string, repl func(param string) string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range routeParams(path) {
+		b.WriteString(path[last:loc[0]])
+		b.WriteString(repl(path[loc[0]:loc[1]]))
+		last = loc[1]
+	}
+	b.WriteString(path[last:])
+	return b.String()
+}
+
+// pathRegex returns an anchored regular expression matching the concrete
+// paths of the route pattern path. Each parameter matches one segment.
+func pathRegex(path string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	last := 0
+	for _, loc := range routeParams(path) {
+		b.WriteString(regexp.QuoteMeta(path[last:loc[0]]))
+		b.WriteString("[^/]+")
+		last = loc[1]
+	}
+	b.WriteString(regexp.QuoteMeta(path[last:]))
+	b.WriteString("$")
+	return b.String()
+}
+
+// shadowingRoutes returns the routes of policies, sorted, with key's method
+// whose paths overlap key's and take precedence over it. Like the generated
+// matcher, a route takes precedence where, at the first segment the two
+// differ in, it has a literal segment and key a parameter, so /users/me
+// shadows /users/{id}. Formats that match each route on its own exclude the
+// paths of these routes, Deny ones included, from key's rules.
+func shadowingRoutes(key model.RouteKey, policies map[model.RouteKey]model.AuthPolicy) []model.RouteKey {
+	var shadowing []model.RouteKey
+	for _, other := range sortedRoutes(policies) {
+		if other.Method == key.Method && routePrecedes(other.Path, key.Path) {
+			shadowing = append(shadowing, other)
+		}
+	}
+	return shadowing
+}
+
+// routesByPrecedence returns the keys of policies ordered so that every
+// route comes after the routes shadowing it, as the generated matcher
+// tries them: /users/me wins over /users/{id}. Formats where the first
+// matching route decides a request, such as Envoy routes, nginx locations
+// and the TypeScript and Python lookups, emit routes in this order, and
+// those with priorities, such as Traefik routers and Kong regex paths,
+// rank them by it. Ties keep sortedRoutes' order.
+func routesByPrecedence(policies map[model.RouteKey]model.AuthPolicy) []model.RouteKey {
+	keys := sortedRoutes(policies)
+	sort.SliceStable(keys, func(i, j int) bool {
+		return routeRank(keys[i].Path) < routeRank(keys[j].Path)
+	})
+	return keys
+}
+
+// routeRank returns a string with a character per segment of the route
+// pattern path, '0' for literal and '1' for parameter segments. A route
+// ranks below every route it shadows.
+func routeRank(path string) string {
+	segs := strings.Split(path, "/")
+	rank := make([]byte, len(segs))
+	for i, seg := range segs {
+		rank[i] = '0'
+		if routeParam.MatchString(seg) {
+			rank[i] = '1'
+		}
+	}
+	return string(rank)
+}
+
+// routePrecedes reports whether some concrete path matches both route
+// patterns a and b, and a is matched first.
+func routePrecedes(a, b string) bool {
+	segsA, segsB := strings.Split(a, "/"), strings.Split(b, "/")
+	if len(segsA) != len(segsB) {
+		return false
+	}
+	decided, precedes := false, false
+	for i, segA := range segsA {
+		segB := segsB[i]
+		paramA, paramB := routeParam.MatchString(segA), routeParam.MatchString(segB)
+		switch {
+		case !paramA && !paramB:
+			if segA != segB {
+				return false
+			}
+		case !paramA:
+			if !segmentMatches(segB, segA) {
+				return false
+			}
+			if !decided {
+				decided, precedes = true, true
+			}
+		case !paramB:
+			if !segmentMatches(segA, segB) {
+				return false
+			}
+			decided = true
+		}
+	}
+	return precedes
+}
+
+// segmentMatches reports whether the literal path segment seg matches the
+// route pattern segment pattern, like pathRegex(pattern) would, without
+// compiling a regular expression: routePrecedes runs for every pair of
+// routes. Each parameter matches one or more characters.
+func segmentMatches(pattern, seg string) bool {
+	var lits []string
+	last := 0
+	for _, loc := range routeParams(pattern) {
+		lits = append(lits, pattern[last:loc[0]])
+		last = loc[1]
+	}
+	lits = append(lits, pattern[last:])
+	if len(lits) == 1 {
+		return seg == pattern
+	}
+
+	first, final := lits[0], lits[len(lits)-1]
+	if !strings.HasPrefix(seg, first) || !strings.HasSuffix(seg, final) {
+		return false
+	}
+	// A parameter can always grow, so placing each literal in between at
+	// its leftmost position leaves the most room for the rest.
+	pos, end := len(first), len(seg)-len(final)
+	for _, lit := range lits[1 : len(lits)-1] {
+		if pos+1 > end {
+			return false
+		}
+		i := strings.Index(seg[pos+1:end], lit)
+		if i < 0 {
+			return false
+		}
+		pos += 1 + i + len(lit)
+	}
+	return end-pos >= 1
+}
+
+var nonIdent = regexp.MustCompile(`[^a-z0-9]+`)
+
+// ident returns s lower-cased, with every run of other characters than
+// letters and digits replaced by an underscore.
+func ident(s string) string {
+	return strings.Trim(nonIdent.ReplaceAllString(strings.ToLower(s), "_"), "_")
+}
+
+// routeIdent returns an identifier naming key, such as "get_users_id".
+func routeIdent(key model.RouteKey) string {
+	return ident(key.Method + "_" + key.Path)
+}
+
+// uniqueName returns name, suffixed with a number if it is already in
+// names, and records the result.
+func uniqueName(names map[string]bool, name string) string {
+	unique := name
+	for i := 2; names[unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	names[unique] = true
+	return unique
+}
+
+// servicePolicy is a policy as passed on to the service behind a proxy or
+// gateway, so it can enforce what the proxy does not.
+type servicePolicy struct {
+	RequireAuth  bool            `json:"requireAuth"`
+	OptionalAuth bool            `json:"optionalAuth,omitempty"`
+	Deny         bool            `json:"deny,omitempty"`
+	Roles        []string        `json:"roles,omitempty"`
+	Scopes       []string        `json:"scopes,omitempty"`
+	Alternatives []servicePolicy `json:"alternatives,omitempty"`
+}
+
+func newServicePolicy(p model.AuthPolicy) servicePolicy {
+	policy := servicePolicy{
+		RequireAuth:  p.RequireAuth,
+		OptionalAuth: p.OptionalAuth,
+		Deny:         p.Deny,
+		Roles:        p.Roles,
+		Scopes:       p.Scopes,
+	}
+	for _, alt := range p.Alternatives {
+		policy.Alternatives = append(policy.Alternatives, newServicePolicy(alt))
+	}
+	return policy
+}
@@ -0,0 +1,1225 @@
+package export
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// testConfig covers the policy shapes exporters have to render: public,
+// authenticated-only, role and scope requirements, alternatives and a
+// denied route.
+func testConfig() *model.Config {
+	return &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
+		{Method: "GET", Path: "/health"}:        {RequireAuth: false},
+		{Method: "GET", Path: "/users/{id}"}:    {RequireAuth: true, OperationID: "getUser"},
+		{Method: "DELETE", Path: "/users/{id}"}: {RequireAuth: true, Roles: []string{"admin", "owner"}, Scopes: []string{"users:write"}},
+		{Method: "GET", Path: "/reports"}: {RequireAuth: true, Scopes: []string{"reports:read"}, Alternatives: []model.AuthPolicy{
+			{RequireAuth: true, Roles: []string{"auditor"}},
+		}},
+		{Method: "POST", Path: "/legacy"}: {RequireAuth: true, Deprecated: true, Deny: true},
+	}}
+}
+
+func exportOne(t *testing.T, format string, opts Options) string {
+	t.Helper()
+	files, err := Export(format, testConfig(), opts)
+	if err != nil {
+		t.Fatalf("Export(%s) error: %v", format, err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected one file, got %d", len(files))
+	}
+	return string(files[0].Data)
+}
+
+// overlapConfig returns policies whose parameter routes also match the paths
+// of more specific routes with stricter policies.
+func overlapConfig() *model.Config {
+	return &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
+		{Method: "GET", Path: "/users/{id}"}:     {RequireAuth: false},
+		{Method: "GET", Path: "/users/me"}:       {RequireAuth: true, Roles: []string{"admin"}},
+		{Method: "GET", Path: "/users/internal"}: {RequireAuth: true, Deny: true},
+		{Method: "DELETE", Path: "/users/me"}:    {RequireAuth: true},
+	}}
+}
+
+func TestExport_UnknownFormat(t *testing.T) {
+	if _, err := Export("nope", testConfig(), Options{}); err == nil || !strings.Contains(err.Error(), FormatEnvoyRBAC) {
+		t.Errorf("expected unknown format error listing formats, got %v", err)
+	}
+}
+
+func TestPathRegex(t *testing.T) {
+	for path, want := range map[string]string{
+		"/users/{id}":        `^/users/[^/]+$`,
+		"/users/:id/posts":   `^/users/[^/]+/posts$`,
+		"/files/{name}.json": `^/files/[^/]+\.json$`,
+		"/users:batchGet":    `^/users:batchGet$`,
+		"/v1/{name}:cancel":  `^/v1/[^/]+:cancel$`,
+		"/":                  `^/$`,
+	} {
+		if got := pathRegex(path); got != want {
+			t.Errorf("pathRegex(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestSegmentMatches(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, seg string
+	}{
+		{"{id}", "me"},
+		{":id", "me"},
+		{"{name}.json", "index.json"},
+		{"{name}:cancel", "jobs:cancel"},
+		{"{a}-{b}", "x-y"},
+		{"{a}-{b}", "x-y-z"},
+		{"v{major}.{minor}", "v1.2"},
+		{"jobs:cancel", "jobs:cancel"},
+		{"{id}", ""},
+		{"{name}.json", ".json"},
+		{"{name}.json", "readme.txt"},
+		{"{a}-{b}", "x-"},
+		{"{a}-{b}", "-y"},
+		{"v{major}.{minor}", "v.2"},
+		{"jobs:cancel", "jobs:get"},
+	} {
+		want := regexp.MustCompile(pathRegex(tt.pattern)).MatchString(tt.seg)
+		if got := segmentMatches(tt.pattern, tt.seg); got != want {
+			t.Errorf("segmentMatches(%q, %q) = %v, want %v", tt.pattern, tt.seg, got, want)
+		}
+	}
+}
+
+func TestHCLString(t *testing.T) {
+	for s, want := range map[string]string{
+		"${var.x} %{if}": `"$${var.x} %%{if}"`,
+		"$ % {}":         `"$ % {}"`,
+		"a\"b\\c\n\r\t":  `"a\"b\\c\n\r\t"`,
+		"iss\x00\a\x7f":  `"iss\u0000\u0007\u007f"`,
+		"café":           `"café"`,
+	} {
+		if got := hclString(s); got != want {
+			t.Errorf("hclString(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
+
+func TestShadowingRoutes(t *testing.T) {
+	policies := map[model.RouteKey]model.AuthPolicy{
+		{Method: "GET", Path: "/users/{id}"}:             {},
+		{Method: "GET", Path: "/users/me"}:               {},
+		{Method: "POST", Path: "/users/me"}:              {},
+		{Method: "GET", Path: "/users/{id}/posts"}:       {},
+		{Method: "GET", Path: "/users/me/{section}"}:     {},
+		{Method: "GET", Path: "/users/{id}/{section}"}:   {},
+		{Method: "GET", Path: "/files/{name}.json"}:      {},
+		{Method: "GET", Path: "/files/index.json"}:       {},
+		{Method: "GET", Path: "/files/readme.txt"}:       {},
+		{Method: "GET", Path: "/files/{name}"}:           {},
+		{Method: "GET", Path: "/orgs/{org}/teams/core"}:  {},
+		{Method: "GET", Path: "/orgs/main/teams/{team}"}: {},
+		{Method: "GET", Path: "/v1/{name}:cancel"}:       {},
+		{Method: "GET", Path: "/v1/jobs:cancel"}:         {},
+	}
+	for path, want := range map[string]string{
+		"/users/{id}":             "/users/me",
+		"/users/me":               "",
+		"/users/{id}/posts":       "/users/me/{section}",
+		"/users/{id}/{section}":   "/users/me/{section} /users/{id}/posts",
+		"/files/{name}.json":      "/files/index.json",
+		"/files/{name}":           "/files/index.json /files/readme.txt",
+		"/orgs/{org}/teams/core":  "/orgs/main/teams/{team}",
+		"/orgs/main/teams/{team}": "",
+		"/v1/{name}:cancel":       "/v1/jobs:cancel",
+		"/v1/jobs:cancel":         "",
+	} {
+		var got []string
+		for _, key := range shadowingRoutes(model.RouteKey{Method: "GET", Path: path}, policies) {
+			got = append(got, key.Path)
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("shadowingRoutes(GET %s) = %v, want %q", path, got, want)
+		}
+	}
+}
+
+// TestExport_OverlappingRoutes checks that the public parameter route of
+// overlapConfig lets no request for the stricter literal routes it also
+// matches through, in every format where routes can overlap.
+func TestExport_OverlappingRoutes(t *testing.T) {
+	for _, tt := range []struct {
+		format string
+		opts   Options
+		check  func(t *testing.T, files []File)
+	}{
+		{FormatEnvoyRBAC, Options{}, func(t *testing.T, files []File) {
+			var filter envoyHTTPFilter
+			if err := yaml.Unmarshal(files[0].Data, &filter); err != nil {
+				t.Fatalf("output is not valid YAML: %v", err)
+			}
+
+			permission := func(route string) string {
+				p, ok := filter.TypedConfig.Rules.Policies[route]
+				if !ok {
+					t.Fatalf("expected a policy for %s", route)
+				}
+				data, err := yaml.Marshal(p.Permissions)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return string(data)
+			}
+			// The public parameter route must not allow the admin-only and the
+			// denied literal routes it also matches.
+			got := permission("GET /users/{id}")
+			for _, want := range []string{"not_rule:", "regex: ^/users/me$", "regex: ^/users/internal$"} {
+				if !strings.Contains(got, want) {
+					t.Errorf("expected %q in GET /users/{id} permission, got:\n%s", want, got)
+				}
+			}
+			if got := permission("GET /users/me"); strings.Contains(got, "not_rule") {
+				t.Errorf("expected no exclusions for GET /users/me, got:\n%s", got)
+			}
+			if got := permission("DELETE /users/me"); strings.Contains(got, "not_rule") {
+				t.Errorf("expected routes of other methods not to be excluded, got:\n%s", got)
+			}
+		}},
+		{FormatRego, Options{}, func(t *testing.T, files []File) {
+			policy := string(files[0].Data)
+
+			// The public parameter route must not allow the admin-only and the
+			// denied literal routes it also matches.
+			want := "# GET /users/{id}\nallow if {\n\tinput.method == \"GET\"\n\tregex.match(\"^/users/[^/]+$\", input.path)\n" +
+				"\tnot regex.match(\"^/users/internal$\", input.path)\n\tnot regex.match(\"^/users/me$\", input.path)\n}\n"
+			if !strings.Contains(policy, want) {
+				t.Errorf("expected %q in policy, got:\n%s", want, policy)
+			}
+			if strings.Count(policy, "not regex.match") != 2 {
+				t.Errorf("expected only GET /users/{id} to exclude other routes, got:\n%s", policy)
+			}
+		}},
+		{FormatOPABundle, Options{Package: "authz"}, func(t *testing.T, files []File) {
+			var doc struct {
+				Authz struct {
+					Routes []opaRoute `json:"routes"`
+				} `json:"authz"`
+			}
+			if err := json.Unmarshal(files[0].Data, &doc); err != nil {
+				t.Fatalf("data.json is not valid JSON: %v", err)
+			}
+
+			// The evaluator decides a request by the first route matching it, so
+			// GET /users/{id} must come after the literal routes it also matches.
+			var got []string
+			for _, r := range doc.Authz.Routes {
+				got = append(got, r.Method+" "+r.Path)
+			}
+			want := "GET /users/internal DELETE /users/me GET /users/me GET /users/{id}"
+			if strings.Join(got, " ") != want {
+				t.Errorf("expected routes %q, got %q", want, got)
+			}
+			if policy := string(files[1].Data); strings.Contains(policy, "some route in") {
+				t.Errorf("expected allow rules to decide against the matched route alone, got:\n%s", policy)
+			}
+		}},
+		{FormatCasbin, Options{}, func(t *testing.T, files []File) {
+			// keyMatch2 matches /users/me against /users/:id, so the literal routes'
+			// rows, each ending with a deny row, must come first.
+			want := `# Code generated by openapi-authz; DO NOT EDIT.
+p,true,/users/internal,GET,deny
+p,r.sub != '',/users/me,DELETE,allow
+p,"g(r.sub, 'admin')",/users/me,GET,allow
+p,true,/users/me,GET,deny
+p,true,/users/:id,GET,allow
+`
+			if got := string(files[1].Data); got != want {
+				t.Errorf("unexpected policy.csv:\n%s\nwant:\n%s", got, want)
+			}
+		}},
+		{FormatAPIGateway, Options{JWTIssuer: "https://idp.example.com/", JWTAudience: []string{"api"}}, func(t *testing.T, files []File) {
+			var doc struct {
+				Paths map[string]map[string]map[string]any `json:"paths"`
+			}
+			if err := json.Unmarshal(files[0].Data, &doc); err != nil {
+				t.Fatalf("output is not valid JSON: %v", err)
+			}
+			if got, _ := json.Marshal(doc.Paths["/users/internal"]["get"]["security"]); string(got) != `[{"jwt":["openapi-authz:deny"]}]` {
+				t.Errorf("expected the denied route to require the deny scope, got %s", got)
+			}
+			if got, _ := json.Marshal(doc.Paths["/users/{id}"]["get"]["security"]); string(got) != `[]` {
+				t.Errorf("unexpected security of GET /users/{id}: %s", got)
+			}
+		}},
+		{FormatAPIGatewayTerraform, Options{JWTIssuer: "https://idp.example.com/", JWTAudience: []string{"api"}}, func(t *testing.T, files []File) {
+			want := "  route_key            = \"GET /users/internal\"\n" +
+				"  target               = \"integrations/${var.integration_id}\"\n" +
+				"  authorization_type   = \"JWT\"\n" +
+				"  authorizer_id        = aws_apigatewayv2_authorizer.jwt.id\n" +
+				"  authorization_scopes = [\"openapi-authz:deny\"]\n"
+			if got := string(files[0].Data); !strings.Contains(got, want) {
+				t.Errorf("expected output to contain %q, got:\n%s", want, got)
+			}
+		}},
+		{FormatKong, Options{}, func(t *testing.T, files []File) {
+			var out kongConfig
+			if err := yaml.Unmarshal(files[0].Data, &out); err != nil {
+				t.Fatalf("output is not valid YAML: %v", err)
+			}
+			routes := make(map[string]kongRoute)
+			for _, r := range out.Services[0].Routes {
+				routes[r.Name] = r
+			}
+
+			id := routes["get_users_id"]
+			for _, name := range []string{"get_users_me", "get_users_internal"} {
+				if routes[name].RegexPriority <= id.RegexPriority {
+					t.Errorf("expected %s to take priority over get_users_id, got %+v", name, routes)
+				}
+			}
+			if r := routes["get_users_internal"]; len(r.Plugins) != 1 || r.Plugins[0].Name != "request-termination" {
+				t.Errorf("expected the denied route to respond 403, got %+v", r)
+			}
+		}},
+		{FormatTraefik, Options{}, func(t *testing.T, files []File) {
+			var out traefikConfig
+			if err := yaml.Unmarshal(files[0].Data, &out); err != nil {
+				t.Fatalf("output is not valid YAML: %v", err)
+			}
+			routers := out.HTTP.Routers
+
+			id := routers["get_users_id"]
+			for _, name := range []string{"get_users_me", "get_users_internal"} {
+				if routers[name].Priority <= id.Priority {
+					t.Errorf("expected %s to take priority over get_users_id, got %+v", name, routers)
+				}
+			}
+			if r := routers["get_users_internal"]; strings.Join(r.Middlewares, ",") != "deny" {
+				t.Errorf("expected the denied route to go through the deny middleware, got %+v", r)
+			}
+		}},
+	} {
+		t.Run(tt.format, func(t *testing.T) {
+			files, err := Export(tt.format, overlapConfig(), tt.opts)
+			if err != nil {
+				t.Fatalf("Export error: %v", err)
+			}
+			tt.check(t, files)
+		})
+	}
+}
+
+func TestNewServicePolicy(t *testing.T) {
+	cfg := testConfig()
+	for key, want := range map[model.RouteKey]string{
+		{Method: "POST", Path: "/legacy"}:       `{"requireAuth":true,"deny":true}`,
+		{Method: "GET", Path: "/health"}:        `{"requireAuth":false}`,
+		{Method: "DELETE", Path: "/users/{id}"}: `{"requireAuth":true,"roles":["admin","owner"],"scopes":["users:write"]}`,
+	} {
+		got, err := json.Marshal(newServicePolicy(cfg.Policies[key]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("newServicePolicy(%s %s) = %s, want %s", key.Method, key.Path, got, want)
+		}
+	}
+}
+
+func TestExport_EnvoyRBAC(t *testing.T) {
+	got := exportOne(t, FormatEnvoyRBAC, Options{RolesClaim: "groups"})
+
+	var filter envoyHTTPFilter
+	if err := yaml.Unmarshal([]byte(got), &filter); err != nil {
+		t.Fatalf("output is not valid YAML: %v\n%s", err, got)
+	}
+	if filter.TypedConfig.Rules.Action != "ALLOW" {
+		t.Errorf("expected ALLOW action, got %q", filter.TypedConfig.Rules.Action)
+	}
+	if _, ok := filter.TypedConfig.Rules.Policies["POST /legacy"]; ok {
+		t.Errorf("expected denied route to have no policy")
+	}
+	if p := filter.TypedConfig.Rules.Policies["GET /reports"]; len(p.Principals) != 2 {
+		t.Errorf("expected a principal per alternative on GET /reports, got %+v", p.Principals)
+	}
+
+	for _, want := range []string{
+		"GET /health:",
+		"- any: true",
+		"regex: ^/users/[^/]+$",
+		"- key: groups",
+		"exact: admin",
+		"regex: (^| )users:write( |$)",
+		"present_match: true",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestExport_EnvoyExtAuthz(t *testing.T) {
+	cfg := testConfig()
+	cfg.Policies[model.RouteKey{Method: "GET", Path: "/users/me"}] = model.AuthPolicy{RequireAuth: true}
+	cfg.Policies[model.RouteKey{Method: "GET", Path: "/a/{x}/b/c"}] = model.AuthPolicy{}
+	cfg.Policies[model.RouteKey{Method: "GET", Path: "/a/b/{y}/{z}"}] = model.AuthPolicy{RequireAuth: true}
+	files, err := Export(FormatEnvoyExtAuthz, cfg, Options{})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	if len(files) != 2 || files[0].Name != "ext_authz.yaml" || files[1].Name != "routes.yaml" {
+		t.Fatalf("expected ext_authz.yaml and routes.yaml, got %+v", files)
+	}
+	if filter := string(files[0].Data); !strings.Contains(filter, "route_metadata_context_namespaces:\n    - openapi_authz") {
+		t.Errorf("expected filter to forward route metadata, got:\n%s", filter)
+	}
+
+	var out struct {
+		Routes []struct {
+			Name           string                    `yaml:"name"`
+			DirectResponse map[string]any            `yaml:"direct_response"`
+			PerFilter      map[string]map[string]any `yaml:"typed_per_filter_config"`
+			Metadata       struct {
+				FilterMetadata map[string]envoyRouteMetadata `yaml:"filter_metadata"`
+			} `yaml:"metadata"`
+		} `yaml:"routes"`
+	}
+	if err := yaml.Unmarshal(files[1].Data, &out); err != nil {
+		t.Fatalf("routes are not valid YAML: %v", err)
+	}
+	index := make(map[string]int)
+	for i, r := range out.Routes {
+		index[r.Name] = i
+	}
+	if index["GET /users/me"] > index["GET /users/{id}"] {
+		t.Errorf("expected /users/me to be matched before /users/{id}, got order %v", index)
+	}
+	// The generated matcher prefers the literal b to {x}, although
+	// /a/b/{y}/{z} has more parameters.
+	if index["GET /a/b/{y}/{z}"] > index["GET /a/{x}/b/c"] {
+		t.Errorf("expected /a/b/{y}/{z} to be matched before /a/{x}/b/c, got order %v", index)
+	}
+
+	routes := out.Routes
+	if r := routes[index["GET /health"]]; r.PerFilter["envoy.filters.http.ext_authz"]["disabled"] != true {
+		t.Errorf("expected ext_authz disabled on public route, got %+v", r)
+	}
+	if r := routes[index["POST /legacy"]]; r.DirectResponse["status"] != 403 {
+		t.Errorf("expected denied route to respond 403, got %+v", r)
+	}
+	m := routes[index["DELETE /users/{id}"]].Metadata.FilterMetadata["openapi_authz"]
+	if !m.RequireAuth || strings.Join(m.Roles, ",") != "admin,owner" || strings.Join(m.Scopes, ",") != "users:write" {
+		t.Errorf("unexpected metadata for DELETE /users/{id}: %+v", m)
+	}
+	if m := routes[index["GET /reports"]].Metadata.FilterMetadata["openapi_authz"]; len(m.Alternatives) != 1 || m.Alternatives[0].Roles[0] != "auditor" {
+		t.Errorf("expected alternatives in metadata for GET /reports, got %+v", m)
+	}
+}
+
+func TestExport_Rego(t *testing.T) {
+	files, err := Export(FormatRego, testConfig(), Options{Package: "vegetables.authz", ScopesClaim: "scp"})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	if len(files) != 2 || files[0].Name != "policy.rego" || files[1].Name != "policy_test.rego" {
+		t.Fatalf("expected policy.rego and policy_test.rego, got %+v", files)
+	}
+	policy, tests := string(files[0].Data), string(files[1].Data)
+
+	for _, want := range []string{
+		"package vegetables.authz\n",
+		"default allow := false\n",
+		`scopes contains scope if some scope in split(input.claims["scp"], " ")`,
+		"# GET /health\nallow if {\n\tinput.method == \"GET\"\n\tregex.match(\"^/health$\", input.path)\n}\n",
+		"\tregex.match(\"^/users/[^/]+$\", input.path)\n\thas_any_role({\"admin\", \"owner\"})\n\t\"users:write\" in scopes\n}\n",
+		"\tregex.match(\"^/reports$\", input.path)\n\thas_any_role({\"auditor\"})\n}\n",
+		"# POST /legacy\n# Denied: no rule allows this route.\n",
+	} {
+		if !strings.Contains(policy, want) {
+			t.Errorf("expected %q in policy, got:\n%s", want, policy)
+		}
+	}
+
+	for _, want := range []string{
+		"package vegetables.authz\n",
+		"test_get_health_allows_anonymous if {\n\tallow with input as {\"method\": \"GET\", \"path\": \"/health\"}\n}\n",
+		"test_delete_users_id_rejects_anonymous if {",
+		"test_delete_users_id_rejects_other_roles if {",
+		`allow with input as {"method": "DELETE", "path": "/users/1", "claims": {"roles": ["admin"], "scp": "users:write"}}`,
+		"test_post_legacy_rejects_authorized if {",
+	} {
+		if !strings.Contains(tests, want) {
+			t.Errorf("expected %q in tests, got:\n%s", want, tests)
+		}
+	}
+}
+
+func TestExport_OPABundle(t *testing.T) {
+	files, err := Export(FormatOPABundle, testConfig(), Options{Package: "vegetables.authz"})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	if len(files) != 2 || files[0].Name != "data.json" || files[1].Name != "policy.rego" {
+		t.Fatalf("expected data.json and policy.rego, got %+v", files)
+	}
+
+	var doc struct {
+		Vegetables struct {
+			Authz struct {
+				Routes []opaRoute `json:"routes"`
+			} `json:"authz"`
+		} `json:"vegetables"`
+	}
+	if err := json.Unmarshal(files[0].Data, &doc); err != nil {
+		t.Fatalf("data.json is not valid JSON: %v", err)
+	}
+	routes := doc.Vegetables.Authz.Routes
+	if len(routes) != 5 {
+		t.Fatalf("expected 5 routes under vegetables.authz, got %+v", routes)
+	}
+	reports := routes[2]
+	if reports.Path != "/reports" || len(reports.Requirements) != 2 || reports.Requirements[1].Roles[0] != "auditor" {
+		t.Errorf("expected GET /reports with an alternative requirement set, got %+v", reports)
+	}
+	if users := routes[4]; users.Regex != "^/users/[^/]+$" || users.Requirements[0].Roles == nil {
+		t.Errorf("expected regex and non-nil roles for GET /users/{id}, got %+v", users)
+	}
+
+	policy := string(files[1].Data)
+	for _, want := range []string{"package vegetables.authz\n", "route_matches(data.vegetables.authz.routes[i])\n", "default allow := false\n"} {
+		if !strings.Contains(policy, want) {
+			t.Errorf("expected %q in policy, got:\n%s", want, policy)
+		}
+	}
+}
+
+func TestExport_Cedar(t *testing.T) {
+	cfg := testConfig()
+	cfg.Policies[model.RouteKey{Method: "GET", Path: "/feed"}] = model.AuthPolicy{OptionalAuth: true}
+	files, err := Export(FormatCedar, cfg, Options{})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	if len(files) != 2 || files[0].Name != "policies.cedar" || files[1].Name != "schema.cedarschema" {
+		t.Fatalf("expected policies.cedar and schema.cedarschema, got %+v", files)
+	}
+	policies, schema := string(files[0].Data), string(files[1].Data)
+
+	for _, want := range []string{
+		"@id(\"GET /health\")\npermit (\n  principal,\n  action == Action::\"GET\",\n  resource == Route::\"/health\"\n);\n",
+		"@id(\"GET /feed\")\npermit (\n  principal is Anonymous,",
+		"@id(\"GET /feed (2)\")\npermit (\n  principal is User,",
+		"when { principal.roles.containsAny([\"admin\", \"owner\"]) && principal.scopes.containsAll([\"users:write\"]) };",
+		"@id(\"GET /reports (2)\")",
+		"@id(\"POST /legacy\")\nforbid (\n  principal,",
+	} {
+		if !strings.Contains(policies, want) {
+			t.Errorf("expected %q in policies, got:\n%s", want, policies)
+		}
+	}
+	for _, want := range []string{"entity User = {\n  roles: Set<String>,\n  scopes: Set<String>,\n};", `action "DELETE" appliesTo {`, `action "POST" appliesTo {`} {
+		if !strings.Contains(schema, want) {
+			t.Errorf("expected %q in schema, got:\n%s", want, schema)
+		}
+	}
+
+	if got := cedarString("a\"b\\c\n"); got != `"a\"b\\c\u{a}"` {
+		t.Errorf("cedarString escaped to %s", got)
+	}
+}
+
+func TestExport_Casbin(t *testing.T) {
+	cfg := testConfig()
+	cfg.Policies[model.RouteKey{Method: "GET", Path: "/feed"}] = model.AuthPolicy{OptionalAuth: true}
+	files, err := Export(FormatCasbin, cfg, Options{})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	if len(files) != 2 || files[0].Name != "model.conf" || files[1].Name != "policy.csv" {
+		t.Fatalf("expected model.conf and policy.csv, got %+v", files)
+	}
+	if m := string(files[0].Data); !strings.Contains(m, "m = keyMatch2(r.obj, p.obj) && r.act == p.act && eval(p.sub_rule)") {
+		t.Errorf("unexpected model:\n%s", m)
+	}
+
+	want := `# Code generated by openapi-authz; DO NOT EDIT.
+p,r.sub == '',/feed,GET,allow
+p,r.sub != '',/feed,GET,allow
+p,true,/health,GET,allow
+p,true,/legacy,POST,deny
+p,"g(r.sub, 'scope:reports:read')",/reports,GET,allow
+p,"g(r.sub, 'auditor')",/reports,GET,allow
+p,"(g(r.sub, 'admin') || g(r.sub, 'owner')) && g(r.sub, 'scope:users:write')",/users/:id,DELETE,allow
+p,r.sub != '',/users/:id,GET,allow
+`
+	if got := string(files[1].Data); got != want {
+		t.Errorf("unexpected policy.csv:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestExport_SpiceDB(t *testing.T) {
+	files, err := Export(FormatSpiceDB, testConfig(), Options{})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	if len(files) != 2 || files[0].Name != "schema.zed" || files[1].Name != "relationships.txt" {
+		t.Fatalf("expected schema.zed and relationships.txt, got %+v", files)
+	}
+	schema := string(files[0].Data)
+	for _, want := range []string{
+		"\trelation everyone: user:* | anonymous:*\n",
+		"\trelation role_admin: user\n",
+		"\trelation scope_users_write: user\n",
+		"\tpermission get_health = everyone\n",
+		"\tpermission post_legacy = nil\n",
+		"\tpermission get_reports = (authenticated & scope_reports_read) + role_auditor\n",
+		"\tpermission delete_users_id = (role_admin + role_owner) & scope_users_write\n",
+		"\tpermission get_users_id = authenticated\n",
+	} {
+		if !strings.Contains(schema, want) {
+			t.Errorf("expected %q in schema, got:\n%s", want, schema)
+		}
+	}
+	if rels := string(files[1].Data); !strings.Contains(rels, "api:default#authenticated@user:*\n") {
+		t.Errorf("expected wildcard relationship for authenticated users, got:\n%s", rels)
+	}
+
+	long := &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
+		{Method: "GET", Path: "/" + strings.Repeat("segment/", 10)}: {},
+	}}
+	if _, err := Export(FormatSpiceDB, long, Options{}); err == nil {
+		t.Errorf("expected an error for a permission name over 64 characters")
+	}
+}
+
+func TestExport_APIGateway(t *testing.T) {
+	if _, err := Export(FormatAPIGateway, testConfig(), Options{}); err == nil {
+		t.Errorf("expected an error without a JWT issuer and audience")
+	}
+
+	cfg := testConfig()
+	cfg.Policies[model.RouteKey{Method: "GET", Path: "/orders/:id"}] = model.AuthPolicy{RequireAuth: true, Scopes: []string{"orders:read"}, Alternatives: []model.AuthPolicy{
+		{RequireAuth: true, Scopes: []string{"orders:admin"}},
+	}}
+	files, err := Export(FormatAPIGateway, cfg, Options{JWTIssuer: "https://idp.example.com/", JWTAudience: []string{"api"}})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	got := string(files[0].Data)
+
+	var doc struct {
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			SecuritySchemes map[string]map[string]any `json:"securitySchemes"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal([]byte(got), &doc); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, got)
+	}
+	authorizer, _ := doc.Components.SecuritySchemes["jwt"]["x-amazon-apigateway-authorizer"].(map[string]any)
+	if authorizer["type"] != "jwt" || authorizer["identitySource"] != "$request.header.Authorization" {
+		t.Errorf("unexpected authorizer: %+v", authorizer)
+	}
+
+	security := func(path, method string) string {
+		b, _ := json.Marshal(doc.Paths[path][method]["security"])
+		return string(b)
+	}
+	for _, tc := range []struct{ path, method, want string }{
+		{"/health", "get", `[]`},
+		{"/users/{id}", "get", `[{"jwt":[]}]`},
+		{"/users/{id}", "delete", `[{"jwt":[]}]`},
+		{"/orders/{id}", "get", `[{"jwt":["orders:read","orders:admin"]}]`},
+		{"/legacy", "post", `[{"jwt":["openapi-authz:deny"]}]`},
+	} {
+		if got := security(tc.path, tc.method); got != tc.want {
+			t.Errorf("security of %s %s = %s, want %s", tc.method, tc.path, got, tc.want)
+		}
+	}
+	if ext, _ := doc.Paths["/users/{id}"]["delete"]["x-openapi-authz"].(map[string]any); ext["roles"] == nil {
+		t.Errorf("expected the full policy in x-openapi-authz, got %+v", ext)
+	}
+}
+
+func TestExport_APIGatewayTerraform(t *testing.T) {
+	if _, err := Export(FormatAPIGatewayTerraform, testConfig(), Options{}); err == nil {
+		t.Errorf("expected an error without a JWT issuer and audience")
+	}
+
+	cfg := testConfig()
+	cfg.Policies[model.RouteKey{Method: "GET", Path: "/orders/:id"}] = model.AuthPolicy{RequireAuth: true, Scopes: []string{"orders:read"}, Alternatives: []model.AuthPolicy{
+		{RequireAuth: true, Scopes: []string{"orders:admin"}},
+	}}
+	files, err := Export(FormatAPIGatewayTerraform, cfg, Options{JWTIssuer: "https://idp.example.com/", JWTAudience: []string{"api", "${admin}"}})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	if files[0].Name != "apigateway.tf" {
+		t.Errorf("unexpected file name %q", files[0].Name)
+	}
+	got := string(files[0].Data)
+
+	for _, want := range []string{
+		`    audience = ["api", "$${admin}"]`,
+		"resource \"aws_apigatewayv2_route\" \"get_health\" {\n" +
+			"  api_id             = var.api_id\n" +
+			"  route_key          = \"GET /health\"\n" +
+			"  target             = \"integrations/${var.integration_id}\"\n" +
+			"  authorization_type = \"NONE\"\n}",
+		"  route_key          = \"DELETE /users/{id}\"\n" +
+			"  target             = \"integrations/${var.integration_id}\"\n" +
+			"  authorization_type = \"JWT\"\n" +
+			"  authorizer_id      = aws_apigatewayv2_authorizer.jwt.id\n}",
+		"  route_key            = \"GET /orders/{id}\"\n",
+		`  authorization_scopes = ["orders:read", "orders:admin"]`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestExport_Kong(t *testing.T) {
+	cfg := testConfig()
+	cfg.Policies[model.RouteKey{Method: "GET", Path: "/feed"}] = model.AuthPolicy{OptionalAuth: true}
+	files, err := Export(FormatKong, cfg, Options{})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+
+	var out kongConfig
+	if err := yaml.Unmarshal(files[0].Data, &out); err != nil {
+		t.Fatalf("output is not valid YAML: %v", err)
+	}
+	routes := make(map[string]kongRoute)
+	for _, r := range out.Services[0].Routes {
+		routes[r.Name] = r
+	}
+	plugins := func(name string) string {
+		var s []string
+		for _, p := range routes[name].Plugins {
+			s = append(s, p.Name)
+		}
+		return strings.Join(s, ",")
+	}
+
+	if r := routes["get_users_id"]; r.Paths[0] != "~/users/[^/]+$" || r.Methods[0] != "GET" || r.StripPath {
+		t.Errorf("unexpected route for GET /users/{id}: %+v", r)
+	}
+	for name, want := range map[string]string{
+		"get_health":      "",
+		"get_feed":        "jwt",
+		"get_users_id":    "jwt",
+		"get_reports":     "jwt,acl",
+		"delete_users_id": "jwt",
+		"post_legacy":     "request-termination",
+	} {
+		if got := plugins(name); got != want {
+			t.Errorf("plugins of %s = %q, want %q", name, got, want)
+		}
+	}
+	if allow := routes["get_reports"].Plugins[1].Config["allow"]; !reflect.DeepEqual(allow, []any{"auditor", "scope:reports:read"}) {
+		t.Errorf("unexpected ACL groups for GET /reports: %v", allow)
+	}
+	if tags := routes["delete_users_id"].Tags; len(tags) != 1 || tags[0] != kongServiceTag {
+		t.Errorf("expected DELETE /users/{id} to be tagged as service-enforced, got %v", tags)
+	}
+	if anon := routes["get_feed"].Plugins[0].Config["anonymous"]; anon != "anonymous" {
+		t.Errorf("expected optional auth to allow the anonymous consumer, got %v", anon)
+	}
+	if len(out.Consumers) != 1 || out.Consumers[0].Username != "anonymous" {
+		t.Errorf("expected the anonymous consumer to be declared, got %+v", out.Consumers)
+	}
+}
+
+func TestExport_Traefik(t *testing.T) {
+	cfg := testConfig()
+	cfg.Policies[model.RouteKey{Method: "GET", Path: "/users/me"}] = model.AuthPolicy{RequireAuth: true}
+	files, err := Export(FormatTraefik, cfg, Options{})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+
+	var out struct {
+		HTTP struct {
+			Routers     map[string]traefikRouter `yaml:"routers"`
+			Middlewares map[string]struct {
+				Headers struct {
+					CustomRequestHeaders map[string]string `yaml:"customRequestHeaders"`
+				} `yaml:"headers"`
+			} `yaml:"middlewares"`
+		} `yaml:"http"`
+	}
+	if err := yaml.Unmarshal(files[0].Data, &out); err != nil {
+		t.Fatalf("output is not valid YAML: %v", err)
+	}
+	routers := out.HTTP.Routers
+
+	if r := routers["get_users_id"]; r.Rule != "Method(`GET`) && PathRegexp(`^/users/[^/]+$`)" || r.Service != "backend" {
+		t.Errorf("unexpected router for GET /users/{id}: %+v", r)
+	}
+	if routers["get_users_me"].Priority <= routers["get_users_id"].Priority {
+		t.Errorf("expected /users/me to take priority over /users/{id}, got %+v", routers)
+	}
+	if r := routers["get_health"]; len(r.Middlewares) != 0 {
+		t.Errorf("expected no middleware on a public route, got %v", r.Middlewares)
+	}
+	if r := routers["post_legacy"]; strings.Join(r.Middlewares, ",") != "deny" {
+		t.Errorf("expected a denied route to go through the deny middleware, got %+v", r)
+	}
+	if r := routers["delete_users_id"]; strings.Join(r.Middlewares, ",") != "delete_users_id-policy,forward-auth" {
+		t.Errorf("unexpected middlewares for DELETE /users/{id}: %v", r.Middlewares)
+	}
+
+	headers := out.HTTP.Middlewares["delete_users_id-policy"].Headers.CustomRequestHeaders
+	if headers["X-Authz-Mode"] != "required" || headers["X-Authz-Roles"] != "admin,owner" || headers["X-Authz-Scopes"] != "users:write" {
+		t.Errorf("unexpected policy headers: %v", headers)
+	}
+	var policy servicePolicy
+	if err := json.Unmarshal([]byte(headers["X-Authz-Policy"]), &policy); err != nil || !policy.RequireAuth || len(policy.Roles) != 2 {
+		t.Errorf("unexpected X-Authz-Policy %q: %v", headers["X-Authz-Policy"], err)
+	}
+}
+
+func TestExport_Nginx(t *testing.T) {
+	cfg := testConfig()
+	cfg.Policies[model.RouteKey{Method: "GET", Path: "/users/me"}] = model.AuthPolicy{RequireAuth: true}
+	files, err := Export(FormatNginx, cfg, Options{})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	got := string(files[0].Data)
+
+	for _, want := range []string{
+		"location = /_authz {\n    internal;\n",
+		"proxy_set_header X-Authz-Scopes $authz_scopes;",
+		"location = \"/health\" {\n    limit_except GET {\n        deny all;\n    }\n",
+		"location ~ \"^/users/[^/]+$\" {\n    limit_except DELETE GET {\n",
+		"    if ($request_method = DELETE) {\n        set $authz_mode \"required\";\n        set $authz_roles \"admin,owner\";\n        set $authz_scopes \"users:write\";\n",
+		`set $authz_policy "{\"requireAuth\":true,\"roles\":[\"admin\",\"owner\"],\"scopes\":[\"users:write\"]}";`,
+		"    if ($request_method = POST) {\n        return 403;\n    }\n",
+		"    if ($request_method ~ ^(GET|HEAD)$) {\n        set $authz_mode \"required\";\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, got)
+		}
+	}
+
+	health := got[strings.Index(got, `location = "/health"`):]
+	health = health[:strings.Index(health, "\n}\n")]
+	if strings.Contains(health, "auth_request") {
+		t.Errorf("expected no auth_request on a public location, got:\n%s", health)
+	}
+	if strings.Index(got, `location = "/users/me"`) > strings.Index(got, `location ~ "^/users/[^/]+$"`) {
+		t.Errorf("expected /users/me before /users/{id}")
+	}
+}
+
+func TestExport_NginxHead(t *testing.T) {
+	cfg := overlapConfig()
+	cfg.Policies[model.RouteKey{Method: "HEAD", Path: "/users/me"}] = model.AuthPolicy{RequireAuth: false}
+	files, err := Export(FormatNginx, cfg, Options{})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	got := string(files[0].Data)
+
+	for _, want := range []string{
+		"location = \"/users/internal\" {\n    limit_except GET {\n        deny all;\n    }\n\n" +
+			"    set $authz_mode \"public\";\n    set $authz_roles \"\";\n    set $authz_scopes \"\";\n    set $authz_policy \"\";\n" +
+			"    if ($request_method ~ ^(GET|HEAD)$) {\n        return 403;\n    }\n",
+		"    if ($request_method = GET) {\n        set $authz_mode \"required\";\n        set $authz_roles \"admin\";\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestExport_JSON(t *testing.T) {
+	cfg := testConfig()
+	cfg.Webhooks = map[model.RouteKey]model.AuthPolicy{
+		{Method: "POST", Path: "newUser"}: {RequireAuth: true, Scopes: []string{"hooks:send"}},
+	}
+	cfg.SecuritySchemes = map[string]model.SecurityScheme{
+		"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+	}
+	files, err := Export(FormatJSON, cfg, Options{})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	if files[0].Name != "policies.json" {
+		t.Errorf("expected policies.json, got %s", files[0].Name)
+	}
+
+	var doc struct {
+		Version         int              `json:"version"`
+		Routes          []map[string]any `json:"routes"`
+		Webhooks        []map[string]any `json:"webhooks"`
+		Callbacks       []map[string]any `json:"callbacks"`
+		SecuritySchemes []map[string]any `json:"securitySchemes"`
+	}
+	if err := json.Unmarshal(files[0].Data, &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if doc.Version != 1 {
+		t.Errorf("expected version 1, got %d", doc.Version)
+	}
+	if len(doc.Routes) != 5 {
+		t.Fatalf("expected 5 routes, got %d", len(doc.Routes))
+	}
+	if doc.Routes[0]["path"] != "/health" || doc.Routes[0]["mode"] != "public" {
+		t.Errorf("expected public /health first, got %v", doc.Routes[0])
+	}
+	reports := doc.Routes[2]
+	if reports["path"] != "/reports" || !reflect.DeepEqual(reports["scopes"], []any{"reports:read"}) {
+		t.Errorf("unexpected /reports route: %v", reports)
+	}
+	alts, _ := reports["alternatives"].([]any)
+	if len(alts) != 1 || !reflect.DeepEqual(alts[0].(map[string]any)["roles"], []any{"auditor"}) {
+		t.Errorf("expected the auditor alternative, got %v", reports["alternatives"])
+	}
+	if doc.Routes[1]["deny"] != true {
+		t.Errorf("expected /legacy to be denied, got %v", doc.Routes[1])
+	}
+	if roles, ok := doc.Routes[0]["roles"].([]any); !ok || len(roles) != 0 {
+		t.Errorf("expected empty roles to be [], got %v", doc.Routes[0]["roles"])
+	}
+	if len(doc.Webhooks) != 1 || doc.Webhooks[0]["path"] != "newUser" {
+		t.Errorf("unexpected webhooks: %v", doc.Webhooks)
+	}
+	if doc.Callbacks == nil || len(doc.Callbacks) != 0 {
+		t.Errorf("expected empty callbacks, got %v", doc.Callbacks)
+	}
+	if len(doc.SecuritySchemes) != 1 || doc.SecuritySchemes[0]["name"] != "bearerAuth" || doc.SecuritySchemes[0]["bearerFormat"] != "JWT" {
+		t.Errorf("unexpected security schemes: %v", doc.SecuritySchemes)
+	}
+
+	again, err := Export(FormatJSON, cfg, Options{})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	if string(again[0].Data) != string(files[0].Data) {
+		t.Errorf("expected identical output across runs")
+	}
+}
+
+func TestExport_Markdown(t *testing.T) {
+	cfg := testConfig()
+	cfg.Callbacks = map[model.RouteKey]model.AuthPolicy{
+		{Method: "POST", Path: "{$request.body#/callbackUrl}"}: {RequireAuth: true},
+	}
+	files, err := Export(FormatMarkdown, cfg, Options{})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	if files[0].Name != "AUTHORIZATION.md" {
+		t.Errorf("expected AUTHORIZATION.md, got %s", files[0].Name)
+	}
+	got := string(files[0].Data)
+
+	for _, want := range []string{
+		"5 routes: 1 public, 0 with optional authentication, 3 requiring authentication, 1 denied.",
+		"| `GET` | `/health` | Public | - | - |",
+		"| `DELETE` | `/users/{id}` | Required | any credentials with one of the roles `admin`, `owner` and scope `users:write` | - |",
+		"| `GET` | `/reports` | Required | any credentials with scope `reports:read`; or any credentials with role `auditor` | - |",
+		"| `POST` | `/legacy` | Denied | - | - |",
+		"### `GET /users/{id}`\n\n- Access: Required\n- Requires: any credentials\n",
+		"## Callbacks\n\n",
+		"| `POST` | `{$request.body#/callbackUrl}` | Required | any credentials | - |",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "## Webhooks") {
+		t.Errorf("expected no webhooks section without webhooks")
+	}
+}
+
+func TestExport_HTML(t *testing.T) {
+	cfg := testConfig()
+	cfg.Policies[model.RouteKey{Method: "GET", Path: "/search"}] = model.AuthPolicy{RequireAuth: true, Roles: []string{"<b>admin</b>"}}
+	files, err := Export(FormatHTML, cfg, Options{})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	if files[0].Name != "authz-report.html" {
+		t.Errorf("expected authz-report.html, got %s", files[0].Name)
+	}
+	got := string(files[0].Data)
+
+	for _, want := range []string{
+		"6 routes: 1 public, 0 with optional authentication, 4 requiring authentication, 1 denied.",
+		"<tr class=\"public\" data-access=\"Public\">\n<td>Route</td>\n<td><code>GET</code></td>\n<td><code>/health</code></td>",
+		"<tr class=\"denied\" data-access=\"Denied\">",
+		"<td>admin, owner</td>\n<td>users:write</td>",
+		"<td>roles: auditor</td>",
+		"&lt;b&gt;admin&lt;/b&gt;",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "<b>admin</b>") {
+		t.Errorf("expected role names to be escaped")
+	}
+}
+
+func TestExport_CSV(t *testing.T) {
+	files, err := Export(FormatCSV, testConfig(), Options{})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	if files[0].Name != "access-matrix.csv" {
+		t.Errorf("expected access-matrix.csv, got %s", files[0].Name)
+	}
+	want := "method,path,access,anonymous,authenticated,role:admin,role:auditor,role:owner,scope:reports:read,scope:users:write\n" +
+		"GET,/health,public,yes,yes,yes,yes,yes,yes,yes\n" +
+		"POST,/legacy,denied,,,,,,,\n" +
+		"GET,/reports,required,,,,yes,,yes,\n" +
+		"DELETE,/users/{id},required,,,partial,,partial,,partial\n" +
+		"GET,/users/{id},required,,yes,yes,yes,yes,yes,yes\n"
+	if got := string(files[0].Data); got != want {
+		t.Errorf("unexpected matrix:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestExport_TypeScript(t *testing.T) {
+	cfg := testConfig()
+	cfg.Policies[model.RouteKey{Method: "GET", Path: "/users/me"}] = model.AuthPolicy{RequireAuth: true}
+	cfg.Policies[model.RouteKey{Method: "GET", Path: "/v1/{x}/b/c"}] = model.AuthPolicy{}
+	cfg.Policies[model.RouteKey{Method: "GET", Path: "/v1/b/{y}/{z}"}] = model.AuthPolicy{RequireAuth: true}
+	files, err := Export(FormatTypeScript, cfg, Options{})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	if files[0].Name != "policies.ts" {
+		t.Errorf("expected policies.ts, got %s", files[0].Name)
+	}
+	got := string(files[0].Data)
+
+	for _, want := range []string{
+		"export interface AuthPolicy {\n  mode: AuthMode;\n",
+		"export const policies: Readonly<Record<string, AuthPolicy>> = {\n  \"GET /health\": {\"mode\":\"public\",",
+		`"DELETE /users/{id}": {"mode":"required","requireAuth":true,"optionalAuth":false,"roles":["admin","owner"],"scopes":["users:write"],`,
+		`{ method: "GET", path: "/users/{id}", pattern: new RegExp("^/users/[^/]+$") },`,
+		"export function authorize(policy: AuthPolicy, claims: Claims | null): 0 | 401 | 403 {",
+		"export function can(method: string, path: string, claims: Claims | null): boolean {",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, got)
+		}
+	}
+	if strings.Index(got, `path: "/users/me"`) > strings.Index(got, `path: "/users/{id}"`) {
+		t.Errorf("expected /users/me to be matched before /users/{id}")
+	}
+	if strings.Index(got, `path: "/v1/b/{y}/{z}"`) > strings.Index(got, `path: "/v1/{x}/b/c"`) {
+		t.Errorf("expected /v1/b/{y}/{z} to be matched before /v1/{x}/b/c")
+	}
+}
+
+func TestExport_Keycloak(t *testing.T) {
+	cfg := testConfig()
+	cfg.SecuritySchemes = map[string]model.SecurityScheme{
+		"OAuth": {Type: "oauth2", Flows: []model.OAuthFlow{{
+			Type:              "clientCredentials",
+			Scopes:            []string{"reports:read", "role:auditor", "unused"},
+			ScopeDescriptions: map[string]string{"reports:read": "Read reports", "role:auditor": "Audits reports"},
+		}}},
+	}
+	files, err := Export(FormatKeycloak, cfg, Options{Realm: "shop"})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+
+	var out keycloakImport
+	if err := json.Unmarshal(files[0].Data, &out); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, files[0].Data)
+	}
+	if out.Realm != "shop" || out.IfResourceExists != "SKIP" {
+		t.Errorf("unexpected realm or conflict policy: %+v", out)
+	}
+	wantRoles := []keycloakRole{
+		{Name: "admin", Description: "Required by DELETE /users/{id}"},
+		{Name: "auditor", Description: "Audits reports"},
+		{Name: "owner", Description: "Required by DELETE /users/{id}"},
+	}
+	if !reflect.DeepEqual(out.Roles.Realm, wantRoles) {
+		t.Errorf("unexpected roles:\n got %+v\nwant %+v", out.Roles.Realm, wantRoles)
+	}
+	var scopes []string
+	for _, s := range out.ClientScopes {
+		scopes = append(scopes, s.Name+"="+s.Description)
+		if s.Protocol != "openid-connect" || s.Attributes["include.in.token.scope"] != "true" {
+			t.Errorf("unexpected client scope %+v", s)
+		}
+	}
+	want := []string{"reports:read=Read reports", "unused=", "users:write=Required by DELETE /users/{id}"}
+	if !reflect.DeepEqual(scopes, want) {
+		t.Errorf("unexpected client scopes:\n got %v\nwant %v", scopes, want)
+	}
+}
+
+func TestExport_Auth0(t *testing.T) {
+	if _, err := Export(FormatAuth0, testConfig(), Options{JWTAudience: []string{"a", "b"}}); err == nil {
+		t.Errorf("expected an error without exactly one JWT audience")
+	}
+
+	cfg := testConfig()
+	cfg.SecuritySchemes = map[string]model.SecurityScheme{
+		"OAuth": {Type: "oauth2", Flows: []model.OAuthFlow{{
+			Type:              "authorizationCode",
+			Scopes:            []string{"reports:read", "role:auditor", "unused"},
+			ScopeDescriptions: map[string]string{"reports:read": "Read reports"},
+		}}},
+	}
+	files, err := Export(FormatAuth0, cfg, Options{JWTAudience: []string{"https://api.example.com"}})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	var out auth0ResourceServer
+	if err := json.Unmarshal(files[0].Data, &out); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, files[0].Data)
+	}
+	want := auth0ResourceServer{
+		Name:       "https://api.example.com",
+		Identifier: "https://api.example.com",
+		SigningAlg: "RS256",
+		Scopes: []auth0Scope{
+			{Value: "reports:read", Description: "Read reports"},
+			{Value: "unused", Description: "unused"},
+			{Value: "users:write", Description: "Required by DELETE /users/{id}"},
+		},
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("unexpected resource server:\n got %+v\nwant %+v", out, want)
+	}
+}
+
+func TestExport_Okta(t *testing.T) {
+	got := exportOne(t, FormatOkta, Options{RolesClaim: "groups"})
+	for _, want := range []string{
+		"variable \"auth_server_id\" {",
+		"resource \"okta_auth_server_scope\" \"scope_reports_read\" {\n  auth_server_id   = var.auth_server_id\n  name             = \"reports:read\"\n  description      = \"Required by GET /reports\"\n",
+		"  name              = \"groups\"\n",
+		"  value             = \"^(admin|auditor|owner)$\"\n",
+		"data \"okta_group\" \"group_everyone\" {\n  name = \"Everyone\"\n}",
+		"  group_whitelist      = [data.okta_group.group_everyone.id]\n  grant_type_whitelist = [\"authorization_code\"]\n  scope_whitelist      = [okta_auth_server_scope.scope_reports_read.name]\n",
+		"  group_whitelist      = [data.okta_group.group_admin.id]\n  grant_type_whitelist = [\"authorization_code\"]\n  scope_whitelist      = [okta_auth_server_scope.scope_users_write.name]\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, got)
+		}
+	}
+	// auditor needs no scope alongside the role, so it gets no rule.
+	if strings.Contains(got, "group_auditor") {
+		t.Errorf("expected no rule for auditor, got:\n%s", got)
+	}
+}
+
+func TestExport_Postman(t *testing.T) {
+	cfg := testConfig()
+	cfg.Sources = []model.Source{{Spec: "specs/openapi.yaml"}}
+	cfg.Policies[model.RouteKey{Method: "GET", Path: "/users/{id}"}] = model.AuthPolicy{
+		RequireAuth: true, Schemes: []model.SchemeType{model.SchemeBearer}, Summary: "Get a user", Tags: []string{"users"},
+	}
+	cfg.Policies[model.RouteKey{Method: "GET", Path: "/session"}] = model.AuthPolicy{
+		RequireAuth: true, Schemes: []model.SchemeType{model.SchemeAPIKey}, APIKey: &model.APIKey{Name: "sid", In: "cookie"}, SessionCookie: true,
+	}
+	files, err := Export(FormatPostman, cfg, Options{})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	var out postmanCollection
+	if err := json.Unmarshal(files[0].Data, &out); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, files[0].Data)
+	}
+	if out.Info.Name != "openapi.yaml" || out.Info.Schema != postmanSchema {
+		t.Errorf("unexpected info: %+v", out.Info)
+	}
+	items := make(map[string]postmanItem)
+	for _, item := range out.Item {
+		for _, sub := range append([]postmanItem{item}, item.Item...) {
+			items[sub.Name] = sub
+		}
+	}
+	if folder := items["users"]; len(folder.Item) != 1 || folder.Item[0].Name != "GET /users/{id}" {
+		t.Errorf("expected a users folder with GET /users/{id}, got %+v", folder)
+	}
+
+	get := items["GET /users/{id}"].Request
+	if get.URL.Raw != "{{baseUrl}}/users/:id" || len(get.URL.Variable) != 1 || get.URL.Variable[0].Key != "id" {
+		t.Errorf("unexpected URL: %+v", get.URL)
+	}
+	if get.Auth.Type != "bearer" || get.Description != "Get a user\n\n**Access:** Required\n\n**Requires:** `bearer`" {
+		t.Errorf("unexpected request: %+v", get)
+	}
+	if h := items["GET /health"]; h.Request.Auth.Type != "noauth" || h.Event != nil {
+		t.Errorf("expected a public request without credentials or script, got %+v", h)
+	}
+	session := items["GET /session"].Request
+	if session.Auth.Type != "noauth" || len(session.Header) != 1 || session.Header[0].Value != "sid={{apiKey}}" {
+		t.Errorf("expected the session cookie as a header, got %+v", session)
+	}
+
+	script := strings.Join(items["DELETE /users/{id}"].Event[0].Script.Exec, "\n")
+	for _, want := range []string{
+		`console.info("DELETE /users/{id} requires any credentials with one of the roles admin, owner and scope users:write");`,
+		`pm.variables.set("requiredRoles", "admin owner");`,
+		`pm.variables.set("requiredScopes", "users:write");`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("expected pre-request script to contain %q, got:\n%s", want, script)
+		}
+	}
+	var vars []string
+	for _, v := range out.Variable {
+		vars = append(vars, v.Key)
+	}
+	if !reflect.DeepEqual(vars, []string{"baseUrl", "token", "apiKey"}) {
+		t.Errorf("unexpected variables %v", vars)
+	}
+}
+
+func TestExport_Python(t *testing.T) {
+	cfg := testConfig()
+	cfg.Policies[model.RouteKey{Method: "GET", Path: "/v1/{x}/b/c"}] = model.AuthPolicy{}
+	cfg.Policies[model.RouteKey{Method: "GET", Path: "/v1/b/{y}/{z}"}] = model.AuthPolicy{RequireAuth: true}
+	files, err := Export(FormatPython, cfg, Options{})
+	if err != nil {
+		t.Fatalf("Export error: %v", err)
+	}
+	if files[0].Name != "policies.py" {
+		t.Errorf("expected policies.py, got %s", files[0].Name)
+	}
+	got := string(files[0].Data)
+
+	for _, want := range []string{
+		`    ("GET", "/health"): {"mode": "public", "requireAuth": False, "optionalAuth": False, "roles": [], `,
+		`"apiKey": None, `,
+		`    ("GET", "/reports"): {"mode": "required", "requireAuth": True, "optionalAuth": False, "roles": [], "scopes": ["reports:read"], `,
+		`"alternatives": [{"mode": "required", "requireAuth": True, "optionalAuth": False, "roles": ["auditor"], `,
+		`    ("GET", "/users/{id}", re.compile("^/users/[^/]+$")),`,
+		"def authorize(policy: dict[str, Any], claims: Optional[Claims]) -> int:",
+		"def can(method: str, path: str, claims: Optional[Claims]) -> bool:",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "true") || strings.Contains(got, "null") {
+		t.Errorf("expected Python literals, got:\n%s", got)
+	}
+	routes := got[strings.Index(got, "_ROUTES = ["):]
+	if strings.Index(routes, `"/v1/b/{y}/{z}"`) > strings.Index(routes, `"/v1/{x}/b/c"`) {
+		t.Errorf("expected /v1/b/{y}/{z} to be matched before /v1/{x}/b/c")
+	}
+}
@@ -0,0 +1,200 @@
+package export
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+type htmlReport struct {
+	Routes   []htmlRoute
+	Total    int
+	Public   int
+	Optional int
+	Required int
+	Denied   int
+}
+
+type htmlRoute struct {
+	Kind         string
+	Method       string
+	Path         string
+	Access       string
+	Roles        string
+	Scopes       string
+	Alternatives []string
+	Operation    string
+	Notes        []string
+}
+
+// htmlTemplate is a self-contained page: the table is sorted by clicking a
+// column header and filtered by the search box and access selector.
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{"lower": strings.ToLower}).Parse(`<!DOCTYPE html>
+<!-- Code generated by openapi-authz; DO NOT EDIT. -->
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Authorization report</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2rem; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #ccc; padding: 0.4rem 0.6rem; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; cursor: pointer; user-select: none; }
+code { font-size: 0.9em; }
+tr.public { background: #fff4cc; }
+tr.optional { background: #eef6ff; }
+tr.denied { background: #fde2e2; color: #666; }
+.controls { margin: 1rem 0; display: flex; gap: 1rem; }
+</style>
+</head>
+<body>
+<h1>Authorization report</h1>
+<p>{{.Total}} routes: {{.Public}} public, {{.Optional}} with optional authentication, {{.Required}} requiring authentication, {{.Denied}} denied.
+A caller needs one of the listed roles and all of the listed scopes, or one of the alternatives.</p>
+<div class="controls">
+<input id="filter" type="search" placeholder="Filter routes, roles, scopes">
+<select id="access">
+<option value="">All access</option>
+<option>Public</option>
+<option>Optional</option>
+<option>Required</option>
+<option>Denied</option>
+</select>
+</div>
+<table id="routes">
+<thead>
+<tr><th>Kind</th><th>Method</th><th>Path</th><th>Access</th><th>Roles</th><th>Scopes</th><th>Alternatives</th><th>Operation</th><th>Notes</th></tr>
+</thead>
+<tbody>
+{{- range .Routes}}
+<tr class="{{.Access | lower}}" data-access="{{.Access}}">
+<td>{{.Kind}}</td>
+<td><code>{{.Method}}</code></td>
+<td><code>{{.Path}}</code></td>
+<td>{{.Access}}</td>
+<td>{{.Roles}}</td>
+<td>{{.Scopes}}</td>
+<td>{{range $i, $alt := .Alternatives}}{{if $i}}<br>{{end}}{{$alt}}{{end}}</td>
+<td>{{.Operation}}</td>
+<td>{{range $i, $note := .Notes}}{{if $i}}<br>{{end}}{{$note}}{{end}}</td>
+</tr>
+{{- end}}
+</tbody>
+</table>
+<script>
+(function () {
+  var table = document.getElementById("routes");
+  var body = table.tBodies[0];
+  var filter = document.getElementById("filter");
+  var access = document.getElementById("access");
+
+  function apply() {
+    var text = filter.value.toLowerCase();
+    Array.prototype.forEach.call(body.rows, function (row) {
+      var show = row.textContent.toLowerCase().indexOf(text) !== -1 &&
+        (access.value === "" || row.dataset.access === access.value);
+      row.style.display = show ? "" : "none";
+    });
+  }
+  filter.addEventListener("input", apply);
+  access.addEventListener("change", apply);
+
+  Array.prototype.forEach.call(table.tHead.rows[0].cells, function (th, col) {
+    var ascending = true;
+    th.addEventListener("click", function () {
+      var rows = Array.prototype.slice.call(body.rows);
+      rows.sort(function (a, b) {
+        var x = a.cells[col].textContent, y = b.cells[col].textContent;
+        return ascending ? x.localeCompare(y) : y.localeCompare(x);
+      });
+      ascending = !ascending;
+      rows.forEach(function (row) { body.appendChild(row); });
+    });
+  });
+})();
+</script>
+</body>
+</html>
+`))
+
+// exportHTML renders a standalone HTML report of every route, webhook and
+// callback for people auditing the API without reading its spec. Public
+// routes are highlighted.
+func exportHTML(cfg *model.Config, _ Options) ([]File, error) {
+	var report htmlReport
+	for _, group := range []struct {
+		kind     string
+		policies map[model.RouteKey]model.AuthPolicy
+	}{
+		{"Route", cfg.Policies},
+		{"Webhook", cfg.Webhooks},
+		{"Callback", cfg.Callbacks},
+	} {
+		for _, key := range sortedRoutes(group.policies) {
+			p := group.policies[key]
+			route := htmlRoute{
+				Kind:      group.kind,
+				Method:    key.Method,
+				Path:      key.Path,
+				Access:    markdownAccess(p),
+				Roles:     strings.Join(p.Roles, ", "),
+				Scopes:    strings.Join(p.Scopes, ", "),
+				Operation: p.OperationID,
+			}
+			for _, alt := range p.Alternatives {
+				route.Alternatives = append(route.Alternatives, htmlRequirement(alt))
+			}
+			if p.OwnerParam != "" {
+				route.Notes = append(route.Notes, "owner: "+p.OwnerParam)
+			}
+			for _, c := range p.Conditions {
+				route.Notes = append(route.Notes, "condition: "+c)
+			}
+			if p.PublicOverride {
+				route.Notes = append(route.Notes, "made public with x-public")
+			}
+			if p.Deprecated {
+				route.Notes = append(route.Notes, "deprecated")
+			}
+			report.Routes = append(report.Routes, route)
+
+			if group.kind != "Route" {
+				continue
+			}
+			report.Total++
+			switch route.Access {
+			case "Public":
+				report.Public++
+			case "Optional":
+				report.Optional++
+			case "Required":
+				report.Required++
+			case "Denied":
+				report.Denied++
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := htmlTemplate.Execute(&buf, report); err != nil {
+		return nil, err
+	}
+	return []File{{Name: "authz-report.html", Data: buf.Bytes()}}, nil
+}
+
+// htmlRequirement describes an alternative requirement set in a line.
+func htmlRequirement(req model.AuthPolicy) string {
+	var parts []string
+	if len(req.Roles) > 0 {
+		parts = append(parts, "roles: "+strings.Join(req.Roles, ", "))
+	}
+	if len(req.Scopes) > 0 {
+		parts = append(parts, "scopes: "+strings.Join(req.Scopes, ", "))
+	}
+	if len(parts) == 0 {
+		return "any authenticated caller"
+	}
+	return strings.Join(parts, "; ")
+}
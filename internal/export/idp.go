@@ -0,0 +1,97 @@
+package export
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// idpName is a role or scope to provision at an identity provider.
+// Description is the description its oauth2 flow declares, if any, and
+// Routes lists the routes whose policies name it, sorted by path and
+// method.
+type idpName struct {
+	Name        string
+	Description string
+	Routes      []model.RouteKey
+}
+
+// idpRolesAndScopes returns every role and scope the policies of cfg name,
+// or an oauth2 flow declares, sorted by name. Declared scopes starting with
+// "role:" are roles, as they are in requirements.
+func idpRolesAndScopes(cfg *model.Config) (roles, scopes []idpName) {
+	byRole := make(map[string]*idpName)
+	byScope := make(map[string]*idpName)
+	name := func(names map[string]*idpName, n string) *idpName {
+		if names[n] == nil {
+			names[n] = &idpName{Name: n}
+		}
+		return names[n]
+	}
+
+	schemes := make([]string, 0, len(cfg.SecuritySchemes))
+	for s := range cfg.SecuritySchemes {
+		schemes = append(schemes, s)
+	}
+	sort.Strings(schemes)
+	for _, s := range schemes {
+		for _, flow := range cfg.SecuritySchemes[s].Flows {
+			for _, scope := range flow.Scopes {
+				var n *idpName
+				if role, ok := strings.CutPrefix(scope, "role:"); ok && role != "" {
+					n = name(byRole, role)
+				} else {
+					n = name(byScope, scope)
+				}
+				if n.Description == "" {
+					n.Description = flow.ScopeDescriptions[scope]
+				}
+			}
+		}
+	}
+
+	for _, policies := range []map[model.RouteKey]model.AuthPolicy{cfg.Policies, cfg.Webhooks, cfg.Callbacks} {
+		for _, key := range sortedRoutes(policies) {
+			p := policies[key]
+			seen := make(map[*idpName]bool)
+			for _, req := range append([]model.AuthPolicy{p}, p.Alternatives...) {
+				for _, role := range req.Roles {
+					seen[name(byRole, role)] = true
+				}
+				for _, scope := range req.Scopes {
+					seen[name(byScope, scope)] = true
+				}
+			}
+			for n := range seen {
+				n.Routes = append(n.Routes, key)
+			}
+		}
+	}
+	return sortedIDPNames(byRole), sortedIDPNames(byScope)
+}
+
+func sortedIDPNames(names map[string]*idpName) []idpName {
+	sorted := make([]idpName, 0, len(names))
+	for _, n := range names {
+		sorted = append(sorted, *n)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted
+}
+
+// description returns n.Description or, when the spec declares none, one
+// listing the routes that name n.
+func (n idpName) description() string {
+	if n.Description != "" {
+		return n.Description
+	}
+	if len(n.Routes) == 0 {
+		return ""
+	}
+	routes := make([]string, len(n.Routes))
+	for i, key := range n.Routes {
+		routes[i] = key.Method + " " + key.Path
+	}
+	return "Required by " + strings.Join(routes, ", ")
+}
@@ -0,0 +1,172 @@
+package export
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// jsonVersion is the version of the JSON document layout. It changes only
+// when a field is removed or changes meaning.
+const jsonVersion = 1
+
+type jsonDocument struct {
+	Version         int                  `json:"version"`
+	Routes          []jsonRoute          `json:"routes"`
+	Webhooks        []jsonRoute          `json:"webhooks"`
+	Callbacks       []jsonRoute          `json:"callbacks"`
+	SecuritySchemes []jsonSecurityScheme `json:"securitySchemes"`
+}
+
+// jsonRoute is a route and its policy. Every field is always present, so
+// consumers need not tell a missing field from a zero one; apiKey is null
+// when the policy has none.
+type jsonRoute struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	jsonPolicy
+}
+
+type jsonPolicy struct {
+	Mode             string       `json:"mode"`
+	RequireAuth      bool         `json:"requireAuth"`
+	OptionalAuth     bool         `json:"optionalAuth"`
+	Roles            []string     `json:"roles"`
+	Scopes           []string     `json:"scopes"`
+	Schemes          []string     `json:"schemes"`
+	APIKey           *jsonAPIKey  `json:"apiKey"`
+	SessionCookie    bool         `json:"sessionCookie"`
+	OpenIDConnectURL string       `json:"openIdConnectUrl"`
+	MutualTLS        bool         `json:"mutualTls"`
+	Conditions       []string     `json:"conditions"`
+	OwnerParam       string       `json:"ownerParam"`
+	OperationID      string       `json:"operationId"`
+	Summary          string       `json:"summary"`
+	Description      string       `json:"description"`
+	PathParams       []string     `json:"pathParams"`
+	GRPCMethod       string       `json:"grpcMethod"`
+	GraphQLField     string       `json:"graphqlField"`
+	PublicOverride   bool         `json:"publicOverride"`
+	Deprecated       bool         `json:"deprecated"`
+	Deny             bool         `json:"deny"`
+	Alternatives     []jsonPolicy `json:"alternatives"`
+}
+
+type jsonAPIKey struct {
+	Name string `json:"name"`
+	In   string `json:"in"`
+}
+
+type jsonSecurityScheme struct {
+	Name             string          `json:"name"`
+	Type             string          `json:"type"`
+	Description      string          `json:"description"`
+	Scheme           string          `json:"scheme"`
+	BearerFormat     string          `json:"bearerFormat"`
+	In               string          `json:"in"`
+	ParameterName    string          `json:"parameterName"`
+	Flows            []jsonOAuthFlow `json:"flows"`
+	OpenIDConnectURL string          `json:"openIdConnectUrl"`
+}
+
+type jsonOAuthFlow struct {
+	Type             string   `json:"type"`
+	AuthorizationURL string   `json:"authorizationUrl"`
+	TokenURL         string   `json:"tokenUrl"`
+	RefreshURL       string   `json:"refreshUrl"`
+	Scopes           []string `json:"scopes"`
+}
+
+// exportJSON renders every policy of cfg, and its security schemes, as a
+// JSON document with routes sorted by path and method.
+func exportJSON(cfg *model.Config, _ Options) ([]File, error) {
+	doc := jsonDocument{
+		Version:         jsonVersion,
+		Routes:          jsonRoutes(cfg.Policies),
+		Webhooks:        jsonRoutes(cfg.Webhooks),
+		Callbacks:       jsonRoutes(cfg.Callbacks),
+		SecuritySchemes: []jsonSecurityScheme{},
+	}
+
+	names := make([]string, 0, len(cfg.SecuritySchemes))
+	for name := range cfg.SecuritySchemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := cfg.SecuritySchemes[name]
+		scheme := jsonSecurityScheme{
+			Name:             name,
+			Type:             s.Type,
+			Description:      s.Description,
+			Scheme:           s.Scheme,
+			BearerFormat:     s.BearerFormat,
+			In:               s.In,
+			ParameterName:    s.Name,
+			Flows:            []jsonOAuthFlow{},
+			OpenIDConnectURL: s.OpenIDConnectURL,
+		}
+		for _, f := range s.Flows {
+			scheme.Flows = append(scheme.Flows, jsonOAuthFlow{
+				Type:             f.Type,
+				AuthorizationURL: f.AuthorizationURL,
+				TokenURL:         f.TokenURL,
+				RefreshURL:       f.RefreshURL,
+				Scopes:           nonNil(f.Scopes),
+			})
+		}
+		doc.SecuritySchemes = append(doc.SecuritySchemes, scheme)
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []File{{Name: "policies.json", Data: append(data, '\n')}}, nil
+}
+
+func jsonRoutes(policies map[model.RouteKey]model.AuthPolicy) []jsonRoute {
+	routes := make([]jsonRoute, 0, len(policies))
+	for _, key := range sortedRoutes(policies) {
+		routes = append(routes, jsonRoute{Method: key.Method, Path: key.Path, jsonPolicy: newJSONPolicy(policies[key])})
+	}
+	return routes
+}
+
+func newJSONPolicy(p model.AuthPolicy) jsonPolicy {
+	schemes := make([]string, len(p.Schemes))
+	for i, s := range p.Schemes {
+		schemes[i] = string(s)
+	}
+	policy := jsonPolicy{
+		Mode:             string(p.Mode()),
+		RequireAuth:      p.RequireAuth,
+		OptionalAuth:     p.OptionalAuth,
+		Roles:            nonNil(p.Roles),
+		Scopes:           nonNil(p.Scopes),
+		Schemes:          schemes,
+		SessionCookie:    p.SessionCookie,
+		OpenIDConnectURL: p.OpenIDConnectURL,
+		MutualTLS:        p.MutualTLS,
+		Conditions:       nonNil(p.Conditions),
+		OwnerParam:       p.OwnerParam,
+		OperationID:      p.OperationID,
+		Summary:          p.Summary,
+		Description:      p.Description,
+		PathParams:       nonNil(p.PathParams),
+		GRPCMethod:       p.GRPCMethod,
+		GraphQLField:     p.GraphQLField,
+		PublicOverride:   p.PublicOverride,
+		Deprecated:       p.Deprecated,
+		Deny:             p.Deny,
+		Alternatives:     []jsonPolicy{},
+	}
+	if p.APIKey != nil {
+		policy.APIKey = &jsonAPIKey{Name: p.APIKey.Name, In: p.APIKey.In}
+	}
+	for _, alt := range p.Alternatives {
+		policy.Alternatives = append(policy.Alternatives, newJSONPolicy(alt))
+	}
+	return policy
+}
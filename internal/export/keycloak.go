@@ -0,0 +1,64 @@
+package export
+
+import (
+	"encoding/json"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+type keycloakImport struct {
+	Realm            string                `json:"realm,omitempty"`
+	IfResourceExists string                `json:"ifResourceExists"`
+	Roles            keycloakRoles         `json:"roles"`
+	ClientScopes     []keycloakClientScope `json:"clientScopes"`
+}
+
+type keycloakRoles struct {
+	Realm []keycloakRole `json:"realm"`
+}
+
+type keycloakRole struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type keycloakClientScope struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Protocol    string            `json:"protocol"`
+	Attributes  map[string]string `json:"attributes"`
+}
+
+// exportKeycloak renders a Keycloak realm partial import with a realm role
+// per role and an OpenID Connect client scope per scope the spec names,
+// described by the spec or by the routes that need them. Resources that
+// already exist are skipped. Client scopes are included in the scope claim
+// of tokens, where the generated middleware looks for them.
+func exportKeycloak(cfg *model.Config, opts Options) ([]File, error) {
+	roles, scopes := idpRolesAndScopes(cfg)
+	out := keycloakImport{
+		Realm:            opts.Realm,
+		IfResourceExists: "SKIP",
+		Roles:            keycloakRoles{Realm: []keycloakRole{}},
+		ClientScopes:     []keycloakClientScope{},
+	}
+	for _, role := range roles {
+		out.Roles.Realm = append(out.Roles.Realm, keycloakRole{Name: role.Name, Description: role.description()})
+	}
+	for _, scope := range scopes {
+		out.ClientScopes = append(out.ClientScopes, keycloakClientScope{
+			Name:        scope.Name,
+			Description: scope.description(),
+			Protocol:    "openid-connect",
+			Attributes: map[string]string{
+				"include.in.token.scope":    "true",
+				"display.on.consent.screen": "true",
+			},
+		})
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []File{{Name: "keycloak-realm.json", Data: append(data, '\n')}}, nil
+}
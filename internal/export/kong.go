@@ -0,0 +1,123 @@
+package export
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+type kongConfig struct {
+	FormatVersion string         `yaml:"_format_version"`
+	Services      []kongService  `yaml:"services"`
+	Consumers     []kongConsumer `yaml:"consumers,omitempty"`
+}
+
+type kongConsumer struct {
+	Username string `yaml:"username"`
+}
+
+type kongService struct {
+	Name   string      `yaml:"name"`
+	URL    string      `yaml:"url"`
+	Routes []kongRoute `yaml:"routes"`
+}
+
+type kongRoute struct {
+	Name          string       `yaml:"name"`
+	Methods       []string     `yaml:"methods"`
+	Paths         []string     `yaml:"paths"`
+	RegexPriority int          `yaml:"regex_priority"`
+	StripPath     bool         `yaml:"strip_path"`
+	Tags          []string     `yaml:"tags,omitempty"`
+	Plugins       []kongPlugin `yaml:"plugins,omitempty"`
+}
+
+type kongPlugin struct {
+	Name   string         `yaml:"name"`
+	Config map[string]any `yaml:"config,omitempty"`
+}
+
+// kongServiceTag marks routes whose policy Kong only partly enforces.
+const kongServiceTag = "openapi-authz-service-enforced"
+
+// kongAnonymous is the username of the consumer tokenless requests to
+// optional-auth routes pass as.
+const kongAnonymous = "anonymous"
+
+// exportKong renders Kong declarative configuration with a route per
+// operation on a single service, whose URL is a placeholder. Routes needing
+// authentication get the jwt plugin, and an acl plugin allowing the
+// consumer groups that satisfy them: roles as themselves and scopes
+// prefixed with "scope:". ACL groups are alternatives, so a route is only
+// given one when each of its requirement sets is either roles alone or a
+// single scope; the others are tagged openapi-authz-service-enforced. The
+// anonymous consumer optional-auth routes use is declared with them.
+func exportKong(cfg *model.Config, _ Options) ([]File, error) {
+	keys := routesByPrecedence(cfg.Policies)
+	service := kongService{Name: "openapi-authz", URL: "http://backend"}
+	names := make(map[string]bool)
+	anonymous := false
+	for i, key := range keys {
+		p := cfg.Policies[key]
+		route := kongRoute{
+			Name:          uniqueName(names, routeIdent(key)),
+			Methods:       []string{key.Method},
+			Paths:         []string{"~" + strings.TrimPrefix(pathRegex(key.Path), "^")},
+			RegexPriority: len(keys) - i,
+		}
+
+		switch {
+		case p.Deny:
+			route.Plugins = []kongPlugin{{Name: "request-termination", Config: map[string]any{"status_code": 403}}}
+		case p.Mode() == model.AuthOptional:
+			// Anonymous requests pass as the "anonymous" consumer, which
+			// no group is granted to, so the service checks the rest.
+			route.Plugins = []kongPlugin{{Name: "jwt", Config: map[string]any{"anonymous": kongAnonymous}}}
+			anonymous = true
+			route.Tags = []string{kongServiceTag}
+		case p.Mode() == model.AuthRequired:
+			route.Plugins = []kongPlugin{{Name: "jwt"}}
+			groups, ok := kongGroups(p)
+			switch {
+			case !ok:
+				route.Tags = []string{kongServiceTag}
+			case len(groups) > 0:
+				route.Plugins = append(route.Plugins, kongPlugin{Name: "acl", Config: map[string]any{"allow": groups}})
+			}
+		}
+		service.Routes = append(service.Routes, route)
+	}
+
+	out := kongConfig{FormatVersion: "3.0", Services: []kongService{service}}
+	if anonymous {
+		out.Consumers = []kongConsumer{{Username: kongAnonymous}}
+	}
+	data, err := marshalYAML(out)
+	if err != nil {
+		return nil, err
+	}
+	return []File{{Name: "kong.yaml", Data: data}}, nil
+}
+
+// kongGroups returns the ACL groups any of which satisfies p, or none when
+// any authenticated consumer does. ok is false when p cannot be expressed
+// as ACL groups.
+func kongGroups(p model.AuthPolicy) (groups []string, ok bool) {
+	reqs := append([]model.AuthPolicy{p}, p.Alternatives...)
+	if slices.ContainsFunc(reqs, func(req model.AuthPolicy) bool { return len(req.Roles) == 0 && len(req.Scopes) == 0 }) {
+		return nil, true
+	}
+	for _, req := range reqs {
+		switch {
+		case len(req.Scopes) == 0:
+			groups = append(groups, req.Roles...)
+		case len(req.Roles) == 0 && len(req.Scopes) == 1:
+			groups = append(groups, "scope:"+req.Scopes[0])
+		default:
+			return nil, false
+		}
+	}
+	slices.Sort(groups)
+	return slices.Compact(groups), true
+}
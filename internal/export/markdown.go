@@ -0,0 +1,162 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// exportMarkdown renders a Markdown document for security reviews: a
+// summary, a table of every route and what it needs, and a section per
+// route with its credentials, conditions and description. Webhooks and
+// callbacks get tables of their own.
+func exportMarkdown(cfg *model.Config, _ Options) ([]File, error) {
+	var buf bytes.Buffer
+	buf.WriteString("<!-- Code generated by openapi-authz; DO NOT EDIT. -->\n\n")
+	buf.WriteString("# Authorization\n\n")
+
+	counts := make(map[string]int)
+	for _, p := range cfg.Policies {
+		counts[markdownAccess(p)]++
+	}
+	fmt.Fprintf(&buf, "%d routes: %d public, %d with optional authentication, %d requiring authentication, %d denied.\n",
+		len(cfg.Policies), counts["Public"], counts["Optional"], counts["Required"], counts["Denied"])
+	buf.WriteString("\nA caller needs one of the listed roles and all of the listed scopes. ")
+	buf.WriteString("Requirements separated by \"or\" are alternatives.\n")
+
+	buf.WriteString("\n## Routes\n\n")
+	writeMarkdownTable(&buf, cfg.Policies)
+
+	for _, key := range sortedRoutes(cfg.Policies) {
+		p := cfg.Policies[key]
+		fmt.Fprintf(&buf, "\n### `%s %s`\n\n", key.Method, key.Path)
+		if p.Summary != "" {
+			fmt.Fprintf(&buf, "%s\n\n", p.Summary)
+		}
+		fmt.Fprintf(&buf, "- Access: %s\n", markdownAccess(p))
+		if p.Mode() != model.AuthPublic && !p.Deny {
+			fmt.Fprintf(&buf, "- Requires: %s\n", markdownRequirements(p))
+		}
+		if p.OperationID != "" {
+			fmt.Fprintf(&buf, "- Operation: `%s`\n", p.OperationID)
+		}
+		if p.APIKey != nil {
+			fmt.Fprintf(&buf, "- API key: `%s` in the %s\n", p.APIKey.Name, p.APIKey.In)
+		}
+		for _, alt := range p.Alternatives {
+			if alt.APIKey != nil {
+				fmt.Fprintf(&buf, "- API key: `%s` in the %s\n", alt.APIKey.Name, alt.APIKey.In)
+			}
+		}
+		if p.OwnerParam != "" {
+			fmt.Fprintf(&buf, "- Owner: the `%s` path parameter must identify the caller\n", p.OwnerParam)
+		}
+		for _, c := range p.Conditions {
+			fmt.Fprintf(&buf, "- Condition: `%s`\n", c)
+		}
+		if p.PublicOverride {
+			buf.WriteString("- Made public with `x-public`\n")
+		}
+		if p.Deprecated {
+			buf.WriteString("- Deprecated\n")
+		}
+		if p.Description != "" {
+			fmt.Fprintf(&buf, "\n%s\n", strings.TrimSpace(p.Description))
+		}
+	}
+
+	if len(cfg.Webhooks) > 0 {
+		buf.WriteString("\n## Webhooks\n\n")
+		writeMarkdownTable(&buf, cfg.Webhooks)
+	}
+	if len(cfg.Callbacks) > 0 {
+		buf.WriteString("\n## Callbacks\n\n")
+		writeMarkdownTable(&buf, cfg.Callbacks)
+	}
+	return []File{{Name: "AUTHORIZATION.md", Data: buf.Bytes()}}, nil
+}
+
+// writeMarkdownTable writes a table row per route of policies.
+func writeMarkdownTable(buf *bytes.Buffer, policies map[model.RouteKey]model.AuthPolicy) {
+	buf.WriteString("| Method | Path | Access | Requires | Operation |\n")
+	buf.WriteString("|--------|------|--------|----------|-----------|\n")
+	for _, key := range sortedRoutes(policies) {
+		p := policies[key]
+		requires := "-"
+		if p.Mode() != model.AuthPublic && !p.Deny {
+			requires = markdownRequirements(p)
+		}
+		operation := "-"
+		if p.OperationID != "" {
+			operation = "`" + p.OperationID + "`"
+		}
+		fmt.Fprintf(buf, "| `%s` | `%s` | %s | %s | %s |\n", key.Method, markdownCell(key.Path), markdownAccess(p), markdownCell(requires), operation)
+	}
+}
+
+// markdownAccess names the kind of access p grants.
+func markdownAccess(p model.AuthPolicy) string {
+	switch {
+	case p.Deny:
+		return "Denied"
+	case p.Mode() == model.AuthOptional:
+		return "Optional"
+	case p.Mode() == model.AuthRequired:
+		return "Required"
+	default:
+		return "Public"
+	}
+}
+
+// markdownRequirements describes the requirement sets of p in words: the
+// credentials each takes, and the roles and scopes they must carry.
+func markdownRequirements(p model.AuthPolicy) string {
+	var sets []string
+	for _, req := range append([]model.AuthPolicy{p}, p.Alternatives...) {
+		credentials := "any credentials"
+		if len(req.Schemes) > 0 {
+			schemes := make([]string, len(req.Schemes))
+			for i, s := range req.Schemes {
+				schemes[i] = "`" + string(s) + "`"
+			}
+			credentials = strings.Join(schemes, " + ")
+		}
+		var parts []string
+		switch len(req.Roles) {
+		case 0:
+		case 1:
+			parts = append(parts, "role "+markdownCodes(req.Roles))
+		default:
+			parts = append(parts, "one of the roles "+markdownCodes(req.Roles))
+		}
+		switch len(req.Scopes) {
+		case 0:
+		case 1:
+			parts = append(parts, "scope "+markdownCodes(req.Scopes))
+		default:
+			parts = append(parts, "scopes "+markdownCodes(req.Scopes))
+		}
+		if len(parts) == 0 {
+			sets = append(sets, credentials)
+			continue
+		}
+		sets = append(sets, credentials+" with "+strings.Join(parts, " and "))
+	}
+	return strings.Join(sets, "; or ")
+}
+
+// markdownCodes formats names as comma-separated code spans.
+func markdownCodes(names []string) string {
+	codes := make([]string, len(names))
+	for i, name := range names {
+		codes[i] = "`" + name + "`"
+	}
+	return strings.Join(codes, ", ")
+}
+
+// markdownCell escapes s for use in a table cell.
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
@@ -0,0 +1,105 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"slices"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// Cell values of the access matrix.
+const (
+	matrixYes     = "yes"
+	matrixPartial = "partial"
+)
+
+// exportMatrix renders a CSV access matrix with a row per route and a
+// column per identity: anonymous callers, authenticated callers holding
+// nothing, and each role and scope. A cell is "yes" when that identity
+// alone gets through, "partial" when it is named in a requirement set that
+// also needs something else, and empty otherwise. Denied routes are empty
+// throughout.
+func exportMatrix(cfg *model.Config, _ Options) ([]File, error) {
+	var roles, scopes []string
+	for _, p := range cfg.Policies {
+		for _, req := range append([]model.AuthPolicy{p}, p.Alternatives...) {
+			roles = append(roles, req.Roles...)
+			scopes = append(scopes, req.Scopes...)
+		}
+	}
+	slices.Sort(roles)
+	roles = slices.Compact(roles)
+	slices.Sort(scopes)
+	scopes = slices.Compact(scopes)
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := []string{"method", "path", "access", "anonymous", "authenticated"}
+	for _, role := range roles {
+		header = append(header, "role:"+role)
+	}
+	for _, scope := range scopes {
+		header = append(header, "scope:"+scope)
+	}
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	for _, key := range sortedRoutes(cfg.Policies) {
+		p := cfg.Policies[key]
+		access := string(p.Mode())
+		if p.Deny {
+			access = "denied"
+		}
+		row := []string{key.Method, key.Path, access}
+		if p.Deny {
+			row = append(row, make([]string, len(header)-len(row))...)
+			if err := w.Write(row); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		reqs := append([]model.AuthPolicy{p}, p.Alternatives...)
+		anyone := slices.ContainsFunc(reqs, func(req model.AuthPolicy) bool { return len(req.Roles) == 0 && len(req.Scopes) == 0 })
+		public := p.Mode() == model.AuthPublic
+		row = append(row, matrixCell(public || p.Mode() == model.AuthOptional, false))
+		row = append(row, matrixCell(public || anyone, false))
+		for _, role := range roles {
+			row = append(row, matrixCell(public || anyone || slices.ContainsFunc(reqs, func(req model.AuthPolicy) bool {
+				return len(req.Scopes) == 0 && slices.Contains(req.Roles, role)
+			}), slices.ContainsFunc(reqs, func(req model.AuthPolicy) bool {
+				return slices.Contains(req.Roles, role)
+			})))
+		}
+		for _, scope := range scopes {
+			row = append(row, matrixCell(public || anyone || slices.ContainsFunc(reqs, func(req model.AuthPolicy) bool {
+				return len(req.Roles) == 0 && len(req.Scopes) == 1 && req.Scopes[0] == scope
+			}), slices.ContainsFunc(reqs, func(req model.AuthPolicy) bool {
+				return slices.Contains(req.Scopes, scope)
+			})))
+		}
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return []File{{Name: "access-matrix.csv", Data: buf.Bytes()}}, nil
+}
+
+// matrixCell returns the cell for an identity that is let through alone
+// (allowed) or named in a requirement set needing more (named).
+func matrixCell(allowed, named bool) string {
+	switch {
+	case allowed:
+		return matrixYes
+	case named:
+		return matrixPartial
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,110 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// nginxAuthLocation is the internal location auth_request subrequests go
+// to. It passes the route's policy to the authorization service in the
+// same headers as the Traefik export.
+const nginxAuthLocation = `location = /_authz {
+    internal;
+    proxy_pass http://authz/check;
+    proxy_pass_request_body off;
+    proxy_set_header Content-Length "";
+    proxy_set_header X-Original-Method $request_method;
+    proxy_set_header X-Original-URI $request_uri;
+    proxy_set_header X-Authz-Mode $authz_mode;
+    proxy_set_header X-Authz-Roles $authz_roles;
+    proxy_set_header X-Authz-Scopes $authz_scopes;
+    proxy_set_header X-Authz-Policy $authz_policy;
+}
+`
+
+// exportNginx renders nginx location blocks, to be included in a server
+// block, with a location per path. Each sets $authz_mode, $authz_roles,
+// $authz_scopes and $authz_policy for the request method and checks them
+// with auth_request before proxying to the upstream "backend". Undeclared methods and denied
+// routes are answered with 403 directly. limit_except GET also allows HEAD,
+// so HEAD gets the policy of GET unless the path declares it.
+func exportNginx(cfg *model.Config, _ Options) ([]File, error) {
+	byPath := make(map[string][]model.RouteKey)
+	var paths []string
+	for _, key := range routesByPrecedence(cfg.Policies) {
+		if byPath[key.Path] == nil {
+			paths = append(paths, key.Path)
+		}
+		byPath[key.Path] = append(byPath[key.Path], key)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# Code generated by openapi-authz; DO NOT EDIT.\n\n")
+	buf.WriteString(nginxAuthLocation)
+
+	for _, path := range paths {
+		keys := byPath[path]
+		buf.WriteString("\n")
+		if routeParam.MatchString(path) {
+			fmt.Fprintf(&buf, "location ~ %s {\n", nginxString(pathRegex(path)))
+		} else {
+			fmt.Fprintf(&buf, "location = %s {\n", nginxString(path))
+		}
+
+		methods := make([]string, len(keys))
+		declared := make(map[string]bool)
+		for i, key := range keys {
+			methods[i] = key.Method
+			declared[key.Method] = true
+		}
+		fmt.Fprintf(&buf, "    limit_except %s {\n        deny all;\n    }\n\n", strings.Join(methods, " "))
+
+		buf.WriteString("    set $authz_mode \"public\";\n")
+		buf.WriteString("    set $authz_roles \"\";\n")
+		buf.WriteString("    set $authz_scopes \"\";\n")
+		buf.WriteString("    set $authz_policy \"\";\n")
+		public := true
+		for _, key := range keys {
+			p := cfg.Policies[key]
+			cond := "$request_method = " + key.Method
+			if key.Method == "GET" && !declared["HEAD"] {
+				cond = "$request_method ~ ^(GET|HEAD)$"
+			}
+			switch {
+			case p.Deny:
+				fmt.Fprintf(&buf, "    if (%s) {\n        return 403;\n    }\n", cond)
+			case p.Mode() != model.AuthPublic:
+				public = false
+				fmt.Fprintf(&buf, "    if (%s) {\n", cond)
+				fmt.Fprintf(&buf, "        set $authz_mode %s;\n", nginxString(string(p.Mode())))
+				if len(p.Roles) > 0 {
+					fmt.Fprintf(&buf, "        set $authz_roles %s;\n", nginxString(strings.Join(p.Roles, ",")))
+				}
+				if len(p.Scopes) > 0 {
+					fmt.Fprintf(&buf, "        set $authz_scopes %s;\n", nginxString(strings.Join(p.Scopes, ",")))
+				}
+				policy, err := json.Marshal(newServicePolicy(p))
+				if err != nil {
+					return nil, err
+				}
+				fmt.Fprintf(&buf, "        set $authz_policy %s;\n", nginxString(string(policy)))
+				buf.WriteString("    }\n")
+			}
+		}
+
+		if !public {
+			buf.WriteString("\n    auth_request /_authz;\n")
+		}
+		buf.WriteString("    proxy_pass http://backend;\n}\n")
+	}
+	return []File{{Name: "authz.conf", Data: buf.Bytes()}}, nil
+}
+
+// nginxString quotes s as an nginx string.
+func nginxString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,142 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// oktaEveryone is the Okta group every user belongs to, which gets the
+// scopes of requirement sets that name no role.
+const oktaEveryone = "Everyone"
+
+// exportOkta renders Terraform configuration for the Okta provider that
+// sets up an authorization server for the API: a scope per scope the spec
+// names, a claim listing the caller's groups named like roles, and an
+// access policy with a rule per role granting the scopes its requirement
+// sets need alongside it. The authorization server is a variable, and
+// groups are looked up by role name.
+func exportOkta(cfg *model.Config, opts Options) ([]File, error) {
+	roles, scopes := idpRolesAndScopes(cfg)
+
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by openapi-authz; DO NOT EDIT.\n\n")
+	buf.WriteString("variable \"auth_server_id\" {\n")
+	buf.WriteString("  description = \"ID of the Okta authorization server of the API\"\n")
+	buf.WriteString("  type        = string\n")
+	buf.WriteString("}\n")
+
+	names := make(map[string]bool)
+	scopeRefs := make(map[string]string)
+	for _, scope := range scopes {
+		name := uniqueName(names, "scope_"+ident(scope.Name))
+		scopeRefs[scope.Name] = "okta_auth_server_scope." + name + ".name"
+		fmt.Fprintf(&buf, "\nresource \"okta_auth_server_scope\" %q {\n", name)
+		buf.WriteString("  auth_server_id   = var.auth_server_id\n")
+		fmt.Fprintf(&buf, "  name             = %s\n", hclString(scope.Name))
+		if d := scope.description(); d != "" {
+			fmt.Fprintf(&buf, "  description      = %s\n", hclString(d))
+		}
+		buf.WriteString("  consent          = \"IMPLICIT\"\n")
+		buf.WriteString("  metadata_publish = \"ALL_CLIENTS\"\n")
+		buf.WriteString("}\n")
+	}
+
+	if len(roles) > 0 {
+		quoted := make([]string, len(roles))
+		for i, role := range roles {
+			quoted[i] = regexp.QuoteMeta(role.Name)
+		}
+		buf.WriteString("\nresource \"okta_auth_server_claim\" \"roles\" {\n")
+		buf.WriteString("  auth_server_id    = var.auth_server_id\n")
+		fmt.Fprintf(&buf, "  name              = %s\n", hclString(opts.rolesClaim()))
+		buf.WriteString("  claim_type        = \"RESOURCE\"\n")
+		buf.WriteString("  value_type        = \"GROUPS\"\n")
+		buf.WriteString("  group_filter_type = \"REGEX\"\n")
+		fmt.Fprintf(&buf, "  value             = %s\n", hclString("^("+strings.Join(quoted, "|")+")$"))
+		buf.WriteString("}\n")
+	}
+
+	grants := oktaGrants(cfg)
+	if len(grants) == 0 {
+		return []File{{Name: "okta.tf", Data: buf.Bytes()}}, nil
+	}
+	buf.WriteString("\nresource \"okta_auth_server_policy\" \"openapi_authz\" {\n")
+	buf.WriteString("  auth_server_id   = var.auth_server_id\n")
+	buf.WriteString("  name             = \"openapi-authz\"\n")
+	buf.WriteString("  description      = \"Grants the scopes the API's operations require\"\n")
+	buf.WriteString("  priority         = 1\n")
+	buf.WriteString("  client_whitelist = [\"ALL_CLIENTS\"]\n")
+	buf.WriteString("}\n")
+
+	groups := make([]string, 0, len(grants))
+	for group := range grants {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for i, group := range groups {
+		name := uniqueName(names, "group_"+ident(group))
+		fmt.Fprintf(&buf, "\ndata \"okta_group\" %q {\n", name)
+		fmt.Fprintf(&buf, "  name = %s\n", hclString(group))
+		buf.WriteString("}\n")
+
+		refs := make([]string, len(grants[group]))
+		for j, scope := range grants[group] {
+			refs[j] = scopeRefs[scope]
+		}
+		fmt.Fprintf(&buf, "\nresource \"okta_auth_server_policy_rule\" %q {\n", name)
+		buf.WriteString("  auth_server_id       = var.auth_server_id\n")
+		buf.WriteString("  policy_id            = okta_auth_server_policy.openapi_authz.id\n")
+		fmt.Fprintf(&buf, "  name                 = %s\n", hclString(group))
+		fmt.Fprintf(&buf, "  priority             = %d\n", i+1)
+		fmt.Fprintf(&buf, "  group_whitelist      = [data.okta_group.%s.id]\n", name)
+		buf.WriteString("  grant_type_whitelist = [\"authorization_code\"]\n")
+		fmt.Fprintf(&buf, "  scope_whitelist      = [%s]\n", strings.Join(refs, ", "))
+		buf.WriteString("}\n")
+	}
+	return []File{{Name: "okta.tf", Data: buf.Bytes()}}, nil
+}
+
+// oktaGrants maps the Okta groups of rules to the scopes they grant,
+// sorted: each role to the scopes of the requirement sets naming it, and
+// Everyone to those of the sets naming no role. Groups granted no scopes
+// are left out.
+func oktaGrants(cfg *model.Config) map[string][]string {
+	grants := make(map[string]map[string]bool)
+	grant := func(group string, scopes []string) {
+		if len(scopes) == 0 {
+			return
+		}
+		if grants[group] == nil {
+			grants[group] = make(map[string]bool)
+		}
+		for _, scope := range scopes {
+			grants[group][scope] = true
+		}
+	}
+	for _, policies := range []map[model.RouteKey]model.AuthPolicy{cfg.Policies, cfg.Webhooks, cfg.Callbacks} {
+		for _, p := range policies {
+			for _, req := range append([]model.AuthPolicy{p}, p.Alternatives...) {
+				if len(req.Roles) == 0 {
+					grant(oktaEveryone, req.Scopes)
+				}
+				for _, role := range req.Roles {
+					grant(role, req.Scopes)
+				}
+			}
+		}
+	}
+
+	sorted := make(map[string][]string, len(grants))
+	for group, scopes := range grants {
+		for scope := range scopes {
+			sorted[group] = append(sorted[group], scope)
+		}
+		sort.Strings(sorted[group])
+	}
+	return sorted
+}
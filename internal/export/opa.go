@@ -0,0 +1,141 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// opaRoute is a route of the OPA data document. Requirements lists the
+// acceptable requirement sets: the policy's own followed by its
+// alternatives.
+type opaRoute struct {
+	Method       string           `json:"method"`
+	Path         string           `json:"path"`
+	Regex        string           `json:"regex"`
+	OperationID  string           `json:"operation_id,omitempty"`
+	RequireAuth  bool             `json:"require_auth"`
+	OptionalAuth bool             `json:"optional_auth"`
+	Deny         bool             `json:"deny"`
+	Requirements []opaRequirement `json:"requirements"`
+}
+
+type opaRequirement struct {
+	Roles  []string `json:"roles"`
+	Scopes []string `json:"scopes"`
+}
+
+// opaEvaluator decides requests against the routes of the data document.
+// It is the same for every spec, so bundles can update policies by
+// replacing data.json alone. Only the first route matching a request
+// decides it; routes are listed so that none follows a route it shadows.
+const opaEvaluator = `
+route_matches(r) if {
+	r.method == input.method
+	regex.match(r.regex, input.path)
+}
+
+# route is the most specific route matching the request: the first listed.
+route := %[1]s[i] if {
+	some i
+	route_matches(%[1]s[i])
+	not matched_before(i)
+}
+
+matched_before(i) if {
+	some j
+	route_matches(%[1]s[j])
+	j < i
+}
+
+satisfies(req) if {
+	count(req.roles) == 0
+	every scope in req.scopes {
+		scope in scopes
+	}
+}
+
+satisfies(req) if {
+	some role in req.roles
+	role in roles
+	every scope in req.scopes {
+		scope in scopes
+	}
+}
+
+allow if {
+	route.deny == false
+	route.require_auth == false
+	route.optional_auth == false
+}
+
+allow if {
+	route.deny == false
+	route.optional_auth
+	not authenticated
+}
+
+allow if {
+	route.deny == false
+	authenticated
+	some req in route.requirements
+	satisfies(req)
+}
+`
+
+// exportOPABundle renders the policies as an OPA data document, placed
+// under the package's path, and a generic Rego evaluator that reads them.
+func exportOPABundle(cfg *model.Config, opts Options) ([]File, error) {
+	routes := make([]opaRoute, 0, len(cfg.Policies))
+	for _, key := range routesByPrecedence(cfg.Policies) {
+		p := cfg.Policies[key]
+		route := opaRoute{
+			Method:       key.Method,
+			Path:         key.Path,
+			Regex:        pathRegex(key.Path),
+			OperationID:  p.OperationID,
+			RequireAuth:  p.RequireAuth,
+			OptionalAuth: p.OptionalAuth,
+			Deny:         p.Deny,
+		}
+		for _, req := range append([]model.AuthPolicy{p}, p.Alternatives...) {
+			route.Requirements = append(route.Requirements, opaRequirement{
+				Roles:  nonNil(req.Roles),
+				Scopes: nonNil(req.Scopes),
+			})
+		}
+		routes = append(routes, route)
+	}
+
+	// data.json is loaded at the bundle root, so nest the routes under the
+	// package path for data.<package>.routes to find them.
+	var doc any = map[string]any{"routes": routes}
+	segments := strings.Split(opts.pkg(), ".")
+	for i := len(segments) - 1; i >= 0; i-- {
+		doc = map[string]any{segments[i]: doc}
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	var policy bytes.Buffer
+	writeRegoPreamble(&policy, opts)
+	fmt.Fprintf(&policy, opaEvaluator, "data."+opts.pkg()+".routes")
+
+	return []File{
+		{Name: "data.json", Data: append(data, '\n')},
+		{Name: "policy.rego", Data: policy.Bytes()},
+	}, nil
+}
+
+// nonNil returns s, or an empty slice if s is nil, so it encodes as [].
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,218 @@
+package export
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// postmanSchema identifies the Postman collection format written.
+const postmanSchema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+type postmanCollection struct {
+	Info     postmanInfo       `json:"info"`
+	Item     []postmanItem     `json:"item"`
+	Variable []postmanVariable `json:"variable"`
+}
+
+type postmanInfo struct {
+	Name   string `json:"name"`
+	Schema string `json:"schema"`
+}
+
+// postmanItem is a request or, when Item is set, a folder of requests.
+type postmanItem struct {
+	Name    string          `json:"name"`
+	Item    []postmanItem   `json:"item,omitempty"`
+	Request *postmanRequest `json:"request,omitempty"`
+	Event   []postmanEvent  `json:"event,omitempty"`
+}
+
+type postmanRequest struct {
+	Method      string            `json:"method"`
+	URL         postmanURL        `json:"url"`
+	Header      []postmanVariable `json:"header,omitempty"`
+	Auth        postmanAuth       `json:"auth"`
+	Description string            `json:"description,omitempty"`
+}
+
+type postmanURL struct {
+	Raw      string            `json:"raw"`
+	Host     []string          `json:"host"`
+	Path     []string          `json:"path"`
+	Variable []postmanVariable `json:"variable,omitempty"`
+}
+
+type postmanAuth struct {
+	Type   string            `json:"type"`
+	Bearer []postmanVariable `json:"bearer,omitempty"`
+	Basic  []postmanVariable `json:"basic,omitempty"`
+	APIKey []postmanVariable `json:"apikey,omitempty"`
+	OAuth2 []postmanVariable `json:"oauth2,omitempty"`
+}
+
+type postmanVariable struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type postmanEvent struct {
+	Listen string        `json:"listen"`
+	Script postmanScript `json:"script"`
+}
+
+type postmanScript struct {
+	Type string   `json:"type"`
+	Exec []string `json:"exec"`
+}
+
+// exportPostman renders a Postman collection with a request per route,
+// in a folder per first tag. Each request authenticates with the
+// credentials of the policy's first requirement set, taken from collection
+// variables, and its description says what the route requires. The
+// pre-request script of a protected request sets the requiredRoles and
+// requiredScopes variables, so a collection script fetching tokens can ask
+// for what the route needs.
+func exportPostman(cfg *model.Config, _ Options) ([]File, error) {
+	name := "openapi-authz"
+	if len(cfg.Sources) > 0 && cfg.Sources[0].Spec != "" && cfg.Sources[0].Spec != "-" {
+		name = path.Base(cfg.Sources[0].Spec)
+	}
+	collection := postmanCollection{
+		Info:     postmanInfo{Name: name, Schema: postmanSchema},
+		Item:     []postmanItem{},
+		Variable: []postmanVariable{{Key: "baseUrl", Value: "http://localhost:8080"}},
+	}
+
+	used := make(map[string]bool)
+	folders := make(map[string]int)
+	for _, key := range sortedRoutes(cfg.Policies) {
+		p := cfg.Policies[key]
+		item := postmanItem{Name: key.Method + " " + key.Path, Request: newPostmanRequest(key, p, used)}
+		if exec := postmanScriptLines(key, p); exec != nil {
+			item.Event = []postmanEvent{{Listen: "prerequest", Script: postmanScript{Type: "text/javascript", Exec: exec}}}
+		}
+		if len(p.Tags) == 0 {
+			collection.Item = append(collection.Item, item)
+			continue
+		}
+		i, ok := folders[p.Tags[0]]
+		if !ok {
+			i = len(collection.Item)
+			folders[p.Tags[0]] = i
+			collection.Item = append(collection.Item, postmanItem{Name: p.Tags[0]})
+		}
+		collection.Item[i].Item = append(collection.Item[i].Item, item)
+	}
+	for _, v := range []string{"token", "username", "password", "apiKey"} {
+		if used[v] {
+			collection.Variable = append(collection.Variable, postmanVariable{Key: v})
+		}
+	}
+
+	data, err := json.MarshalIndent(collection, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []File{{Name: "postman_collection.json", Data: append(data, '\n')}}, nil
+}
+
+// newPostmanRequest returns the request for key, recording the collection
+// variables its credentials use in used.
+func newPostmanRequest(key model.RouteKey, p model.AuthPolicy, used map[string]bool) *postmanRequest {
+	url := postmanURL{Host: []string{"{{baseUrl}}"}, Path: []string{}}
+	for _, seg := range strings.Split(strings.TrimPrefix(key.Path, "/"), "/") {
+		seg = replaceRouteParams(seg, func(param string) string {
+			name, _, _ := strings.Cut(strings.Trim(param, "{}:"), ":")
+			url.Variable = append(url.Variable, postmanVariable{Key: name})
+			return ":" + name
+		})
+		url.Path = append(url.Path, seg)
+	}
+	url.Raw = "{{baseUrl}}/" + strings.Join(url.Path, "/")
+
+	req := &postmanRequest{Method: key.Method, URL: url, Auth: postmanAuth{Type: "noauth"}}
+	var desc []string
+	if p.Summary != "" {
+		desc = append(desc, p.Summary)
+	}
+	if p.Description != "" {
+		desc = append(desc, strings.TrimSpace(p.Description))
+	}
+	access := "**Access:** " + markdownAccess(p)
+	if p.Mode() != model.AuthPublic && !p.Deny {
+		access += "\n\n**Requires:** " + markdownRequirements(p)
+	}
+	req.Description = strings.Join(append(desc, access), "\n\n")
+
+	if p.Mode() == model.AuthPublic || p.Deny {
+		return req
+	}
+	// Postman's apikey auth cannot set cookies.
+	if p.APIKey != nil && p.APIKey.In == "cookie" {
+		used["apiKey"] = true
+		req.Header = append(req.Header, postmanVariable{Key: "Cookie", Value: p.APIKey.Name + "={{apiKey}}"})
+	}
+	for _, scheme := range p.Schemes {
+		if auth, ok := postmanCredentials(scheme, p, used); ok {
+			req.Auth = auth
+			break
+		}
+	}
+	return req
+}
+
+// postmanCredentials returns the auth of a request presenting credentials
+// of scheme for p, recording the variables it uses in used. It returns
+// false for schemes Postman auth does not cover: mutual TLS and API keys
+// in cookies.
+func postmanCredentials(scheme model.SchemeType, p model.AuthPolicy, used map[string]bool) (postmanAuth, bool) {
+	switch scheme {
+	case model.SchemeBearer:
+		used["token"] = true
+		return postmanAuth{Type: "bearer", Bearer: []postmanVariable{{Key: "token", Value: "{{token}}"}}}, true
+	case model.SchemeOAuth2, model.SchemeOpenIDConnect:
+		used["token"] = true
+		return postmanAuth{Type: "oauth2", OAuth2: []postmanVariable{
+			{Key: "accessToken", Value: "{{token}}"},
+			{Key: "addTokenTo", Value: "header"},
+			{Key: "scope", Value: strings.Join(p.Scopes, " ")},
+		}}, true
+	case model.SchemeBasic:
+		used["username"], used["password"] = true, true
+		return postmanAuth{Type: "basic", Basic: []postmanVariable{
+			{Key: "username", Value: "{{username}}"},
+			{Key: "password", Value: "{{password}}"},
+		}}, true
+	case model.SchemeAPIKey:
+		if p.APIKey == nil || p.APIKey.In == "cookie" {
+			return postmanAuth{}, false
+		}
+		used["apiKey"] = true
+		return postmanAuth{Type: "apikey", APIKey: []postmanVariable{
+			{Key: "key", Value: p.APIKey.Name},
+			{Key: "value", Value: "{{apiKey}}"},
+			{Key: "in", Value: p.APIKey.In},
+		}}, true
+	}
+	return postmanAuth{}, false
+}
+
+// postmanScriptLines returns the pre-request script of a route protected
+// by p, or nil for routes that need no credentials.
+func postmanScriptLines(key model.RouteKey, p model.AuthPolicy) []string {
+	if p.Mode() == model.AuthPublic || p.Deny {
+		return nil
+	}
+	requires, _ := json.Marshal(key.Method + " " + key.Path + " requires " + strings.ReplaceAll(markdownRequirements(p), "`", ""))
+	roles, _ := json.Marshal(strings.Join(p.Roles, " "))
+	scopes, _ := json.Marshal(strings.Join(p.Scopes, " "))
+	return []string{
+		"// Generated by openapi-authz.",
+		"console.info(" + string(requires) + ");",
+		"pm.variables.set(\"requiredRoles\", " + string(roles) + ");",
+		"pm.variables.set(\"requiredScopes\", " + string(scopes) + ");",
+	}
+}
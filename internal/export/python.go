@@ -0,0 +1,176 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+const pythonHeader = `# Code generated by openapi-authz; DO NOT EDIT.
+"""Authorization policies derived from an OpenAPI spec by openapi-authz.
+
+POLICIES maps (method, path template) to a policy dict with the fields of
+the json export format. The helpers decide requests the way the generated
+Go middleware does.
+"""
+
+from __future__ import annotations
+
+import re
+from dataclasses import dataclass, field
+from typing import Any, Optional, Sequence
+
+`
+
+const pythonHelpers = `
+
+@dataclass(frozen=True)
+class Claims:
+    """What authorize needs to know about an authenticated caller."""
+
+    roles: Sequence[str] = field(default_factory=tuple)
+    scopes: Sequence[str] = field(default_factory=tuple)
+
+
+def lookup_policy(method: str, path: str) -> Optional[dict[str, Any]]:
+    """Return the policy of a route template such as "/users/{id}"."""
+    return POLICIES.get((method.upper(), path))
+
+
+def match_policy(method: str, path: str) -> Optional[dict[str, Any]]:
+    """Return the policy of the route a concrete path such as "/users/42" is sent to.
+
+    A literal segment wins over a parameter, as in the Go matcher, so
+    /users/me is preferred over /users/{id}.
+    """
+    method = method.upper()
+    for route_method, template, pattern in _ROUTES:
+        if route_method == method and pattern.match(path):
+            return POLICIES[(route_method, template)]
+    return None
+
+
+def authorize(policy: dict[str, Any], claims: Optional[Claims]) -> int:
+    """Return the HTTP status a request must be rejected with, or 0 if it may proceed.
+
+    claims is None for unauthenticated requests. Authenticated requests must
+    hold any of the policy's roles and all of its scopes, or those of one of
+    its alternatives.
+    """
+    if policy["deny"]:
+        return 403
+    if claims is None:
+        return 401 if policy["requireAuth"] else 0
+    if policy["mode"] == "public":
+        return 0
+    if _satisfies(claims, policy) or any(_satisfies(claims, alt) for alt in policy["alternatives"]):
+        return 0
+    return 403
+
+
+def can(method: str, path: str, claims: Optional[Claims]) -> bool:
+    """Report whether a caller may send method to a concrete path.
+
+    Paths without a policy are allowed, as the generated middleware lets
+    them pass.
+    """
+    policy = match_policy(method, path)
+    return policy is None or authorize(policy, claims) == 0
+
+
+def _satisfies(claims: Claims, policy: dict[str, Any]) -> bool:
+    if policy["roles"] and not any(role in claims.roles for role in policy["roles"]):
+        return False
+    return all(scope in claims.scopes for scope in policy["scopes"])
+`
+
+// exportPython renders a Python module with the policy map, keyed by
+// (method, path) tuples, and helpers matching those of the typescript
+// format.
+func exportPython(cfg *model.Config, _ Options) ([]File, error) {
+	var buf bytes.Buffer
+	buf.WriteString(pythonHeader)
+
+	keys := sortedRoutes(cfg.Policies)
+	buf.WriteString("POLICIES: dict[tuple[str, str], dict[str, Any]] = {\n")
+	for _, key := range keys {
+		policy, err := json.Marshal(newJSONPolicy(cfg.Policies[key]))
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "    (%s, %s): ", pythonString(key.Method), pythonString(key.Path))
+		if err := writePython(&buf, json.NewDecoder(bytes.NewReader(policy))); err != nil {
+			return nil, err
+		}
+		buf.WriteString(",\n")
+	}
+	buf.WriteString("}\n")
+
+	keys = routesByPrecedence(cfg.Policies)
+	buf.WriteString("\n_ROUTES = [\n")
+	for _, key := range keys {
+		fmt.Fprintf(&buf, "    (%s, %s, re.compile(%s)),\n", pythonString(key.Method), pythonString(key.Path), pythonString(pathRegex(key.Path)))
+	}
+	buf.WriteString("]\n")
+	buf.WriteString(pythonHelpers)
+	return []File{{Name: "policies.py", Data: buf.Bytes()}}, nil
+}
+
+// writePython writes the next JSON value from dec as a Python literal,
+// keeping the order of object keys.
+func writePython(w io.Writer, dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		open, close := "[", "]"
+		if v == '{' {
+			open, close = "{", "}"
+		}
+		io.WriteString(w, open)
+		for i := 0; dec.More(); i++ {
+			if i > 0 {
+				io.WriteString(w, ", ")
+			}
+			if v == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(w, "%s: ", pythonString(key.(string)))
+			}
+			if err := writePython(w, dec); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		io.WriteString(w, close)
+	case string:
+		io.WriteString(w, pythonString(v))
+	case bool:
+		if v {
+			io.WriteString(w, "True")
+		} else {
+			io.WriteString(w, "False")
+		}
+	case nil:
+		io.WriteString(w, "None")
+	default:
+		fmt.Fprint(w, v)
+	}
+	return nil
+}
+
+// pythonString quotes s as a Python string literal. JSON string escapes
+// are valid in Python.
+func pythonString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
@@ -0,0 +1,162 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// exportRego renders a Rego package with an allow rule per route and
+// requirement set, and a test file exercising each route. A rule does not
+// match the paths of the routes shadowing its own, so only the most
+// specific route matching a request decides it. Queries evaluate
+// data.<package>.allow against an input of the form
+//
+//	{"method": "GET", "path": "/users/42", "claims": {"roles": [...], "scope": "a b"}}
+//
+// where claims is omitted for unauthenticated requests.
+func exportRego(cfg *model.Config, opts Options) ([]File, error) {
+	var policy, tests bytes.Buffer
+	pkg := opts.pkg()
+
+	writeRegoPreamble(&policy, opts)
+	policy.WriteString("\nhas_any_role(want) if {\n\tsome role in want\n\trole in roles\n}\n")
+
+	tests.WriteString("# Code generated by openapi-authz; DO NOT EDIT.\n")
+	fmt.Fprintf(&tests, "package %s\n\n", pkg)
+	tests.WriteString("import rego.v1\n")
+
+	names := make(map[string]bool)
+	for _, key := range sortedRoutes(cfg.Policies) {
+		p := cfg.Policies[key]
+		match := fmt.Sprintf("\tinput.method == %s\n\tregex.match(%s, input.path)\n", regoString(key.Method), regoString(pathRegex(key.Path)))
+		for _, other := range shadowingRoutes(key, cfg.Policies) {
+			match += fmt.Sprintf("\tnot regex.match(%s, input.path)\n", regoString(pathRegex(other.Path)))
+		}
+
+		fmt.Fprintf(&policy, "\n# %s %s\n", key.Method, key.Path)
+		switch {
+		case p.Deny:
+			policy.WriteString("# Denied: no rule allows this route.\n")
+		case p.Mode() == model.AuthPublic:
+			fmt.Fprintf(&policy, "allow if {\n%s}\n", match)
+		default:
+			if p.Mode() == model.AuthOptional {
+				fmt.Fprintf(&policy, "allow if {\n%s\tnot authenticated\n}\n", match)
+			}
+			var written []string
+			for _, req := range append([]model.AuthPolicy{p}, p.Alternatives...) {
+				body := regoRequirement(req)
+				if !slices.Contains(written, body) {
+					written = append(written, body)
+					fmt.Fprintf(&policy, "allow if {\n%s%s}\n", match, body)
+				}
+			}
+		}
+
+		writeRegoTests(&tests, key, p, uniqueName(names, routeIdent(key)), opts)
+	}
+
+	return []File{
+		{Name: "policy.rego", Data: policy.Bytes()},
+		{Name: "policy_test.rego", Data: tests.Bytes()},
+	}, nil
+}
+
+// writeRegoPreamble writes the package clause, the default allow decision and
+// the rules reading the caller's claims from the input.
+func writeRegoPreamble(buf *bytes.Buffer, opts Options) {
+	buf.WriteString("# Code generated by openapi-authz; DO NOT EDIT.\n")
+	fmt.Fprintf(buf, "package %s\n\n", opts.pkg())
+	buf.WriteString("import rego.v1\n\n")
+	buf.WriteString("default allow := false\n\n")
+	buf.WriteString("authenticated if input.claims\n\n")
+	fmt.Fprintf(buf, "roles contains role if some role in input.claims[%s]\n\n", regoString(opts.rolesClaim()))
+	fmt.Fprintf(buf, "scopes contains scope if some scope in split(input.claims[%s], \" \")\n", regoString(opts.scopesClaim()))
+}
+
+// regoRequirement returns the body lines requiring the roles and scopes of
+// p, or an authenticated caller when it names neither.
+func regoRequirement(p model.AuthPolicy) string {
+	var b strings.Builder
+	if len(p.Roles) > 0 {
+		fmt.Fprintf(&b, "\thas_any_role({%s})\n", regoList(p.Roles))
+	}
+	for _, scope := range p.Scopes {
+		fmt.Fprintf(&b, "\t%s in scopes\n", regoString(scope))
+	}
+	if b.Len() == 0 {
+		b.WriteString("\tauthenticated\n")
+	}
+	return b.String()
+}
+
+// writeRegoTests writes tests checking that anonymous callers, callers
+// without the required role and callers satisfying the policy of key get
+// the expected decision.
+func writeRegoTests(buf *bytes.Buffer, key model.RouteKey, p model.AuthPolicy, name string, opts Options) {
+	request := fmt.Sprintf(`{"method": %s, "path": %s`, regoString(key.Method), regoString(examplePath(key.Path)))
+	anonymous := request + "}"
+	claims := func(roles []string) string {
+		return fmt.Sprintf(`%s, "claims": {%s: [%s], %s: %s}}`, request,
+			regoString(opts.rolesClaim()), regoList(roles),
+			regoString(opts.scopesClaim()), regoString(strings.Join(p.Scopes, " ")))
+	}
+	test := func(suffix string, allowed bool, input string) {
+		if allowed {
+			fmt.Fprintf(buf, "\ntest_%s_allows_%s if {\n\tallow with input as %s\n}\n", name, suffix, input)
+		} else {
+			fmt.Fprintf(buf, "\ntest_%s_rejects_%s if {\n\tnot allow with input as %s\n}\n", name, suffix, input)
+		}
+	}
+
+	switch {
+	case p.Deny:
+		test("authorized", false, claims(p.Roles))
+	case p.Mode() == model.AuthPublic:
+		test("anonymous", true, anonymous)
+	default:
+		test("anonymous", p.Mode() == model.AuthOptional, anonymous)
+		var roles []string
+		if len(p.Roles) > 0 {
+			roles = p.Roles[:1]
+			if !slices.ContainsFunc(p.Alternatives, func(alt model.AuthPolicy) bool { return len(alt.Roles) == 0 && subset(alt.Scopes, p.Scopes) }) {
+				test("other_roles", false, claims(nil))
+			}
+		}
+		test("authorized", true, claims(roles))
+	}
+}
+
+func subset(a, b []string) bool {
+	for _, s := range a {
+		if !slices.Contains(b, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// examplePath returns a concrete path matching the route pattern path, with
+// every parameter set to "1".
+func examplePath(path string) string {
+	return replaceRouteParams(path, func(string) string { return "1" })
+}
+
+// regoString quotes s as a Rego string literal, which follows JSON.
+func regoString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func regoList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = regoString(item)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,133 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// exportSpiceDB renders a SpiceDB schema in which a single api object has a
+// relation per role and scope and a permission per route, and the
+// relationships that make public and authenticated-only routes reachable.
+// Checks are made against api:default, with user:<id> for authenticated
+// callers and anonymous:<id> for anyone else.
+func exportSpiceDB(cfg *model.Config, _ Options) ([]File, error) {
+	keys := sortedRoutes(cfg.Policies)
+
+	// Relations are named after the roles and scopes they grant, which are
+	// sorted so renames from sanitizing stay stable.
+	var roles, scopes []string
+	for _, key := range keys {
+		p := cfg.Policies[key]
+		for _, req := range append([]model.AuthPolicy{p}, p.Alternatives...) {
+			roles = append(roles, req.Roles...)
+			scopes = append(scopes, req.Scopes...)
+		}
+	}
+	slices.Sort(roles)
+	slices.Sort(scopes)
+	names := map[string]bool{"everyone": true, "authenticated": true}
+	roleRelations := make(map[string]string)
+	for _, role := range slices.Compact(roles) {
+		roleRelations[role] = uniqueName(names, "role_"+ident(role))
+	}
+	scopeRelations := make(map[string]string)
+	for _, scope := range slices.Compact(scopes) {
+		scopeRelations[scope] = uniqueName(names, "scope_"+ident(scope))
+	}
+
+	var schema bytes.Buffer
+	schema.WriteString("// Code generated by openapi-authz; DO NOT EDIT.\n")
+	schema.WriteString("definition user {}\n\n")
+	schema.WriteString("definition anonymous {}\n\n")
+	schema.WriteString("definition api {\n")
+	schema.WriteString("\trelation everyone: user:* | anonymous:*\n")
+	schema.WriteString("\trelation authenticated: user:*\n")
+	for _, rel := range sortedValues(roleRelations) {
+		fmt.Fprintf(&schema, "\trelation %s: user\n", rel)
+	}
+	for _, rel := range sortedValues(scopeRelations) {
+		fmt.Fprintf(&schema, "\trelation %s: user\n", rel)
+	}
+
+	routeNames := make(map[string]bool)
+	for _, key := range keys {
+		p := cfg.Policies[key]
+		var expr string
+		switch {
+		case p.Deny:
+			expr = "nil"
+		case p.Mode() != model.AuthRequired:
+			expr = "everyone"
+		default:
+			var alts []string
+			for _, req := range append([]model.AuthPolicy{p}, p.Alternatives...) {
+				if alt := spiceDBRequirement(req, roleRelations, scopeRelations); !slices.Contains(alts, alt) {
+					alts = append(alts, alt)
+				}
+			}
+			if len(alts) > 1 {
+				for i, alt := range alts {
+					if strings.Contains(alt, " ") {
+						alts[i] = "(" + alt + ")"
+					}
+				}
+			}
+			expr = strings.Join(alts, " + ")
+		}
+		name := uniqueName(routeNames, routeIdent(key))
+		if len(name) > 64 {
+			return nil, fmt.Errorf("%s %s: SpiceDB permission name %s is longer than 64 characters", key.Method, key.Path, name)
+		}
+		fmt.Fprintf(&schema, "\n\t// %s %s\n", key.Method, key.Path)
+		fmt.Fprintf(&schema, "\tpermission %s = %s\n", name, expr)
+	}
+	schema.WriteString("}\n")
+
+	relationships := "api:default#everyone@user:*\napi:default#everyone@anonymous:*\napi:default#authenticated@user:*\n"
+
+	return []File{
+		{Name: "schema.zed", Data: schema.Bytes()},
+		{Name: "relationships.txt", Data: []byte(relationships)},
+	}, nil
+}
+
+// spiceDBRequirement returns the permission expression requiring any of
+// p's roles and all of its scopes, or any authenticated caller when it
+// names neither.
+func spiceDBRequirement(p model.AuthPolicy, roles, scopes map[string]string) string {
+	var terms []string
+	if len(p.Roles) > 0 {
+		rels := make([]string, len(p.Roles))
+		for i, role := range p.Roles {
+			rels[i] = roles[role]
+		}
+		term := strings.Join(rels, " + ")
+		if len(rels) > 1 && len(p.Scopes) > 0 {
+			term = "(" + term + ")"
+		}
+		terms = append(terms, term)
+	} else if len(p.Scopes) > 0 {
+		terms = append(terms, "authenticated")
+	}
+	for _, scope := range p.Scopes {
+		terms = append(terms, scopes[scope])
+	}
+	if len(terms) == 0 {
+		return "authenticated"
+	}
+	return strings.Join(terms, " & ")
+}
+
+func sortedValues(m map[string]string) []string {
+	values := make([]string, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	return values
+}
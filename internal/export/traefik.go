@@ -0,0 +1,81 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+type traefikConfig struct {
+	HTTP traefikHTTP `yaml:"http"`
+}
+
+type traefikHTTP struct {
+	Routers     map[string]traefikRouter `yaml:"routers"`
+	Middlewares map[string]any           `yaml:"middlewares"`
+	Services    map[string]any           `yaml:"services"`
+}
+
+type traefikRouter struct {
+	Rule        string   `yaml:"rule"`
+	Priority    int      `yaml:"priority"`
+	Service     string   `yaml:"service"`
+	Middlewares []string `yaml:"middlewares,omitempty"`
+}
+
+// exportTraefik renders Traefik v3 dynamic configuration with a router per
+// route. Routes that need authentication go through a headers middleware
+// stating their policy and then the shared forward-auth middleware, which
+// passes those headers to the authorization service. Its address and the
+// backend service URL are placeholders. Denied routes go through the deny
+// middleware, whose allow list no client address matches, so they answer
+// 403 instead of falling through to a parameter route that matches them.
+func exportTraefik(cfg *model.Config, _ Options) ([]File, error) {
+	keys := routesByPrecedence(cfg.Policies)
+
+	out := traefikHTTP{
+		Routers: make(map[string]traefikRouter),
+		Middlewares: map[string]any{
+			"forward-auth": map[string]any{"forwardAuth": map[string]any{"address": "http://authz/check"}},
+			"deny":         map[string]any{"ipAllowList": map[string]any{"sourceRange": []string{"0.0.0.0/32"}}},
+		},
+		Services: map[string]any{
+			"backend": map[string]any{"loadBalancer": map[string]any{"servers": []any{map[string]any{"url": "http://backend"}}}},
+		},
+	}
+	names := make(map[string]bool)
+	for i, key := range keys {
+		p := cfg.Policies[key]
+		name := uniqueName(names, routeIdent(key))
+		router := traefikRouter{
+			Rule:     fmt.Sprintf("Method(`%s`) && PathRegexp(`%s`)", key.Method, pathRegex(key.Path)),
+			Priority: len(keys) - i,
+			Service:  "backend",
+		}
+		switch {
+		case p.Deny:
+			router.Middlewares = []string{"deny"}
+		case p.Mode() != model.AuthPublic:
+			policy, err := json.Marshal(newServicePolicy(p))
+			if err != nil {
+				return nil, err
+			}
+			out.Middlewares[name+"-policy"] = map[string]any{"headers": map[string]any{"customRequestHeaders": map[string]string{
+				"X-Authz-Mode":   string(p.Mode()),
+				"X-Authz-Roles":  strings.Join(p.Roles, ","),
+				"X-Authz-Scopes": strings.Join(p.Scopes, ","),
+				"X-Authz-Policy": string(policy),
+			}}}
+			router.Middlewares = []string{name + "-policy", "forward-auth"}
+		}
+		out.Routers[name] = router
+	}
+
+	data, err := marshalYAML(traefikConfig{HTTP: out})
+	if err != nil {
+		return nil, err
+	}
+	return []File{{Name: "traefik.yaml", Data: data}}, nil
+}
@@ -0,0 +1,151 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// tsTypes declares the shape of the policies, following the json format.
+const tsTypes = `export type AuthMode = "public" | "optional" | "required";
+
+export interface APIKey {
+  name: string;
+  in: "header" | "query" | "cookie";
+}
+
+export interface AuthPolicy {
+  mode: AuthMode;
+  requireAuth: boolean;
+  optionalAuth: boolean;
+  roles: readonly string[];
+  scopes: readonly string[];
+  schemes: readonly string[];
+  apiKey: APIKey | null;
+  sessionCookie: boolean;
+  openIdConnectUrl: string;
+  mutualTls: boolean;
+  conditions: readonly string[];
+  ownerParam: string;
+  operationId: string;
+  summary: string;
+  description: string;
+  pathParams: readonly string[];
+  grpcMethod: string;
+  graphqlField: string;
+  publicOverride: boolean;
+  deprecated: boolean;
+  deny: boolean;
+  alternatives: readonly AuthPolicy[];
+}
+
+/** Claims is what authorize needs to know about an authenticated caller. */
+export interface Claims {
+  roles: readonly string[];
+  scopes: readonly string[];
+}
+`
+
+// tsHelpers mirrors the generated Go Authorize and LookupPolicy.
+const tsHelpers = `
+/** lookupPolicy returns the policy of a route template such as "/users/{id}". */
+export function lookupPolicy(method: string, path: string): AuthPolicy | undefined {
+  return policies[method.toUpperCase() + " " + path];
+}
+
+/**
+ * matchPolicy returns the policy of the route a concrete path such as
+ * "/users/42" is sent to. A literal segment wins over a parameter, as in
+ * the Go matcher, so /users/me is preferred over /users/{id}.
+ */
+export function matchPolicy(method: string, path: string): AuthPolicy | undefined {
+  const m = method.toUpperCase();
+  for (const route of routes) {
+    if (route.method === m && route.pattern.test(path)) {
+      return policies[route.method + " " + route.path];
+    }
+  }
+  return undefined;
+}
+
+/**
+ * authorize returns the HTTP status a request must be rejected with under
+ * policy, or 0 if it may proceed. claims is null for unauthenticated
+ * requests. Authenticated requests must hold any of the policy's roles and
+ * all of its scopes, or those of one of its alternatives.
+ */
+export function authorize(policy: AuthPolicy, claims: Claims | null): 0 | 401 | 403 {
+  if (policy.deny) {
+    return 403;
+  }
+  if (claims === null) {
+    return policy.requireAuth ? 401 : 0;
+  }
+  if (policy.mode === "public") {
+    return 0;
+  }
+  if (satisfies(claims, policy) || policy.alternatives.some((alt) => satisfies(claims, alt))) {
+    return 0;
+  }
+  return 403;
+}
+
+/**
+ * can reports whether a caller may send method to a concrete path. Paths
+ * without a policy are allowed, as the generated middleware lets them pass.
+ */
+export function can(method: string, path: string, claims: Claims | null): boolean {
+  const policy = matchPolicy(method, path);
+  return policy === undefined || authorize(policy, claims) === 0;
+}
+
+function satisfies(claims: Claims, policy: AuthPolicy): boolean {
+  if (policy.roles.length > 0 && !policy.roles.some((role) => claims.roles.includes(role))) {
+    return false;
+  }
+  return policy.scopes.every((scope) => claims.scopes.includes(scope));
+}
+`
+
+// exportTypeScript renders a TypeScript module with the policy map, keyed
+// by "METHOD path", and helpers that decide requests the way the generated
+// Go middleware does, so frontends can hide what a caller cannot do.
+func exportTypeScript(cfg *model.Config, _ Options) ([]File, error) {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by openapi-authz; DO NOT EDIT.\n\n")
+	buf.WriteString(tsTypes)
+
+	keys := sortedRoutes(cfg.Policies)
+	buf.WriteString("\nexport const policies: Readonly<Record<string, AuthPolicy>> = {\n")
+	for _, key := range keys {
+		name, err := json.Marshal(key.Method + " " + key.Path)
+		if err != nil {
+			return nil, err
+		}
+		policy, err := json.Marshal(newJSONPolicy(cfg.Policies[key]))
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "  %s: %s,\n", name, policy)
+	}
+	buf.WriteString("};\n")
+
+	keys = routesByPrecedence(cfg.Policies)
+	buf.WriteString("\nconst routes: readonly { method: string; path: string; pattern: RegExp }[] = [\n")
+	for _, key := range keys {
+		path, err := json.Marshal(key.Path)
+		if err != nil {
+			return nil, err
+		}
+		pattern, err := json.Marshal(pathRegex(key.Path))
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "  { method: %q, path: %s, pattern: new RegExp(%s) },\n", key.Method, path, pattern)
+	}
+	buf.WriteString("];\n")
+	buf.WriteString(tsHelpers)
+	return []File{{Name: "policies.ts", Data: buf.Bytes()}}, nil
+}
@@ -0,0 +1,166 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// conformanceSource replays Policies against a handler. It only depends on
+// the policy map, so it is the same for every spec and target.
+const conformanceSource = `
+// Identity is a caller RunConformance sends requests as.
+type Identity struct {
+	Roles  []string
+	Scopes []string
+}
+
+// ConformanceOptions configures RunConformance.
+type ConformanceOptions struct {
+	// Authenticate adds credentials for id to r, for example a signed
+	// token in the Authorization header. It is not called for anonymous
+	// requests.
+	Authenticate func(r *http.Request, id Identity)
+
+	// PathParam returns the value sent for the path parameter name of
+	// route. When nil, every parameter is "1".
+	PathParam func(route RouteKey, name string) string
+}
+
+// conformanceWrongRole is a role no policy grants.
+const conformanceWrongRole = "openapi-authz-conformance-wrong-role"
+
+var conformanceParam = regexp.MustCompile(` + "`" + `\{[^{}/]*\}|:[^/]+|\*[^/]*` + "`" + `)
+
+// RunConformance sends a request for every route in Policies to handler,
+// as an anonymous caller, as a caller lacking the route's roles and scopes,
+// and as one holding them, and checks each response. Rejections must be
+// 401 for anonymous callers and 403 otherwise; any other status counts as
+// allowed, since handlers may answer made-up path parameters with 404 or
+// 400. Routes the middleware does not reach fail as allowed where a
+// rejection is expected.
+func RunConformance(t *testing.T, handler http.Handler, opts ConformanceOptions) {
+	t.Helper()
+	keys := make([]RouteKey, 0, len(Policies))
+	for key := range Policies {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Path == keys[j].Path {
+			return keys[i].Method < keys[j].Method
+		}
+		return keys[i].Path < keys[j].Path
+	})
+
+	for _, key := range keys {
+		key, policy := key, Policies[key]
+		t.Run(key.Method+" "+key.Path, func(t *testing.T) {
+			path := conformanceParam.ReplaceAllStringFunc(key.Path, func(param string) string {
+				name := strings.Trim(param, "{}:*")
+				name = strings.TrimSuffix(name, "...")
+				if name == "$" {
+					return ""
+				}
+				if opts.PathParam != nil {
+					return opts.PathParam(key, name)
+				}
+				return "1"
+			})
+
+			send := func(id *Identity) int {
+				r := httptest.NewRequest(key.Method, path, nil)
+				if id != nil && opts.Authenticate != nil {
+					opts.Authenticate(r, *id)
+				}
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				return w.Code
+			}
+			check := func(name string, id *Identity, want int) {
+				t.Helper()
+				got := send(id)
+				switch {
+				case want == 0 && (got == http.StatusUnauthorized || got == http.StatusForbidden):
+					t.Errorf("%s: got %d, want the request allowed", name, got)
+				case want != 0 && got != want:
+					t.Errorf("%s: got %d, want %d", name, got, want)
+				}
+			}
+
+			holder := &Identity{Scopes: policy.Scopes}
+			if len(policy.Roles) > 0 {
+				holder.Roles = policy.Roles[:1]
+			}
+			if policy.Deny {
+				check("anonymous", nil, http.StatusForbidden)
+				check("authorized", holder, http.StatusForbidden)
+				return
+			}
+			switch policy.Mode() {
+			case AuthPublic:
+				check("anonymous", nil, 0)
+				return
+			case AuthOptional:
+				check("anonymous", nil, 0)
+			case AuthRequired:
+				check("anonymous", nil, http.StatusUnauthorized)
+			}
+			if len(policy.Roles) > 0 || len(policy.Scopes) > 0 {
+				wrong := &Identity{Roles: []string{conformanceWrongRole}}
+				if !conformanceSatisfied(policy, wrong) {
+					check("wrong role", wrong, http.StatusForbidden)
+				}
+			}
+			check("authorized", holder, 0)
+		})
+	}
+}
+
+// conformanceSatisfied reports whether id satisfies policy or one of its
+// Alternatives.
+func conformanceSatisfied(policy AuthPolicy, id *Identity) bool {
+	for _, p := range append([]AuthPolicy{policy}, policy.Alternatives...) {
+		ok := len(p.Roles) == 0
+		for _, role := range p.Roles {
+			for _, have := range id.Roles {
+				ok = ok || role == have
+			}
+		}
+		for _, scope := range p.Scopes {
+			found := false
+			for _, have := range id.Scopes {
+				found = found || scope == have
+			}
+			ok = ok && found
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+`
+
+// GenerateConformance produces a Go test file for the package written by
+// Generate with RunConformance, which replays every route of Policies
+// against a router to check that its middleware enforces them. The file
+// imports testing and net/http/httptest, so its name must end in _test.go.
+// Only opts.BuildTag, opts.Names and opts.NameSuffix apply.
+func GenerateConformance(pkg string, opts Options) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := writeBuildTag(&buf, opts.BuildTag); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&buf, "// Code generated by openapi-authz; DO NOT EDIT.\n")
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	writeImports(&buf, []string{"net/http", "net/http/httptest", "regexp", "sort", "strings", "testing"})
+	buf.WriteString(conformanceSource)
+
+	formatted, err := FormatSource(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated conformance harness: %w", err)
+	}
+	return renameSibling(formatted, pkg, &model.Config{}, opts)
+}
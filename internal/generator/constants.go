@@ -0,0 +1,134 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// rolesAndScopes returns every role and scope named by a policy of cfg, or
+// one of its alternatives, sorted.
+func rolesAndScopes(cfg *model.Config) (roles, scopes []string) {
+	seenRoles, seenScopes := make(map[string]bool), make(map[string]bool)
+	var add func(p model.AuthPolicy)
+	add = func(p model.AuthPolicy) {
+		for _, r := range p.Roles {
+			if !seenRoles[r] {
+				seenRoles[r] = true
+				roles = append(roles, r)
+			}
+		}
+		for _, s := range p.Scopes {
+			if !seenScopes[s] {
+				seenScopes[s] = true
+				scopes = append(scopes, s)
+			}
+		}
+		for _, alt := range p.Alternatives {
+			add(alt)
+		}
+	}
+	for _, policies := range []map[model.RouteKey]model.AuthPolicy{cfg.Policies, cfg.Webhooks, cfg.Callbacks} {
+		for _, p := range policies {
+			add(p)
+		}
+	}
+	sort.Strings(roles)
+	sort.Strings(scopes)
+	return roles, scopes
+}
+
+// constName turns value into an exported identifier with prefix, starting
+// a new word at every character that is not a letter or digit:
+// "vegetable:write" becomes ScopeVegetableWrite.
+func constName(prefix, value string) string {
+	var b strings.Builder
+	b.WriteString(prefix)
+	upper := true
+	for _, r := range value {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			upper = true
+		case upper:
+			b.WriteRune(unicode.ToUpper(r))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// writeConstants writes a Role constant per role and a Scope constant per
+// scope named by cfg. With typed, they have the types Role and Scope, which
+// come with AllRoles and AllScopes, Valid methods and ParseRole and
+// ParseScope. Two values mapping to the same name are an error.
+func writeConstants(buf *bytes.Buffer, cfg *model.Config, typed bool) error {
+	roles, scopes := rolesAndScopes(cfg)
+	for _, group := range []struct {
+		prefix, plural string
+		values         []string
+	}{
+		{"Role", "Roles", roles},
+		{"Scope", "Scopes", scopes},
+	} {
+		if len(group.values) == 0 && !typed {
+			continue
+		}
+		names := make([]string, len(group.values))
+		seen := make(map[string]string)
+		for i, v := range group.values {
+			names[i] = constName(group.prefix, v)
+			if prev, ok := seen[names[i]]; ok {
+				return fmt.Errorf("%s and %s both map to the constant %s", prev, v, names[i])
+			}
+			seen[names[i]] = v
+		}
+
+		typ := ""
+		if typed {
+			fmt.Fprintf(buf, "\n// %s is a %s named by the policies.\n", group.prefix, strings.ToLower(group.prefix))
+			fmt.Fprintf(buf, "type %s string\n", group.prefix)
+			typ = " " + group.prefix
+		}
+		if len(group.values) > 0 {
+			fmt.Fprintf(buf, "\n// %s named by the policies.\n", group.plural)
+			buf.WriteString("const (\n")
+			for i, v := range group.values {
+				fmt.Fprintf(buf, "\t%s%s = %q\n", names[i], typ, v)
+			}
+			buf.WriteString(")\n")
+		}
+		if !typed {
+			continue
+		}
+
+		fmt.Fprintf(buf, "\n// All%s returns every %s, sorted.\n", group.plural, group.prefix)
+		fmt.Fprintf(buf, "func All%s() []%s {\n", group.plural, group.prefix)
+		fmt.Fprintf(buf, "\treturn []%s{%s}\n", group.prefix, strings.Join(names, ", "))
+		buf.WriteString("}\n")
+
+		recv := strings.ToLower(group.prefix[:1])
+		fmt.Fprintf(buf, "\n// Valid reports whether %s is named by the policies.\n", recv)
+		fmt.Fprintf(buf, "func (%s %s) Valid() bool {\n", recv, group.prefix)
+		if len(names) > 0 {
+			fmt.Fprintf(buf, "\tswitch %s {\n", recv)
+			fmt.Fprintf(buf, "\tcase %s:\n", strings.Join(names, ", "))
+			buf.WriteString("\t\treturn true\n")
+			buf.WriteString("\t}\n")
+		}
+		buf.WriteString("\treturn false\n")
+		buf.WriteString("}\n")
+
+		fmt.Fprintf(buf, "\n// Parse%s returns s as a %s, and false if no policy names it.\n", group.prefix, group.prefix)
+		fmt.Fprintf(buf, "func Parse%s(s string) (%s, bool) {\n", group.prefix, group.prefix)
+		fmt.Fprintf(buf, "\tv := %s(s)\n", group.prefix)
+		buf.WriteString("\treturn v, v.Valid()\n")
+		buf.WriteString("}\n")
+	}
+	return nil
+}
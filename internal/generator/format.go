@@ -0,0 +1,140 @@
+package generator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SourceError reports generated code that is not valid Go. Source holds
+// the code as generated, before formatting.
+type SourceError struct {
+	Err    error
+	Source []byte
+}
+
+// sourceContext is the number of lines shown on each side of the line an
+// error points at.
+const sourceContext = 3
+
+// Error returns the error followed by the lines of Source around it.
+func (e *SourceError) Error() string {
+	line := 0
+	var list scanner.ErrorList
+	if errors.As(e.Err, &list) && len(list) > 0 {
+		line = list[0].Pos.Line
+	}
+	if line == 0 {
+		return e.Err.Error()
+	}
+
+	lines := strings.Split(string(e.Source), "\n")
+	var b strings.Builder
+	b.WriteString(e.Err.Error())
+	b.WriteString("\n")
+	for i := max(line-sourceContext, 1); i <= min(line+sourceContext, len(lines)); i++ {
+		marker := " "
+		if i == line {
+			marker = ">"
+		}
+		fmt.Fprintf(&b, "\n%s %4d | %s", marker, i, lines[i-1])
+	}
+	return b.String()
+}
+
+func (e *SourceError) Unwrap() error { return e.Err }
+
+// FormatSource removes the imports the Go file src does not use and formats
+// it like gofmt, which also sorts the remaining imports. Invalid Go is
+// reported as a *SourceError. Every Generate function formats its output
+// with it, except GenerateTemplate, whose output need not be Go.
+func FormatSource(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, &SourceError{Err: err, Source: src}
+	}
+
+	// Unused imports are removed line by line, so the rest of the source
+	// keeps its layout.
+	unused := make(map[int]bool)
+	used := usedPackages(file)
+	for _, spec := range file.Imports {
+		if name := importName(spec); name != "" && !used[name] {
+			unused[fset.Position(spec.Pos()).Line] = true
+		}
+	}
+	if len(unused) > 0 {
+		lines := bytes.Split(src, []byte("\n"))
+		kept := lines[:0]
+		for i, line := range lines {
+			if !unused[i+1] {
+				kept = append(kept, line)
+			}
+		}
+		src = bytes.Join(kept, []byte("\n"))
+	}
+
+	formatted, err := format.Source(src)
+	if err != nil {
+		return nil, &SourceError{Err: err, Source: src}
+	}
+	return formatted, nil
+}
+
+// usedPackages returns the identifiers file qualifies selectors with, which
+// include the names of the packages it uses.
+func usedPackages(file *ast.File) map[string]bool {
+	used := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok {
+				used[id.Name] = true
+			}
+		}
+		return true
+	})
+	return used
+}
+
+var (
+	majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+	gopkgVersion = regexp.MustCompile(`\.v[0-9]+$`)
+)
+
+// importName returns the name spec's package is referred to by: its
+// explicit name, or the last element of its path that is not a major
+// version ("github.com/labstack/echo/v4" is echo, "gopkg.in/yaml.v3" is
+// yaml). It returns "" for blank and dot imports, which are not referred to
+// by name, and for paths that do not end in an identifier, whose package
+// name cannot be told from the path.
+func importName(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		if spec.Name.Name == "_" || spec.Name.Name == "." {
+			return ""
+		}
+		return spec.Name.Name
+	}
+	p, err := strconv.Unquote(spec.Path.Value)
+	if err != nil {
+		return ""
+	}
+	name := path.Base(p)
+	if majorVersion.MatchString(name) && path.Dir(p) != "." {
+		name = path.Base(path.Dir(p))
+	}
+	name = gopkgVersion.ReplaceAllString(name, "")
+	if !token.IsIdentifier(name) {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,85 @@
+package generator
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+	"github.com/chr1sbest/openapi-authz/internal/parser"
+)
+
+// TemplateFuncs returns the functions GenerateTemplate makes available to
+// templates, in a new map callers may add to:
+//
+//   - camelCase, pascalCase and snakeCase turn a name such as
+//     "vegetable:write" or an operationId into an identifier:
+//     vegetableWrite, VegetableWrite, vegetable_write.
+//   - roleConst and scopeConst name the constants of Options.Constants:
+//     RoleAdmin, ScopeVegetableWrite.
+//   - routePattern converts an OpenAPI path template to the pattern syntax
+//     of a router (chi, gin, echo, fiber, gorilla or servemux):
+//     {{routePattern "gin" .Path}}.
+//   - quote returns a Go string literal, stringSlice a []string literal (or
+//     nil) and join joins a list with a separator.
+//   - policyFields returns the fields of a policy as written in the
+//     composite literals of the built-in output:
+//     AuthPolicy{ {{policyFields .AuthPolicy}} }.
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"camelCase":  camelCase,
+		"pascalCase": func(s string) string { return constName("", s) },
+		"snakeCase":  snakeCase,
+		"roleConst":  func(role string) string { return constName("Role", role) },
+		"scopeConst": func(scope string) string { return constName("Scope", scope) },
+		"routePattern": func(router, path string) (string, error) {
+			return parser.RoutePattern(path, router)
+		},
+		"quote":       strconv.Quote,
+		"stringSlice": stringSlice,
+		"join":        func(items []string, sep string) string { return strings.Join(items, sep) },
+		"policyFields": func(p model.AuthPolicy) string {
+			var buf bytes.Buffer
+			writePolicyFields(&buf, p)
+			return buf.String()
+		},
+	}
+}
+
+// camelCase is like constName without a prefix, but starts with a lower
+// case letter: "vegetable:write" becomes vegetableWrite.
+func camelCase(s string) string {
+	name := []rune(constName("", s))
+	if len(name) > 0 {
+		name[0] = unicode.ToLower(name[0])
+	}
+	return string(name)
+}
+
+// snakeCase lower-cases s and separates its words with "_", starting a new
+// word at every character that is not a letter or digit and at every upper
+// case letter following a lower case one: "getUser" becomes get_user.
+func snakeCase(s string) string {
+	var b strings.Builder
+	sep := false
+	prevLower := false
+	for _, r := range s {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			sep = true
+			prevLower = false
+			continue
+		case unicode.IsUpper(r) && prevLower:
+			sep = true
+		}
+		if sep && b.Len() > 0 {
+			b.WriteByte('_')
+		}
+		sep = false
+		prevLower = unicode.IsLower(r) || unicode.IsDigit(r)
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
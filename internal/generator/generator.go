@@ -3,38 +3,349 @@ package generator
 import (
 	"bytes"
 	"fmt"
-	"go/format"
+	"go/build/constraint"
 	"sort"
 	"strings"
+	"text/template"
 
 	"github.com/chr1sbest/openapi-authz/internal/model"
 )
 
+// Options controls optional generator behaviour. The zero value reproduces
+// the behaviour of Generate.
+type Options struct {
+	// Target selects middleware generated next to the policy map for a
+	// router or RPC framework (one of the Target* constants). Empty and
+	// TargetMap generate the policy map only.
+	Target string
+
+	// GRPCService names the fully-qualified gRPC service (e.g.
+	// "users.v1.UserService") that operations without an x-grpc-method are
+	// mapped to by operationId, for the RPC targets. "getUser" becomes
+	// "/users.v1.UserService/GetUser". When empty, only operations with an
+	// x-grpc-method are mapped.
+	GRPCService string
+
+	// Constants adds a Role constant for every role and a Scope constant for
+	// every scope the policies name, such as RoleAdmin = "admin" and
+	// ScopeVegetableWrite = "vegetable:write".
+	Constants bool
+
+	// TypedConstants gives the constants of Constants the types Role and
+	// Scope, with AllRoles, AllScopes, ParseRole, ParseScope and Valid
+	// methods, so roles and scopes cannot be mixed up. It implies
+	// Constants.
+	TypedConstants bool
+
+	// Claims adds the Claims interface, its StaticClaims implementation and
+	// the HasAnyRole and HasAllScopes helpers for hand-written middleware.
+	// Every Target other than TargetMap generates them regardless.
+	Claims bool
+
+	// ExemptPreflight lets CORS preflight requests (OPTIONS requests with
+	// Origin and Access-Control-Request-Method headers) through the
+	// middleware of the router targets without authorization, so browsers
+	// can negotiate CORS on protected routes. It only applies to those
+	// targets.
+	ExemptPreflight bool
+
+	// Version is the openapi-authz version recorded in the header of the
+	// generated file, next to the specs of Config.Sources and their
+	// hashes. It is left out when empty.
+	Version string
+
+	// BuildTag is a build constraint expression, such as "!generate",
+	// written as a //go:build line at the top of every generated file.
+	BuildTag string
+
+	// Lookup selects how LookupPolicy finds a route's policy: LookupMap
+	// (the default when empty) indexes Policies, LookupSwitch switches on
+	// method and path, which avoids hashing a RouteKey on every request.
+	// LookupPolicy is generated for LookupSwitch even without a Target.
+	Lookup string
+
+	// Matcher adds MatchRoute and MatchPolicy, which match concrete request
+	// paths such as "/users/42" to the route patterns of Policies, for code
+	// whose router does not report the matched pattern.
+	Matcher bool
+
+	// Registry adds a PolicyRegistry, Registry, with Get, Routes and
+	// PublicRoutes methods, and unexports Policies as policies unless
+	// Names renames it.
+	Registry bool
+
+	// Names renames generated top-level identifiers, keyed by their
+	// default name: {"Policies": "V2Policies", "AuthPolicy": "V2Policy"}.
+	// NameSuffix is appended to every other top-level identifier, so files
+	// generated from several specs can share a package. Both apply to
+	// every Go file generated with opts.
+	Names      map[string]string
+	NameSuffix string
+
+	// TemplateFuncs adds functions for GenerateTemplate's template to call,
+	// replacing those of TemplateFuncs with the same name.
+	TemplateFuncs template.FuncMap
+}
+
+// Ways LookupPolicy finds policies.
+const (
+	LookupMap    = "map"
+	LookupSwitch = "switch"
+)
+
 // Generate produces Go source code that defines RouteKey, AuthPolicy and a
 // Policies map initialized with the contents of cfg.
 func Generate(pkg string, cfg *model.Config) ([]byte, error) {
+	return GenerateWithOptions(pkg, cfg, Options{})
+}
+
+// GenerateWithOptions is like Generate but allows optional behaviour to be
+// enabled through opts.
+func GenerateWithOptions(pkg string, cfg *model.Config, opts Options) ([]byte, error) {
+	code, err := generate(pkg, cfg, opts, nil)
+	if err != nil || !opts.renaming() {
+		return code, err
+	}
+	names, err := newNames(opts, code)
+	if err != nil {
+		return nil, err
+	}
+	return renameSource(code, names)
+}
+
+// generate implements GenerateWithOptions. With groups, Policies joins the
+// maps of the groups, which are written to files of their own, rather than
+// listing every route.
+func generate(pkg string, cfg *model.Config, opts Options, groups []policyGroup) ([]byte, error) {
+	t, err := lookupTarget(opts.Target)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ExemptPreflight && (t == nil || !t.extractor) {
+		return nil, fmt.Errorf("exempting preflight requests needs a router target")
+	}
+	switch opts.Lookup {
+	case "", LookupMap:
+	case LookupSwitch:
+		if groups != nil {
+			return nil, fmt.Errorf("switch lookup cannot be split into groups")
+		}
+	default:
+		return nil, fmt.Errorf("unknown lookup %q (want %s or %s)", opts.Lookup, LookupMap, LookupSwitch)
+	}
+
 	var buf bytes.Buffer
 
+	if err := writeBuildTag(&buf, opts.BuildTag); err != nil {
+		return nil, err
+	}
 	fmt.Fprintf(&buf, "// Code generated by openapi-authz; DO NOT EDIT.\n")
+	writeProvenance(&buf, cfg.Sources, opts.Version)
 	fmt.Fprintf(&buf, "package %s\n\n", pkg)
 
+	var imports []string
+	if cfg.CaseInsensitivePaths || opts.Matcher {
+		imports = append(imports, "strings")
+	}
+	if cfg.CaseInsensitivePaths {
+		imports = append(imports, "unicode")
+	}
+	if t != nil {
+		imports = append(imports, t.imports...)
+	}
+	writeImports(&buf, imports)
+
 	buf.WriteString("type RouteKey struct {\n")
 	buf.WriteString("\tMethod string\n")
 	buf.WriteString("\tPath   string\n")
 	buf.WriteString("}\n\n")
 
 	buf.WriteString("type AuthPolicy struct {\n")
-	buf.WriteString("\tRequireAuth bool\n")
-	buf.WriteString("\tRoles       []string\n")
-	buf.WriteString("\tScopes      []string\n")
+	buf.WriteString("\tRequireAuth      bool\n")
+	buf.WriteString("\tOptionalAuth     bool\n")
+	buf.WriteString("\tRoles            []string\n")
+	buf.WriteString("\tScopes           []string\n")
+	buf.WriteString("\tSchemes          []string\n")
+	buf.WriteString("\tAPIKey           *APIKey\n")
+	buf.WriteString("\tSessionCookie    bool\n")
+	buf.WriteString("\tOpenIDConnectURL string\n")
+	buf.WriteString("\tMutualTLS        bool\n")
+	buf.WriteString("\tConditions       []string\n")
+	buf.WriteString("\tOwnerParam       string\n")
+	buf.WriteString("\tOperationID      string\n")
+	buf.WriteString("\tSummary          string\n")
+	buf.WriteString("\tDescription      string\n")
+	buf.WriteString("\tPathParams       []string\n")
+	buf.WriteString("\tPublicOverride   bool\n")
+	buf.WriteString("\tDeprecated       bool\n")
+	buf.WriteString("\tDeny             bool\n")
+	buf.WriteString("\tAlternatives     []AuthPolicy\n")
+	buf.WriteString("}\n\n")
+
+	buf.WriteString("// AuthMode says whether an operation needs authentication.\n")
+	buf.WriteString("type AuthMode string\n\n")
+	buf.WriteString("const (\n")
+	buf.WriteString("\tAuthPublic   AuthMode = \"public\"\n")
+	buf.WriteString("\tAuthOptional AuthMode = \"optional\"\n")
+	buf.WriteString("\tAuthRequired AuthMode = \"required\"\n")
+	buf.WriteString(")\n\n")
+	buf.WriteString("// Mode reports whether p is public, accepts optional authentication, or requires it.\n")
+	buf.WriteString("func (p AuthPolicy) Mode() AuthMode {\n")
+	buf.WriteString("\tswitch {\n")
+	buf.WriteString("\tcase p.RequireAuth:\n")
+	buf.WriteString("\t\treturn AuthRequired\n")
+	buf.WriteString("\tcase p.OptionalAuth:\n")
+	buf.WriteString("\t\treturn AuthOptional\n")
+	buf.WriteString("\tdefault:\n")
+	buf.WriteString("\t\treturn AuthPublic\n")
+	buf.WriteString("\t}\n")
+	buf.WriteString("}\n\n")
+
+	buf.WriteString("// APIKey locates an API key credential: In is \"header\", \"query\" or \"cookie\".\n")
+	buf.WriteString("type APIKey struct {\n")
+	buf.WriteString("\tName string\n")
+	buf.WriteString("\tIn   string\n")
 	buf.WriteString("}\n\n")
 
+	var keys []model.RouteKey
+	if opts.Lookup == LookupSwitch {
+		keys = writeRoutePolicies(&buf, cfg.Policies)
+	}
 	buf.WriteString("// Policies is derived from OpenAPI security requirements; see openapi-authz docs.\n")
-	buf.WriteString("var Policies = map[RouteKey]AuthPolicy{\n")
+	switch {
+	case groups != nil:
+		writeJoinedPolicies(&buf, groups)
+	case keys != nil:
+		writeIndexedPolicies(&buf, keys)
+	default:
+		writePolicyMap(&buf, "Policies", cfg.Policies)
+	}
+	if t != nil && t.writeMaps != nil {
+		if err := t.writeMaps(&buf, cfg, opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Constants || opts.TypedConstants {
+		if err := writeConstants(&buf, cfg, opts.TypedConstants); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case opts.Lookup == LookupSwitch:
+		writeSwitchLookup(&buf, keys, cfg.CaseInsensitivePaths)
+	case cfg.CaseInsensitivePaths:
+		buf.WriteString("\n// LookupPolicy returns the policy for method and route pattern. Route keys\n")
+		buf.WriteString("// were lower-cased, so path is matched case-insensitively.\n")
+		buf.WriteString("func LookupPolicy(method, path string) (AuthPolicy, bool) {\n")
+		buf.WriteString("\tpolicy, ok := Policies[RouteKey{Method: method, Path: lowerStaticPath(path)}]\n")
+		buf.WriteString("\treturn policy, ok\n")
+		buf.WriteString("}\n")
+	case opts.Registry || t != nil && t.lookup:
+		// Generated middleware looks policies up the same way either way.
+		buf.WriteString("\n// LookupPolicy returns the policy for method and route pattern.\n")
+		buf.WriteString("func LookupPolicy(method, path string) (AuthPolicy, bool) {\n")
+		buf.WriteString("\tpolicy, ok := Policies[RouteKey{Method: method, Path: path}]\n")
+		buf.WriteString("\treturn policy, ok\n")
+		buf.WriteString("}\n")
+	}
 
-	// Sort keys for deterministic output.
-	keys := make([]model.RouteKey, 0, len(cfg.Policies))
-	for k := range cfg.Policies {
+	if cfg.CaseInsensitivePaths {
+		buf.WriteString(lowerStaticPathSource)
+	}
+
+	if opts.Registry {
+		writeRegistry(&buf, cfg.Policies)
+	}
+	if opts.Matcher {
+		writeMatcher(&buf, cfg.CaseInsensitivePaths)
+	}
+
+	if len(cfg.SecuritySchemes) > 0 {
+		writeSecuritySchemes(&buf, cfg.SecuritySchemes)
+	}
+
+	if len(cfg.Webhooks) > 0 {
+		buf.WriteString("\n// WebhookPolicies is derived from the OpenAPI webhooks section. Path holds the\n")
+		buf.WriteString("// webhook name rather than a route pattern.\n")
+		writePolicyMap(&buf, "WebhookPolicies", cfg.Webhooks)
+	}
+
+	if len(cfg.Callbacks) > 0 {
+		buf.WriteString("\n// CallbackPolicies is derived from operation callbacks. Path holds the callback\n")
+		buf.WriteString("// URL expression rather than a route pattern.\n")
+		writePolicyMap(&buf, "CallbackPolicies", cfg.Callbacks)
+	}
+
+	if t != nil || opts.Claims {
+		buf.WriteString(claimsSource)
+	}
+	if t != nil {
+		buf.WriteString(authorizeSource)
+		if t.extractor {
+			buf.WriteString(extractorSource)
+			writeAuthorizeRequest(&buf, opts.ExemptPreflight)
+		}
+		buf.WriteString(t.source)
+	}
+
+	formatted, err := FormatSource(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w", err)
+	}
+	return formatted, nil
+}
+
+// writeBuildTag writes a //go:build line for the constraint expr, if any,
+// followed by the blank line that keeps it apart from the package comment.
+func writeBuildTag(buf *bytes.Buffer, expr string) error {
+	if expr == "" {
+		return nil
+	}
+	line := "//go:build " + expr
+	if _, err := constraint.Parse(line); err != nil {
+		return fmt.Errorf("invalid build tag %q: %w", expr, err)
+	}
+	buf.WriteString(line + "\n\n")
+	return nil
+}
+
+// writeProvenance writes the generator version and the spec and SHA-256 of
+// every source below the generated-code notice, so tooling and reviewers
+// can tell whether the file is stale.
+func writeProvenance(buf *bytes.Buffer, sources []model.Source, version string) {
+	if version == "" && len(sources) == 0 {
+		return
+	}
+	buf.WriteString("//\n")
+	if version != "" {
+		fmt.Fprintf(buf, "// Generator: openapi-authz %s\n", version)
+	}
+	for _, s := range sources {
+		spec := s.Spec
+		if spec == "" {
+			spec = "(in memory)"
+		}
+		fmt.Fprintf(buf, "// Spec: %s sha256:%s\n", spec, s.SHA256)
+	}
+}
+
+// writePolicyMap writes a map[RouteKey]AuthPolicy variable named name,
+// sorted by path and method for deterministic output.
+func writePolicyMap(buf *bytes.Buffer, name string, policies map[model.RouteKey]model.AuthPolicy) {
+	fmt.Fprintf(buf, "var %s = map[RouteKey]AuthPolicy{\n", name)
+	for _, k := range sortedKeys(policies) {
+		fmt.Fprintf(buf, "\t{Method: %q, Path: %q}: {", k.Method, k.Path)
+		writePolicyFields(buf, policies[k])
+		buf.WriteString("},\n")
+	}
+	buf.WriteString("}\n")
+}
+
+// sortedKeys returns the keys of policies sorted by path and method.
+func sortedKeys(policies map[model.RouteKey]model.AuthPolicy) []model.RouteKey {
+	keys := make([]model.RouteKey, 0, len(policies))
+	for k := range policies {
 		keys = append(keys, k)
 	}
 	sort.Slice(keys, func(i, j int) bool {
@@ -43,28 +354,196 @@ func Generate(pkg string, cfg *model.Config) ([]byte, error) {
 		}
 		return keys[i].Path < keys[j].Path
 	})
+	return keys
+}
 
-	for _, k := range keys {
-		p := cfg.Policies[k]
-		fmt.Fprintf(&buf, "\t{Method: %q, Path: %q}: {RequireAuth: %t", k.Method, k.Path, p.RequireAuth)
+// writePolicyFields writes the fields of p as the body of an AuthPolicy
+// composite literal, omitting zero values other than RequireAuth.
+func writePolicyFields(buf *bytes.Buffer, p model.AuthPolicy) {
+	fmt.Fprintf(buf, "RequireAuth: %t", p.RequireAuth)
+	if p.OptionalAuth {
+		buf.WriteString(", OptionalAuth: true")
+	}
 
-		if len(p.Roles) > 0 {
-			fmt.Fprintf(&buf, ", Roles: []string{%s}", quoteList(p.Roles))
+	if len(p.Roles) > 0 {
+		fmt.Fprintf(buf, ", Roles: []string{%s}", quoteList(p.Roles))
+	}
+	if len(p.Scopes) > 0 {
+		fmt.Fprintf(buf, ", Scopes: []string{%s}", quoteList(p.Scopes))
+	}
+	if len(p.Schemes) > 0 {
+		schemes := make([]string, len(p.Schemes))
+		for i, s := range p.Schemes {
+			schemes[i] = string(s)
 		}
-		if len(p.Scopes) > 0 {
-			fmt.Fprintf(&buf, ", Scopes: []string{%s}", quoteList(p.Scopes))
+		fmt.Fprintf(buf, ", Schemes: []string{%s}", quoteList(schemes))
+	}
+	if p.APIKey != nil {
+		fmt.Fprintf(buf, ", APIKey: &APIKey{Name: %q, In: %q}", p.APIKey.Name, p.APIKey.In)
+	}
+	if p.SessionCookie {
+		buf.WriteString(", SessionCookie: true")
+	}
+	if p.OpenIDConnectURL != "" {
+		fmt.Fprintf(buf, ", OpenIDConnectURL: %q", p.OpenIDConnectURL)
+	}
+	if p.MutualTLS {
+		buf.WriteString(", MutualTLS: true")
+	}
+	if len(p.Conditions) > 0 {
+		fmt.Fprintf(buf, ", Conditions: []string{%s}", quoteList(p.Conditions))
+	}
+	if p.OwnerParam != "" {
+		fmt.Fprintf(buf, ", OwnerParam: %q", p.OwnerParam)
+	}
+	if p.OperationID != "" {
+		fmt.Fprintf(buf, ", OperationID: %q", p.OperationID)
+	}
+	if p.Summary != "" {
+		fmt.Fprintf(buf, ", Summary: %q", p.Summary)
+	}
+	if p.Description != "" {
+		fmt.Fprintf(buf, ", Description: %q", p.Description)
+	}
+	if len(p.PathParams) > 0 {
+		fmt.Fprintf(buf, ", PathParams: []string{%s}", quoteList(p.PathParams))
+	}
+	if p.PublicOverride {
+		buf.WriteString(", PublicOverride: true")
+	}
+	if p.Deprecated {
+		buf.WriteString(", Deprecated: true")
+	}
+	if p.Deny {
+		buf.WriteString(", Deny: true")
+	}
+	if len(p.Alternatives) > 0 {
+		buf.WriteString(", Alternatives: []AuthPolicy{")
+		for i, alt := range p.Alternatives {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString("{")
+			writePolicyFields(buf, alt)
+			buf.WriteString("}")
 		}
+		buf.WriteString("}")
+	}
+}
 
-		buf.WriteString("},\n")
+// writeSecuritySchemes writes the SecurityScheme and OAuthFlow types and a
+// SecuritySchemes map describing every declared scheme, sorted by name.
+func writeSecuritySchemes(buf *bytes.Buffer, schemes map[string]model.SecurityScheme) {
+	buf.WriteString("\n// SecurityScheme describes how a declared security scheme transports credentials.\n")
+	buf.WriteString("type SecurityScheme struct {\n")
+	buf.WriteString("\tType             string\n")
+	buf.WriteString("\tDescription      string\n")
+	buf.WriteString("\tScheme           string\n")
+	buf.WriteString("\tBearerFormat     string\n")
+	buf.WriteString("\tName             string\n")
+	buf.WriteString("\tIn               string\n")
+	buf.WriteString("\tFlows            []OAuthFlow\n")
+	buf.WriteString("\tOpenIDConnectURL string\n")
+	buf.WriteString("}\n\n")
+
+	buf.WriteString("// OAuthFlow is one flow of an oauth2 security scheme.\n")
+	buf.WriteString("type OAuthFlow struct {\n")
+	buf.WriteString("\tType             string\n")
+	buf.WriteString("\tAuthorizationURL string\n")
+	buf.WriteString("\tTokenURL         string\n")
+	buf.WriteString("\tRefreshURL       string\n")
+	buf.WriteString("\tScopes           []string\n")
+	buf.WriteString("}\n\n")
+
+	names := make([]string, 0, len(schemes))
+	for name := range schemes {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
+	buf.WriteString("// SecuritySchemes is derived from components.securitySchemes, keyed by scheme name.\n")
+	buf.WriteString("var SecuritySchemes = map[string]SecurityScheme{\n")
+	for _, name := range names {
+		s := schemes[name]
+		fmt.Fprintf(buf, "\t%q: {Type: %q", name, s.Type)
+		for _, field := range []struct{ name, value string }{
+			{"Description", s.Description},
+			{"Scheme", s.Scheme},
+			{"BearerFormat", s.BearerFormat},
+			{"Name", s.Name},
+			{"In", s.In},
+			{"OpenIDConnectURL", s.OpenIDConnectURL},
+		} {
+			if field.value != "" {
+				fmt.Fprintf(buf, ", %s: %q", field.name, field.value)
+			}
+		}
+		if len(s.Flows) > 0 {
+			buf.WriteString(", Flows: []OAuthFlow{")
+			for i, f := range s.Flows {
+				if i > 0 {
+					buf.WriteString(", ")
+				}
+				fmt.Fprintf(buf, "{Type: %q", f.Type)
+				for _, field := range []struct{ name, value string }{
+					{"AuthorizationURL", f.AuthorizationURL},
+					{"TokenURL", f.TokenURL},
+					{"RefreshURL", f.RefreshURL},
+				} {
+					if field.value != "" {
+						fmt.Fprintf(buf, ", %s: %q", field.name, field.value)
+					}
+				}
+				if len(f.Scopes) > 0 {
+					fmt.Fprintf(buf, ", Scopes: []string{%s}", quoteList(f.Scopes))
+				}
+				buf.WriteString("}")
+			}
+			buf.WriteString("}")
+		}
+		buf.WriteString("},\n")
+	}
 	buf.WriteString("}\n")
+}
 
-	formatted, err := format.Source(buf.Bytes())
-	if err != nil {
-		return nil, fmt.Errorf("format generated code: %w", err)
+// writeImports writes an import declaration for paths, standard library
+// packages first.
+func writeImports(buf *bytes.Buffer, paths []string) {
+	switch len(paths) {
+	case 0:
+		return
+	case 1:
+		fmt.Fprintf(buf, "import %q\n\n", paths[0])
+		return
 	}
-	return formatted, nil
+
+	var std, other []string
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		if strings.Contains(strings.SplitN(p, "/", 2)[0], ".") {
+			other = append(other, p)
+		} else {
+			std = append(std, p)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+
+	buf.WriteString("import (\n")
+	for _, p := range std {
+		fmt.Fprintf(buf, "\t%q\n", p)
+	}
+	if len(std) > 0 && len(other) > 0 {
+		buf.WriteString("\n")
+	}
+	for _, p := range other {
+		fmt.Fprintf(buf, "\t%q\n", p)
+	}
+	buf.WriteString(")\n\n")
 }
 
 func quoteList(items []string) string {
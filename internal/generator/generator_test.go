@@ -1,20 +1,45 @@
 package generator
 
 import (
+	"errors"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"text/template"
 
 	"github.com/chr1sbest/openapi-authz/internal/model"
 )
 
 func TestGenerate_MatchesGolden(t *testing.T) {
 	cfg := &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
-		{Method: "GET", Path: "/public"}:   {RequireAuth: false},
-		{Method: "GET", Path: "/user"}:     {RequireAuth: true},
-		{Method: "DELETE", Path: "/admin"}: {RequireAuth: true, Roles: []string{"admin"}},
-		{Method: "POST", Path: "/scoped"}:  {RequireAuth: true, Scopes: []string{"vegetable:write"}},
+		{Method: "GET", Path: "/public"}:    {RequireAuth: false, PublicOverride: true},
+		{Method: "GET", Path: "/feed"}:      {OptionalAuth: true, Schemes: []model.SchemeType{model.SchemeBearer}},
+		{Method: "GET", Path: "/user"}:      {RequireAuth: true, Schemes: []model.SchemeType{model.SchemeBearer}, OperationID: "getUser", Summary: "Get the current user"},
+		{Method: "DELETE", Path: "/admin"}:  {RequireAuth: true, Roles: []string{"admin"}, Schemes: []model.SchemeType{model.SchemeBearer}},
+		{Method: "POST", Path: "/scoped"}:   {RequireAuth: true, Scopes: []string{"vegetable:write"}, Schemes: []model.SchemeType{model.SchemeBearer}},
+		{Method: "GET", Path: "/reports"}:   {RequireAuth: true, Schemes: []model.SchemeType{model.SchemeAPIKey}, APIKey: &model.APIKey{Name: "X-API-Key", In: "header"}},
+		{Method: "GET", Path: "/profile"}:   {RequireAuth: true, Schemes: []model.SchemeType{model.SchemeOpenIDConnect}, OpenIDConnectURL: "https://id.example.com/.well-known/openid-configuration"},
+		{Method: "POST", Path: "/payments"}: {RequireAuth: true, Schemes: []model.SchemeType{model.SchemeMutualTLS}, MutualTLS: true},
+		{Method: "GET", Path: "/reports/{id}"}: {
+			RequireAuth: true,
+			Schemes:     []model.SchemeType{model.SchemeBearer},
+			Alternatives: []model.AuthPolicy{
+				{RequireAuth: true, Schemes: []model.SchemeType{model.SchemeAPIKey}, APIKey: &model.APIKey{Name: "X-API-Key", In: "header"}},
+			},
+		},
+		{Method: "PUT", Path: "/users/{userId}"}: {
+			RequireAuth: true,
+			Roles:       []string{"member"},
+			Schemes:     []model.SchemeType{model.SchemeBearer},
+			Conditions:  []string{"tenant == claims.tenant"},
+			OwnerParam:  "userId",
+			PathParams:  []string{"userId"},
+		},
+		{Method: "GET", Path: "/dashboard"}: {RequireAuth: true, Schemes: []model.SchemeType{model.SchemeAPIKey}, APIKey: &model.APIKey{Name: "session", In: "cookie"}, SessionCookie: true},
+		{Method: "GET", Path: "/legacy"}:    {RequireAuth: true, Schemes: []model.SchemeType{model.SchemeBasic}, Deprecated: true, Deny: true},
 	}}
 
 	got, err := Generate("httproutes", cfg)
@@ -33,3 +58,965 @@ func TestGenerate_MatchesGolden(t *testing.T) {
 		t.Errorf("generated code does not match golden file.\nGot:\n%s\nWant:\n%s", string(got), string(want))
 	}
 }
+
+func TestGenerate_WebhooksAndCallbacks(t *testing.T) {
+	cfg := &model.Config{
+		Policies: map[model.RouteKey]model.AuthPolicy{
+			{Method: "GET", Path: "/public"}: {RequireAuth: false},
+		},
+		Webhooks: map[model.RouteKey]model.AuthPolicy{
+			{Method: "POST", Path: "newVegetable"}: {RequireAuth: true, Schemes: []model.SchemeType{model.SchemeBearer}},
+		},
+		Callbacks: map[model.RouteKey]model.AuthPolicy{
+			{Method: "POST", Path: "{$request.body#/callbackUrl}"}: {RequireAuth: false},
+		},
+	}
+
+	got, err := Generate("httproutes", cfg)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+
+	want := `{Method: "POST", Path: "newVegetable"}: {RequireAuth: true, Schemes: []string{"bearer"}},`
+	if !strings.Contains(string(got), "var WebhookPolicies = map[RouteKey]AuthPolicy{") || !strings.Contains(string(got), want) {
+		t.Errorf("expected WebhookPolicies in generated code, got:\n%s", got)
+	}
+	if !strings.Contains(string(got), "var CallbackPolicies = map[RouteKey]AuthPolicy{") {
+		t.Errorf("expected CallbackPolicies in generated code, got:\n%s", got)
+	}
+}
+
+func TestGenerate_CaseInsensitivePaths(t *testing.T) {
+	cfg := &model.Config{
+		Policies: map[model.RouteKey]model.AuthPolicy{
+			{Method: "GET", Path: "/users"}: {RequireAuth: true},
+		},
+		CaseInsensitivePaths: true,
+	}
+
+	got, err := Generate("httproutes", cfg)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	for _, want := range []string{"\t\"strings\"\n\t\"unicode\"\n", "func LookupPolicy(method, path string) (AuthPolicy, bool) {", "lowerStaticPath(path)", "func lowerStaticPath(path string) string {"} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("expected %q in generated code, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestGenerate_SecuritySchemes(t *testing.T) {
+	cfg := &model.Config{
+		Policies: map[model.RouteKey]model.AuthPolicy{},
+		SecuritySchemes: map[string]model.SecurityScheme{
+			"BearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			"OAuth2": {Type: "oauth2", Flows: []model.OAuthFlow{
+				{Type: "clientCredentials", TokenURL: "https://auth.example.com/token", Scopes: []string{"vegetable:read"}},
+			}},
+		},
+	}
+
+	got, err := Generate("httproutes", cfg)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	for _, want := range []string{
+		`"BearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},`,
+		`"OAuth2":     {Type: "oauth2", Flows: []OAuthFlow{{Type: "clientCredentials", TokenURL: "https://auth.example.com/token", Scopes: []string{"vegetable:read"}}}},`,
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("expected %q in generated code, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestGenerate_GinTarget(t *testing.T) {
+	cfg := &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
+		{Method: "GET", Path: "/users/:id"}: {RequireAuth: true, Roles: []string{"admin"}},
+	}}
+
+	got, err := GenerateWithOptions("httproutes", cfg, Options{Target: TargetGin})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	for _, want := range []string{
+		`"github.com/gin-gonic/gin"`,
+		"func LookupPolicy(method, path string) (AuthPolicy, bool) {",
+		"func Authorize(policy AuthPolicy, claims Claims) int {",
+		"type ClaimsExtractor func(r *http.Request) (Claims, error)",
+		"func AuthorizeRequest(policy AuthPolicy, r *http.Request, extract ClaimsExtractor) int {",
+		"func AuthPolicyMiddleware(extract ClaimsExtractor) gin.HandlerFunc {",
+		"AuthorizeRequest(policy, c.Request, extract)",
+		"LookupPolicy(c.Request.Method, c.FullPath())",
+		"c.AbortWithStatus(status)",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("expected %q in generated code, got:\n%s", want, got)
+		}
+	}
+
+	if _, err := GenerateWithOptions("httproutes", cfg, Options{Target: "martini"}); err == nil {
+		t.Errorf("expected error for unknown target")
+	}
+}
+
+func TestGenerate_EchoTarget(t *testing.T) {
+	cfg := &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
+		{Method: "GET", Path: "/users/:id"}: {RequireAuth: true},
+	}}
+
+	got, err := GenerateWithOptions("httproutes", cfg, Options{Target: TargetEcho})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	for _, want := range []string{
+		`"github.com/labstack/echo/v4"`,
+		"func AuthPolicyMiddleware(extract ClaimsExtractor) echo.MiddlewareFunc {",
+		"AuthorizeRequest(policy, c.Request(), extract)",
+		"LookupPolicy(c.Request().Method, c.Path())",
+		"return echo.NewHTTPError(status)",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("expected %q in generated code, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestGenerate_FiberTarget(t *testing.T) {
+	cfg := &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
+		{Method: "GET", Path: "/users/:id"}: {RequireAuth: true},
+	}}
+
+	got, err := GenerateWithOptions("httproutes", cfg, Options{Target: TargetFiber})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	for _, want := range []string{
+		`"github.com/gofiber/fiber/v2"`,
+		`"github.com/gofiber/fiber/v2/middleware/adaptor"`,
+		"func AuthPolicyMiddleware(extract ClaimsExtractor) fiber.Handler {",
+		"adaptor.ConvertRequest(c, false)",
+		"LookupPolicy(c.Method(), c.Route().Path)",
+		"return fiber.NewError(status)",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("expected %q in generated code, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestGenerate_GorillaTarget(t *testing.T) {
+	cfg := &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
+		{Method: "GET", Path: "/users/{id}"}: {RequireAuth: true},
+	}}
+
+	got, err := GenerateWithOptions("httproutes", cfg, Options{Target: TargetGorilla})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	for _, want := range []string{
+		`"github.com/gorilla/mux"`,
+		"func AuthPolicyMiddleware(extract ClaimsExtractor) mux.MiddlewareFunc {",
+		"mux.CurrentRoute(r)",
+		"LookupPolicy(r.Method, stripVarPatterns(tpl))",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("expected %q in generated code, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestGenerate_ServeMuxTarget(t *testing.T) {
+	cfg := &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
+		{Method: "GET", Path: "/users/{id}"}: {RequireAuth: true, Roles: []string{"admin"}},
+	}}
+
+	got, err := GenerateWithOptions("httproutes", cfg, Options{Target: TargetServeMux})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	for _, want := range []string{
+		"var PatternPolicies = map[string]AuthPolicy{",
+		`"GET /users/{id}": {RequireAuth: true, Roles: []string{"admin"}},`,
+		"func AuthPolicyMiddleware(extract ClaimsExtractor) func(http.Handler) http.Handler {",
+		"patternPolicy(r.Pattern)",
+		"\tpolicy, ok := PatternPolicies[pattern]\n",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("expected %q in generated code, got:\n%s", want, got)
+		}
+	}
+}
+
+// serveMuxCaseTest registers a route with another casing than the spec and
+// a parameter name in mixed case, as handlers written against the spec do.
+const serveMuxCaseTest = `package httproutes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMixedCasePattern(t *testing.T) {
+	mw := AuthPolicyMiddleware(func(*http.Request) (Claims, error) { return nil, nil })
+	mux := http.NewServeMux()
+	mux.Handle("GET /Users/{userId}", mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.PathValue("userId")))
+	})))
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/Users/42", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("got %d, want 401", w.Code)
+	}
+}
+`
+
+func TestGenerate_ServeMuxCaseInsensitivePaths(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the generated package")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+
+	cfg := &model.Config{
+		Policies: map[model.RouteKey]model.AuthPolicy{
+			{Method: "GET", Path: "/users/{userId}"}: {RequireAuth: true, PathParams: []string{"userId"}},
+		},
+		CaseInsensitivePaths: true,
+	}
+	code, err := GenerateWithOptions("httproutes", cfg, Options{Target: TargetServeMux})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	if want := "PatternPolicies[method+\" \"+lowerStaticPath(path)]"; !strings.Contains(string(code), want) {
+		t.Errorf("expected %q in generated code, got:\n%s", want, code)
+	}
+
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"go.mod":        "module httproutes\n\ngo 1.23\n",
+		"authz.go":      string(code),
+		"authz_test.go": serveMuxCaseTest,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command(gobin, "test", "./...")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOWORK=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("generated middleware let a mixed-case pattern through: %v\n%s", err, out)
+	}
+}
+
+func TestGenerate_GRPCTarget(t *testing.T) {
+	cfg := &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
+		{Method: "GET", Path: "/v1/users/{id}"}:    {RequireAuth: true, OperationID: "getUser", GRPCMethod: "/users.v1.UserService/GetUser"},
+		{Method: "DELETE", Path: "/v1/users/{id}"}: {RequireAuth: true, Roles: []string{"admin"}, OperationID: "deleteUser"},
+		{Method: "GET", Path: "/health"}:           {RequireAuth: false},
+	}}
+
+	got, err := GenerateWithOptions("httproutes", cfg, Options{Target: TargetGRPC, GRPCService: "users.v1.UserService"})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	for _, want := range []string{
+		`"google.golang.org/grpc/status"`,
+		`"/users.v1.UserService/DeleteUser": {RequireAuth: true, Roles: []string{"admin"}, OperationID: "deleteUser"},`,
+		`"/users.v1.UserService/GetUser":    {RequireAuth: true, OperationID: "getUser"},`,
+		"func UnaryServerInterceptor(claims func(context.Context) Claims) grpc.UnaryServerInterceptor {",
+		"func StreamServerInterceptor(claims func(context.Context) Claims) grpc.StreamServerInterceptor {",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("expected %q in generated code, got:\n%s", want, got)
+		}
+	}
+
+	// Without a service only x-grpc-method is mapped.
+	got, err = GenerateWithOptions("httproutes", cfg, Options{Target: TargetGRPC})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	if strings.Contains(string(got), "DeleteUser") {
+		t.Errorf("expected DeleteUser to be unmapped without a service, got:\n%s", got)
+	}
+
+	cfg.Policies[model.RouteKey{Method: "GET", Path: "/v2/users/{id}"}] = model.AuthPolicy{GRPCMethod: "/users.v1.UserService/GetUser"}
+	if _, err := GenerateWithOptions("httproutes", cfg, Options{Target: TargetGRPC}); err == nil || !strings.Contains(err.Error(), "GET /v1/users/{id} and GET /v2/users/{id}") {
+		t.Errorf("expected duplicate method error, got %v", err)
+	}
+}
+
+func TestGenerate_ConnectTarget(t *testing.T) {
+	cfg := &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
+		{Method: "GET", Path: "/v1/users/{id}"}: {RequireAuth: true, GRPCMethod: "/users.v1.UserService/GetUser"},
+	}}
+
+	got, err := GenerateWithOptions("httproutes", cfg, Options{Target: TargetConnect})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	for _, want := range []string{
+		`"connectrpc.com/connect"`,
+		`"/users.v1.UserService/GetUser": {RequireAuth: true},`,
+		"func NewAuthPolicyInterceptor(claims func(context.Context) Claims) *AuthPolicyInterceptor {",
+		"func (i *AuthPolicyInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {",
+		"func (i *AuthPolicyInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("expected %q in generated code, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestGenerate_GraphQLTarget(t *testing.T) {
+	cfg := &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
+		{Method: "GET", Path: "/users/{id}"}:    {RequireAuth: true, GraphQLField: "Query.user"},
+		{Method: "DELETE", Path: "/users/{id}"}: {RequireAuth: true, Roles: []string{"admin"}, GraphQLField: "Mutation.deleteUser"},
+		{Method: "GET", Path: "/health"}:        {RequireAuth: false},
+	}}
+
+	got, err := GenerateWithOptions("httproutes", cfg, Options{Target: TargetGraphQL})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	for _, want := range []string{
+		`"github.com/99designs/gqlgen/graphql"`,
+		"var FieldPolicies = map[string]AuthPolicy{\n\t\"Mutation.deleteUser\": {RequireAuth: true, Roles: []string{\"admin\"}},\n\t\"Query.user\":          {RequireAuth: true},\n}",
+		"func AuthorizeField(field string, claims Claims) error {",
+		"func AuthDirective(claims func(context.Context) Claims) func(ctx context.Context, obj any, next graphql.Resolver) (any, error) {",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("expected %q in generated code, got:\n%s", want, got)
+		}
+	}
+
+	cfg.Policies[model.RouteKey{Method: "GET", Path: "/v2/users/{id}"}] = model.AuthPolicy{GraphQLField: "Query.user"}
+	if _, err := GenerateWithOptions("httproutes", cfg, Options{Target: TargetGraphQL}); err == nil || !strings.Contains(err.Error(), "GET /users/{id} and GET /v2/users/{id}") {
+		t.Errorf("expected duplicate field error, got %v", err)
+	}
+}
+
+func TestGenerateTest(t *testing.T) {
+	cfg := &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
+		{Method: "GET", Path: "/public"}:   {RequireAuth: false},
+		{Method: "GET", Path: "/feed"}:     {OptionalAuth: true},
+		{Method: "DELETE", Path: "/admin"}: {RequireAuth: true, Roles: []string{"admin"}, Scopes: []string{"admin:write"}},
+		{Method: "GET", Path: "/legacy"}:   {RequireAuth: true, Deny: true},
+	}}
+
+	got, err := GenerateTest("httproutes", cfg, Options{})
+	if err != nil {
+		t.Fatalf("GenerateTest error: %v", err)
+	}
+
+	for _, want := range []string{
+		"package httproutes\n\nimport \"testing\"\n",
+		"func TestPolicies(t *testing.T) {",
+		`{RouteKey{Method: "DELETE", Path: "/admin"}, true, false, false, []string{"admin"}, []string{"admin:write"}},`,
+		`{RouteKey{Method: "GET", Path: "/feed"}, false, true, false, nil, nil},`,
+		`{RouteKey{Method: "GET", Path: "/legacy"}, true, false, true, nil, nil},`,
+		"if len(Policies) != len(tests) {",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("expected %q in generated test, got:\n%s", want, got)
+		}
+	}
+	if strings.Index(string(got), `Path: "/admin"`) > strings.Index(string(got), `Path: "/public"`) {
+		t.Errorf("expected routes sorted by path")
+	}
+}
+
+func TestGenerateConformance(t *testing.T) {
+	got, err := GenerateConformance("httproutes", Options{})
+	if err != nil {
+		t.Fatalf("GenerateConformance error: %v", err)
+	}
+
+	for _, want := range []string{
+		"package httproutes\n",
+		"\t\"net/http/httptest\"\n",
+		"func RunConformance(t *testing.T, handler http.Handler, opts ConformanceOptions) {",
+		"check(\"anonymous\", nil, http.StatusUnauthorized)",
+		"check(\"wrong role\", wrong, http.StatusForbidden)",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("expected %q in generated harness, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestGenerate_Constants(t *testing.T) {
+	cfg := &model.Config{
+		Policies: map[model.RouteKey]model.AuthPolicy{
+			{Method: "DELETE", Path: "/admin"}: {RequireAuth: true, Roles: []string{"super-admin", "admin"}},
+			{Method: "POST", Path: "/scoped"}: {
+				RequireAuth:  true,
+				Scopes:       []string{"vegetable:write"},
+				Alternatives: []model.AuthPolicy{{RequireAuth: true, Roles: []string{"gardener"}}},
+			},
+		},
+		Webhooks: map[model.RouteKey]model.AuthPolicy{
+			{Method: "POST", Path: "newVegetable"}: {RequireAuth: true, Scopes: []string{"hooks.send"}},
+		},
+	}
+
+	got, err := GenerateWithOptions("httproutes", cfg, Options{Constants: true})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	want := "// Roles named by the policies.\nconst (\n\tRoleAdmin      = \"admin\"\n\tRoleGardener   = \"gardener\"\n\tRoleSuperAdmin = \"super-admin\"\n)\n\n" +
+		"// Scopes named by the policies.\nconst (\n\tScopeHooksSend      = \"hooks.send\"\n\tScopeVegetableWrite = \"vegetable:write\"\n)\n"
+	if !strings.Contains(string(got), want) {
+		t.Errorf("expected constants %q in generated code, got:\n%s", want, got)
+	}
+
+	plain, err := Generate("httproutes", cfg)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	if strings.Contains(string(plain), "RoleAdmin") {
+		t.Errorf("expected no constants without Options.Constants")
+	}
+
+	cfg.Policies[model.RouteKey{Method: "GET", Path: "/x"}] = model.AuthPolicy{RequireAuth: true, Roles: []string{"super_admin"}}
+	if _, err := GenerateWithOptions("httproutes", cfg, Options{Constants: true}); err == nil || !strings.Contains(err.Error(), "RoleSuperAdmin") {
+		t.Errorf("expected an error for colliding constant names, got %v", err)
+	}
+}
+
+func TestGenerate_TypedConstants(t *testing.T) {
+	cfg := &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
+		{Method: "DELETE", Path: "/admin"}: {RequireAuth: true, Roles: []string{"admin", "owner"}},
+		{Method: "GET", Path: "/public"}:   {RequireAuth: false},
+	}}
+
+	got, err := GenerateWithOptions("httproutes", cfg, Options{TypedConstants: true})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	for _, want := range []string{
+		"type Role string\n",
+		"const (\n\tRoleAdmin Role = \"admin\"\n\tRoleOwner Role = \"owner\"\n)\n",
+		"func AllRoles() []Role {\n\treturn []Role{RoleAdmin, RoleOwner}\n}\n",
+		"func (r Role) Valid() bool {\n\tswitch r {\n\tcase RoleAdmin, RoleOwner:\n\t\treturn true\n\t}\n\treturn false\n}\n",
+		"func ParseRole(s string) (Role, bool) {\n\tv := Role(s)\n\treturn v, v.Valid()\n}\n",
+		"type Scope string\n",
+		"func AllScopes() []Scope {\n\treturn []Scope{}\n}\n",
+		"func (s Scope) Valid() bool {\n\treturn false\n}\n",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("expected %q in generated code, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestGenerate_Claims(t *testing.T) {
+	cfg := &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
+		{Method: "GET", Path: "/public"}: {RequireAuth: false},
+	}}
+
+	got, err := GenerateWithOptions("httproutes", cfg, Options{Claims: true})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	for _, want := range []string{
+		"type Claims interface {\n\t// Subject identifies the caller, such as a token's sub claim.\n\tSubject() string\n",
+		"\tScheme() string\n\tHasRole(role string) bool\n\tHasScope(scope string) bool\n}\n",
+		"type StaticClaims struct {\n\tSub        string\n\tAuthScheme string\n\tRoles      []string\n\tScopes     []string\n}\n",
+		"func HasAnyRole(claims Claims, roles ...string) bool {",
+		"func HasAllScopes(claims Claims, scopes ...string) bool {",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("expected %q in generated code, got:\n%s", want, got)
+		}
+	}
+	if strings.Contains(string(got), "func Authorize(") {
+		t.Errorf("expected no Authorize without a target")
+	}
+}
+
+const authorizeSchemeTest = `package httproutes
+
+import "testing"
+
+func TestAuthorizeScheme(t *testing.T) {
+	policy := Policies[RouteKey{Method: "GET", Path: "/users"}]
+	for _, tt := range []struct {
+		claims *StaticClaims
+		want   int
+	}{
+		{&StaticClaims{AuthScheme: "oauth2"}, 403},
+		{&StaticClaims{AuthScheme: "oauth2", Scopes: []string{"users:read"}}, 0},
+		{&StaticClaims{AuthScheme: "apiKey"}, 0},
+		{&StaticClaims{AuthScheme: "basic"}, 403},
+	} {
+		if got := Authorize(policy, tt.claims); got != tt.want {
+			t.Errorf("Authorize(%+v) = %d, want %d", tt.claims, got, tt.want)
+		}
+	}
+}
+`
+
+func TestGenerate_AuthorizeScheme(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the generated package")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+
+	// security: [{oauth2: [users:read]}, {ApiKey: []}]
+	cfg := &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
+		{Method: "GET", Path: "/users"}: {
+			RequireAuth: true, Scopes: []string{"users:read"}, Schemes: []model.SchemeType{model.SchemeOAuth2},
+			Alternatives: []model.AuthPolicy{{RequireAuth: true, Schemes: []model.SchemeType{model.SchemeAPIKey}}},
+		},
+	}}
+	code, err := GenerateWithOptions("httproutes", cfg, Options{Target: TargetServeMux})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"go.mod":        "module httproutes\n\ngo 1.23\n",
+		"authz.go":      string(code),
+		"authz_test.go": authorizeSchemeTest,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command(gobin, "test", "./...")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOWORK=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("generated Authorize ignored the caller's scheme: %v\n%s", err, out)
+	}
+}
+
+func TestGenerate_ExemptPreflight(t *testing.T) {
+	cfg := &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
+		{Method: "OPTIONS", Path: "/users/{id}"}: {RequireAuth: true},
+	}}
+
+	got, err := GenerateWithOptions("httproutes", cfg, Options{Target: TargetServeMux, ExemptPreflight: true})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	for _, want := range []string{
+		"func AuthorizeRequest(policy AuthPolicy, r *http.Request, extract ClaimsExtractor) int {\n\tif isPreflight(r) {\n\t\treturn 0\n\t}\n",
+		`return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" && r.Header.Get("Access-Control-Request-Method") != ""`,
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("expected %q in generated code, got:\n%s", want, got)
+		}
+	}
+
+	got, err = GenerateWithOptions("httproutes", cfg, Options{Target: TargetServeMux})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	if strings.Contains(string(got), "isPreflight") {
+		t.Errorf("expected no preflight check without ExemptPreflight")
+	}
+
+	for _, target := range []string{TargetMap, TargetGRPC} {
+		if _, err := GenerateWithOptions("httproutes", cfg, Options{Target: target, ExemptPreflight: true}); err == nil {
+			t.Errorf("expected error for ExemptPreflight with target %s", target)
+		}
+	}
+}
+
+func TestGenerate_Provenance(t *testing.T) {
+	cfg := &model.Config{
+		Policies: map[model.RouteKey]model.AuthPolicy{
+			{Method: "GET", Path: "/public"}: {RequireAuth: false},
+		},
+		Sources: []model.Source{
+			{Spec: "users.yaml", SHA256: "aa"},
+			{SHA256: "bb"},
+		},
+	}
+
+	got, err := GenerateWithOptions("httproutes", cfg, Options{Version: "v1.2.3"})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	want := "// Code generated by openapi-authz; DO NOT EDIT.\n" +
+		"//\n" +
+		"// Generator: openapi-authz v1.2.3\n" +
+		"// Spec: users.yaml sha256:aa\n" +
+		"// Spec: (in memory) sha256:bb\n" +
+		"package httproutes\n"
+	if !strings.HasPrefix(string(got), want) {
+		t.Errorf("expected header %q, got:\n%s", want, got)
+	}
+}
+
+func TestFormatSource(t *testing.T) {
+	src := "package p\n\nimport (\n\t\"strings\"\n\t\"net/http\"\n\t_ \"embed\"\n\n\t\"github.com/labstack/echo/v4\"\n\t\"gopkg.in/yaml.v3\"\n)\n\nvar _ = http.StatusOK\nvar _ echo.Context\nvar _ = yaml.Marshal\n"
+	got, err := FormatSource([]byte(src))
+	if err != nil {
+		t.Fatalf("FormatSource error: %v", err)
+	}
+	want := "package p\n\nimport (\n\t_ \"embed\"\n\t\"net/http\"\n\n\t\"github.com/labstack/echo/v4\"\n\t\"gopkg.in/yaml.v3\"\n)\n\nvar _ = http.StatusOK\nvar _ echo.Context\nvar _ = yaml.Marshal\n"
+	if string(got) != want {
+		t.Errorf("expected unused import removed and imports sorted:\n%s\ngot:\n%s", want, got)
+	}
+
+	src = "package p\n\nfunc f() {\n\treturn 1 +\n}\n"
+	_, err = FormatSource([]byte(src))
+	var srcErr *SourceError
+	if !errors.As(err, &srcErr) || string(srcErr.Source) != src {
+		t.Fatalf("expected *SourceError with the source, got %v", err)
+	}
+	if !strings.Contains(err.Error(), ">    5 | }") || !strings.Contains(err.Error(), "     4 | \treturn 1 +") {
+		t.Errorf("expected error to quote the source around the error, got:\n%s", err)
+	}
+}
+
+func TestGenerate_BuildTag(t *testing.T) {
+	cfg := &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
+		{Method: "GET", Path: "/public"}: {RequireAuth: false},
+	}}
+	opts := Options{BuildTag: "!generate && linux"}
+
+	code, err := GenerateWithOptions("httproutes", cfg, opts)
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	test, err := GenerateTest("httproutes", cfg, opts)
+	if err != nil {
+		t.Fatalf("GenerateTest error: %v", err)
+	}
+	harness, err := GenerateConformance("httproutes", opts)
+	if err != nil {
+		t.Fatalf("GenerateConformance error: %v", err)
+	}
+	want := "//go:build !generate && linux\n\n// Code generated by openapi-authz; DO NOT EDIT.\n"
+	for name, got := range map[string][]byte{"code": code, "test": test, "conformance harness": harness} {
+		if !strings.HasPrefix(string(got), want) {
+			t.Errorf("expected %s to start with %q, got:\n%s", name, want, got)
+		}
+	}
+
+	if _, err := GenerateWithOptions("httproutes", cfg, Options{BuildTag: "!generate &&"}); err == nil || !strings.Contains(err.Error(), "invalid build tag") {
+		t.Errorf("expected invalid build tag error, got %v", err)
+	}
+}
+
+func TestGenerate_SwitchLookup(t *testing.T) {
+	cfg := &model.Config{
+		Policies: map[model.RouteKey]model.AuthPolicy{
+			{Method: "GET", Path: "/users"}:    {RequireAuth: true},
+			{Method: "DELETE", Path: "/users"}: {RequireAuth: true, Roles: []string{"admin"}},
+			{Method: "GET", Path: "/healthz"}:  {RequireAuth: false},
+		},
+		CaseInsensitivePaths: true,
+	}
+	code, err := GenerateWithOptions("httproutes", cfg, Options{Lookup: LookupSwitch})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	for _, want := range []string{
+		"\t// 0: GET /healthz\n\t{RequireAuth: false},\n",
+		"{Method: \"DELETE\", Path: \"/users\"}: routePolicies[1],",
+		"\tpath = lowerStaticPath(path)\n\tswitch method {\n\tcase \"DELETE\":\n\t\tswitch path {\n\t\tcase \"/users\":\n\t\t\treturn routePolicies[1], true\n",
+		"\tcase \"GET\":\n\t\tswitch path {\n\t\tcase \"/healthz\":\n\t\t\treturn routePolicies[0], true\n\t\tcase \"/users\":\n\t\t\treturn routePolicies[2], true\n",
+	} {
+		if !strings.Contains(string(code), want) {
+			t.Errorf("expected generated code to contain %q, got:\n%s", want, code)
+		}
+	}
+	if strings.Contains(string(code), "Policies[RouteKey{") {
+		t.Errorf("expected LookupPolicy not to index Policies, got:\n%s", code)
+	}
+
+	if _, err := GenerateWithOptions("httproutes", cfg, Options{Lookup: "hash"}); err == nil || !strings.Contains(err.Error(), "unknown lookup") {
+		t.Errorf("expected unknown lookup error, got %v", err)
+	}
+	if _, _, err := GenerateSplit("httproutes", cfg, Options{Lookup: LookupSwitch}, SplitPath); err == nil {
+		t.Error("expected error splitting switch lookup")
+	}
+}
+
+func TestGenerate_Matcher(t *testing.T) {
+	cfg := &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
+		{Method: "GET", Path: "/users/{id}"}: {RequireAuth: true},
+	}}
+	code, err := GenerateWithOptions("httproutes", cfg, Options{Matcher: true})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	for _, want := range []string{
+		"import \"strings\"",
+		"var routeTree = newRouteTree(Policies)",
+		"func MatchRoute(method, path string) (RouteKey, []string, bool) {",
+		"func MatchPolicy(method, path string) (AuthPolicy, bool) {",
+		"n.static[seg]; ok {",
+	} {
+		if !strings.Contains(string(code), want) {
+			t.Errorf("expected generated code to contain %q, got:\n%s", want, code)
+		}
+	}
+
+	cfg.CaseInsensitivePaths = true
+	code, err = GenerateWithOptions("httproutes", cfg, Options{Matcher: true})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	if want := "n.static[strings.ToLower(seg)]; ok {"; !strings.Contains(string(code), want) {
+		t.Errorf("expected generated code to contain %q, got:\n%s", want, code)
+	}
+}
+
+func TestGenerate_Names(t *testing.T) {
+	cfg := &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
+		{Method: "GET", Path: "/users"}: {RequireAuth: true, APIKey: &model.APIKey{Name: "X-API-Key", In: "header"}},
+	}}
+	opts := Options{
+		Target:     TargetGin,
+		Names:      map[string]string{"Policies": "V2Policies", "AuthPolicyMiddleware": "V2Middleware"},
+		NameSuffix: "V2",
+	}
+
+	code, err := GenerateWithOptions("httproutes", cfg, opts)
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	for _, want := range []string{
+		"type AuthPolicyV2 struct {",
+		"\tAPIKey           *APIKeyV2\n",
+		"// V2Policies is derived from OpenAPI security requirements",
+		"var V2Policies = map[RouteKeyV2]AuthPolicyV2{",
+		"{Method: \"GET\", Path: \"/users\"}: {RequireAuth: true, APIKey: &APIKeyV2{Name: \"X-API-Key\", In: \"header\"}},",
+		"func (p AuthPolicyV2) Mode() AuthModeV2 {",
+		"func V2Middleware(extract ClaimsExtractorV2) gin.HandlerFunc {",
+		"policy, ok := LookupPolicyV2(c.Request.Method, c.FullPath())",
+	} {
+		if !strings.Contains(string(code), want) {
+			t.Errorf("expected generated code to contain %q, got:\n%s", want, code)
+		}
+	}
+
+	test, err := GenerateTest("httproutes", cfg, opts)
+	if err != nil {
+		t.Fatalf("GenerateTest error: %v", err)
+	}
+	for _, want := range []string{"func TestPoliciesV2(t *testing.T) {", "key          RouteKeyV2", "p, ok := V2Policies[tt.key]"} {
+		if !strings.Contains(string(test), want) {
+			t.Errorf("expected generated test to contain %q, got:\n%s", want, test)
+		}
+	}
+
+	for _, tt := range []struct {
+		names map[string]string
+		want  string
+	}{
+		{map[string]string{"Nope": "X"}, "no such generated identifier"},
+		{map[string]string{"Policies": "not-an-ident"}, "not an identifier"},
+		{map[string]string{"RouteKey": "AuthPolicy"}, "would both be named"},
+	} {
+		if _, err := GenerateWithOptions("httproutes", cfg, Options{Names: tt.names}); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Names %v: expected error containing %q, got %v", tt.names, tt.want, err)
+		}
+	}
+}
+
+func TestGenerate_NamesKeepProvenance(t *testing.T) {
+	cfg := &model.Config{
+		Policies: map[model.RouteKey]model.AuthPolicy{
+			{Method: "GET", Path: "/users"}: {RequireAuth: true},
+		},
+		Sources: []model.Source{{Spec: "specs/Policies.yaml", SHA256: "aa"}},
+	}
+	code, err := GenerateWithOptions("httproutes", cfg, Options{Names: map[string]string{"Policies": "UserPolicies"}})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	for _, want := range []string{
+		"// Spec: specs/Policies.yaml sha256:aa\n",
+		"var UserPolicies = map[RouteKey]AuthPolicy{",
+	} {
+		if !strings.Contains(string(code), want) {
+			t.Errorf("expected generated code to contain %q, got:\n%s", want, code)
+		}
+	}
+}
+
+func TestGenerate_Registry(t *testing.T) {
+	cfg := &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
+		{Method: "GET", Path: "/users"}:   {RequireAuth: true},
+		{Method: "GET", Path: "/healthz"}: {RequireAuth: false},
+		{Method: "GET", Path: "/legacy"}:  {RequireAuth: false, Deny: true},
+		{Method: "GET", Path: "/feed"}:    {OptionalAuth: true},
+	}}
+	code, err := GenerateWithOptions("httproutes", cfg, Options{Registry: true})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	for _, want := range []string{
+		"var policies = map[RouteKey]AuthPolicy{",
+		"policy, ok := policies[RouteKey{Method: method, Path: path}]",
+		"var Registry PolicyRegistry",
+		"func (PolicyRegistry) Get(method, pattern string) (AuthPolicy, bool) {",
+		"var registryPublicRoutes = []RouteKey{\n\t{Method: \"GET\", Path: \"/feed\"},\n\t{Method: \"GET\", Path: \"/healthz\"},\n}",
+	} {
+		if !strings.Contains(string(code), want) {
+			t.Errorf("expected generated code to contain %q, got:\n%s", want, code)
+		}
+	}
+
+	code, err = GenerateWithOptions("httproutes", cfg, Options{Registry: true, Names: map[string]string{"Policies": "Policies"}})
+	if err != nil {
+		t.Fatalf("GenerateWithOptions error: %v", err)
+	}
+	if !strings.Contains(string(code), "var Policies = map[RouteKey]AuthPolicy{") {
+		t.Errorf("expected Names to keep Policies, got:\n%s", code)
+	}
+}
+
+func TestGenerateSplit(t *testing.T) {
+	cfg := &model.Config{Policies: map[model.RouteKey]model.AuthPolicy{
+		{Method: "GET", Path: "/users"}:        {RequireAuth: true, Tags: []string{"Users"}},
+		{Method: "DELETE", Path: "/users/:id"}: {RequireAuth: true, Roles: []string{"admin"}, Tags: []string{"users", "admin"}},
+		{Method: "POST", Path: "/orders"}:      {RequireAuth: true, Tags: []string{"Order History"}},
+		{Method: "GET", Path: "/"}:             {RequireAuth: false},
+	}}
+
+	code, parts, err := GenerateSplit("httproutes", cfg, Options{Target: TargetGin}, SplitTag)
+	if err != nil {
+		t.Fatalf("GenerateSplit error: %v", err)
+	}
+	for _, want := range []string{
+		"var Policies = joinPolicies(policiesOrderHistory, policiesUntagged, policiesUsers)",
+		"func joinPolicies(parts ...map[RouteKey]AuthPolicy) map[RouteKey]AuthPolicy {",
+		"func LookupPolicy(method, path string) (AuthPolicy, bool) {",
+	} {
+		if !strings.Contains(string(code), want) {
+			t.Errorf("expected %q in generated code, got:\n%s", want, code)
+		}
+	}
+	if strings.Contains(string(code), `{Method: "GET", Path: "/users"}`) {
+		t.Errorf("expected routes to be moved to parts, got:\n%s", code)
+	}
+
+	var groups []string
+	for _, p := range parts {
+		groups = append(groups, p.Group)
+	}
+	if want := []string{"order_history", "untagged", "users"}; !reflect.DeepEqual(groups, want) {
+		t.Fatalf("expected groups %q, got %q", want, groups)
+	}
+	users := string(parts[2].Source)
+	for _, want := range []string{
+		"package httproutes\n",
+		"// policiesUsers holds the policies of operations tagged Users or users.\n",
+		`{Method: "DELETE", Path: "/users/:id"}: {RequireAuth: true, Roles: []string{"admin"}},`,
+		`{Method: "GET", Path: "/users"}:        {RequireAuth: true},`,
+	} {
+		if !strings.Contains(users, want) {
+			t.Errorf("expected %q in users part, got:\n%s", want, users)
+		}
+	}
+
+	_, parts, err = GenerateSplit("httproutes", cfg, Options{}, SplitPath)
+	if err != nil {
+		t.Fatalf("GenerateSplit error: %v", err)
+	}
+	groups = groups[:0]
+	for _, p := range parts {
+		groups = append(groups, p.Group)
+	}
+	if want := []string{"orders", "root", "users"}; !reflect.DeepEqual(groups, want) {
+		t.Errorf("expected groups %q, got %q", want, groups)
+	}
+
+	if _, _, err := GenerateSplit("httproutes", cfg, Options{}, "size"); err == nil {
+		t.Errorf("expected error for unknown split")
+	}
+}
+
+func TestGenerateTemplate(t *testing.T) {
+	cfg := &model.Config{
+		Policies: map[model.RouteKey]model.AuthPolicy{
+			{Method: "GET", Path: "/users"}:    {RequireAuth: true, Scopes: []string{"users:read"}},
+			{Method: "DELETE", Path: "/admin"}: {RequireAuth: true, Roles: []string{"admin"}},
+			{Method: "GET", Path: "/optional"}: {OptionalAuth: true},
+		},
+		SecuritySchemes: map[string]model.SecurityScheme{
+			"BearerAuth": {Type: "http", Scheme: "bearer"},
+		},
+		Sources: []model.Source{{Spec: "openapi.yaml", SHA256: "aa"}},
+	}
+	text := `package {{.Package}} // {{.Version}}{{range .Sources}} {{.Spec}}{{end}}
+{{range .Routes}}{{.Method}} {{.Path}} {{.Mode}} {{.Roles}} {{.Scopes}}
+{{end}}{{range .SecuritySchemes}}{{.Name}}={{.Type}}/{{.Scheme}}
+{{end}}roles={{.Roles}} scopes={{.Scopes}}
+`
+	got, err := GenerateTemplate("test.tmpl", text, "rules", cfg, Options{Version: "v1.2.3"})
+	if err != nil {
+		t.Fatalf("GenerateTemplate error: %v", err)
+	}
+	want := `package rules // v1.2.3 openapi.yaml
+DELETE /admin required [admin] []
+GET /optional optional [] []
+GET /users required [] [users:read]
+BearerAuth=http/bearer
+roles=[admin] scopes=[users:read]
+`
+	if string(got) != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+
+	if _, err := GenerateTemplate("test.tmpl", "{{.Nope}}", "rules", cfg, Options{}); err == nil || !strings.Contains(err.Error(), "test.tmpl") {
+		t.Errorf("expected execution error naming the template, got %v", err)
+	}
+	if _, err := GenerateTemplate("test.tmpl", "{{", "rules", cfg, Options{}); err == nil || !strings.Contains(err.Error(), "parse template") {
+		t.Errorf("expected parse error, got %v", err)
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	cfg := &model.Config{
+		Policies: map[model.RouteKey]model.AuthPolicy{
+			{Method: "GET", Path: "/users/{userId}"}: {RequireAuth: true, Roles: []string{"admin"}, Scopes: []string{"users:read"}},
+		},
+	}
+	text := `{{range .Routes}}{{camelCase .OperationID}}{{pascalCase "users:read"}} {{snakeCase "getUserByID"}}
+{{range .Roles}}{{roleConst .}}{{end}} {{range .Scopes}}{{scopeConst .}}{{end}}
+{{routePattern "gin" .Path}} {{routePattern "servemux" .Path}} {{quote .Path}} {{stringSlice .Roles}} {{join .Scopes ","}}
+AuthPolicy{ {{policyFields .AuthPolicy}} } {{shout .Method}}
+{{end}}`
+	opts := Options{TemplateFuncs: template.FuncMap{
+		"shout":     func(s string) string { return s + "!" },
+		"camelCase": func(string) string { return "overridden" },
+	}}
+	got, err := GenerateTemplate("funcs.tmpl", text, "rules", cfg, opts)
+	if err != nil {
+		t.Fatalf("GenerateTemplate error: %v", err)
+	}
+	want := `overriddenUsersRead get_user_by_id
+RoleAdmin ScopeUsersRead
+/users/:userId /users/{userId} "/users/{userId}" []string{"admin"} users:read
+AuthPolicy{ RequireAuth: true, Roles: []string{"admin"}, Scopes: []string{"users:read"} } GET!
+`
+	if string(got) != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+
+	if got := camelCase("vegetable:write"); got != "vegetableWrite" {
+		t.Errorf("camelCase = %q", got)
+	}
+	if _, err := GenerateTemplate("funcs.tmpl", `{{routePattern "nope" "/"}}`, "rules", cfg, Options{}); err == nil {
+		t.Error("expected error for unknown router")
+	}
+}
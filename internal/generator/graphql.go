@@ -0,0 +1,102 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// fieldPolicies maps the GraphQL field of every policy that declares one to
+// the policy. Two routes mapped to the same field are an error.
+func fieldPolicies(cfg *model.Config) (map[string]model.AuthPolicy, error) {
+	fields := make(map[string]model.AuthPolicy)
+	origin := make(map[string]model.RouteKey)
+	for key, policy := range cfg.Policies {
+		name := policy.GraphQLField
+		if name == "" {
+			continue
+		}
+		if prev, ok := origin[name]; ok {
+			a, b := prev, key
+			if b.Path < a.Path || b.Path == a.Path && b.Method < a.Method {
+				a, b = b, a
+			}
+			return nil, fmt.Errorf("GraphQL field %s is mapped from both %s %s and %s %s", name, a.Method, a.Path, b.Method, b.Path)
+		}
+		origin[name] = key
+		fields[name] = policy
+	}
+	return fields, nil
+}
+
+// writeFieldPolicies writes a FieldPolicies map keyed by GraphQL field,
+// sorted by field.
+func writeFieldPolicies(buf *bytes.Buffer, cfg *model.Config, _ Options) error {
+	fields, err := fieldPolicies(cfg)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf.WriteString("\n// FieldPolicies holds the policies of operations mapped to GraphQL fields,\n")
+	buf.WriteString("// keyed by type and field name (\"Query.user\").\n")
+	buf.WriteString("var FieldPolicies = map[string]AuthPolicy{\n")
+	for _, name := range names {
+		fmt.Fprintf(buf, "\t%q: {", name)
+		writePolicyFields(buf, fields[name])
+		buf.WriteString("},\n")
+	}
+	buf.WriteString("}\n")
+	return nil
+}
+
+const graphqlSource = `
+// Errors returned by AuthorizeField and AuthDirective.
+var (
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrForbidden       = errors.New("forbidden")
+)
+
+// AuthorizeField checks claims against the policy of field ("Query.user"),
+// returning ErrUnauthenticated or ErrForbidden when Authorize rejects them.
+// Fields without a policy are allowed.
+func AuthorizeField(field string, claims Claims) error {
+	policy, ok := FieldPolicies[field]
+	if !ok {
+		return nil
+	}
+	switch Authorize(policy, claims) {
+	case 0:
+		return nil
+	case http.StatusUnauthorized:
+		return ErrUnauthenticated
+	default:
+		return ErrForbidden
+	}
+}
+
+// AuthDirective returns a gqlgen directive that enforces FieldPolicies on
+// the fields it decorates, looked up by the object and name of the field
+// being resolved. claims returns the caller's claims, or nil when the
+// request is unauthenticated. Declare the directive in the schema as
+//
+//	directive @authz on FIELD_DEFINITION
+//
+// and set Directives.Authz to it in the generated Config.
+func AuthDirective(claims func(context.Context) Claims) func(ctx context.Context, obj any, next graphql.Resolver) (any, error) {
+	return func(ctx context.Context, obj any, next graphql.Resolver) (any, error) {
+		if fc := graphql.GetFieldContext(ctx); fc != nil {
+			if err := AuthorizeField(fc.Object+"."+fc.Field.Name, claims(ctx)); err != nil {
+				return nil, err
+			}
+		}
+		return next(ctx)
+	}
+}
+`
@@ -0,0 +1,237 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// writeRoutePolicies writes the policies of LookupSwitch as a routePolicies
+// array, which Policies and LookupPolicy share, and returns the route of
+// each element.
+func writeRoutePolicies(buf *bytes.Buffer, policies map[model.RouteKey]model.AuthPolicy) []model.RouteKey {
+	keys := sortedKeys(policies)
+	buf.WriteString("// routePolicies holds the policy of every route, indexed by Policies and\n")
+	buf.WriteString("// LookupPolicy.\n")
+	buf.WriteString("var routePolicies = [...]AuthPolicy{\n")
+	for i, k := range keys {
+		fmt.Fprintf(buf, "\t// %d: %s %s\n", i, k.Method, k.Path)
+		buf.WriteString("\t{")
+		writePolicyFields(buf, policies[k])
+		buf.WriteString("},\n")
+	}
+	buf.WriteString("}\n\n")
+	return keys
+}
+
+// writeIndexedPolicies writes a Policies map whose values are the elements
+// of routePolicies, for the routes keys.
+func writeIndexedPolicies(buf *bytes.Buffer, keys []model.RouteKey) {
+	buf.WriteString("var Policies = map[RouteKey]AuthPolicy{\n")
+	for i, k := range keys {
+		fmt.Fprintf(buf, "\t{Method: %q, Path: %q}: routePolicies[%d],\n", k.Method, k.Path, i)
+	}
+	buf.WriteString("}\n")
+}
+
+// lowerStaticPathSource normalizes route patterns like the parser does for
+// case-insensitive paths: parameter names keep their case, since handlers
+// look parameters up by them.
+const lowerStaticPathSource = `
+// lowerStaticPath lower-cases the route pattern path like route keys were,
+// leaving parameter names ({name}, :name and *name) as they are.
+func lowerStaticPath(path string) string {
+	segs := strings.Split(path, "/")
+	for i, seg := range segs {
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			continue
+		}
+		var b strings.Builder
+		depth := 0
+		for _, r := range seg {
+			switch r {
+			case '{':
+				depth++
+			case '}':
+				depth--
+			}
+			if depth == 0 {
+				r = unicode.ToLower(r)
+			}
+			b.WriteRune(r)
+		}
+		segs[i] = b.String()
+	}
+	return strings.Join(segs, "/")
+}
+`
+
+// writeSwitchLookup writes a LookupPolicy that switches on method, then on
+// path, to return the elements of routePolicies for the routes keys.
+func writeSwitchLookup(buf *bytes.Buffer, keys []model.RouteKey, caseInsensitive bool) {
+	buf.WriteString("\n// LookupPolicy returns the policy for method and route pattern.")
+	if caseInsensitive {
+		buf.WriteString(" Route keys\n// were lower-cased, so path is matched case-insensitively.")
+	}
+	buf.WriteString("\nfunc LookupPolicy(method, path string) (AuthPolicy, bool) {\n")
+	if caseInsensitive {
+		buf.WriteString("\tpath = lowerStaticPath(path)\n")
+	}
+
+	byMethod := make(map[string][]int)
+	var methods []string
+	for i, k := range keys {
+		if _, ok := byMethod[k.Method]; !ok {
+			methods = append(methods, k.Method)
+		}
+		byMethod[k.Method] = append(byMethod[k.Method], i)
+	}
+	sort.Strings(methods)
+
+	buf.WriteString("\tswitch method {\n")
+	for _, method := range methods {
+		fmt.Fprintf(buf, "\tcase %q:\n", method)
+		buf.WriteString("\t\tswitch path {\n")
+		for _, i := range byMethod[method] {
+			fmt.Fprintf(buf, "\t\tcase %q:\n", keys[i].Path)
+			fmt.Fprintf(buf, "\t\t\treturn routePolicies[%d], true\n", i)
+		}
+		buf.WriteString("\t\t}\n")
+	}
+	buf.WriteString("\t}\n")
+	buf.WriteString("\treturn AuthPolicy{}, false\n")
+	buf.WriteString("}\n")
+}
+
+// matcherSource matches concrete request paths to the route patterns of
+// Policies, walking a tree with a level per path segment. staticKey is
+// replaced by the expression static segments are looked up by.
+const matcherSource = `
+// routeNode is a node of the tree MatchRoute walks, with a level per path
+// segment. A segment is matched literally before it is bound to a parameter,
+// and a catch-all parameter matches the rest of the path.
+type routeNode struct {
+	static   map[string]*routeNode
+	param    *routeNode
+	routes   map[string]RouteKey
+	catchAll map[string]RouteKey
+}
+
+var routeTree = newRouteTree(Policies)
+
+func newRouteTree(policies map[RouteKey]AuthPolicy) *routeNode {
+	root := &routeNode{}
+	for key := range policies {
+		n := root
+		rest := strings.TrimPrefix(key.Path, "/")
+		for {
+			seg, tail, more := strings.Cut(rest, "/")
+			if !more && isCatchAllSegment(seg) {
+				if n.catchAll == nil {
+					n.catchAll = make(map[string]RouteKey)
+				}
+				n.catchAll[key.Method] = key
+				break
+			}
+			n = n.child(seg)
+			if !more {
+				if n.routes == nil {
+					n.routes = make(map[string]RouteKey)
+				}
+				n.routes[key.Method] = key
+				break
+			}
+			rest = tail
+		}
+	}
+	return root
+}
+
+// child returns the node of the pattern segment seg below n, adding it if
+// needed. Segments holding a parameter share a node however it is named.
+func (n *routeNode) child(seg string) *routeNode {
+	if seg == "{$}" {
+		seg = ""
+	}
+	if strings.HasPrefix(seg, ":") || strings.Contains(seg, "{") {
+		if n.param == nil {
+			n.param = &routeNode{}
+		}
+		return n.param
+	}
+	if n.static == nil {
+		n.static = make(map[string]*routeNode)
+	}
+	c, ok := n.static[seg]
+	if !ok {
+		c = &routeNode{}
+		n.static[seg] = c
+	}
+	return c
+}
+
+// isCatchAllSegment reports whether the pattern segment seg matches the
+// rest of a path: "*" and "*name" in chi and gin, "{name...}" in ServeMux.
+func isCatchAllSegment(seg string) bool {
+	return strings.HasPrefix(seg, "*") || strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "...}")
+}
+
+func (n *routeNode) match(method, rest string, params []string) (RouteKey, []string, bool) {
+	seg, tail, more := strings.Cut(rest, "/")
+	if c, ok := n.static[staticKey]; ok {
+		if key, p, ok := c.matchNext(method, tail, more, params); ok {
+			return key, p, true
+		}
+	}
+	if n.param != nil && seg != "" {
+		if key, p, ok := n.param.matchNext(method, tail, more, append(params, seg)); ok {
+			return key, p, true
+		}
+	}
+	if key, ok := n.catchAll[method]; ok {
+		return key, append(params, rest), true
+	}
+	return RouteKey{}, nil, false
+}
+
+func (n *routeNode) matchNext(method, tail string, more bool, params []string) (RouteKey, []string, bool) {
+	if more {
+		return n.match(method, tail, params)
+	}
+	key, ok := n.routes[method]
+	return key, params, ok
+}
+
+// MatchRoute finds the route of Policies a request for method and the
+// concrete path (such as r.URL.Path) is served by, for code that does not
+// know the route pattern. It returns the route and the values of its path
+// parameters, in order. A literal segment is tried before a parameter, and
+// a failed branch backtracks, but each node of the route tree is visited
+// at most once, so a match takes at most time proportional to the tree.
+func MatchRoute(method, path string) (RouteKey, []string, bool) {
+	return routeTree.match(method, strings.TrimPrefix(path, "/"), nil)
+}
+
+// MatchPolicy returns the policy of the route MatchRoute finds for method
+// and path.
+func MatchPolicy(method, path string) (AuthPolicy, bool) {
+	key, _, ok := MatchRoute(method, path)
+	if !ok {
+		return AuthPolicy{}, false
+	}
+	return Policies[key], true
+}
+`
+
+// writeMatcher writes MatchRoute and MatchPolicy. With caseInsensitive,
+// route keys were lower-cased, so static segments are too.
+func writeMatcher(buf *bytes.Buffer, caseInsensitive bool) {
+	key := "seg"
+	if caseInsensitive {
+		key = "strings.ToLower(seg)"
+	}
+	buf.WriteString(strings.ReplaceAll(matcherSource, "staticKey", key))
+}
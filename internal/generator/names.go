@@ -0,0 +1,207 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// renaming reports whether opts renames generated identifiers.
+func (opts Options) renaming() bool {
+	return len(opts.names()) > 0 || opts.NameSuffix != ""
+}
+
+// names returns opts.Names, adding the rename of Policies to policies
+// with Registry.
+func (opts Options) names() map[string]string {
+	if !opts.Registry {
+		return opts.Names
+	}
+	if _, ok := opts.Names["Policies"]; ok {
+		return opts.Names
+	}
+	names := map[string]string{"Policies": "policies"}
+	for old, name := range opts.Names {
+		names[old] = name
+	}
+	return names
+}
+
+// newNames maps the top-level identifiers the files srcs declare to their
+// names under opts.Names and opts.NameSuffix, leaving out those that keep
+// their name. It fails for Names that are not declared, names that are not
+// identifiers, and renames that make two identifiers the same.
+func newNames(opts Options, srcs ...[]byte) (map[string]string, error) {
+	declared := make(map[string]bool)
+	for _, src := range srcs {
+		file, err := parser.ParseFile(token.NewFileSet(), "", src, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, &SourceError{Err: err, Source: src}
+		}
+		for _, obj := range topLevelIdents(file) {
+			declared[obj.Name] = true
+		}
+	}
+
+	renames := opts.names()
+	for old, name := range renames {
+		if !declared[old] {
+			return nil, fmt.Errorf("cannot rename %s: no such generated identifier", old)
+		}
+		if !token.IsIdentifier(name) {
+			return nil, fmt.Errorf("cannot rename %s to %q: not an identifier", old, name)
+		}
+	}
+	if opts.NameSuffix != "" && !token.IsIdentifier("x"+opts.NameSuffix) {
+		return nil, fmt.Errorf("name suffix %q cannot be part of an identifier", opts.NameSuffix)
+	}
+
+	names := make(map[string]string)
+	byNew := make(map[string]string)
+	olds := make([]string, 0, len(declared))
+	for old := range declared {
+		olds = append(olds, old)
+	}
+	sort.Strings(olds)
+	for _, old := range olds {
+		name, ok := renames[old]
+		if !ok {
+			name = old + opts.NameSuffix
+		}
+		if prev, ok := byNew[name]; ok {
+			return nil, fmt.Errorf("%s and %s would both be named %s", prev, old, name)
+		}
+		byNew[name] = old
+		if name != old {
+			names[old] = name
+		}
+	}
+	return names, nil
+}
+
+// renameSibling renames the identifiers of src, a file of the package
+// GenerateWithOptions writes for pkg, cfg and opts, to match that file.
+func renameSibling(src []byte, pkg string, cfg *model.Config, opts Options) ([]byte, error) {
+	if !opts.renaming() {
+		return src, nil
+	}
+	code, err := generate(pkg, cfg, opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	names, err := newNames(opts, code, src)
+	if err != nil {
+		return nil, err
+	}
+	return renameSource(src, names)
+}
+
+// topLevelIdents returns the names of the types, variables, constants and
+// functions file declares at the top level, but not those of methods.
+func topLevelIdents(file *ast.File) []*ast.Ident {
+	var idents []*ast.Ident
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				idents = append(idents, d.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					idents = append(idents, s.Name)
+				case *ast.ValueSpec:
+					idents = append(idents, s.Names...)
+				}
+			}
+		}
+	}
+	return idents
+}
+
+// renameSource renames the identifiers of the generated file src as names
+// says: those declared at its top level, the references to them, and
+// references to identifiers declared by the other files of the package.
+// Whole words of comments naming them are renamed too, so doc comments
+// keep starting with the name they document. The header above the package
+// clause is left alone: its provenance lines name spec files, not
+// identifiers.
+func renameSource(src []byte, names map[string]string) ([]byte, error) {
+	if len(names) == 0 {
+		return src, nil
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, &SourceError{Err: err, Source: src}
+	}
+
+	topLevel := make(map[*ast.Object]bool)
+	for _, id := range topLevelIdents(file) {
+		if id.Obj != nil {
+			topLevel[id.Obj] = true
+		}
+	}
+	// Field names in composite literals and selectors resolve to
+	// same-named top-level identifiers, or to nothing, but never refer to
+	// them: APIKey: &APIKey{...}.
+	fields := make(map[*ast.Ident]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CompositeLit:
+			for _, elt := range n.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if id, ok := kv.Key.(*ast.Ident); ok {
+						fields[id] = true
+					}
+				}
+			}
+		case *ast.SelectorExpr:
+			fields[n.Sel] = true
+		}
+		return true
+	})
+	ast.Inspect(file, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok || fields[id] {
+			return true
+		}
+		name, ok := names[id.Name]
+		if ok && (id.Obj == nil || topLevel[id.Obj]) {
+			id.Name = name
+		}
+		return true
+	})
+
+	olds := make([]string, 0, len(names))
+	for old := range names {
+		olds = append(olds, regexp.QuoteMeta(old))
+	}
+	word := regexp.MustCompile(`\b(` + strings.Join(olds, "|") + `)\b`)
+	for _, group := range file.Comments {
+		if group == file.Doc {
+			continue
+		}
+		for _, c := range group.List {
+			if strings.HasPrefix(c.Text, "//go:") {
+				continue
+			}
+			c.Text = word.ReplaceAllStringFunc(c.Text, func(old string) string { return names[old] })
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
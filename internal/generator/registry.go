@@ -0,0 +1,52 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// registrySource declares PolicyRegistry, whose methods read the
+// registryRoutes and registryPublicRoutes written by writeRegistry.
+const registrySource = `
+// PolicyRegistry gives access to the policies derived from the spec. Use
+// Registry rather than a map, so the way policies are stored can change
+// without breaking callers.
+type PolicyRegistry struct{}
+
+// Registry holds the policies derived from the spec.
+var Registry PolicyRegistry
+
+// Get returns the policy for method and route pattern.
+func (PolicyRegistry) Get(method, pattern string) (AuthPolicy, bool) {
+	return LookupPolicy(method, pattern)
+}
+
+// Routes returns every route with a policy, sorted by path and method.
+func (PolicyRegistry) Routes() []RouteKey {
+	return append([]RouteKey(nil), registryRoutes...)
+}
+
+// PublicRoutes returns the routes anonymous callers may use, because their
+// policy does not require authentication and does not deny every request,
+// sorted like Routes. Routes with optional authentication are included.
+func (PolicyRegistry) PublicRoutes() []RouteKey {
+	return append([]RouteKey(nil), registryPublicRoutes...)
+}
+`
+
+// writeRegistry writes PolicyRegistry and the routes of policies it
+// returns.
+func writeRegistry(buf *bytes.Buffer, policies map[model.RouteKey]model.AuthPolicy) {
+	buf.WriteString(registrySource)
+	var routes, public bytes.Buffer
+	for _, k := range sortedKeys(policies) {
+		fmt.Fprintf(&routes, "\t{Method: %q, Path: %q},\n", k.Method, k.Path)
+		if p := policies[k]; p.Mode() != model.AuthRequired && !p.Deny {
+			fmt.Fprintf(&public, "\t{Method: %q, Path: %q},\n", k.Method, k.Path)
+		}
+	}
+	fmt.Fprintf(buf, "\nvar registryRoutes = []RouteKey{\n%s}\n", routes.String())
+	fmt.Fprintf(buf, "\nvar registryPublicRoutes = []RouteKey{\n%s}\n", public.String())
+}
@@ -0,0 +1,164 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// methodPolicies maps the full gRPC method name of every policy that has one
+// to the policy: its x-grpc-method, or else its operationId within
+// opts.GRPCService. Two routes mapped to the same method are an error.
+func methodPolicies(cfg *model.Config, opts Options) (map[string]model.AuthPolicy, error) {
+	methods := make(map[string]model.AuthPolicy)
+	origin := make(map[string]model.RouteKey)
+	for key, policy := range cfg.Policies {
+		name := policy.GRPCMethod
+		if name == "" && opts.GRPCService != "" && policy.OperationID != "" {
+			name = "/" + opts.GRPCService + "/" + upperFirst(policy.OperationID)
+		}
+		if name == "" {
+			continue
+		}
+		if prev, ok := origin[name]; ok {
+			a, b := prev, key
+			if b.Path < a.Path || b.Path == a.Path && b.Method < a.Method {
+				a, b = b, a
+			}
+			return nil, fmt.Errorf("gRPC method %s is mapped from both %s %s and %s %s", name, a.Method, a.Path, b.Method, b.Path)
+		}
+		origin[name] = key
+		methods[name] = policy
+	}
+	return methods, nil
+}
+
+func upperFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[n:]
+}
+
+// writeMethodPolicies writes a MethodPolicies map keyed by full gRPC method
+// name, sorted by name.
+func writeMethodPolicies(buf *bytes.Buffer, cfg *model.Config, opts Options) error {
+	methods, err := methodPolicies(cfg, opts)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(methods))
+	for name := range methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf.WriteString("\n// MethodPolicies holds the policies of operations mapped to gRPC methods,\n")
+	buf.WriteString("// keyed by full method name (\"/package.Service/Method\").\n")
+	buf.WriteString("var MethodPolicies = map[string]AuthPolicy{\n")
+	for _, name := range names {
+		fmt.Fprintf(buf, "\t%q: {", name)
+		writePolicyFields(buf, methods[name])
+		buf.WriteString("},\n")
+	}
+	buf.WriteString("}\n")
+	return nil
+}
+
+const grpcSource = `
+// UnaryServerInterceptor enforces MethodPolicies on unary RPCs, looked up by
+// info.FullMethod. claims returns the caller's claims, or nil when the call
+// is unauthenticated. Calls Authorize rejects fail with codes.Unauthenticated
+// or codes.PermissionDenied; methods without a policy pass through.
+func UnaryServerInterceptor(claims func(context.Context) Claims) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := authorizeMethod(ctx, info.FullMethod, claims); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is like UnaryServerInterceptor for streaming RPCs.
+func StreamServerInterceptor(claims func(context.Context) Claims) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := authorizeMethod(ss.Context(), info.FullMethod, claims); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func authorizeMethod(ctx context.Context, fullMethod string, claims func(context.Context) Claims) error {
+	policy, ok := MethodPolicies[fullMethod]
+	if !ok {
+		return nil
+	}
+	switch Authorize(policy, claims(ctx)) {
+	case 0:
+		return nil
+	case http.StatusUnauthorized:
+		return status.Error(codes.Unauthenticated, "unauthenticated")
+	default:
+		return status.Error(codes.PermissionDenied, "permission denied")
+	}
+}
+`
+
+const connectSource = `
+// AuthPolicyInterceptor is a connect.Interceptor that enforces MethodPolicies
+// on handlers, looked up by procedure ("/package.Service/Method"). Calls
+// Authorize rejects fail with connect.CodeUnauthenticated or
+// connect.CodePermissionDenied; procedures without a policy pass through.
+// Clients are not affected.
+type AuthPolicyInterceptor struct {
+	claims func(context.Context) Claims
+}
+
+// NewAuthPolicyInterceptor returns an interceptor that gets the caller's
+// claims from claims, which returns nil when the call is unauthenticated.
+func NewAuthPolicyInterceptor(claims func(context.Context) Claims) *AuthPolicyInterceptor {
+	return &AuthPolicyInterceptor{claims: claims}
+}
+
+func (i *AuthPolicyInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if !req.Spec().IsClient {
+			if err := i.authorize(ctx, req.Spec().Procedure); err != nil {
+				return nil, err
+			}
+		}
+		return next(ctx, req)
+	}
+}
+
+func (i *AuthPolicyInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *AuthPolicyInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		if err := i.authorize(ctx, conn.Spec().Procedure); err != nil {
+			return err
+		}
+		return next(ctx, conn)
+	}
+}
+
+func (i *AuthPolicyInterceptor) authorize(ctx context.Context, procedure string) error {
+	policy, ok := MethodPolicies[procedure]
+	if !ok {
+		return nil
+	}
+	switch Authorize(policy, i.claims(ctx)) {
+	case 0:
+		return nil
+	case http.StatusUnauthorized:
+		return connect.NewError(connect.CodeUnauthenticated, errors.New("unauthenticated"))
+	default:
+		return connect.NewError(connect.CodePermissionDenied, errors.New("permission denied"))
+	}
+}
+`
@@ -0,0 +1,217 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// Ways GenerateSplit groups routes into files.
+const (
+	// SplitTag groups routes by the first tag of their operation.
+	// Untagged operations form the group "untagged".
+	SplitTag = "tag"
+	// SplitPath groups routes by the first segment of their path, so
+	// "/users/{id}" is in the group "users". "/" forms the group "root".
+	SplitPath = "path"
+)
+
+// Part is a file of policies split off the file written by GenerateSplit.
+type Part struct {
+	// Group names the routes of the part, lower-cased and with every
+	// character other than a letter or digit replaced by "_", so it can
+	// be used in a file name.
+	Group string
+
+	Source []byte
+}
+
+// policyGroup is the routes of a Part.
+type policyGroup struct {
+	name  string
+	ident string
+
+	// label describes the routes, for the comment of the map.
+	label string
+
+	policies map[model.RouteKey]model.AuthPolicy
+}
+
+// GenerateSplit is like GenerateWithOptions, but moves the routes of
+// Policies into one Part per group, grouped by tag or path as by says
+// (SplitTag or SplitPath). The main file joins the maps of the parts into
+// Policies, so the package behaves the same as with a single file. Parts
+// are sorted by group.
+func GenerateSplit(pkg string, cfg *model.Config, opts Options, by string) ([]byte, []Part, error) {
+	groups, err := splitPolicies(cfg.Policies, by)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	code, err := generate(pkg, cfg, opts, groups)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parts := make([]Part, 0, len(groups))
+	for _, g := range groups {
+		var buf bytes.Buffer
+		if err := writeBuildTag(&buf, opts.BuildTag); err != nil {
+			return nil, nil, err
+		}
+		fmt.Fprintf(&buf, "// Code generated by openapi-authz; DO NOT EDIT.\n")
+		fmt.Fprintf(&buf, "package %s\n\n", pkg)
+		fmt.Fprintf(&buf, "// %s holds the policies of %s.\n", g.ident, g.label)
+		writePolicyMap(&buf, g.ident, g.policies)
+
+		src, err := FormatSource(buf.Bytes())
+		if err != nil {
+			return nil, nil, fmt.Errorf("format generated code for group %s: %w", g.name, err)
+		}
+		parts = append(parts, Part{Group: g.name, Source: src})
+	}
+
+	if opts.renaming() {
+		srcs := [][]byte{code}
+		for _, p := range parts {
+			srcs = append(srcs, p.Source)
+		}
+		names, err := newNames(opts, srcs...)
+		if err != nil {
+			return nil, nil, err
+		}
+		if code, err = renameSource(code, names); err != nil {
+			return nil, nil, err
+		}
+		for i := range parts {
+			if parts[i].Source, err = renameSource(parts[i].Source, names); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return code, parts, nil
+}
+
+// splitPolicies groups policies as by says, sorted by group name.
+func splitPolicies(policies map[model.RouteKey]model.AuthPolicy, by string) ([]policyGroup, error) {
+	switch by {
+	case SplitTag, SplitPath:
+	default:
+		return nil, fmt.Errorf("unknown split %q (want %s or %s)", by, SplitTag, SplitPath)
+	}
+
+	byName := make(map[string]*policyGroup)
+	// Tags or segments that only differ in case or punctuation share a
+	// group, which is described by all of them.
+	raw := make(map[string]map[string]bool)
+	for key, policy := range policies {
+		var value string
+		if by == SplitTag {
+			if len(policy.Tags) > 0 {
+				value = policy.Tags[0]
+			}
+		} else {
+			value, _, _ = strings.Cut(strings.TrimPrefix(key.Path, "/"), "/")
+		}
+		name := groupName(value, by)
+
+		g, ok := byName[name]
+		if !ok {
+			g = &policyGroup{
+				name:     name,
+				ident:    "policies" + constName("", name),
+				policies: make(map[model.RouteKey]model.AuthPolicy),
+			}
+			byName[name] = g
+			raw[name] = make(map[string]bool)
+		}
+		raw[name][value] = true
+		g.policies[key] = policy
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	groups := make([]policyGroup, 0, len(byName))
+	idents := make(map[string]string)
+	for _, name := range names {
+		g := byName[name]
+		if prev, ok := idents[g.ident]; ok {
+			return nil, fmt.Errorf("groups %s and %s both map to %s", prev, g.name, g.ident)
+		}
+		idents[g.ident] = g.name
+
+		values := make([]string, 0, len(raw[name]))
+		for v := range raw[name] {
+			if by == SplitPath {
+				v = "/" + v
+			}
+			values = append(values, v)
+		}
+		sort.Strings(values)
+		switch {
+		case by == SplitPath:
+			g.label = "routes under " + strings.Join(values, " or ")
+		case len(values) == 1 && values[0] == "":
+			g.label = "untagged operations"
+		default:
+			g.label = "operations tagged " + strings.Join(values, " or ")
+		}
+		groups = append(groups, *g)
+	}
+	return groups, nil
+}
+
+// groupName lower-cases s and replaces every run of characters other than
+// letters and digits with "_". Names left empty are "untagged" or, when
+// splitting by path, "root".
+func groupName(s, by string) string {
+	var b strings.Builder
+	sep := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if sep && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+			sep = false
+		} else {
+			sep = true
+		}
+	}
+	switch {
+	case b.Len() > 0:
+		return b.String()
+	case by == SplitPath:
+		return "root"
+	default:
+		return "untagged"
+	}
+}
+
+// writeJoinedPolicies writes a Policies map joining the maps of groups,
+// which are declared in the files of their parts.
+func writeJoinedPolicies(buf *bytes.Buffer, groups []policyGroup) {
+	idents := make([]string, len(groups))
+	for i, g := range groups {
+		idents[i] = g.ident
+	}
+	fmt.Fprintf(buf, "var Policies = joinPolicies(%s)\n\n", strings.Join(idents, ", "))
+	buf.WriteString("// joinPolicies returns a map holding the routes of every map of parts.\n")
+	buf.WriteString("func joinPolicies(parts ...map[RouteKey]AuthPolicy) map[RouteKey]AuthPolicy {\n")
+	buf.WriteString("\tpolicies := make(map[RouteKey]AuthPolicy)\n")
+	buf.WriteString("\tfor _, part := range parts {\n")
+	buf.WriteString("\t\tfor key, policy := range part {\n")
+	buf.WriteString("\t\t\tpolicies[key] = policy\n")
+	buf.WriteString("\t\t}\n")
+	buf.WriteString("\t}\n")
+	buf.WriteString("\treturn policies\n")
+	buf.WriteString("}\n")
+}
@@ -0,0 +1,475 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// Generation targets.
+const (
+	// TargetMap generates the policy map only.
+	TargetMap = "map"
+	// TargetGin adds a gin.HandlerFunc that looks policies up by
+	// c.FullPath(). Route keys must use gin's ":param" syntax.
+	TargetGin = "gin"
+	// TargetEcho adds an echo.MiddlewareFunc that looks policies up by
+	// c.Path(). Route keys must use echo's ":param" syntax.
+	TargetEcho = "echo"
+	// TargetFiber adds a fiber.Handler that looks policies up by
+	// c.Route().Path. Route keys must use fiber's ":param" syntax.
+	TargetFiber = "fiber"
+	// TargetGorilla adds a mux.MiddlewareFunc that looks policies up by
+	// mux.CurrentRoute(r).GetPathTemplate().
+	TargetGorilla = "gorilla"
+	// TargetServeMux adds a PatternPolicies map keyed by Go 1.22 ServeMux
+	// patterns ("GET /users/{id}") and net/http middleware that looks
+	// policies up by r.Pattern.
+	TargetServeMux = "servemux"
+	// TargetGRPC adds a MethodPolicies map keyed by full gRPC method name
+	// and unary and stream server interceptors that enforce it.
+	TargetGRPC = "grpc"
+	// TargetConnect adds the same MethodPolicies map, keyed by Connect
+	// procedure, and a connect.Interceptor that enforces it.
+	TargetConnect = "connect"
+	// TargetGraphQL adds a FieldPolicies map keyed by the x-graphql-field of
+	// each operation and a gqlgen directive that enforces it.
+	TargetGraphQL = "graphql"
+)
+
+// target describes the middleware generated for a router or RPC framework.
+type target struct {
+	// imports lists the packages source needs besides those of the policy
+	// map.
+	imports []string
+
+	// lookup says whether source calls LookupPolicy.
+	lookup bool
+
+	// extractor says whether source takes a ClaimsExtractor and calls
+	// AuthorizeRequest.
+	extractor bool
+
+	// source is appended after the Authorize helper.
+	source string
+
+	// writeMaps, if set, writes further variables derived from cfg after
+	// the Policies map.
+	writeMaps func(buf *bytes.Buffer, cfg *model.Config, opts Options) error
+}
+
+var targets = map[string]*target{
+	TargetGin: {
+		imports:   []string{"net/http", "github.com/gin-gonic/gin"},
+		lookup:    true,
+		extractor: true,
+		source:    ginSource,
+	},
+	TargetEcho: {
+		imports:   []string{"net/http", "github.com/labstack/echo/v4"},
+		lookup:    true,
+		extractor: true,
+		source:    echoSource,
+	},
+	TargetFiber: {
+		imports:   []string{"net/http", "github.com/gofiber/fiber/v2", "github.com/gofiber/fiber/v2/middleware/adaptor"},
+		lookup:    true,
+		extractor: true,
+		source:    fiberSource,
+	},
+	TargetGorilla: {
+		imports:   []string{"net/http", "strings", "github.com/gorilla/mux"},
+		lookup:    true,
+		extractor: true,
+		source:    gorillaSource,
+	},
+	TargetServeMux: {
+		imports:   []string{"net/http"},
+		extractor: true,
+		source:    serveMuxSource,
+		writeMaps: writePatternPolicies,
+	},
+	TargetGRPC: {
+		imports: []string{
+			"context", "net/http",
+			"google.golang.org/grpc", "google.golang.org/grpc/codes", "google.golang.org/grpc/status",
+		},
+		source:    grpcSource,
+		writeMaps: writeMethodPolicies,
+	},
+	TargetConnect: {
+		imports:   []string{"context", "errors", "net/http", "connectrpc.com/connect"},
+		source:    connectSource,
+		writeMaps: writeMethodPolicies,
+	},
+	TargetGraphQL: {
+		imports:   []string{"context", "errors", "net/http", "github.com/99designs/gqlgen/graphql"},
+		source:    graphqlSource,
+		writeMaps: writeFieldPolicies,
+	},
+}
+
+// lookupTarget returns the target named name, or nil for the policy map
+// only.
+func lookupTarget(name string) (*target, error) {
+	if name == "" || name == TargetMap {
+		return nil, nil
+	}
+	t, ok := targets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown target %q", name)
+	}
+	return t, nil
+}
+
+// claimsSource is generated for every target, and with Options.Claims for
+// the policy map alone: what authorization needs to know about a caller,
+// and checks against it.
+const claimsSource = `
+// Claims is what authorization needs to know about an authenticated caller.
+// StaticClaims implements it; your own token or session type can too.
+type Claims interface {
+	// Subject identifies the caller, such as a token's sub claim.
+	Subject() string
+	// Scheme is the type of security scheme the caller authenticated
+	// with, as listed in AuthPolicy.Schemes, such as "bearer" or "apiKey".
+	Scheme() string
+	HasRole(role string) bool
+	HasScope(scope string) bool
+}
+
+// StaticClaims is a Claims filled in from a validated token.
+type StaticClaims struct {
+	Sub        string
+	AuthScheme string
+	Roles      []string
+	Scopes     []string
+}
+
+func (c *StaticClaims) Subject() string { return c.Sub }
+
+func (c *StaticClaims) Scheme() string { return c.AuthScheme }
+
+func (c *StaticClaims) HasRole(role string) bool { return containsString(c.Roles, role) }
+
+func (c *StaticClaims) HasScope(scope string) bool { return containsString(c.Scopes, scope) }
+
+// HasAnyRole reports whether claims holds any of roles.
+func HasAnyRole(claims Claims, roles ...string) bool {
+	for _, role := range roles {
+		if claims.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAllScopes reports whether claims holds every one of scopes.
+func HasAllScopes(claims Claims, scopes ...string) bool {
+	for _, scope := range scopes {
+		if !claims.HasScope(scope) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+`
+
+// authorizeSource is shared by every target: the decision the middleware
+// makes from the caller's claims.
+const authorizeSource = `
+// Authorize returns the HTTP status a request must be rejected with under
+// policy, or 0 if it may proceed. claims is nil for unauthenticated requests.
+// Authenticated requests must hold any of the policy's roles and all of its
+// scopes, or those of one of its Alternatives. Only requirements naming the
+// scheme the caller authenticated with, or no scheme, are checked, so an
+// API key alternative does not let a bearer token lacking the policy's
+// scopes through.
+func Authorize(policy AuthPolicy, claims Claims) int {
+	switch {
+	case policy.Deny:
+		return http.StatusForbidden
+	case claims == nil:
+		if policy.RequireAuth {
+			return http.StatusUnauthorized
+		}
+		return 0
+	case policy.Mode() == AuthPublic:
+		return 0
+	}
+	if satisfies(claims, policy) {
+		return 0
+	}
+	for _, alt := range policy.Alternatives {
+		if satisfies(claims, alt) {
+			return 0
+		}
+	}
+	return http.StatusForbidden
+}
+
+func satisfies(claims Claims, p AuthPolicy) bool {
+	if len(p.Schemes) > 0 && !containsString(p.Schemes, claims.Scheme()) {
+		return false
+	}
+	return (len(p.Roles) == 0 || HasAnyRole(claims, p.Roles...)) && HasAllScopes(claims, p.Scopes...)
+}
+`
+
+// extractorSource is shared by the router targets: how their middleware
+// gets the caller's claims from a request.
+const extractorSource = `
+// ClaimsExtractor returns the claims of the caller sending r, or nil when r
+// carries no credentials. Return a nil Claims rather than a nil pointer of
+// your own type, since the middleware compares the interface with nil. An
+// error means r carries credentials that are not valid, such as an expired
+// token, and rejects the request with 401 unless its route is public.
+type ClaimsExtractor func(r *http.Request) (Claims, error)
+`
+
+// writeAuthorizeRequest writes AuthorizeRequest for the router targets.
+// With exemptPreflight it lets CORS preflight requests through, since
+// browsers send them without credentials.
+func writeAuthorizeRequest(buf *bytes.Buffer, exemptPreflight bool) {
+	buf.WriteString("\n// AuthorizeRequest is like Authorize, getting the caller's claims from r\n")
+	buf.WriteString("// with extract.")
+	if exemptPreflight {
+		buf.WriteString(" CORS preflight requests are let through without\n")
+		buf.WriteString("// calling extract, so the CORS handler can answer them.")
+	}
+	buf.WriteString("\n")
+	buf.WriteString("func AuthorizeRequest(policy AuthPolicy, r *http.Request, extract ClaimsExtractor) int {\n")
+	if exemptPreflight {
+		buf.WriteString("\tif isPreflight(r) {\n")
+		buf.WriteString("\t\treturn 0\n")
+		buf.WriteString("\t}\n")
+	}
+	buf.WriteString(authorizeRequestBody)
+	if exemptPreflight {
+		buf.WriteString(preflightSource)
+	}
+}
+
+const authorizeRequestBody = `	claims, err := extract(r)
+	if err != nil {
+		if !policy.Deny && policy.Mode() != AuthPublic {
+			return http.StatusUnauthorized
+		}
+		claims = nil
+	}
+	return Authorize(policy, claims)
+}
+`
+
+const preflightSource = `
+// isPreflight reports whether r is a CORS preflight request: an OPTIONS
+// request naming the method of the request the browser means to send.
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" && r.Header.Get("Access-Control-Request-Method") != ""
+}
+`
+
+const ginSource = `
+// AuthPolicyMiddleware enforces Policies on gin routes, looked up by method
+// and c.FullPath(), getting the caller's claims from c.Request with extract.
+// Requests AuthorizeRequest rejects are aborted with its status; routes
+// without a policy pass through.
+func AuthPolicyMiddleware(extract ClaimsExtractor) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policy, ok := LookupPolicy(c.Request.Method, c.FullPath())
+		if !ok {
+			c.Next()
+			return
+		}
+		if status := AuthorizeRequest(policy, c.Request, extract); status != 0 {
+			c.AbortWithStatus(status)
+			return
+		}
+		c.Next()
+	}
+}
+`
+
+const echoSource = `
+// AuthPolicyMiddleware enforces Policies on echo routes, looked up by method
+// and c.Path(), getting the caller's claims from c.Request() with extract.
+// Requests AuthorizeRequest rejects fail with an *echo.HTTPError carrying
+// its status; routes without a policy pass through.
+func AuthPolicyMiddleware(extract ClaimsExtractor) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			policy, ok := LookupPolicy(c.Request().Method, c.Path())
+			if !ok {
+				return next(c)
+			}
+			if status := AuthorizeRequest(policy, c.Request(), extract); status != 0 {
+				return echo.NewHTTPError(status)
+			}
+			return next(c)
+		}
+	}
+}
+`
+
+const fiberSource = `
+// AuthPolicyMiddleware enforces Policies on fiber routes, looked up by method
+// and c.Route().Path. fiber only reports the matched route to handlers
+// registered with it, so pass the middleware to each route (or app.Add)
+// rather than app.Use. extract gets the caller's claims from the request,
+// converted to an *http.Request, of routes with a policy. Requests
+// AuthorizeRequest rejects fail with a *fiber.Error carrying its status;
+// routes without a policy pass through.
+func AuthPolicyMiddleware(extract ClaimsExtractor) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		policy, ok := LookupPolicy(c.Method(), c.Route().Path)
+		if !ok {
+			return c.Next()
+		}
+		r, err := adaptor.ConvertRequest(c, false)
+		if err != nil {
+			return err
+		}
+		if status := AuthorizeRequest(policy, r, extract); status != 0 {
+			return fiber.NewError(status)
+		}
+		return c.Next()
+	}
+}
+`
+
+const gorillaSource = `
+// AuthPolicyMiddleware enforces Policies on gorilla/mux routes, looked up by
+// method and mux.CurrentRoute(r).GetPathTemplate(). Variable patterns such
+// as "{id:[0-9]+}" are reduced to "{id}" to match the spec's templates.
+// extract gets the caller's claims from the request. Requests
+// AuthorizeRequest rejects get its status; routes without a policy pass
+// through.
+func AuthPolicyMiddleware(extract ClaimsExtractor) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := mux.CurrentRoute(r)
+			if route == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			tpl, err := route.GetPathTemplate()
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			policy, ok := LookupPolicy(r.Method, stripVarPatterns(tpl))
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if status := AuthorizeRequest(policy, r, extract); status != 0 {
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// stripVarPatterns turns "/users/{id:[0-9]+}" into "/users/{id}".
+func stripVarPatterns(tpl string) string {
+	var b strings.Builder
+	depth, pattern := 0, false
+	for _, r := range tpl {
+		switch {
+		case r == '{':
+			depth++
+			if depth == 1 {
+				pattern = false
+				b.WriteRune(r)
+				continue
+			}
+		case r == '}':
+			depth--
+			if depth == 0 {
+				b.WriteRune(r)
+				continue
+			}
+		case r == ':' && depth == 1:
+			pattern = true
+			continue
+		}
+		if depth == 0 || !pattern {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+`
+
+// writePatternPolicies writes cfg.Policies keyed by ServeMux pattern, sorted
+// like the Policies map.
+func writePatternPolicies(buf *bytes.Buffer, cfg *model.Config, _ Options) error {
+	buf.WriteString("\n// PatternPolicies holds Policies keyed by ServeMux pattern, as reported by\n")
+	buf.WriteString("// r.Pattern for routes registered as \"METHOD /path\".\n")
+	buf.WriteString("var PatternPolicies = map[string]AuthPolicy{\n")
+	for _, k := range sortedKeys(cfg.Policies) {
+		fmt.Fprintf(buf, "\t%q: {", k.Method+" "+k.Path)
+		writePolicyFields(buf, cfg.Policies[k])
+		buf.WriteString("},\n")
+	}
+	buf.WriteString("}\n")
+
+	buf.WriteString("\n// patternPolicy returns the policy of the ServeMux pattern.")
+	if !cfg.CaseInsensitivePaths {
+		buf.WriteString("\nfunc patternPolicy(pattern string) (AuthPolicy, bool) {\n")
+		buf.WriteString("\tpolicy, ok := PatternPolicies[pattern]\n")
+		buf.WriteString("\treturn policy, ok\n")
+		buf.WriteString("}\n")
+		return nil
+	}
+	buf.WriteString(" Route keys\n// were lower-cased, so its path is matched case-insensitively.\n")
+	buf.WriteString("func patternPolicy(pattern string) (AuthPolicy, bool) {\n")
+	buf.WriteString("\tmethod, path, ok := strings.Cut(pattern, \" \")\n")
+	buf.WriteString("\tif !ok {\n")
+	buf.WriteString("\t\tmethod, path = \"\", pattern\n")
+	buf.WriteString("\t}\n")
+	buf.WriteString("\tpolicy, ok := PatternPolicies[method+\" \"+lowerStaticPath(path)]\n")
+	buf.WriteString("\treturn policy, ok\n")
+	buf.WriteString("}\n")
+	return nil
+}
+
+const serveMuxSource = `
+// AuthPolicyMiddleware enforces PatternPolicies on net/http ServeMux routes,
+// looked up by r.Pattern with patternPolicy. ServeMux sets r.Pattern when
+// it routes a request, so wrap the handlers registered on the mux rather
+// than the mux itself:
+//
+//	mux.Handle("GET /users/{id}", mw(getUser))
+//
+// extract gets the caller's claims from the request. Requests
+// AuthorizeRequest rejects get its status; routes without a policy pass
+// through. r.Pattern needs Go 1.23.
+func AuthPolicyMiddleware(extract ClaimsExtractor) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			policy, ok := patternPolicy(r.Pattern)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if status := AuthorizeRequest(policy, r, extract); status != 0 {
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+`
@@ -0,0 +1,95 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"text/template"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// TemplateData is what GenerateTemplate executes templates with.
+type TemplateData struct {
+	// Package is the package name passed to GenerateTemplate.
+	Package string
+
+	// Version is Options.Version.
+	Version string
+
+	// Sources are the specs the policies were derived from.
+	Sources []model.Source
+
+	// Routes, Webhooks and Callbacks hold the policies of the Config,
+	// sorted by path and method.
+	Routes    []TemplateRoute
+	Webhooks  []TemplateRoute
+	Callbacks []TemplateRoute
+
+	// SecuritySchemes holds the declared security schemes, sorted by name.
+	SecuritySchemes []TemplateScheme
+
+	// Roles and Scopes list every role and scope a policy names, sorted.
+	Roles  []string
+	Scopes []string
+}
+
+// TemplateRoute is a route and its policy, whose fields and Mode method
+// templates can use directly: {{.Method}}, {{.Path}}, {{.RequireAuth}}.
+type TemplateRoute struct {
+	model.RouteKey
+	model.AuthPolicy
+}
+
+// TemplateScheme is a declared security scheme and its name.
+type TemplateScheme struct {
+	Name string
+	model.SecurityScheme
+}
+
+// newTemplateData collects the TemplateData of cfg.
+func newTemplateData(pkg string, cfg *model.Config, opts Options) TemplateData {
+	data := TemplateData{
+		Package:   pkg,
+		Version:   opts.Version,
+		Sources:   cfg.Sources,
+		Routes:    templateRoutes(cfg.Policies),
+		Webhooks:  templateRoutes(cfg.Webhooks),
+		Callbacks: templateRoutes(cfg.Callbacks),
+	}
+	names := make([]string, 0, len(cfg.SecuritySchemes))
+	for name := range cfg.SecuritySchemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data.SecuritySchemes = append(data.SecuritySchemes, TemplateScheme{Name: name, SecurityScheme: cfg.SecuritySchemes[name]})
+	}
+	data.Roles, data.Scopes = rolesAndScopes(cfg)
+	return data
+}
+
+func templateRoutes(policies map[model.RouteKey]model.AuthPolicy) []TemplateRoute {
+	var routes []TemplateRoute
+	for _, k := range sortedKeys(policies) {
+		routes = append(routes, TemplateRoute{RouteKey: k, AuthPolicy: policies[k]})
+	}
+	return routes
+}
+
+// GenerateTemplate executes the text/template text, named name in errors,
+// with the TemplateData of cfg, so the output can take any shape: Go code
+// for an organization's own middleware, or other text altogether. The
+// template can call TemplateFuncs and opts.TemplateFuncs. The output is
+// returned as executed; FormatSource formats Go output.
+func GenerateTemplate(name, text, pkg string, cfg *model.Config, opts Options) ([]byte, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(TemplateFuncs()).Funcs(opts.TemplateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, newTemplateData(pkg, cfg, opts)); err != nil {
+		return nil, fmt.Errorf("execute template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
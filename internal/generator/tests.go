@@ -0,0 +1,89 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// GenerateTest produces a _test.go file for the package written by
+// Generate that asserts each route's RequireAuth, OptionalAuth, Deny, Roles
+// and Scopes, and that Policies holds no other routes. Regenerating from a
+// changed spec without regenerating the test, or editing the generated
+// map by hand, then fails the build. Only opts.BuildTag, opts.Names and
+// opts.NameSuffix apply.
+func GenerateTest(pkg string, cfg *model.Config, opts Options) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := writeBuildTag(&buf, opts.BuildTag); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&buf, "// Code generated by openapi-authz; DO NOT EDIT.\n")
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	writeImports(&buf, []string{"testing"})
+
+	buf.WriteString("func TestPolicies(t *testing.T) {\n")
+	buf.WriteString("\ttests := []struct {\n")
+	buf.WriteString("\t\tkey          RouteKey\n")
+	buf.WriteString("\t\trequireAuth  bool\n")
+	buf.WriteString("\t\toptionalAuth bool\n")
+	buf.WriteString("\t\tdeny         bool\n")
+	buf.WriteString("\t\troles        []string\n")
+	buf.WriteString("\t\tscopes       []string\n")
+	buf.WriteString("\t}{\n")
+	for _, k := range sortedKeys(cfg.Policies) {
+		p := cfg.Policies[k]
+		fmt.Fprintf(&buf, "\t\t{RouteKey{Method: %q, Path: %q}, %t, %t, %t, %s, %s},\n",
+			k.Method, k.Path, p.RequireAuth, p.OptionalAuth, p.Deny, stringSlice(p.Roles), stringSlice(p.Scopes))
+	}
+	buf.WriteString("\t}\n\n")
+
+	buf.WriteString("\tif len(Policies) != len(tests) {\n")
+	buf.WriteString("\t\tt.Errorf(\"Policies has %d routes, want %d\", len(Policies), len(tests))\n")
+	buf.WriteString("\t}\n")
+	buf.WriteString("\tfor _, tt := range tests {\n")
+	buf.WriteString("\t\tp, ok := Policies[tt.key]\n")
+	buf.WriteString("\t\tif !ok {\n")
+	buf.WriteString("\t\t\tt.Errorf(\"%s %s: no policy\", tt.key.Method, tt.key.Path)\n")
+	buf.WriteString("\t\t\tcontinue\n")
+	buf.WriteString("\t\t}\n")
+	buf.WriteString("\t\tif p.RequireAuth != tt.requireAuth || p.OptionalAuth != tt.optionalAuth || p.Deny != tt.deny {\n")
+	buf.WriteString("\t\t\tt.Errorf(\"%s %s: RequireAuth, OptionalAuth, Deny = %t, %t, %t, want %t, %t, %t\", tt.key.Method, tt.key.Path,\n")
+	buf.WriteString("\t\t\t\tp.RequireAuth, p.OptionalAuth, p.Deny, tt.requireAuth, tt.optionalAuth, tt.deny)\n")
+	buf.WriteString("\t\t}\n")
+	buf.WriteString("\t\tif !equalPolicyStrings(p.Roles, tt.roles) {\n")
+	buf.WriteString("\t\t\tt.Errorf(\"%s %s: Roles = %q, want %q\", tt.key.Method, tt.key.Path, p.Roles, tt.roles)\n")
+	buf.WriteString("\t\t}\n")
+	buf.WriteString("\t\tif !equalPolicyStrings(p.Scopes, tt.scopes) {\n")
+	buf.WriteString("\t\t\tt.Errorf(\"%s %s: Scopes = %q, want %q\", tt.key.Method, tt.key.Path, p.Scopes, tt.scopes)\n")
+	buf.WriteString("\t\t}\n")
+	buf.WriteString("\t}\n")
+	buf.WriteString("}\n\n")
+
+	buf.WriteString("func equalPolicyStrings(a, b []string) bool {\n")
+	buf.WriteString("\tif len(a) != len(b) {\n")
+	buf.WriteString("\t\treturn false\n")
+	buf.WriteString("\t}\n")
+	buf.WriteString("\tfor i := range a {\n")
+	buf.WriteString("\t\tif a[i] != b[i] {\n")
+	buf.WriteString("\t\t\treturn false\n")
+	buf.WriteString("\t\t}\n")
+	buf.WriteString("\t}\n")
+	buf.WriteString("\treturn true\n")
+	buf.WriteString("}\n")
+
+	formatted, err := FormatSource(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated test: %w", err)
+	}
+	return renameSibling(formatted, pkg, cfg, opts)
+}
+
+// stringSlice returns a []string literal of items, or nil when empty.
+func stringSlice(items []string) string {
+	if len(items) == 0 {
+		return "nil"
+	}
+	return "[]string{" + quoteList(items) + "}"
+}
@@ -1,5 +1,7 @@
 package model
 
+import "fmt"
+
 // RouteKey uniquely identifies an operation by HTTP method and normalized path.
 type RouteKey struct {
 	Method string
@@ -8,17 +10,228 @@ type RouteKey struct {
 
 // AuthPolicy represents the authorization requirements for a single operation.
 //
+// RequireAuth is set when anonymous requests must be rejected. OptionalAuth
+// is set instead when the spec lists an empty requirement object (`{}`)
+// next to real ones: anonymous requests are allowed, but credentials that
+// are presented must satisfy the policy or one of its Alternatives. Mode
+// combines the two.
+//
 // Roles is a coarse-grained list of roles that are allowed to access the
-// operation. Scopes are more granular permissions and are reserved for future
-// use.
+// operation. Scopes are more granular permissions, such as OAuth2 scopes. A
+// caller must hold one of the Roles, if any are listed, and every one of the
+// Scopes.
+//
+// Schemes records the kinds of credential the operation expects, so that
+// enforcement can differ between, say, bearer tokens and basic auth. When it
+// lists more than one scheme, all of them must be satisfied together. APIKey is
+// set when the operation is protected by an apiKey security scheme
+// and describes where the key must be presented. OpenIDConnectURL is set for
+// openIdConnect schemes and points at the provider's discovery document.
+// SessionCookie is set when the API key is a cookie (`in: cookie`), so
+// middleware can look for a session cookie instead of an Authorization
+// header; APIKey.Name is the cookie name.
+// MutualTLS is set when the caller must present a client certificate, which
+// middleware can check via the request's TLS connection state.
+//
+// Conditions and OwnerParam come from the x-authz extension. Conditions are
+// free-form expressions for the application to evaluate; OwnerParam names a
+// path parameter that must identify the caller (e.g. "userId").
+//
+// OperationID is the operation's `operationId`, when declared, so generated
+// code and audit logs can refer to an operation by a stable name. Summary and
+// Description are the operation's `summary` and `description`, for
+// documentation and reports. None of them are part of the security
+// requirements, and they are empty on Alternatives.
+//
+// PathParams lists the names of the parameters in the operation's path
+// template, in order (e.g. ["tenantId", "userId"] for
+// "/tenants/{tenantId}/users/{userId}"), so ownership and tenancy checks can
+// bind them to claims. It is empty on Alternatives.
+//
+// GRPCMethod is the full gRPC method name ("/users.v1.UserService/GetUser")
+// declared with the x-grpc-method extension, so the same policy can be
+// enforced on gRPC and Connect handlers. It is empty on Alternatives.
+//
+// GraphQLField is the GraphQL field ("Query.user") declared with the
+// x-graphql-field extension, whose resolver enforces the same policy. It is
+// empty on Alternatives.
+//
+// Tags are the operation's `tags`, in order, for grouping generated code
+// and reports. They are empty on Alternatives.
+//
+// PublicOverride is set when the operation was made public by the x-public
+// extension rather than by its security requirements, so audits can tell
+// the two apart.
+//
+// Deprecated is set for operations marked `deprecated: true`. Depending on the
+// parser's deprecated mode their policy may be tightened with an extra scope,
+// or Deny may be set, in which case every request must be rejected.
+//
+// Alternatives holds further acceptable requirement sets, mirroring the OR
+// semantics of an OpenAPI security array: a request is allowed if it
+// satisfies the policy itself or any one of its alternatives.
 type AuthPolicy struct {
-	RequireAuth bool
-	Roles       []string
-	Scopes      []string
+	RequireAuth      bool
+	OptionalAuth     bool
+	Roles            []string
+	Scopes           []string
+	Schemes          []SchemeType
+	APIKey           *APIKey
+	SessionCookie    bool
+	OpenIDConnectURL string
+	MutualTLS        bool
+	Conditions       []string
+	OwnerParam       string
+	OperationID      string
+	Summary          string
+	Description      string
+	PathParams       []string
+	GRPCMethod       string
+	GraphQLField     string
+	Tags             []string
+	PublicOverride   bool
+	Deprecated       bool
+	Deny             bool
+	Alternatives     []AuthPolicy
+}
+
+// AuthMode says whether an operation needs authentication.
+type AuthMode string
+
+const (
+	AuthPublic   AuthMode = "public"
+	AuthOptional AuthMode = "optional"
+	AuthRequired AuthMode = "required"
+)
+
+// Mode reports whether p is public, accepts optional authentication, or
+// requires it.
+func (p AuthPolicy) Mode() AuthMode {
+	switch {
+	case p.RequireAuth:
+		return AuthRequired
+	case p.OptionalAuth:
+		return AuthOptional
+	default:
+		return AuthPublic
+	}
+}
+
+// SchemeType identifies the kind of security scheme protecting an operation.
+type SchemeType string
+
+const (
+	SchemeBearer        SchemeType = "bearer"
+	SchemeBasic         SchemeType = "basic"
+	SchemeAPIKey        SchemeType = "apiKey"
+	SchemeOAuth2        SchemeType = "oauth2"
+	SchemeOpenIDConnect SchemeType = "openIdConnect"
+	SchemeMutualTLS     SchemeType = "mutualTLS"
+)
+
+// APIKey locates the API key credential for an operation. In is one of
+// "header", "query" or "cookie", and Name is the header, query parameter or
+// cookie name that carries the key.
+type APIKey struct {
+	Name string
+	In   string
 }
 
 // Config is the in-memory representation of all auth policies derived from a
 // specification.
+//
+// Webhooks holds the policies of an OpenAPI 3.1 `webhooks` section. Webhooks
+// are identified by name rather than path, so their RouteKey.Path is the
+// webhook name (e.g. "newVegetable"). It is nil when the spec declares none.
+//
+// Callbacks likewise holds the policies of operations declared under an
+// operation's `callbacks`, keyed by method and callback URL expression (e.g.
+// "{$request.body#/callbackUrl}").
+//
+// SecuritySchemes describes every scheme declared under
+// components.securitySchemes, keyed by name, so consumers know how
+// credentials are transported and where tokens come from.
+//
+// CaseInsensitivePaths is set when the route keys of Policies were
+// lower-cased, except for their parameter names, so lookups must lower-case
+// the path the same way.
+//
+// Warnings lists diagnostics that did not stop parsing: operations whose
+// security overrides different root-level security and, in lenient mode,
+// constructs the parser did not recognize and skipped.
 type Config struct {
-	Policies map[RouteKey]AuthPolicy
+	Policies  map[RouteKey]AuthPolicy
+	Webhooks  map[RouteKey]AuthPolicy
+	Callbacks map[RouteKey]AuthPolicy
+
+	SecuritySchemes map[string]SecurityScheme
+
+	CaseInsensitivePaths bool
+
+	// Sources lists the specs the policies were derived from, in the order
+	// they were given.
+	Sources []Source
+
+	Warnings []Warning
+}
+
+// Source identifies a parsed spec. Spec is its path or URL, "-" for stdin,
+// or empty for a spec parsed from memory, and SHA256 is the hex-encoded
+// SHA-256 of its contents as read. Overlays and files the spec references
+// through $ref are not covered by the hash.
+type Source struct {
+	Spec   string
+	SHA256 string
+}
+
+// SecurityScheme is the metadata of a declared security scheme. Type is the
+// OpenAPI scheme type ("http", "apiKey", "oauth2", "openIdConnect" or
+// "mutualTLS"). Scheme and BearerFormat apply to http schemes, Name and In
+// to apiKey schemes, Flows to oauth2 schemes and OpenIDConnectURL to
+// openIdConnect schemes.
+type SecurityScheme struct {
+	Type             string
+	Description      string
+	Scheme           string
+	BearerFormat     string
+	Name             string
+	In               string
+	Flows            []OAuthFlow
+	OpenIDConnectURL string
+}
+
+// OAuthFlow is one flow of an oauth2 scheme. Type is "implicit",
+// "password", "clientCredentials" or "authorizationCode", and Scopes lists
+// the scopes it declares, sorted. ScopeDescriptions maps the scopes
+// declared with a non-empty description to it.
+type OAuthFlow struct {
+	Type              string
+	AuthorizationURL  string
+	TokenURL          string
+	RefreshURL        string
+	Scopes            []string
+	ScopeDescriptions map[string]string
+}
+
+// Warning describes a problem found in a spec that did not stop parsing.
+// Spec is the spec's path or URL, Line and Column locate the offending node,
+// and Method and Path identify the operation, when the warning concerns one.
+type Warning struct {
+	Spec    string
+	Line    int
+	Column  int
+	Method  string
+	Path    string
+	Message string
+}
+
+func (w Warning) String() string {
+	s := fmt.Sprintf("%s:%d:%d: ", w.Spec, w.Line, w.Column)
+	if w.Method != "" {
+		s += w.Method + " "
+	}
+	if w.Path != "" {
+		s += w.Path + ": "
+	}
+	return s + w.Message
 }
@@ -0,0 +1,83 @@
+package parser
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxAliasDepth bounds how deeply aliases may be nested inside the nodes
+// they refer to.
+const maxAliasDepth = 64
+
+// maxAliasNodes bounds the size of a document once its aliases have been
+// expanded, so that a few nested aliases cannot blow a small spec up
+// exponentially ("billion laughs").
+const maxAliasNodes = 1_000_000
+
+// aliasExpander replaces YAML alias nodes (`*name`) with copies of the node
+// they refer to. Overlays, reference resolution and bundling all walk the
+// node tree, and none of them follow aliases, so they must be expanded
+// first. A recursive alias would otherwise expand forever, so it is
+// reported as an error.
+type aliasExpander struct {
+	// expanding tracks the anchored nodes currently being expanded.
+	expanding map[*yaml.Node]bool
+
+	// nodes counts the nodes visited so far.
+	nodes int
+}
+
+// expandAliases expands every alias below doc in place. Copies keep the
+// line and column of the anchored node they were made from.
+func expandAliases(doc *yaml.Node) error {
+	e := &aliasExpander{expanding: make(map[*yaml.Node]bool)}
+	return e.expand(doc, 0)
+}
+
+func (e *aliasExpander) expand(n *yaml.Node, depth int) error {
+	e.nodes++
+	if e.nodes > maxAliasNodes {
+		return fmt.Errorf("yaml aliases expand to more than %d nodes", maxAliasNodes)
+	}
+
+	for i, c := range n.Content {
+		if c.Kind != yaml.AliasNode {
+			if err := e.expand(c, depth); err != nil {
+				return err
+			}
+			continue
+		}
+
+		pos := position{Line: c.Line, Column: c.Column}
+		target := c.Alias
+		switch {
+		case target == nil:
+			return pos.at(fmt.Errorf("unknown yaml anchor %q", c.Value))
+		case e.expanding[target]:
+			return pos.at(fmt.Errorf("yaml alias *%s refers to a node that contains it", c.Value))
+		case depth >= maxAliasDepth:
+			return pos.at(fmt.Errorf("yaml alias *%s is nested more than %d aliases deep", c.Value, maxAliasDepth))
+		}
+
+		expanded := copyNode(target)
+		clearAnchors(expanded)
+		e.expanding[target] = true
+		err := e.expand(expanded, depth+1)
+		delete(e.expanding, target)
+		if err != nil {
+			return err
+		}
+		n.Content[i] = expanded
+	}
+	return nil
+}
+
+// clearAnchors removes anchor names from n and its descendants, so that an
+// expanded copy does not redefine the anchor it was copied from.
+func clearAnchors(n *yaml.Node) {
+	n.Anchor = ""
+	for _, c := range n.Content {
+		clearAnchors(c)
+	}
+}
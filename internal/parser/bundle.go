@@ -0,0 +1,95 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BundleSpec reads the spec at path, applies opts.Overlays and expands every
+// `$ref`, including those inside schemas, into a single self-contained
+// document. This is the view policies are derived from, so downstream
+// tooling can work from the same spec. Recursive references cannot be
+// expanded and are kept as they are. The result is YAML, or indented JSON
+// when asJSON is set. Each document of a YAML stream is bundled on its own,
+// so JSON output needs a single document.
+func BundleSpec(path string, opts Options, asJSON bool) ([]byte, error) {
+	return bundleSpec(path, opts, asJSON, false)
+}
+
+// EffectiveSpec is like BundleSpec, but also states on every operation the
+// security that applies to it once root security, opts.RootSecurity,
+// opts.Profile and x-public are taken into account, for publishing and for
+// tools that do not implement inheritance or the x- extensions.
+func EffectiveSpec(path string, opts Options, asJSON bool) ([]byte, error) {
+	switch opts.RootSecurity {
+	case "", RootSecurityOverride, RootSecurityMerge:
+	default:
+		return nil, fmt.Errorf("unknown root security strategy %q (want %s or %s)", opts.RootSecurity, RootSecurityOverride, RootSecurityMerge)
+	}
+	return bundleSpec(path, opts, asJSON, true)
+}
+
+func bundleSpec(path string, opts Options, asJSON, explicit bool) ([]byte, error) {
+	data, location, err := readSpec(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := splitDocuments(data)
+	if err != nil {
+		return nil, err
+	}
+	if asJSON && len(docs) > 1 {
+		return nil, fmt.Errorf("JSON output needs a single document, the spec has %d", len(docs))
+	}
+	for i, doc := range docs {
+		err := bundleDocument(doc, location, opts)
+		if err == nil && explicit {
+			err = explicitSecurity(doc, location, opts)
+		}
+		if err != nil {
+			if len(docs) > 1 {
+				return nil, fmt.Errorf("document %d: %w", i+1, err)
+			}
+			return nil, err
+		}
+	}
+
+	if asJSON {
+		var v any
+		if err := docs[0].Decode(&v); err != nil {
+			return nil, fmt.Errorf("encode bundle: %w", err)
+		}
+		out, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("encode bundle: %w", err)
+		}
+		return append(out, '\n'), nil
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			return nil, fmt.Errorf("encode bundle: %w", err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("encode bundle: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// bundleDocument expands doc in place.
+func bundleDocument(doc *yaml.Node, location string, opts Options) error {
+	if err := expandAliases(doc); err != nil {
+		return err
+	}
+	if err := applyOverlays(doc, opts.Overlays); err != nil {
+		return err
+	}
+	return resolveAllRefs(doc, location, opts)
+}
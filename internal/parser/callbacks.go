@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// callbackPolicies derives policies for the callback operations declared by
+// the operations of items, including callbacks nested inside callbacks. They
+// are keyed by method and callback URL expression, since callbacks are not
+// routed by path. The same expression may be declared by several operations
+// as long as they agree on its security.
+func callbackPolicies(root *openapiRoot, items map[string]*pathItem, opts Options) (map[model.RouteKey]model.AuthPolicy, error) {
+	policies := make(map[model.RouteKey]model.AuthPolicy)
+	origin := make(map[model.RouteKey]string)
+	if err := collectCallbacks(root, items, opts, policies, origin); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+func collectCallbacks(root *openapiRoot, items map[string]*pathItem, opts Options, dst map[model.RouteKey]model.AuthPolicy, origin map[model.RouteKey]string) error {
+	for _, rawPath := range slices.Sorted(maps.Keys(items)) {
+		item := items[rawPath]
+		if item == nil {
+			continue
+		}
+		ops, err := item.Operations()
+		if err != nil {
+			return item.pos.at(fmt.Errorf("path %s: %w", rawPath, err))
+		}
+
+		for _, method := range slices.Sorted(maps.Keys(ops)) {
+			op := ops[method]
+			if op == nil {
+				continue
+			}
+			for _, name := range slices.Sorted(maps.Keys(op.Callbacks)) {
+				callback := op.Callbacks[name]
+				source := fmt.Sprintf("callback %s of %s %s", name, method, rawPath)
+
+				policies, err := derivePathPolicies(root, callback, opts, noPrefixes)
+				if err != nil {
+					return fmt.Errorf("%s: %w", source, err)
+				}
+				if err := mergePolicies(dst, origin, policies, source); err != nil {
+					return err
+				}
+				if err := collectCallbacks(root, callback, opts, dst, origin); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
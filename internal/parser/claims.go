@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ClaimsMapping describes how the security schemes of a spec translate into
+// the roles and scopes of derived policies, for specs that do not follow the
+// "role:" naming convention. Claims use the same convention: "role:admin" is
+// a role and any other string a scope.
+//
+//	schemes:
+//	  AdminAuth:
+//	    implies: ["role:admin"]
+//	  OAuth2:
+//	    scopes:
+//	      admin: ["role:admin"]
+//	      vegetables: ["vegetable:read", "vegetable:write"]
+//	rewrite:
+//	  - match: '(\w+)s\.(\w+)'
+//	    replace: '$1:$2'
+//
+// Rewrite rules then rename the scopes of every derived policy, e.g.
+// "vegetables.write" to "vegetable:write", for specs written against an
+// identity provider with different scope naming.
+type ClaimsMapping struct {
+	Schemes map[string]SchemeClaims `yaml:"schemes"`
+	Rewrite []ScopeRewrite          `yaml:"rewrite"`
+}
+
+// SchemeClaims maps a single security scheme. Implies lists the claims
+// required whenever the scheme is used, and Scopes replaces each requested
+// scope with the claims it maps to. Scopes without an entry are kept as is.
+type SchemeClaims struct {
+	Implies []string            `yaml:"implies"`
+	Scopes  map[string][]string `yaml:"scopes"`
+}
+
+// ScopeRewrite renames the scopes matched by Match, which must match the
+// whole scope, to Replace. Replace may refer to submatches as in
+// regexp.Regexp.Expand ("$1").
+type ScopeRewrite struct {
+	Match   *regexp.Regexp
+	Replace string
+}
+
+// UnmarshalYAML decodes a rule and compiles its pattern, anchored at both
+// ends.
+func (r *ScopeRewrite) UnmarshalYAML(n *yaml.Node) error {
+	var raw struct {
+		Match   string `yaml:"match"`
+		Replace string `yaml:"replace"`
+	}
+	if err := n.Decode(&raw); err != nil {
+		return err
+	}
+	re, err := regexp.Compile("^(?:" + raw.Match + ")$")
+	if err != nil {
+		return fmt.Errorf("line %d: rewrite pattern: %w", n.Line, err)
+	}
+	r.Match, r.Replace = re, raw.Replace
+	return nil
+}
+
+// LoadClaimsMapping reads a ClaimsMapping from a YAML or JSON file.
+func LoadClaimsMapping(path string) (*ClaimsMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read claims mapping: %w", err)
+	}
+	var m ClaimsMapping
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("unmarshal claims mapping %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// claims translates the scopes requested for scheme into the claims they
+// map to. A nil mapping returns scopes unchanged.
+func (m *ClaimsMapping) claims(scheme string, scopes []string) []string {
+	if m == nil {
+		return scopes
+	}
+	mapped, ok := m.Schemes[scheme]
+	if !ok {
+		return scopes
+	}
+
+	claims := appendUnique(nil, mapped.Implies...)
+	for _, scope := range scopes {
+		if to, ok := mapped.Scopes[scope]; ok {
+			claims = appendUnique(claims, to...)
+		} else {
+			claims = appendUnique(claims, scope)
+		}
+	}
+	return claims
+}
+
+// rewriteScopes applies the rewrite rules to the scopes of policy and its
+// alternatives. The first matching rule wins; unmatched scopes are kept.
+func (m *ClaimsMapping) rewriteScopes(policy *model.AuthPolicy) {
+	if m == nil || len(m.Rewrite) == 0 {
+		return
+	}
+
+	var scopes []string
+	for _, scope := range policy.Scopes {
+		for _, rule := range m.Rewrite {
+			if match := rule.Match.FindStringSubmatchIndex(scope); match != nil {
+				scope = string(rule.Match.ExpandString(nil, rule.Replace, scope, match))
+				break
+			}
+		}
+		scopes = appendUnique(scopes, scope)
+	}
+	policy.Scopes = scopes
+
+	for i := range policy.Alternatives {
+		m.rewriteScopes(&policy.Alternatives[i])
+	}
+}
@@ -0,0 +1,46 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// Modes for tightening the policy of operations marked `deprecated: true`.
+const (
+	// DeprecatedAllow keeps the derived policy unchanged.
+	DeprecatedAllow = "allow"
+	// DeprecatedDeny denies every request to the operation.
+	DeprecatedDeny = "deny"
+	// DeprecatedScope additionally requires Options.DeprecatedScope.
+	DeprecatedScope = "scope"
+)
+
+// applyDeprecated marks policy as deprecated and tightens it according to
+// opts.DeprecatedMode.
+func applyDeprecated(policy *model.AuthPolicy, opts Options) error {
+	policy.Deprecated = true
+
+	switch opts.DeprecatedMode {
+	case "", DeprecatedAllow:
+	case DeprecatedDeny:
+		policy.RequireAuth = true
+		policy.OptionalAuth = false
+		policy.Deny = true
+		policy.Alternatives = nil
+	case DeprecatedScope:
+		if opts.DeprecatedScope == "" {
+			return fmt.Errorf("deprecated mode %q requires a scope", DeprecatedScope)
+		}
+		// The scope must hold whichever requirement the caller satisfies.
+		policy.RequireAuth = true
+		policy.OptionalAuth = false
+		policy.Scopes = appendUnique(policy.Scopes, opts.DeprecatedScope)
+		for i := range policy.Alternatives {
+			policy.Alternatives[i].Scopes = appendUnique(policy.Alternatives[i].Scopes, opts.DeprecatedScope)
+		}
+	default:
+		return fmt.Errorf("unknown deprecated mode %q", opts.DeprecatedMode)
+	}
+	return nil
+}
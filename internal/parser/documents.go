@@ -0,0 +1,51 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// splitDocuments decodes every document of data, which may be a YAML stream
+// of `---`-separated documents as produced by tools that concatenate specs.
+// Empty documents, such as one left by a trailing `---`, are skipped and not
+// counted. JSON specs always hold a single document.
+func splitDocuments(data []byte) ([]*yaml.Node, error) {
+	if err := validateFormat(data); err != nil {
+		return nil, err
+	}
+
+	var docs []*yaml.Node
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal spec: %w", err)
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Tag == "!!null" {
+			continue
+		}
+		docs = append(docs, &doc)
+	}
+	if len(docs) == 0 {
+		// An empty spec decodes like an empty document.
+		docs = append(docs, &yaml.Node{Kind: yaml.DocumentNode})
+	}
+	return docs, nil
+}
+
+// documentName identifies document i of the spec called name, for merge
+// conflicts between documents of the same stream.
+func documentName(name string, i int) string {
+	if name == "" {
+		return fmt.Sprintf("document %d", i+1)
+	}
+	return fmt.Sprintf("%s (document %d)", name, i+1)
+}
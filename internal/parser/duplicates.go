@@ -0,0 +1,60 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// checkDuplicatePaths looks for paths that only differ in the names of their
+// parameters, such as "/users/{id}" and "/users/{userId}". Routers treat them
+// as the same route, so they are an error in strict mode and a warning in
+// lenient mode.
+func checkDuplicatePaths(root *openapiRoot, opts Options) error {
+	byTemplate := make(map[string][]string)
+	for rawPath, item := range root.Paths {
+		if item == nil {
+			continue
+		}
+		template := pathParam.ReplaceAllString(rawPath, "{}")
+		byTemplate[template] = append(byTemplate[template], rawPath)
+	}
+
+	templates := make([]string, 0, len(byTemplate))
+	for template, paths := range byTemplate {
+		if len(paths) > 1 {
+			templates = append(templates, template)
+		}
+	}
+	sort.Strings(templates)
+
+	for _, template := range templates {
+		paths := byTemplate[template]
+		sort.Strings(paths)
+		msg := fmt.Sprintf("paths %s only differ in parameter names", strings.Join(paths, ", "))
+		if opts.Mode == ModeStrict {
+			return root.Paths[paths[1]].pos.at(fmt.Errorf("%s", msg))
+		}
+		for _, path := range paths[1:] {
+			root.warn(root.Paths[path].pos, "", path, msg)
+		}
+	}
+	return nil
+}
+
+// sortWarnings orders warnings by their position in the spec, so output does
+// not depend on map iteration order.
+func sortWarnings(warnings []model.Warning) {
+	sort.SliceStable(warnings, func(i, j int) bool {
+		a, b := warnings[i], warnings[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return a.Message < b.Message
+	})
+}
@@ -0,0 +1,184 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// itemExtensions are the path item extensions an operation inherits.
+var itemExtensions = []string{"x-authz", "x-roles", "x-scopes", "x-env"}
+
+// explicitSecurity rewrites the bundled doc so that every operation, webhook
+// and callback states its effective security, and x-public and x-env are
+// gone. Path item x-authz, x-roles and x-scopes are copied onto the
+// operations that inherit them; roles cannot be stated as security
+// requirements, so these extensions remain.
+func explicitSecurity(doc *yaml.Node, location string, opts Options) error {
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	// Overlays were applied while bundling.
+	decodeOpts := opts
+	decodeOpts.Overlays = nil
+	root, err := decodeRoot(doc, location, decodeOpts)
+	if err != nil {
+		return err
+	}
+
+	top := doc.Content[0]
+	if err := explicitItems(root, mappingValue(top, "paths"), root.Paths, opts); err != nil {
+		return err
+	}
+	if err := explicitItems(root, mappingValue(top, "webhooks"), root.Webhooks, opts); err != nil {
+		return fmt.Errorf("webhooks: %w", err)
+	}
+	return nil
+}
+
+// explicitItems makes the security of every operation of the path items in
+// the mapping node items explicit. decoded holds the same path items.
+func explicitItems(root *openapiRoot, items *yaml.Node, decoded map[string]*pathItem, opts Options) error {
+	if items == nil || items.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(items.Content); i += 2 {
+		rawPath := items.Content[i].Value
+		item := decoded[rawPath]
+		if item == nil || items.Content[i+1].Kind != yaml.MappingNode {
+			continue
+		}
+		// Path items expanded from the same $ref share their nodes.
+		itemNode := copyNode(items.Content[i+1])
+		items.Content[i+1] = itemNode
+
+		ops, err := item.Operations()
+		if err != nil {
+			return item.pos.at(fmt.Errorf("path %s: %w", rawPath, err))
+		}
+		for method, op := range ops {
+			opNode := operationNode(itemNode, method)
+			if op == nil || opNode == nil || opNode.Kind != yaml.MappingNode {
+				continue
+			}
+			explicitOperation(root, item, op, itemNode, opNode, opts)
+
+			callbacks := mappingValue(opNode, "callbacks")
+			if callbacks == nil || callbacks.Kind != yaml.MappingNode {
+				continue
+			}
+			for j := 0; j+1 < len(callbacks.Content); j += 2 {
+				name := callbacks.Content[j].Value
+				if err := explicitItems(root, callbacks.Content[j+1], op.Callbacks[name], opts); err != nil {
+					return fmt.Errorf("callback %s of %s %s: %w", name, method, rawPath, err)
+				}
+			}
+		}
+		for _, key := range itemExtensions {
+			deleteKey(itemNode, key)
+		}
+	}
+	return nil
+}
+
+// explicitOperation sets the security of opNode, the node of op, and copies
+// the profile's and the path item's extensions onto it.
+func explicitOperation(root *openapiRoot, item *pathItem, op *operation, itemNode, opNode *yaml.Node, opts Options) {
+	o := op.withProfile(item, opts.Profile)
+	if env := profileNode(opNode, itemNode, opts.Profile); env != nil {
+		if v := mappingValue(env, "x-authz"); v != nil {
+			setKey(opNode, "x-authz", copyNode(v))
+		}
+		if mappingValue(env, "x-roles") != nil || mappingValue(env, "x-scopes") != nil {
+			deleteKey(opNode, "x-roles")
+			deleteKey(opNode, "x-scopes")
+			for _, key := range []string{"x-roles", "x-scopes"} {
+				if v := mappingValue(env, key); v != nil {
+					setKey(opNode, key, copyNode(v))
+				}
+			}
+		}
+	}
+	deleteKey(opNode, "x-env")
+	deleteKey(opNode, "x-public")
+
+	sec := []securityRequirement{}
+	if o.Public {
+		deleteKey(opNode, "x-authz")
+		deleteKey(opNode, "x-roles")
+		deleteKey(opNode, "x-scopes")
+	} else {
+		sec = append(sec, effectiveSecurity(root, o, opts)...)
+		if mappingValue(opNode, "x-roles") == nil && mappingValue(opNode, "x-scopes") == nil {
+			for _, key := range []string{"x-roles", "x-scopes"} {
+				if v := mappingValue(itemNode, key); v != nil {
+					setKey(opNode, key, copyNode(v))
+				}
+			}
+		}
+		if v := mappingValue(itemNode, "x-authz"); v != nil && mappingValue(opNode, "x-authz") == nil {
+			setKey(opNode, "x-authz", copyNode(v))
+		}
+	}
+
+	var node yaml.Node
+	// Encoding a slice of string maps cannot fail.
+	_ = node.Encode(sec)
+	setKey(opNode, "security", &node)
+}
+
+// operationNode returns the node of the method operation of the path item
+// node item, looking under x-methods for non-standard methods.
+func operationNode(item *yaml.Node, method string) *yaml.Node {
+	if n := mappingValue(item, strings.ToLower(method)); n != nil {
+		return n
+	}
+	custom := mappingValue(item, "x-methods")
+	if custom == nil {
+		return nil
+	}
+	for i := 0; i+1 < len(custom.Content); i += 2 {
+		if strings.ToUpper(custom.Content[i].Value) == method {
+			return custom.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// profileNode returns the x-env entry for profile that applies to opNode,
+// its own or else the path item's, like operation.withProfile.
+func profileNode(opNode, itemNode *yaml.Node, profile string) *yaml.Node {
+	if profile == "" {
+		return nil
+	}
+	for _, n := range []*yaml.Node{opNode, itemNode} {
+		if env := mappingValue(n, "x-env"); env != nil {
+			if v := mappingValue(env, profile); v != nil && v.Kind == yaml.MappingNode {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+// setKey sets key of the mapping node n to value, adding it when missing.
+func setKey(n *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content[i+1] = value
+			return
+		}
+	}
+	n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+// deleteKey removes key from the mapping node n.
+func deleteKey(n *yaml.Node, key string) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content = append(n.Content[:i:i], n.Content[i+2:]...)
+			return
+		}
+	}
+}
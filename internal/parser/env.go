@@ -0,0 +1,58 @@
+package parser
+
+// envOverride is one profile of the `x-env` extension, which lets an
+// operation or path item change its authorization per environment:
+//
+//	x-public: true
+//	x-env:
+//	  prod:
+//	    x-public: false
+//	    x-roles: [sre]
+//
+// Only the fields a profile sets replace the operation's own.
+type envOverride struct {
+	Security []securityRequirement `yaml:"security"`
+	Public   *bool                 `yaml:"x-public"`
+	Authz    *authzExtension       `yaml:"x-authz"`
+	XRoles   []string              `yaml:"x-roles"`
+	XScopes  []string              `yaml:"x-scopes"`
+}
+
+// withProfile returns op with the x-env overrides of profile applied. The
+// operation's own x-env entry for profile takes precedence over the path
+// item's. op itself is returned unchanged when neither declares one.
+func (op *operation) withProfile(item *pathItem, profile string) *operation {
+	if profile == "" {
+		return op
+	}
+	env := op.XEnv[profile]
+	if env == nil {
+		env = item.XEnv[profile]
+	}
+	if env == nil {
+		return op
+	}
+
+	o := *op
+	if env.Security != nil {
+		o.Security = env.Security
+	}
+	if env.Authz != nil {
+		o.Authz = env.Authz
+	}
+	if env.XRoles != nil || env.XScopes != nil {
+		o.XRoles, o.XScopes = env.XRoles, env.XScopes
+	}
+
+	switch {
+	case env.Public != nil && *env.Public:
+		// A profile that makes the operation public drops whatever it
+		// required, so x-public does not conflict with it.
+		o.Public = true
+		o.Security, o.Authz, o.XRoles, o.XScopes = nil, nil, nil, nil
+	case env.Public != nil || env.Security != nil || env.Authz != nil || env.XRoles != nil || env.XScopes != nil:
+		// Any other requirement the profile states replaces x-public.
+		o.Public = false
+	}
+	return &o
+}
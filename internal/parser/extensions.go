@@ -0,0 +1,143 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// authzExtension is the `x-authz` vendor extension, which lets a spec state
+// authorization intent directly instead of encoding it in security scopes:
+//
+//	x-authz:
+//	  mode: override      # or "augment" (the default)
+//	  roles: [admin]
+//	  scopes: [vegetable:write]
+//	  conditions: ["tenant == claims.tenant"]
+//	  owner: userId       # path parameter that must match the caller
+type authzExtension struct {
+	Mode       string   `yaml:"mode"`
+	Roles      []string `yaml:"roles"`
+	Scopes     []string `yaml:"scopes"`
+	Conditions []string `yaml:"conditions"`
+	Owner      string   `yaml:"owner"`
+}
+
+// authzExtensions returns the authorization extensions that apply to op in
+// the order they are applied. The shorthand `x-roles` and `x-scopes`
+// extensions always augment the derived policy and are applied before
+// `x-authz`, so an x-authz override takes precedence over them.
+//
+// Extensions declared on the path item are inherited unless the operation
+// declares its own: an operation's x-authz replaces the path item's x-authz,
+// and its x-roles/x-scopes replace the path item's x-roles/x-scopes.
+func (op *operation) authzExtensions(item *pathItem) []*authzExtension {
+	roles, scopes := op.XRoles, op.XScopes
+	if roles == nil && scopes == nil {
+		roles, scopes = item.XRoles, item.XScopes
+	}
+	authz := op.Authz
+	if authz == nil {
+		authz = item.Authz
+	}
+
+	var exts []*authzExtension
+	if len(roles) > 0 || len(scopes) > 0 {
+		exts = append(exts, &authzExtension{Roles: roles, Scopes: scopes})
+	}
+	if authz != nil {
+		exts = append(exts, authz)
+	}
+	return exts
+}
+
+// checkPublic rejects an `x-public: true` operation that also states
+// authorization requirements of its own, since it is unclear which one the
+// author meant. Inherited root-level security and path-item extensions are
+// what x-public exists to override, so they are ignored.
+func (op *operation) checkPublic() error {
+	switch {
+	case len(op.Security) > 0:
+		return fmt.Errorf("x-public: operation also declares security requirements")
+	case op.Authz != nil, len(op.XRoles) > 0, len(op.XScopes) > 0:
+		return fmt.Errorf("x-public: operation also declares x-authz, x-roles or x-scopes")
+	}
+	return nil
+}
+
+// applyAuthz layers an x-authz extension on top of a policy derived from
+// security requirements. In "augment" mode its roles and scopes are added to
+// the derived ones; in "override" mode they replace them. Either way the
+// operation requires authentication, and the extension applies to every
+// alternative since it describes authorization rather than credentials.
+func applyAuthz(policy *model.AuthPolicy, ext *authzExtension, path string) error {
+	if ext == nil {
+		return nil
+	}
+
+	override := false
+	switch ext.Mode {
+	case "", "augment":
+	case "override":
+		override = true
+	default:
+		return fmt.Errorf("x-authz: unknown mode %q (want augment or override)", ext.Mode)
+	}
+
+	if ext.Owner != "" && !strings.Contains(path, "{"+ext.Owner+"}") {
+		return fmt.Errorf("x-authz: owner parameter %q is not a path parameter of %s", ext.Owner, path)
+	}
+
+	apply := func(p *model.AuthPolicy) {
+		p.RequireAuth = true
+		p.OptionalAuth = false
+		if override {
+			p.Roles = append([]string(nil), ext.Roles...)
+			p.Scopes = append([]string(nil), ext.Scopes...)
+		} else {
+			p.Roles = appendUnique(p.Roles, ext.Roles...)
+			p.Scopes = appendUnique(p.Scopes, ext.Scopes...)
+		}
+		p.Conditions = appendUnique(p.Conditions, ext.Conditions...)
+		if ext.Owner != "" {
+			p.OwnerParam = ext.Owner
+		}
+	}
+
+	apply(policy)
+	for i := range policy.Alternatives {
+		apply(&policy.Alternatives[i])
+	}
+	return nil
+}
+
+// checkGRPCMethod rejects an `x-grpc-method` that is not a full gRPC method
+// name such as "/users.v1.UserService/GetUser".
+func checkGRPCMethod(name string) error {
+	if name == "" {
+		return nil
+	}
+	service, method, ok := strings.Cut(strings.TrimPrefix(name, "/"), "/")
+	if !strings.HasPrefix(name, "/") || !ok || service == "" || method == "" || strings.Contains(method, "/") {
+		return fmt.Errorf("x-grpc-method: %q is not a full method name like /package.Service/Method", name)
+	}
+	return nil
+}
+
+// graphQLName matches a GraphQL name (GraphQL spec section 2.1.9).
+var graphQLName = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*$`)
+
+// checkGraphQLField rejects an `x-graphql-field` that is not a type and
+// field name such as "Query.user".
+func checkGraphQLField(name string) error {
+	if name == "" {
+		return nil
+	}
+	typ, field, ok := strings.Cut(name, ".")
+	if !ok || !graphQLName.MatchString(typ) || !graphQLName.MatchString(field) {
+		return fmt.Errorf("x-graphql-field: %q is not a field name like Query.user", name)
+	}
+	return nil
+}
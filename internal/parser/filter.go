@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// pathFilter selects the spec paths that policies are derived for. A path is
+// kept if it matches any include pattern (or there are none) and no exclude
+// pattern.
+//
+// Patterns are matched segment by segment against the path as declared in
+// the spec: `*` matches within a single segment, as in path.Match, and a
+// `**` segment matches any number of segments, including none. So
+// "/api/v1/**" matches "/api/v1" and "/api/v1/users/{id}".
+type pathFilter struct {
+	include []string
+	exclude []string
+}
+
+func newPathFilter(opts Options) (pathFilter, error) {
+	for _, pattern := range append(append([]string(nil), opts.IncludePaths...), opts.ExcludePaths...) {
+		for _, segment := range splitPath(pattern) {
+			if _, err := path.Match(segment, ""); err != nil {
+				return pathFilter{}, fmt.Errorf("invalid path pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return pathFilter{include: opts.IncludePaths, exclude: opts.ExcludePaths}, nil
+}
+
+func (f pathFilter) keep(rawPath string) bool {
+	for _, pattern := range f.exclude {
+		if matchPath(pattern, rawPath) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, pattern := range f.include {
+		if matchPath(pattern, rawPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply drops the path items f does not keep, and with them their
+// callbacks.
+func (f pathFilter) apply(items map[string]*pathItem) {
+	if len(f.include) == 0 && len(f.exclude) == 0 {
+		return
+	}
+	for rawPath := range items {
+		if !f.keep(rawPath) {
+			delete(items, rawPath)
+		}
+	}
+}
+
+// matchPath reports whether p matches pattern.
+func matchPath(pattern, p string) bool {
+	return matchSegments(splitPath(pattern), splitPath(p))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
+
+func splitPath(p string) []string {
+	return strings.Split(strings.Trim(p, "/"), "/")
+}
@@ -0,0 +1,41 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// specFormat is the serialization a spec document is written in.
+type specFormat int
+
+const (
+	formatYAML specFormat = iota
+	formatJSON
+)
+
+// sniffFormat guesses the format of data from its first significant byte. A
+// JSON document always starts with an object or array; anything else is
+// treated as YAML.
+func sniffFormat(data []byte) specFormat {
+	trimmed := bytes.TrimLeft(data, " \t\r\n\ufeff")
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return formatJSON
+	}
+	return formatYAML
+}
+
+// validateFormat reports syntax errors using the detected format's own
+// decoder. JSON is a subset of YAML, so JSON documents are still decoded with
+// the YAML decoder afterwards, but encoding/json produces far clearer error
+// messages for malformed JSON.
+func validateFormat(data []byte) error {
+	if sniffFormat(data) != formatJSON {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("invalid JSON spec: %w", err)
+	}
+	return nil
+}
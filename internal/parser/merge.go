@@ -0,0 +1,186 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// mergeConfigs combines the policies of several specs into one Config.
+// sources[i] names the spec cfgs[i] was parsed from and is used in error
+// messages. The same method+path (or webhook, or callback) may appear in more
+// than one spec only if every occurrence derives an identical policy.
+func mergeConfigs(sources []string, cfgs []*model.Config) (*model.Config, error) {
+	merged := &model.Config{Policies: make(map[model.RouteKey]model.AuthPolicy)}
+	if len(cfgs) > 0 {
+		// Every spec is parsed with the same options.
+		merged.CaseInsensitivePaths = cfgs[0].CaseInsensitivePaths
+	}
+	webhooks := make(map[model.RouteKey]model.AuthPolicy)
+	callbacks := make(map[model.RouteKey]model.AuthPolicy)
+
+	policyOrigin := make(map[model.RouteKey]string)
+	webhookOrigin := make(map[model.RouteKey]string)
+	callbackOrigin := make(map[model.RouteKey]string)
+	schemeOrigin := make(map[string]string)
+	for i, cfg := range cfgs {
+		if err := mergePolicies(merged.Policies, policyOrigin, cfg.Policies, sources[i]); err != nil {
+			return nil, err
+		}
+		if err := mergePolicies(webhooks, webhookOrigin, cfg.Webhooks, sources[i]); err != nil {
+			return nil, fmt.Errorf("webhooks: %w", err)
+		}
+		if err := mergePolicies(callbacks, callbackOrigin, cfg.Callbacks, sources[i]); err != nil {
+			return nil, fmt.Errorf("callbacks: %w", err)
+		}
+		if err := mergeSchemes(merged, schemeOrigin, cfg.SecuritySchemes, sources[i]); err != nil {
+			return nil, err
+		}
+		merged.Sources = append(merged.Sources, cfg.Sources...)
+		merged.Warnings = append(merged.Warnings, cfg.Warnings...)
+	}
+
+	if len(webhooks) > 0 {
+		merged.Webhooks = webhooks
+	}
+	if len(callbacks) > 0 {
+		merged.Callbacks = callbacks
+	}
+	return merged, nil
+}
+
+// mergeSchemes adds the security schemes declared by source to merged. Specs
+// may share a scheme name only if they declare it identically, since
+// policies refer to schemes by name.
+func mergeSchemes(merged *model.Config, origin map[string]string, schemes map[string]model.SecurityScheme, source string) error {
+	for name, scheme := range schemes {
+		if existing, ok := merged.SecuritySchemes[name]; ok {
+			if !reflect.DeepEqual(existing, scheme) {
+				return fmt.Errorf("conflicting security scheme %s: declared differently by %s and %s", name, origin[name], source)
+			}
+			continue
+		}
+		if merged.SecuritySchemes == nil {
+			merged.SecuritySchemes = make(map[string]model.SecurityScheme)
+		}
+		merged.SecuritySchemes[name] = scheme
+		origin[name] = source
+	}
+	return nil
+}
+
+// ConflictError reports a route for which two sources derive different
+// policies. A source is the spec a policy came from when merging specs, or
+// the spec path it was declared under when several paths normalize to the
+// same route.
+type ConflictError struct {
+	Method   string
+	Path     string
+	Sources  [2]string
+	Policies [2]model.AuthPolicy
+}
+
+// newConflictError orders the two sides by source, so the message does not
+// depend on map iteration order.
+func newConflictError(key model.RouteKey, sourceA string, a model.AuthPolicy, sourceB string, b model.AuthPolicy) *ConflictError {
+	if sourceB < sourceA {
+		sourceA, sourceB, a, b = sourceB, sourceA, b, a
+	}
+	return &ConflictError{
+		Method:   key.Method,
+		Path:     key.Path,
+		Sources:  [2]string{sourceA, sourceB},
+		Policies: [2]model.AuthPolicy{a, b},
+	}
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("conflicting security for %s %s: %s has %s, %s has %s",
+		e.Method, e.Path, e.Sources[0], describePolicy(e.Policies[0]), e.Sources[1], describePolicy(e.Policies[1]))
+}
+
+// mergePolicies adds policies from source into dst, recording where each key
+// came from in origin.
+func mergePolicies(dst map[model.RouteKey]model.AuthPolicy, origin map[model.RouteKey]string, policies map[model.RouteKey]model.AuthPolicy, source string) error {
+	for key, policy := range policies {
+		if existing, ok := dst[key]; ok {
+			if !samePolicy(existing, policy) {
+				return newConflictError(key, origin[key], existing, source, policy)
+			}
+			continue
+		}
+		dst[key] = policy
+		origin[key] = source
+	}
+	return nil
+}
+
+// samePolicy reports whether a and b enforce the same requirements. Role and
+// scope order is not significant, and descriptive fields such as OperationID,
+// Summary and PathParams are ignored because they do not affect enforcement.
+func samePolicy(a, b model.AuthPolicy) bool {
+	return a.RequireAuth == b.RequireAuth &&
+		a.OptionalAuth == b.OptionalAuth &&
+		sameSet(a.Roles, b.Roles) &&
+		sameSet(a.Scopes, b.Scopes) &&
+		sameSchemes(a.Schemes, b.Schemes) &&
+		sameAPIKey(a.APIKey, b.APIKey) &&
+		a.OpenIDConnectURL == b.OpenIDConnectURL &&
+		a.MutualTLS == b.MutualTLS &&
+		sameSet(a.Conditions, b.Conditions) &&
+		a.OwnerParam == b.OwnerParam &&
+		a.Deny == b.Deny &&
+		slices.EqualFunc(a.Alternatives, b.Alternatives, samePolicy)
+}
+
+func sameSchemes(a, b []model.SchemeType) bool {
+	as := make([]string, len(a))
+	for i, s := range a {
+		as[i] = string(s)
+	}
+	bs := make([]string, len(b))
+	for i, s := range b {
+		bs[i] = string(s)
+	}
+	return sameSet(as, bs)
+}
+
+func sameAPIKey(a, b *model.APIKey) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func sameSet(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+func describePolicy(p model.AuthPolicy) string {
+	if p.Deny {
+		return "denied access"
+	}
+	if p.OptionalAuth {
+		return "optional auth"
+	}
+	if !p.RequireAuth {
+		return "public access"
+	}
+	if p.APIKey != nil {
+		return fmt.Sprintf("%s apiKey %q with roles %v and scopes %v", p.APIKey.In, p.APIKey.Name, p.Roles, p.Scopes)
+	}
+	if len(p.Schemes) > 0 {
+		schemes := make([]string, len(p.Schemes))
+		for i, s := range p.Schemes {
+			schemes[i] = string(s)
+		}
+		return fmt.Sprintf("%s auth with roles %v and scopes %v", strings.Join(schemes, "+"), p.Roles, p.Scopes)
+	}
+	return fmt.Sprintf("auth with roles %v and scopes %v", p.Roles, p.Scopes)
+}
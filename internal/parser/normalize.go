@@ -0,0 +1,189 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// Routers whose route pattern syntax route keys can be normalized to.
+const (
+	RouterChi      = "chi"
+	RouterGin      = "gin"
+	RouterEcho     = "echo"
+	RouterFiber    = "fiber"
+	RouterGorilla  = "gorilla"
+	RouterServeMux = "servemux"
+)
+
+// pathParam matches an OpenAPI path template parameter such as "{id}".
+var pathParam = regexp.MustCompile(`\{([^{}/]+)\}`)
+
+// pathParams returns the names of the parameters in the path template
+// rawPath, in order. Callback runtime expressions such as
+// "{$request.query.url}" are not parameters and are skipped.
+func pathParams(rawPath string) []string {
+	var names []string
+	for _, m := range pathParam.FindAllStringSubmatch(rawPath, -1) {
+		if !strings.HasPrefix(m[1], "$") {
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// normalizePath rewrites an OpenAPI path template into the pattern syntax
+// the given router reports for matched routes: chi's RoutePattern, gin's
+// FullPath, echo's and fiber's route paths, gorilla's GetPathTemplate or the
+// net/http ServeMux pattern. chi, gorilla and ServeMux share the OpenAPI
+// "{param}" syntax; gin, echo and fiber use ":param".
+func normalizePath(path, router string) (string, error) {
+	switch router {
+	case "", RouterChi, RouterGorilla, RouterServeMux:
+		return path, nil
+	case RouterGin, RouterEcho, RouterFiber:
+		return pathParam.ReplaceAllString(path, ":$1"), nil
+	default:
+		return "", fmt.Errorf("unknown router %q", router)
+	}
+}
+
+// RoutePattern rewrites the OpenAPI path template path into the pattern
+// syntax of router, like route keys are with Options.Router.
+func RoutePattern(path, router string) (string, error) {
+	return normalizePath(path, router)
+}
+
+// Trailing slash handling.
+const (
+	// TrailingSlashStrip removes the trailing slash of every path other
+	// than "/", so "/users/" and "/users" become the same route.
+	TrailingSlashStrip = "strip"
+)
+
+// Handling of routes that several spec paths collapse to.
+const (
+	// DuplicatesMerge keeps a single route when every path that collapses to
+	// it derives the same policy. It is the default.
+	DuplicatesMerge = "merge"
+	// DuplicatesError rejects any two paths that collapse to the same route.
+	DuplicatesError = "error"
+)
+
+// canonicalPath applies the casing and trailing slash handling of opts to
+// path.
+func canonicalPath(path string, opts Options) (string, error) {
+	if opts.CaseInsensitivePaths {
+		path = lowerStaticPath(path)
+	}
+	switch opts.TrailingSlash {
+	case "":
+		return path, nil
+	case TrailingSlashStrip:
+		if len(path) > 1 {
+			path = strings.TrimSuffix(path, "/")
+		}
+		return path, nil
+	default:
+		return "", fmt.Errorf("unknown trailing slash handling %q", opts.TrailingSlash)
+	}
+}
+
+// lowerStaticPath lower-cases path except for its parameter names, which
+// handlers look parameters up by. Parameters are {name} and, in router
+// patterns, segments starting with : or *. Generated code normalizes route
+// patterns with a copy of this function, so the two must agree.
+func lowerStaticPath(path string) string {
+	segs := strings.Split(path, "/")
+	for i, seg := range segs {
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			continue
+		}
+		var b strings.Builder
+		depth := 0
+		for _, r := range seg {
+			switch r {
+			case '{':
+				depth++
+			case '}':
+				depth--
+			}
+			if depth == 0 {
+				r = unicode.ToLower(r)
+			}
+			b.WriteRune(r)
+		}
+		segs[i] = b.String()
+	}
+	return strings.Join(segs, "/")
+}
+
+// normalizeRoutes canonicalizes casing and trailing slashes and rewrites every route key
+// of policies for opts.Router. Distinct spec paths that collapse to the same
+// method and pattern are merged or rejected according to opts.Duplicates.
+// Merged routes keep the policy of the path that sorts first, so the
+// descriptive fields samePolicy ignores do not change between runs. In
+// lenient mode, routes that would be rejected are reported as warnings on
+// root and also keep that first policy.
+func normalizeRoutes(root *openapiRoot, policies map[model.RouteKey]model.AuthPolicy, opts Options) (map[model.RouteKey]model.AuthPolicy, error) {
+	switch opts.Duplicates {
+	case "", DuplicatesMerge, DuplicatesError:
+	default:
+		return nil, fmt.Errorf("unknown duplicate handling %q", opts.Duplicates)
+	}
+
+	normalized := make(map[model.RouteKey]model.AuthPolicy, len(policies))
+	origin := make(map[model.RouteKey]string, len(policies))
+	keys := make([]model.RouteKey, 0, len(policies))
+	for key := range policies {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Path == keys[j].Path {
+			return keys[i].Method < keys[j].Method
+		}
+		return keys[i].Path < keys[j].Path
+	})
+
+	for _, key := range keys {
+		policy := policies[key]
+		path, err := canonicalPath(key.Path, opts)
+		if err != nil {
+			return nil, err
+		}
+		if path, err = normalizePath(path, opts.Router); err != nil {
+			return nil, err
+		}
+
+		nkey := model.RouteKey{Method: key.Method, Path: path}
+		if existing, ok := normalized[nkey]; ok {
+			var err error
+			switch {
+			case !samePolicy(existing, policy):
+				err = newConflictError(nkey, origin[nkey], existing, key.Path, policy)
+			case opts.Duplicates == DuplicatesError:
+				paths := []string{origin[nkey], key.Path}
+				sort.Strings(paths)
+				err = fmt.Errorf("duplicate route %s %s: declared as both %s and %s", nkey.Method, nkey.Path, paths[0], paths[1])
+			}
+			if err != nil && opts.Mode != ModeLenient {
+				return nil, err
+			}
+			if err != nil {
+				var pos position
+				if item := root.Paths[key.Path]; item != nil {
+					pos = item.pos
+				}
+				root.warn(pos, key.Method, key.Path, fmt.Sprintf("%v; keeping the policy of %s", err, origin[nkey]))
+			}
+			continue
+		}
+		normalized[nkey] = policy
+		origin[nkey] = key.Path
+	}
+	return normalized, nil
+}
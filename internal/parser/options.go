@@ -0,0 +1,166 @@
+package parser
+
+import (
+	"runtime"
+	"time"
+)
+
+// Options controls optional parser behaviour. The zero value reproduces the
+// behaviour of ParseConfig.
+type Options struct {
+	// AllowRemoteRefs enables resolving `$ref` pointers to http(s) URLs. It is
+	// off by default so that parsing never reaches out to the network
+	// unexpectedly.
+	AllowRemoteRefs bool
+
+	// RemoteTimeout bounds each remote fetch. Zero means defaultRemoteTimeout.
+	RemoteTimeout time.Duration
+
+	// RemoteCacheDir, when set, persists fetched remote documents on disk so
+	// repeated runs do not refetch them. A spec loaded from a URL is cached
+	// here too and revalidated with its ETag.
+	RemoteCacheDir string
+
+	// RemoteCacheTTL is how long an entry in RemoteCacheDir stays fresh. Zero
+	// means cached documents never expire.
+	RemoteCacheTTL time.Duration
+
+	// SpecAuthHeader is sent when the spec itself is loaded from a URL. It is
+	// either a full "Name: value" header or a bare value for Authorization.
+	SpecAuthHeader string
+
+	// BearerSchemes names the security schemes treated as bearer-token auth
+	// regardless of their declared type (e.g. "JWT" or "OAuth2"). When empty,
+	// only "BearerAuth" is. Schemes declared as `type: http, scheme: bearer`
+	// are always treated as bearer-token auth.
+	BearerSchemes []string
+
+	// ServerBasePath prefixes every route key with the path of the spec's
+	// servers (e.g. "/api/v1" for `url: https://example.com/api/v1`), so keys
+	// match the routes as actually mounted. A path item's own servers take
+	// precedence over the root servers, and when several servers declare
+	// different base paths each route is emitted once per base path.
+	ServerBasePath bool
+
+	// Router rewrites route keys into the pattern syntax of the named router
+	// (one of the Router* constants), e.g. "/users/:id" for gin. Empty keeps
+	// the OpenAPI "{param}" syntax, which chi, gorilla and ServeMux share.
+	Router string
+
+	// TrailingSlash canonicalizes trailing slashes in route keys;
+	// TrailingSlashStrip turns "/users/" into "/users". Empty keeps paths as
+	// declared.
+	TrailingSlash string
+
+	// CaseInsensitivePaths lower-cases route keys, except for their
+	// parameter names, for APIs served behind gateways that match paths
+	// case-insensitively. Lookups must normalize the request's route pattern
+	// the same way, which generated code does in LookupPolicy.
+	CaseInsensitivePaths bool
+
+	// Duplicates controls what happens when several spec paths collapse to
+	// the same route after trailing slash and router normalization:
+	// DuplicatesMerge (the default when empty) keeps one route if they agree
+	// on its policy, and DuplicatesError rejects them outright.
+	Duplicates string
+
+	// DeprecatedMode controls the policy of operations marked `deprecated:
+	// true`: DeprecatedAllow (the default when empty) keeps it unchanged,
+	// DeprecatedDeny denies them outright and DeprecatedScope additionally
+	// requires DeprecatedScope.
+	DeprecatedMode  string
+	DeprecatedScope string
+
+	// ClaimsMapping, when set, translates each scheme's requested scopes into
+	// the roles and scopes of the derived policy.
+	ClaimsMapping *ClaimsMapping
+
+	// Overlays lists OpenAPI Overlay documents applied, in order, to every
+	// spec before policies are derived.
+	Overlays []string
+
+	// IncludePaths and ExcludePaths select which spec paths policies are
+	// derived for, using glob patterns such as "/api/v1/**" (see
+	// pathFilter). Excluded paths and their callbacks are dropped before
+	// they are inspected, so they cannot cause errors or warnings. When
+	// IncludePaths is empty, every path not excluded is kept.
+	IncludePaths []string
+	ExcludePaths []string
+
+	// RootSecurity decides how an operation's own security combines with
+	// the root security: RootSecurityOverride (the default when empty)
+	// replaces it, as the OpenAPI specification requires, and
+	// RootSecurityMerge accepts the requirements of both.
+	RootSecurity string
+
+	// Profile selects the `x-env` overrides applied to operations, e.g.
+	// "prod". When empty, x-env is ignored.
+	Profile string
+
+	// Concurrency bounds how many specs ParseConfigsWithOptions parses at
+	// once. Zero means runtime.GOMAXPROCS(0).
+	Concurrency int
+
+	// Mode controls how constructs the parser does not recognize are
+	// handled: ModeStrict rejects them and ModeLenient reports them as
+	// Config.Warnings. When empty, requirements using an unsupported or
+	// undeclared scheme are skipped silently, and an operation none of whose
+	// requirements can be enforced is an error.
+	Mode string
+
+	// Fallback decides the policy of an operation that has security
+	// requirements but none the parser can enforce: FallbackError rejects
+	// the spec, FallbackRequireAuth only requires authentication and
+	// FallbackPublic makes the operation public. Both of the latter report a
+	// warning. When empty, it is FallbackRequireAuth in lenient mode and
+	// FallbackError otherwise; strict mode only allows FallbackError.
+	Fallback string
+}
+
+// Parse modes.
+const (
+	// ModeStrict fails on undeclared or unsupported security schemes and on
+	// paths that only differ in their parameter names.
+	ModeStrict = "strict"
+	// ModeLenient reports the same problems as warnings. An operation none
+	// of whose requirements can be enforced only requires authentication.
+	ModeLenient = "lenient"
+)
+
+// Strategies for combining root and operation security.
+const (
+	RootSecurityOverride = "override"
+	RootSecurityMerge    = "merge"
+)
+
+// Fallbacks for operations without an enforceable security requirement.
+const (
+	FallbackError       = "error"
+	FallbackRequireAuth = "require-auth"
+	FallbackPublic      = "public"
+)
+
+func (o Options) fallback() string {
+	switch {
+	case o.Fallback != "":
+		return o.Fallback
+	case o.Mode == ModeLenient:
+		return FallbackRequireAuth
+	default:
+		return FallbackError
+	}
+}
+
+func (o Options) concurrency() int {
+	if o.Concurrency <= 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return o.Concurrency
+}
+
+func (o Options) bearerSchemes() []string {
+	if len(o.BearerSchemes) == 0 {
+		return defaultBearerSchemes
+	}
+	return o.BearerSchemes
+}
@@ -0,0 +1,243 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// overlayDocument is an OpenAPI Overlay (https://spec.openapis.org/overlay/v1.0.0),
+// a list of actions that update or remove parts of a spec selected by
+// JSONPath expressions. Overlays let authorization metadata live in a file
+// maintained separately from the spec itself.
+type overlayDocument struct {
+	Overlay string          `yaml:"overlay"`
+	Actions []overlayAction `yaml:"actions"`
+}
+
+type overlayAction struct {
+	Target string    `yaml:"target"`
+	Update yaml.Node `yaml:"update"`
+	Remove bool      `yaml:"remove"`
+}
+
+// applyOverlays loads every overlay in paths and applies it to doc, in
+// order, before any `$ref` is resolved.
+func applyOverlays(doc *yaml.Node, paths []string) error {
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read overlay: %w", err)
+		}
+		var overlay overlayDocument
+		if err := yaml.Unmarshal(data, &overlay); err != nil {
+			return fmt.Errorf("unmarshal overlay %s: %w", path, err)
+		}
+		if err := overlay.apply(doc); err != nil {
+			return fmt.Errorf("overlay %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func (o *overlayDocument) apply(doc *yaml.Node) error {
+	if o.Overlay != "1.0" && !strings.HasPrefix(o.Overlay, "1.0.") {
+		return fmt.Errorf("unsupported overlay version %q", o.Overlay)
+	}
+
+	root := doc
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+
+	for i, action := range o.Actions {
+		matches, err := selectJSONPath(root, action.Target)
+		if err != nil {
+			return fmt.Errorf("action %d: %w", i, err)
+		}
+		switch {
+		case action.Remove:
+			removeMatches(matches)
+		case action.Update.Kind != 0:
+			for _, m := range matches {
+				mergeOverlay(m.node, &action.Update)
+			}
+		}
+	}
+	return nil
+}
+
+// mergeOverlay applies an overlay update to target: objects are merged
+// recursively, arrays are concatenated, and any other value replaces the
+// target's. An update aimed at an array is appended to it as one element.
+func mergeOverlay(target, update *yaml.Node) {
+	switch {
+	case target.Kind == yaml.MappingNode && update.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(update.Content); i += 2 {
+			key, value := update.Content[i], update.Content[i+1]
+			existing := mappingValue(target, key.Value)
+			switch {
+			case existing == nil:
+				target.Content = append(target.Content, copyNode(key), copyNode(value))
+			case existing.Kind == yaml.SequenceNode && value.Kind == yaml.SequenceNode:
+				for _, item := range value.Content {
+					existing.Content = append(existing.Content, copyNode(item))
+				}
+			default:
+				mergeOverlay(existing, value)
+			}
+		}
+	case target.Kind == yaml.SequenceNode:
+		target.Content = append(target.Content, copyNode(update))
+	default:
+		*target = *copyNode(update)
+	}
+}
+
+// copyNode returns a deep copy of n, so that one update applied to several
+// targets does not share nodes between them.
+func copyNode(n *yaml.Node) *yaml.Node {
+	c := *n
+	c.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		c.Content[i] = copyNode(child)
+	}
+	return &c
+}
+
+// jsonPathMatch is a node selected by a JSONPath expression. parent and
+// index locate it, so it can be removed; both are unset for the root.
+type jsonPathMatch struct {
+	node   *yaml.Node
+	parent *yaml.Node
+	index  int
+}
+
+// removeMatches deletes every match from its parent. Matches are removed
+// from the highest index down so earlier removals do not shift later ones.
+func removeMatches(matches []jsonPathMatch) {
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].index > matches[j].index })
+	for _, m := range matches {
+		switch {
+		case m.parent == nil:
+		case m.parent.Kind == yaml.MappingNode:
+			// index is the value's position; its key precedes it.
+			m.parent.Content = append(m.parent.Content[:m.index-1], m.parent.Content[m.index+1:]...)
+		default:
+			m.parent.Content = append(m.parent.Content[:m.index], m.parent.Content[m.index+1:]...)
+		}
+	}
+}
+
+// jsonPathSegment is one step of a JSONPath expression: a member name, an
+// array index or a wildcard.
+type jsonPathSegment struct {
+	name     string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// selectJSONPath returns the nodes below root selected by expr. Only the
+// subset of JSONPath needed to address spec locations is supported: member
+// names in dot or bracket notation, array indexes and wildcards.
+func selectJSONPath(root *yaml.Node, expr string) ([]jsonPathMatch, error) {
+	segments, err := parseJSONPath(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []jsonPathMatch{{node: root}}
+	for _, seg := range segments {
+		var next []jsonPathMatch
+		for _, m := range matches {
+			next = append(next, seg.apply(m.node)...)
+		}
+		matches = next
+	}
+	return matches, nil
+}
+
+func (s jsonPathSegment) apply(n *yaml.Node) []jsonPathMatch {
+	var matches []jsonPathMatch
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			if s.wildcard || !s.isIndex && n.Content[i-1].Value == s.name {
+				matches = append(matches, jsonPathMatch{node: n.Content[i], parent: n, index: i})
+			}
+		}
+	case yaml.SequenceNode:
+		for i, c := range n.Content {
+			if s.wildcard || s.isIndex && s.index == i {
+				matches = append(matches, jsonPathMatch{node: c, parent: n, index: i})
+			}
+		}
+	}
+	return matches
+}
+
+func parseJSONPath(expr string) ([]jsonPathSegment, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("JSONPath %q must start with $", expr)
+	}
+
+	var segments []jsonPathSegment
+	rest := expr[1:]
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			return nil, fmt.Errorf("JSONPath %q: recursive descent is not supported", expr)
+		case strings.HasPrefix(rest, ".*"):
+			segments = append(segments, jsonPathSegment{wildcard: true})
+			rest = rest[2:]
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("JSONPath %q: empty member name", expr)
+			}
+			segments = append(segments, jsonPathSegment{name: rest[1 : end+1]})
+			rest = rest[end+1:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("JSONPath %q: unterminated [", expr)
+			}
+			inner := rest[1:end]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') {
+				// A quoted name may itself contain ']', as in "['{id}]']".
+				quote := inner[0]
+				closing := strings.IndexByte(rest[2:], quote)
+				if closing < 0 || !strings.HasPrefix(rest[2+closing+1:], "]") {
+					return nil, fmt.Errorf("JSONPath %q: unterminated quoted name", expr)
+				}
+				segments = append(segments, jsonPathSegment{name: rest[2 : 2+closing]})
+				rest = rest[2+closing+2:]
+				continue
+			}
+			switch {
+			case inner == "*":
+				segments = append(segments, jsonPathSegment{wildcard: true})
+			case strings.HasPrefix(inner, "?"):
+				return nil, fmt.Errorf("JSONPath %q: filter expressions are not supported", expr)
+			default:
+				i, err := strconv.Atoi(inner)
+				if err != nil || i < 0 {
+					return nil, fmt.Errorf("JSONPath %q: invalid index %q", expr, inner)
+				}
+				segments = append(segments, jsonPathSegment{index: i, isIndex: true})
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("JSONPath %q: unexpected %q", expr, rest)
+		}
+	}
+	return segments, nil
+}
@@ -1,60 +1,481 @@
 package parser
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"slices"
+	"strings"
+	"sync"
 
 	"gopkg.in/yaml.v3"
 
 	"github.com/chr1sbest/openapi-authz/internal/model"
 )
 
-// ParseConfig reads an OpenAPI v3 YAML file and extracts authorization
-// requirements into a Config structure. It focuses on paths, methods and
-// security blocks; it does not attempt to fully model the entire spec.
-func ParseConfig(path string) (*model.Config, error) {
-	data, err := os.ReadFile(path)
+// ParseConfig reads one or more OpenAPI v3 YAML files and extracts
+// authorization requirements into a single Config structure. It focuses on
+// paths, methods and security blocks; it does not attempt to fully model the
+// entire spec. When several specs declare the same method and path, they must
+// agree on its security.
+func ParseConfig(paths ...string) (*model.Config, error) {
+	return ParseConfigsWithOptions(paths, Options{})
+}
+
+// ParseConfigsWithOptions parses every spec in paths with opts and merges the
+// results, failing if two specs derive different policies for the same route.
+func ParseConfigsWithOptions(paths []string, opts Options) (*model.Config, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no specs to parse")
+	}
+	if len(paths) == 1 {
+		return ParseConfigWithOptions(paths[0], opts)
+	}
+
+	// Specs are parsed concurrently but merged in the order given, so the
+	// result and any error do not depend on scheduling.
+	cfgs := make([]*model.Config, len(paths))
+	errs := make([]error, len(paths))
+	sem := make(chan struct{}, opts.concurrency())
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			cfgs[i], errs[i] = ParseConfigWithOptions(path, opts)
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", paths[i], err)
+		}
+	}
+	return mergeConfigs(paths, cfgs)
+}
+
+// ParseConfigWithOptions is like ParseConfig but allows optional behaviour to
+// be enabled through opts. path may also be an http(s) URL, in which case the
+// spec is downloaded and relative references are resolved against it, or "-"
+// to read the spec from stdin. Both YAML and JSON documents are accepted.
+func ParseConfigWithOptions(path string, opts Options) (*model.Config, error) {
+	data, location, err := readSpec(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	return parseSpec(data, location, path, opts)
+}
+
+// readSpec reads the spec at path, which may be a file, an http(s) URL or
+// "-" for stdin, and returns it along with the location its relative
+// references resolve against.
+func readSpec(path string, opts Options) ([]byte, string, error) {
+	var data []byte
+	var err error
+	location := path
+	switch {
+	case path == "-":
+		// Relative references in a piped spec resolve against the working
+		// directory.
+		location = ""
+		data, err = io.ReadAll(os.Stdin)
+	case isRemote(path):
+		data, err = newRemoteFetcher(opts).fetchSpec(path, opts.SpecAuthHeader)
+	default:
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("read spec: %w", err)
+	}
+	return data, location, nil
+}
+
+// ParseConfigFromBytes parses a spec held in memory, such as one embedded
+// with go:embed. Relative file references are resolved against the working
+// directory.
+func ParseConfigFromBytes(data []byte, opts Options) (*model.Config, error) {
+	return parseSpec(data, "", "", opts)
+}
+
+// ParseConfigFromReader is like ParseConfigFromBytes but reads the spec from
+// r.
+func ParseConfigFromReader(r io.Reader, opts Options) (*model.Config, error) {
+	data, err := io.ReadAll(r)
 	if err != nil {
 		return nil, fmt.Errorf("read spec: %w", err)
 	}
+	return ParseConfigFromBytes(data, opts)
+}
 
-	var root openapiRoot
-	if err := yaml.Unmarshal(data, &root); err != nil {
-		return nil, fmt.Errorf("unmarshal spec: %w", err)
+// parseSpec derives the policies of the spec in data. location is where
+// relative references resolve from, and name identifies the spec in
+// warnings.
+func parseSpec(data []byte, location, name string, opts Options) (*model.Config, error) {
+	switch opts.Mode {
+	case "", ModeStrict, ModeLenient:
+	default:
+		return nil, fmt.Errorf("unknown parse mode %q", opts.Mode)
+	}
+	switch opts.Fallback {
+	case "", FallbackError:
+	case FallbackRequireAuth, FallbackPublic:
+		if opts.Mode == ModeStrict {
+			return nil, fmt.Errorf("fallback %q cannot be used in strict mode", opts.Fallback)
+		}
+	default:
+		return nil, fmt.Errorf("unknown fallback %q (want %s, %s or %s)", opts.Fallback, FallbackError, FallbackRequireAuth, FallbackPublic)
+	}
+	switch opts.RootSecurity {
+	case "", RootSecurityOverride, RootSecurityMerge:
+	default:
+		return nil, fmt.Errorf("unknown root security strategy %q (want %s or %s)", opts.RootSecurity, RootSecurityOverride, RootSecurityMerge)
+	}
+
+	filter, err := newPathFilter(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	docs, err := splitDocuments(data)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	source := model.Source{Spec: name, SHA256: hex.EncodeToString(sum[:])}
+	if len(docs) == 1 {
+		cfg, err := parseDocument(docs[0], location, name, filter, opts)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Sources = []model.Source{source}
+		return cfg, nil
+	}
+
+	// Each document of a stream is a spec of its own, merged like specs
+	// given separately. Positions stay relative to the whole stream.
+	sources := make([]string, len(docs))
+	cfgs := make([]*model.Config, len(docs))
+	for i, doc := range docs {
+		sources[i] = documentName(name, i)
+		if cfgs[i], err = parseDocument(doc, location, name, filter, opts); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i+1, err)
+		}
+	}
+	cfg, err := mergeConfigs(sources, cfgs)
+	if err != nil {
+		return nil, err
 	}
+	cfg.Sources = []model.Source{source}
+	sortWarnings(cfg.Warnings)
+	return cfg, nil
+}
+
+// parseDocument derives the policies of a single spec document.
+func parseDocument(doc *yaml.Node, location, name string, filter pathFilter, opts Options) (*model.Config, error) {
+	root, err := decodeRoot(doc, location, opts)
+	if err != nil {
+		return nil, err
+	}
+	filter.apply(root.Paths)
 
+	if opts.Mode != "" {
+		if err := checkDuplicatePaths(root, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	policies, err := derivePathPolicies(root, root.Paths, opts, func(item *pathItem) []string {
+		// Without server prefixing, routes are keyed by their spec path only.
+		if !opts.ServerBasePath {
+			return []string{""}
+		}
+		servers := root.Servers
+		if len(item.Servers) > 0 {
+			servers = item.Servers
+		}
+		return basePaths(servers)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if policies, err = normalizeRoutes(root, policies, opts); err != nil {
+		return nil, err
+	}
+
+	// Webhooks are named rather than routed, so their keys are never
+	// prefixed or normalized.
+	webhooks, err := derivePathPolicies(root, root.Webhooks, opts, noPrefixes)
+	if err != nil {
+		return nil, fmt.Errorf("webhooks: %w", err)
+	}
+
+	callbacks, err := callbackPolicies(root, root.Paths, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &model.Config{Policies: policies, CaseInsensitivePaths: opts.CaseInsensitivePaths}
+	if len(root.Components.SecuritySchemes) > 0 {
+		cfg.SecuritySchemes = schemeMetadata(root.Components.SecuritySchemes)
+	}
+	if len(webhooks) > 0 {
+		cfg.Webhooks = webhooks
+	}
+	if len(callbacks) > 0 {
+		cfg.Callbacks = callbacks
+	}
+	cfg.Warnings = root.warnings
+	for i := range cfg.Warnings {
+		cfg.Warnings[i].Spec = name
+	}
+	sortWarnings(cfg.Warnings)
+	return cfg, nil
+}
+
+// noPrefixes keys policies by their item name alone.
+func noPrefixes(*pathItem) []string {
+	return []string{""}
+}
+
+// derivePathPolicies derives a policy for every operation of items, keyed by
+// method and the item's name prefixed with each of prefixes(item). Two
+// items whose prefixed names are the same route, such as /users under a
+// /v1 server and /v1/users under a / server, are handled like duplicate
+// routes: identical policies are merged, and otherwise the route is an
+// error, or a warning keeping the first policy in lenient mode.
+func derivePathPolicies(root *openapiRoot, items map[string]*pathItem, opts Options, prefixes func(*pathItem) []string) (map[model.RouteKey]model.AuthPolicy, error) {
 	policies := make(map[model.RouteKey]model.AuthPolicy)
+	origin := make(map[model.RouteKey]string)
 
-	for rawPath, item := range root.Paths {
+	// Paths and methods are visited in order, so that which of several
+	// paths a route key is derived from, and the first error, do not
+	// depend on map iteration order.
+	for _, rawPath := range slices.Sorted(maps.Keys(items)) {
+		item := items[rawPath]
 		if item == nil {
 			continue
 		}
 
-		for method, op := range item.Operations() {
+		ops, err := item.Operations()
+		if err != nil {
+			return nil, item.pos.at(fmt.Errorf("path %s: %w", rawPath, err))
+		}
+
+		for _, method := range slices.Sorted(maps.Keys(ops)) {
+			op := ops[method]
 			if op == nil {
 				continue
 			}
 
-			key := model.RouteKey{Method: method, Path: rawPath}
-			policy, err := derivePolicy(&root, op)
+			policy, warnings, err := deriveOperationPolicy(root, item, op, rawPath, opts)
 			if err != nil {
-				return nil, fmt.Errorf("derive policy for %s %s: %w", method, rawPath, err)
+				return nil, op.pos.at(fmt.Errorf("derive policy for %s %s: %w", method, rawPath, err))
+			}
+			for _, msg := range warnings {
+				root.warn(op.pos, method, rawPath, msg)
+			}
+
+			for _, prefix := range prefixes(item) {
+				key := model.RouteKey{Method: method, Path: prefix + rawPath}
+				if first, ok := origin[key]; ok {
+					var err error
+					switch {
+					case !samePolicy(policies[key], policy):
+						err = newConflictError(key, first, policies[key], rawPath, policy)
+					case opts.Duplicates == DuplicatesError:
+						err = fmt.Errorf("duplicate route %s %s: declared as both %s and %s", key.Method, key.Path, first, rawPath)
+					}
+					if err != nil && opts.Mode != ModeLenient {
+						return nil, op.pos.at(err)
+					}
+					if err != nil {
+						root.warn(op.pos, method, rawPath, fmt.Sprintf("%v; keeping the policy of %s", err, first))
+					}
+					continue
+				}
+				policies[key] = policy
+				origin[key] = rawPath
+			}
+		}
+	}
+
+	return policies, nil
+}
+
+// deriveOperationPolicy derives the policy of op, declared on item at
+// rawPath, including its vendor extensions and deprecation.
+func deriveOperationPolicy(root *openapiRoot, item *pathItem, op *operation, rawPath string, opts Options) (model.AuthPolicy, []string, error) {
+	op = op.withProfile(item, opts.Profile)
+
+	var policy model.AuthPolicy
+	var warnings []string
+	if op.Public {
+		if err := op.checkPublic(); err != nil {
+			return model.AuthPolicy{}, nil, err
+		}
+		policy.PublicOverride = true
+	} else {
+		var err error
+		if policy, warnings, err = derivePolicy(root, op, opts); err != nil {
+			return model.AuthPolicy{}, nil, err
+		}
+		if msg := overrideDiagnostic(root, op, policy, opts); msg != "" {
+			warnings = append(warnings, msg)
+		}
+		for _, ext := range op.authzExtensions(item) {
+			if err := applyAuthz(&policy, ext, rawPath); err != nil {
+				return model.AuthPolicy{}, nil, err
 			}
-			policies[key] = policy
 		}
+		opts.ClaimsMapping.rewriteScopes(&policy)
 	}
+	policy.OperationID = op.OperationID
+	policy.Summary = op.Summary
+	policy.Description = op.Description
+	policy.PathParams = pathParams(rawPath)
+	if err := checkGRPCMethod(op.GRPCMethod); err != nil {
+		return model.AuthPolicy{}, nil, err
+	}
+	policy.GRPCMethod = op.GRPCMethod
+	if err := checkGraphQLField(op.GraphQLField); err != nil {
+		return model.AuthPolicy{}, nil, err
+	}
+	policy.GraphQLField = op.GraphQLField
+	policy.Tags = op.Tags
+	if op.Deprecated {
+		if err := applyDeprecated(&policy, opts); err != nil {
+			return model.AuthPolicy{}, nil, err
+		}
+	}
+	return policy, warnings, nil
+}
 
-	return &model.Config{Policies: policies}, nil
+// decodeRoot decodes one document of a spec into an openapiRoot. Aliases
+// are expanded and overlays applied first, then `$ref` pointers are expanded
+// relative to location, and Swagger 2.0 documents are converted to their
+// OpenAPI 3.0 equivalent so that the rest of the parser only has to deal
+// with a single shape.
+func decodeRoot(doc *yaml.Node, location string, opts Options) (*openapiRoot, error) {
+	if err := expandAliases(doc); err != nil {
+		return nil, err
+	}
+	if err := applyOverlays(doc, opts.Overlays); err != nil {
+		return nil, err
+	}
+	if err := resolveRefs(doc, location, opts); err != nil {
+		return nil, err
+	}
+
+	var header struct {
+		OpenAPI string `yaml:"openapi"`
+		Swagger string `yaml:"swagger"`
+	}
+	if err := doc.Decode(&header); err != nil {
+		return nil, fmt.Errorf("unmarshal spec: %w", err)
+	}
+
+	if header.Swagger != "" && header.OpenAPI != "" {
+		return nil, fmt.Errorf("document declares both `openapi` and `swagger`; keep `openapi` for OpenAPI 3 or `swagger` for Swagger 2.0")
+	}
+	if header.Swagger != "" {
+		if err := checkSwaggerVersion(header.Swagger); err != nil {
+			return nil, err
+		}
+		var sw swagger2Root
+		if err := doc.Decode(&sw); err != nil {
+			return nil, fmt.Errorf("unmarshal spec: %w", err)
+		}
+		return convertSwagger2(&sw), nil
+	}
+
+	if err := checkOpenAPIVersion(header.OpenAPI); err != nil {
+		return nil, err
+	}
+
+	var missing string
+	if header.OpenAPI == "" {
+		var err error
+		if missing, err = missingVersion(doc, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	var root openapiRoot
+	if err := doc.Decode(&root); err != nil {
+		return nil, fmt.Errorf("unmarshal spec: %w", err)
+	}
+	if missing != "" {
+		root.warn(position{Line: doc.Content[0].Line, Column: doc.Content[0].Column}, "", "", missing)
+	}
+	return &root, nil
 }
 
 // openapiRoot is a minimal representation of the parts of an OpenAPI v3
-// document we care about: global security and per-path operations.
+// document we care about: global security and per-path operations. Webhooks
+// and reusable path items were added in 3.1 but are read from any document.
 type openapiRoot struct {
-	Security []securityRequirement `yaml:"security"`
-	Paths    map[string]*pathItem  `yaml:"paths"`
+	OpenAPI    string                `yaml:"openapi"`
+	Servers    []server              `yaml:"servers"`
+	Security   []securityRequirement `yaml:"security"`
+	Paths      map[string]*pathItem  `yaml:"paths"`
+	Webhooks   map[string]*pathItem  `yaml:"webhooks"`
+	Components components            `yaml:"components"`
+
+	// warnings collects the problems that did not stop parsing.
+	warnings []model.Warning
+}
+
+func (r *openapiRoot) warn(pos position, method, path, msg string) {
+	r.warnings = append(r.warnings, model.Warning{
+		Line:    pos.Line,
+		Column:  pos.Column,
+		Method:  method,
+		Path:    path,
+		Message: msg,
+	})
+}
+
+type components struct {
+	SecuritySchemes map[string]*securityScheme `yaml:"securitySchemes"`
+	PathItems       map[string]*pathItem       `yaml:"pathItems"`
+}
+
+// securityScheme captures the subset of a components.securitySchemes entry
+// needed to classify a security requirement.
+type securityScheme struct {
+	Type             string     `yaml:"type"`
+	Description      string     `yaml:"description"`
+	Scheme           string     `yaml:"scheme"`
+	BearerFormat     string     `yaml:"bearerFormat"`
+	Name             string     `yaml:"name"`
+	In               string     `yaml:"in"`
+	Flows            oauthFlows `yaml:"flows"`
+	OpenIDConnectURL string     `yaml:"openIdConnectUrl"`
+}
+
+type oauthFlows struct {
+	Implicit          *oauthFlow `yaml:"implicit"`
+	Password          *oauthFlow `yaml:"password"`
+	ClientCredentials *oauthFlow `yaml:"clientCredentials"`
+	AuthorizationCode *oauthFlow `yaml:"authorizationCode"`
+}
+
+type oauthFlow struct {
+	AuthorizationURL string            `yaml:"authorizationUrl"`
+	TokenURL         string            `yaml:"tokenUrl"`
+	RefreshURL       string            `yaml:"refreshUrl"`
+	Scopes           map[string]string `yaml:"scopes"`
 }
 
 type pathItem struct {
+	Servers []server   `yaml:"servers"`
 	Get     *operation `yaml:"get"`
 	Post    *operation `yaml:"post"`
 	Put     *operation `yaml:"put"`
@@ -62,10 +483,28 @@ type pathItem struct {
 	Patch   *operation `yaml:"patch"`
 	Options *operation `yaml:"options"`
 	Head    *operation `yaml:"head"`
+	Trace   *operation `yaml:"trace"`
+
+	// Authorization extensions declared here are inherited by every
+	// operation of the path item that does not declare its own.
+	Authz   *authzExtension `yaml:"x-authz"`
+	XRoles  []string        `yaml:"x-roles"`
+	XScopes []string        `yaml:"x-scopes"`
+
+	// XMethods declares operations for non-standard HTTP methods, keyed by
+	// method name (e.g. PROPFIND or PURGE).
+	XMethods map[string]*operation `yaml:"x-methods"`
+
+	// XEnv holds per-environment overrides inherited by every operation
+	// that does not override the same profile itself.
+	XEnv map[string]*envOverride `yaml:"x-env"`
+
+	pos position
 }
 
-// Operations returns a map of HTTP method (uppercase) to operation.
-func (p *pathItem) Operations() map[string]*operation {
+// Operations returns a map of HTTP method (uppercase) to operation, including
+// any custom methods declared under x-methods.
+func (p *pathItem) Operations() (map[string]*operation, error) {
 	ops := make(map[string]*operation)
 	if p.Get != nil {
 		ops["GET"] = p.Get
@@ -88,11 +527,61 @@ func (p *pathItem) Operations() map[string]*operation {
 	if p.Head != nil {
 		ops["HEAD"] = p.Head
 	}
-	return ops
+	if p.Trace != nil {
+		ops["TRACE"] = p.Trace
+	}
+	for name, op := range p.XMethods {
+		if op == nil {
+			continue
+		}
+		method := strings.ToUpper(name)
+		if !isMethodToken(method) {
+			return nil, fmt.Errorf("x-methods: invalid HTTP method %q", name)
+		}
+		if _, ok := ops[method]; ok {
+			return nil, fmt.Errorf("x-methods: %s is already declared on the path item", method)
+		}
+		ops[method] = op
+	}
+	return ops, nil
+}
+
+// isMethodToken reports whether method is a valid HTTP method token
+// (RFC 9110 section 5.6.2), restricted to the characters seen in practice.
+func isMethodToken(method string) bool {
+	if method == "" {
+		return false
+	}
+	for _, r := range method {
+		if !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
 }
 
 type operation struct {
-	Security []securityRequirement `yaml:"security"`
+	OperationID  string                `yaml:"operationId"`
+	Summary      string                `yaml:"summary"`
+	Description  string                `yaml:"description"`
+	GRPCMethod   string                `yaml:"x-grpc-method"`
+	GraphQLField string                `yaml:"x-graphql-field"`
+	Tags         []string              `yaml:"tags"`
+	Deprecated   bool                  `yaml:"deprecated"`
+	Security     []securityRequirement `yaml:"security"`
+	Public       bool                  `yaml:"x-public"`
+	Authz        *authzExtension       `yaml:"x-authz"`
+	XRoles       []string              `yaml:"x-roles"`
+	XScopes      []string              `yaml:"x-scopes"`
+
+	// XEnv holds per-environment overrides, keyed by profile name.
+	XEnv map[string]*envOverride `yaml:"x-env"`
+
+	// Callbacks maps callback names to their path items, keyed by callback
+	// URL expression.
+	Callbacks map[string]map[string]*pathItem `yaml:"callbacks"`
+
+	pos position
 }
 
 type securityRequirement map[string][]string
@@ -100,51 +589,89 @@ type securityRequirement map[string][]string
 // derivePolicy determines the AuthPolicy for an operation, taking into account
 // operation-level and root-level security requirements. The precedence rules
 // follow the OpenAPI specification: operation.security overrides root.security
-// when present.
+// when present. If security is present but no requirement uses a supported
+// scheme, an error is returned to avoid silently misconfiguring protection,
+// unless opts.Fallback says otherwise.
+func derivePolicy(root *openapiRoot, op *operation, opts Options) (model.AuthPolicy, []string, error) {
+	sec := effectiveSecurity(root, op, opts)
 
-// derivePolicy determines the AuthPolicy for an operation, taking into account
-// operation-level and root-level security requirements. The precedence rules
-// follow the OpenAPI specification: operation.security overrides root.security
-// when present. If security is present but no BearerAuth requirement is found,
-// an error is returned to avoid silently misconfiguring protection.
-func derivePolicy(root *openapiRoot, op *operation) (model.AuthPolicy, error) {
-	sec := op.Security
-	if sec == nil {
-		sec = root.Security
+	// No security section at all, or an explicit empty array, means public.
+	if len(sec) == 0 {
+		return model.AuthPolicy{RequireAuth: false}, nil, nil
 	}
 
-	// If there is an explicit empty array, the operation is public.
-	if sec != nil && len(sec) == 0 {
-		return model.AuthPolicy{RequireAuth: false}, nil
+	// Strict mode does not fall back to the bearer scheme names: every
+	// scheme must be declared.
+	if opts.Mode == ModeStrict {
+		if undeclared := undeclaredSchemes(root, sec, nil); len(undeclared) > 0 {
+			return model.AuthPolicy{}, nil, fmt.Errorf("undeclared security schemes %s", strings.Join(undeclared, ", "))
+		}
 	}
 
-	// If there is no security section at all, treat as public.
-	if sec == nil {
-		return model.AuthPolicy{RequireAuth: false}, nil
+	// Requirements are alternatives: the first one that uses a supported
+	// scheme becomes the policy and any further ones its Alternatives.
+	var alternatives []model.AuthPolicy
+	var warnings []string
+	anonymous := false
+	for _, req := range sec {
+		if len(req) == 0 {
+			anonymous = true
+			continue
+		}
+		policy, ok, err := requirementPolicy(root, req, opts)
+		if err != nil {
+			return model.AuthPolicy{}, nil, err
+		}
+		if ok {
+			alternatives = append(alternatives, policy)
+			continue
+		}
+		switch opts.Mode {
+		case ModeStrict:
+			return model.AuthPolicy{}, nil, fmt.Errorf("%s", skipReason(root, req, opts))
+		case ModeLenient:
+			warnings = append(warnings, skipReason(root, req, opts)+"; requirement skipped")
+		}
 	}
 
-	policy := model.AuthPolicy{RequireAuth: false}
+	// An empty requirement object lets anonymous requests through, so
+	// authentication is optional: the other requirements describe the
+	// credentials to check when a request presents some.
+	if anonymous {
+		if len(alternatives) == 0 {
+			return model.AuthPolicy{}, warnings, nil
+		}
+		policy := alternatives[0]
+		policy.RequireAuth = false
+		policy.OptionalAuth = true
+		if len(alternatives) > 1 {
+			policy.Alternatives = alternatives[1:]
+		}
+		return policy, warnings, nil
+	}
 
-	// We only look at the first BearerAuth requirement for now. If there are
-	// multiple different security schemes, we conservatively require auth.
-	for _, req := range sec {
-		for scheme, scopes := range req {
-			if scheme == "BearerAuth" {
-				policy.RequireAuth = true
-				// Convention: scopes starting with "role:" are roles; others are scopes.
-				for _, s := range scopes {
-					if len(s) > 5 && s[:5] == "role:" {
-						policy.Roles = append(policy.Roles, s[5:])
-					} else {
-						policy.Scopes = append(policy.Scopes, s)
-					}
-				}
-				return policy, nil
-			}
+	// Security requirements exist but none use a supported scheme: unless a
+	// fallback is configured, treat as configuration error rather than
+	// silently public. A scheme that is not declared at all is most likely a
+	// typo, so name it.
+	if len(alternatives) == 0 {
+		switch opts.fallback() {
+		case FallbackRequireAuth:
+			warnings = append(warnings, "no supported security requirement found; requiring authentication with any scheme")
+			return model.AuthPolicy{RequireAuth: true}, warnings, nil
+		case FallbackPublic:
+			warnings = append(warnings, "no supported security requirement found; treating the operation as public")
+			return model.AuthPolicy{}, warnings, nil
 		}
+		if undeclared := undeclaredSchemes(root, sec, opts.bearerSchemes()); len(undeclared) > 0 {
+			return model.AuthPolicy{}, nil, fmt.Errorf("security section present but no supported security requirement found (undeclared security schemes %s)", strings.Join(undeclared, ", "))
+		}
+		return model.AuthPolicy{}, nil, fmt.Errorf("security section present but no supported security requirement found")
 	}
 
-	// Security requirements exist but none reference BearerAuth: treat as
-	// configuration error rather than silently public.
-	return model.AuthPolicy{}, fmt.Errorf("security section present but no BearerAuth requirement found")
+	policy := alternatives[0]
+	if len(alternatives) > 1 {
+		policy.Alternatives = alternatives[1:]
+	}
+	return policy, warnings, nil
 }
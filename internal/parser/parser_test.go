@@ -1,7 +1,17 @@
 package parser
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/chr1sbest/openapi-authz/internal/model"
@@ -37,6 +47,12 @@ func TestParseConfig_Basic(t *testing.T) {
 		if len(p.Scopes) != 0 {
 			t.Errorf("expected no scopes for GET /user, got %+v", p.Scopes)
 		}
+		if p.OperationID != "getUser" {
+			t.Errorf("expected operationId getUser for GET /user, got %q", p.OperationID)
+		}
+		if p.Summary != "Any authenticated user" {
+			t.Errorf("expected summary for GET /user, got %q", p.Summary)
+		}
 	}
 
 	// /admin DELETE -> requires auth, admin role
@@ -63,3 +79,1725 @@ func TestParseConfig_Basic(t *testing.T) {
 		}
 	}
 }
+
+func TestParseConfig_OpenAPI31(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "openapi31.yaml")
+
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	// /vegetables is a $ref to components.pathItems.
+	if p, ok := cfg.Policies[model.RouteKey{Method: "GET", Path: "/vegetables"}]; !ok {
+		t.Fatalf("missing policy for GET /vegetables")
+	} else if p.RequireAuth {
+		t.Errorf("expected GET /vegetables to be public, got %+v", p)
+	}
+
+	if p, ok := cfg.Policies[model.RouteKey{Method: "POST", Path: "/vegetables"}]; !ok {
+		t.Fatalf("missing policy for POST /vegetables")
+	} else if !p.RequireAuth || len(p.Scopes) != 1 || p.Scopes[0] != "vegetable:write" {
+		t.Errorf("expected POST /vegetables to require vegetable:write, got %+v", p)
+	}
+
+	// /user inherits root security.
+	if p, ok := cfg.Policies[model.RouteKey{Method: "GET", Path: "/user"}]; !ok {
+		t.Fatalf("missing policy for GET /user")
+	} else if !p.RequireAuth {
+		t.Errorf("expected GET /user to require auth, got %+v", p)
+	}
+}
+
+func TestParseConfig_UnsupportedVersion(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "unsupported_version.yaml")
+
+	if _, err := ParseConfig(path); err == nil {
+		t.Fatalf("expected error for unsupported OpenAPI version")
+	}
+}
+
+func TestParseConfig_VersionDiagnostics(t *testing.T) {
+	dir := filepath.Join("..", "..", "testdata")
+
+	tests := []struct {
+		file, want string
+	}{
+		{"unsupported_version.yaml", "supported versions are 3.0.x and 3.1.x"},
+		{"openapi2_version.yaml", "declare `swagger: \"2.0\"` instead of `openapi`"},
+		{filepath.Join("claims", "mapping.yaml"), "is this an OpenAPI document?"},
+	}
+	for _, tt := range tests {
+		_, err := ParseConfig(filepath.Join(dir, tt.file))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.file, tt.want, err)
+		}
+	}
+
+	// A spec without a version is still parsed, with a warning.
+	path := filepath.Join(dir, "missing_version.yaml")
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+	if len(cfg.Warnings) != 1 || cfg.Warnings[0].Line != 1 || !strings.Contains(cfg.Warnings[0].Message, "add `openapi: 3.0.3`") {
+		t.Errorf("expected a missing version warning, got %v", cfg.Warnings)
+	}
+	if _, err := ParseConfigWithOptions(path, Options{Mode: ModeStrict}); err == nil {
+		t.Errorf("expected strict mode to reject a missing version")
+	}
+}
+
+func TestParseConfig_Swagger2(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "swagger2.yaml")
+
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	if p, ok := cfg.Policies[model.RouteKey{Method: "GET", Path: "/public"}]; !ok {
+		t.Fatalf("missing policy for GET /public")
+	} else if p.RequireAuth {
+		t.Errorf("expected GET /public to be public, got %+v", p)
+	}
+
+	if p, ok := cfg.Policies[model.RouteKey{Method: "GET", Path: "/user"}]; !ok {
+		t.Fatalf("missing policy for GET /user")
+	} else if !p.RequireAuth {
+		t.Errorf("expected GET /user to inherit root security, got %+v", p)
+	}
+
+	if p, ok := cfg.Policies[model.RouteKey{Method: "DELETE", Path: "/admin"}]; !ok {
+		t.Fatalf("missing policy for DELETE /admin")
+	} else if len(p.Roles) != 1 || p.Roles[0] != "admin" {
+		t.Errorf("expected admin role for DELETE /admin, got %+v", p)
+	}
+}
+
+func TestConvertSwagger2_SecurityDefinitions(t *testing.T) {
+	root := convertSwagger2(&swagger2Root{
+		BasePath: "/api",
+		SecurityDefinitions: map[string]*swagger2Scheme{
+			"Basic":  {Type: "basic"},
+			"Key":    {Type: "apiKey", Name: "X-API-Key", In: "header"},
+			"OAuth2": {Type: "oauth2", Flow: "application", TokenURL: "https://auth.example.com/token"},
+		},
+	})
+
+	if len(root.Servers) != 1 || root.Servers[0].URL != "/api" {
+		t.Errorf("expected basePath to become a server, got %+v", root.Servers)
+	}
+
+	schemes := root.Components.SecuritySchemes
+	if s := schemes["Basic"]; s.Type != "http" || s.Scheme != "basic" {
+		t.Errorf("unexpected basic scheme: %+v", s)
+	}
+	if s := schemes["Key"]; s.Type != "apiKey" || s.Name != "X-API-Key" || s.In != "header" {
+		t.Errorf("unexpected apiKey scheme: %+v", s)
+	}
+	if s := schemes["OAuth2"]; s.Type != "oauth2" || s.Flows.ClientCredentials == nil {
+		t.Errorf("expected application flow to map to clientCredentials, got %+v", s)
+	}
+}
+
+func TestParseConfig_LocalRefs(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "local_refs.yaml")
+
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	if p, ok := cfg.Policies[model.RouteKey{Method: "GET", Path: "/tree"}]; !ok {
+		t.Fatalf("missing policy for referenced GET /tree")
+	} else if p.RequireAuth {
+		t.Errorf("expected GET /tree to be public, got %+v", p)
+	}
+
+	for _, key := range []model.RouteKey{
+		{Method: "DELETE", Path: "/tree"},
+		{Method: "PUT", Path: "/tree/{id}"},
+	} {
+		p, ok := cfg.Policies[key]
+		if !ok {
+			t.Fatalf("missing policy for %s %s", key.Method, key.Path)
+		}
+		if !p.RequireAuth || len(p.Roles) != 1 || p.Roles[0] != "admin" {
+			t.Errorf("expected %s %s to require admin via $ref, got %+v", key.Method, key.Path, p)
+		}
+	}
+}
+
+func TestParseConfig_CircularRef(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "circular_refs.yaml")
+
+	_, err := ParseConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "circular $ref") {
+		t.Fatalf("expected circular $ref error, got %v", err)
+	}
+}
+
+func TestParseConfig_ExternalFileRefs(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "multifile", "openapi.yaml")
+
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	if p, ok := cfg.Policies[model.RouteKey{Method: "GET", Path: "/public"}]; !ok {
+		t.Fatalf("missing policy for GET /public")
+	} else if p.RequireAuth {
+		t.Errorf("expected GET /public to be public, got %+v", p)
+	}
+
+	if p, ok := cfg.Policies[model.RouteKey{Method: "GET", Path: "/user"}]; !ok {
+		t.Fatalf("missing policy for GET /user")
+	} else if !p.RequireAuth {
+		t.Errorf("expected GET /user to require auth, got %+v", p)
+	}
+
+	// /admin's security lives in a file referenced from a referenced file.
+	if p, ok := cfg.Policies[model.RouteKey{Method: "DELETE", Path: "/admin"}]; !ok {
+		t.Fatalf("missing policy for DELETE /admin")
+	} else if len(p.Roles) != 1 || p.Roles[0] != "admin" {
+		t.Errorf("expected admin role for DELETE /admin, got %+v", p)
+	}
+}
+
+func TestParseConfig_ExternalFileCycle(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "multifile_cycle", "openapi.yaml")
+
+	_, err := ParseConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "circular $ref") {
+		t.Fatalf("expected circular $ref error, got %v", err)
+	}
+}
+
+func TestParseConfig_RemoteRefs(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		switch r.URL.Path {
+		case "/shared/paths.yaml":
+			w.Write([]byte("admin:\n  delete:\n    security:\n      $ref: 'security.yaml#/admin'\n"))
+		case "/shared/security.yaml":
+			w.Write([]byte("admin:\n  - BearerAuth: [\"role:admin\"]\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "openapi.yaml")
+	spec := "openapi: 3.0.3\npaths:\n  /admin:\n    $ref: '" + srv.URL + "/shared/paths.yaml#/admin'\n"
+	if err := os.WriteFile(path, []byte(spec), 0o644); err != nil {
+		t.Fatalf("write spec: %v", err)
+	}
+
+	if _, err := ParseConfig(path); err == nil {
+		t.Fatalf("expected remote $ref to fail when remote references are disabled")
+	}
+
+	opts := Options{AllowRemoteRefs: true, RemoteCacheDir: filepath.Join(dir, "cache")}
+	cfg, err := ParseConfigWithOptions(path, opts)
+	if err != nil {
+		t.Fatalf("ParseConfigWithOptions error: %v", err)
+	}
+	if p := cfg.Policies[model.RouteKey{Method: "DELETE", Path: "/admin"}]; len(p.Roles) != 1 || p.Roles[0] != "admin" {
+		t.Errorf("expected admin role from remote $ref, got %+v", p)
+	}
+
+	// A second parse must be served from the cache.
+	srv.Close()
+	before := hits
+	if _, err := ParseConfigWithOptions(path, opts); err != nil {
+		t.Fatalf("expected cached parse to succeed, got %v", err)
+	}
+	if hits != before {
+		t.Errorf("expected no remote fetches with a warm cache")
+	}
+}
+
+func TestParseConfigWithOptions_SpecURL(t *testing.T) {
+	spec, err := os.ReadFile(filepath.Join("..", "..", "testdata", "basic.yaml"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+
+	notModified := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer registry-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(spec)
+	}))
+	defer srv.Close()
+
+	if _, err := ParseConfigWithOptions(srv.URL+"/openapi.yaml", Options{}); err == nil {
+		t.Fatalf("expected error without auth header")
+	}
+
+	opts := Options{
+		SpecAuthHeader: "Authorization: Bearer registry-token",
+		RemoteCacheDir: t.TempDir(),
+	}
+	for i := 0; i < 2; i++ {
+		cfg, err := ParseConfigWithOptions(srv.URL+"/openapi.yaml", opts)
+		if err != nil {
+			t.Fatalf("ParseConfigWithOptions error: %v", err)
+		}
+		if p := cfg.Policies[model.RouteKey{Method: "DELETE", Path: "/admin"}]; len(p.Roles) != 1 || p.Roles[0] != "admin" {
+			t.Errorf("expected admin role for DELETE /admin, got %+v", p)
+		}
+	}
+	if notModified != 1 {
+		t.Errorf("expected second fetch to be revalidated with the ETag, got %d 304s", notModified)
+	}
+}
+
+func TestParseConfigWithOptions_SpecURLRefs(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("admin:\n  - BearerAuth: [\"role:admin\"]\n"))
+	}))
+	defer other.Close()
+
+	var spec string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/specs/openapi.yaml":
+			w.Write([]byte(spec))
+		case "/specs/security.yaml":
+			w.Write([]byte("admin:\n  - BearerAuth: [\"role:admin\"]\n"))
+		case "/specs/huge.yaml":
+			w.Write([]byte("admin: '" + strings.Repeat("x", 2048) + "'\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	parse := func(ref string, opts Options) error {
+		spec = "openapi: 3.0.3\npaths:\n  /admin:\n    delete:\n      security:\n        $ref: '" + ref + "'\n"
+		_, err := ParseConfigWithOptions(srv.URL+"/specs/openapi.yaml", opts)
+		return err
+	}
+
+	if err := parse("security.yaml#/admin", Options{}); err != nil {
+		t.Errorf("expected a relative $ref on the spec's origin to resolve, got %v", err)
+	}
+	if err := parse(other.URL+"/security.yaml#/admin", Options{}); err == nil || !strings.Contains(err.Error(), "-allow-remote-refs") {
+		t.Errorf("expected a $ref to another host to need -allow-remote-refs, got %v", err)
+	}
+	if err := parse(other.URL+"/security.yaml#/admin", Options{AllowRemoteRefs: true}); err != nil {
+		t.Errorf("expected -allow-remote-refs to follow a $ref to another host, got %v", err)
+	}
+
+	defer func(size int64) { maxRemoteSize = size }(maxRemoteSize)
+	maxRemoteSize = 1024
+	if err := parse("huge.yaml#/admin", Options{}); err == nil || !strings.Contains(err.Error(), "exceeds 1024 bytes") {
+		t.Errorf("expected an oversized document to be rejected, got %v", err)
+	}
+}
+
+func TestParseConfigWithOptions_Stdin(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "basic.json"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	go func() {
+		w.Write(data)
+		w.Close()
+	}()
+
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+
+	cfg, err := ParseConfigWithOptions("-", Options{})
+	if err != nil {
+		t.Fatalf("ParseConfigWithOptions error: %v", err)
+	}
+	if p := cfg.Policies[model.RouteKey{Method: "DELETE", Path: "/admin"}]; len(p.Roles) != 1 || p.Roles[0] != "admin" {
+		t.Errorf("expected admin role for DELETE /admin, got %+v", p)
+	}
+	if p := cfg.Policies[model.RouteKey{Method: "GET", Path: "/public"}]; p.RequireAuth {
+		t.Errorf("expected GET /public to be public, got %+v", p)
+	}
+}
+
+func TestSniffFormat(t *testing.T) {
+	if got := sniffFormat([]byte("  \n{\"openapi\": \"3.0.0\"}")); got != formatJSON {
+		t.Errorf("expected JSON, got %v", got)
+	}
+	if got := sniffFormat([]byte("openapi: 3.0.0\n")); got != formatYAML {
+		t.Errorf("expected YAML, got %v", got)
+	}
+	if err := validateFormat([]byte(`{"openapi": "3.0.0",}`)); err == nil || !strings.Contains(err.Error(), "invalid JSON") {
+		t.Errorf("expected invalid JSON error, got %v", err)
+	}
+}
+
+func TestParseConfig_MergesMultipleSpecs(t *testing.T) {
+	dir := filepath.Join("..", "..", "testdata", "merge")
+
+	cfg, err := ParseConfig(filepath.Join(dir, "users.yaml"), filepath.Join(dir, "orders.yaml"))
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	if len(cfg.Policies) != 3 {
+		t.Fatalf("expected 3 merged policies, got %d: %+v", len(cfg.Policies), cfg.Policies)
+	}
+	if p := cfg.Policies[model.RouteKey{Method: "GET", Path: "/users"}]; !p.RequireAuth {
+		t.Errorf("expected GET /users to require auth, got %+v", p)
+	}
+	if p := cfg.Policies[model.RouteKey{Method: "POST", Path: "/orders"}]; len(p.Scopes) != 1 || p.Scopes[0] != "orders:write" {
+		t.Errorf("expected orders:write scope for POST /orders, got %+v", p)
+	}
+
+	var want []model.Source
+	for _, name := range []string{"users.yaml", "orders.yaml"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("read spec: %v", err)
+		}
+		sum := sha256.Sum256(data)
+		want = append(want, model.Source{Spec: filepath.Join(dir, name), SHA256: hex.EncodeToString(sum[:])})
+	}
+	if !reflect.DeepEqual(cfg.Sources, want) {
+		t.Errorf("expected sources %+v, got %+v", want, cfg.Sources)
+	}
+}
+
+func TestParseConfigsWithOptions_Concurrency(t *testing.T) {
+	dir := filepath.Join("..", "..", "testdata", "merge")
+	paths := []string{
+		filepath.Join(dir, "users.yaml"),
+		filepath.Join(dir, "missing-a.yaml"),
+		filepath.Join(dir, "orders.yaml"),
+		filepath.Join(dir, "missing-b.yaml"),
+	}
+
+	// Whichever spec fails first, the error names the first failing spec in
+	// the order given.
+	for range 10 {
+		_, err := ParseConfigsWithOptions(paths, Options{Concurrency: 2})
+		if err == nil || !strings.HasPrefix(err.Error(), paths[1]+":") {
+			t.Fatalf("expected error for %s, got %v", paths[1], err)
+		}
+	}
+
+	cfg, err := ParseConfigsWithOptions([]string{paths[0], paths[2]}, Options{Concurrency: 1})
+	if err != nil {
+		t.Fatalf("ParseConfigsWithOptions error: %v", err)
+	}
+	if len(cfg.Policies) != 3 {
+		t.Errorf("expected 3 merged policies, got %+v", cfg.Policies)
+	}
+}
+
+func TestParseConfig_MergeConflict(t *testing.T) {
+	dir := filepath.Join("..", "..", "testdata", "merge")
+
+	_, err := ParseConfig(filepath.Join(dir, "users.yaml"), filepath.Join(dir, "conflict.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "conflicting security for GET /users") {
+		t.Fatalf("expected conflict error for GET /users, got %v", err)
+	}
+}
+
+func TestParseConfig_APIKey(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "apikey.yaml")
+
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	tests := []struct {
+		key  model.RouteKey
+		want model.APIKey
+	}{
+		{model.RouteKey{Method: "GET", Path: "/reports"}, model.APIKey{Name: "X-API-Key", In: "header"}},
+		{model.RouteKey{Method: "GET", Path: "/export"}, model.APIKey{Name: "api_key", In: "query"}},
+		{model.RouteKey{Method: "GET", Path: "/dashboard"}, model.APIKey{Name: "session", In: "cookie"}},
+	}
+	for _, tt := range tests {
+		p, ok := cfg.Policies[tt.key]
+		if !ok {
+			t.Fatalf("missing policy for %s %s", tt.key.Method, tt.key.Path)
+		}
+		if !p.RequireAuth || p.APIKey == nil || *p.APIKey != tt.want {
+			t.Errorf("%s %s: expected apiKey %+v, got %+v", tt.key.Method, tt.key.Path, tt.want, p)
+		}
+	}
+
+	if p := cfg.Policies[model.RouteKey{Method: "GET", Path: "/dashboard"}]; len(p.Roles) != 1 || p.Roles[0] != "viewer" {
+		t.Errorf("expected viewer role for GET /dashboard, got %+v", p.Roles)
+	}
+	if p := cfg.Policies[model.RouteKey{Method: "GET", Path: "/dashboard"}]; !p.SessionCookie {
+		t.Errorf("expected GET /dashboard to use a session cookie, got %+v", p)
+	}
+	if p := cfg.Policies[model.RouteKey{Method: "GET", Path: "/reports"}]; p.SessionCookie {
+		t.Errorf("expected GET /reports not to use a session cookie, got %+v", p)
+	}
+}
+
+func TestParseConfig_OAuth2(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "oauth2.yaml")
+
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	if p := cfg.Policies[model.RouteKey{Method: "GET", Path: "/vegetables"}]; !p.RequireAuth || len(p.Scopes) != 1 || p.Scopes[0] != "vegetable:read" {
+		t.Errorf("expected vegetable:read scope for GET /vegetables, got %+v", p)
+	}
+
+	p := cfg.Policies[model.RouteKey{Method: "POST", Path: "/vegetables"}]
+	if len(p.Scopes) != 1 || p.Scopes[0] != "vegetable:write" {
+		t.Errorf("expected vegetable:write scope for POST /vegetables, got %+v", p.Scopes)
+	}
+	if len(p.Roles) != 1 || p.Roles[0] != "admin" {
+		t.Errorf("expected admin role for POST /vegetables, got %+v", p.Roles)
+	}
+}
+
+func TestParseConfig_OAuth2UndeclaredScope(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "oauth2_undeclared_scope.yaml")
+
+	_, err := ParseConfig(path)
+	if err == nil || !strings.Contains(err.Error(), `"vegetable:delete" is not declared`) {
+		t.Fatalf("expected undeclared scope error, got %v", err)
+	}
+}
+
+func TestParseConfig_OpenIDConnect(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "openidconnect.yaml")
+
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	p, ok := cfg.Policies[model.RouteKey{Method: "GET", Path: "/profile"}]
+	if !ok {
+		t.Fatalf("missing policy for GET /profile")
+	}
+	if !p.RequireAuth || p.OpenIDConnectURL != "https://id.example.com/.well-known/openid-configuration" {
+		t.Errorf("expected openIdConnectUrl on GET /profile, got %+v", p)
+	}
+	if len(p.Scopes) != 1 || p.Scopes[0] != "profile" || len(p.Roles) != 1 || p.Roles[0] != "member" {
+		t.Errorf("expected profile scope and member role, got %+v", p)
+	}
+}
+
+func TestParseConfig_HTTPSchemes(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "http_basic.yaml")
+
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	p := cfg.Policies[model.RouteKey{Method: "GET", Path: "/legacy"}]
+	if !p.RequireAuth || len(p.Schemes) != 1 || p.Schemes[0] != model.SchemeBasic {
+		t.Errorf("expected basic scheme for GET /legacy, got %+v", p)
+	}
+
+	// Any http bearer scheme is recognised, whatever its name.
+	p = cfg.Policies[model.RouteKey{Method: "GET", Path: "/modern"}]
+	if !p.RequireAuth || len(p.Schemes) != 1 || p.Schemes[0] != model.SchemeBearer {
+		t.Errorf("expected bearer scheme for GET /modern, got %+v", p)
+	}
+	if len(p.Roles) != 1 || p.Roles[0] != "admin" {
+		t.Errorf("expected admin role for GET /modern, got %+v", p.Roles)
+	}
+}
+
+func TestParseConfig_MutualTLS(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "mutualtls.yaml")
+
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	p := cfg.Policies[model.RouteKey{Method: "POST", Path: "/payments"}]
+	if !p.RequireAuth || !p.MutualTLS || len(p.Schemes) != 1 || p.Schemes[0] != model.SchemeMutualTLS {
+		t.Errorf("expected mutualTLS policy for POST /payments, got %+v", p)
+	}
+	if len(p.Roles) != 1 || p.Roles[0] != "partner" {
+		t.Errorf("expected partner role for POST /payments, got %+v", p.Roles)
+	}
+}
+
+func TestParseConfig_AlternativeRequirements(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "alternatives.yaml")
+
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	p := cfg.Policies[model.RouteKey{Method: "GET", Path: "/reports"}]
+	if !p.RequireAuth || len(p.Schemes) != 1 || p.Schemes[0] != model.SchemeBearer {
+		t.Fatalf("expected bearer as the primary requirement, got %+v", p)
+	}
+	if len(p.Alternatives) != 1 {
+		t.Fatalf("expected one alternative, got %+v", p.Alternatives)
+	}
+	if alt := p.Alternatives[0]; alt.APIKey == nil || alt.APIKey.Name != "X-API-Key" {
+		t.Errorf("expected API key alternative, got %+v", alt)
+	}
+
+	// A single operation-level requirement has no alternatives.
+	if p := cfg.Policies[model.RouteKey{Method: "DELETE", Path: "/admin"}]; len(p.Alternatives) != 0 {
+		t.Errorf("expected no alternatives for DELETE /admin, got %+v", p.Alternatives)
+	}
+}
+
+func TestParseConfig_CombinedRequirement(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "combined.yaml")
+
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	p := cfg.Policies[model.RouteKey{Method: "DELETE", Path: "/admin"}]
+	if len(p.Schemes) != 2 || p.Schemes[0] != model.SchemeAPIKey || p.Schemes[1] != model.SchemeBearer {
+		t.Errorf("expected apiKey AND bearer schemes, got %+v", p.Schemes)
+	}
+	if p.APIKey == nil || p.APIKey.Name != "X-API-Key" {
+		t.Errorf("expected API key location to be kept, got %+v", p.APIKey)
+	}
+	if len(p.Roles) != 1 || p.Roles[0] != "admin" {
+		t.Errorf("expected admin role from the bearer scheme, got %+v", p.Roles)
+	}
+	if len(p.Alternatives) != 0 {
+		t.Errorf("expected no alternatives, got %+v", p.Alternatives)
+	}
+
+	// The bearer+digest requirement cannot be enforced, so only the API key
+	// requirement remains.
+	p = cfg.Policies[model.RouteKey{Method: "GET", Path: "/mixed"}]
+	if len(p.Schemes) != 1 || p.Schemes[0] != model.SchemeAPIKey || len(p.Alternatives) != 0 {
+		t.Errorf("expected only the apiKey requirement for GET /mixed, got %+v", p)
+	}
+}
+
+func TestParseConfig_CombinedRoles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "openapi.yaml")
+	spec := `openapi: 3.0.3
+components:
+  securitySchemes:
+    BearerAuth:
+      type: http
+      scheme: bearer
+    ApiKeyAuth:
+      type: apiKey
+      in: header
+      name: X-API-Key
+paths:
+  /reports:
+    get:
+      security:
+        - BearerAuth: ["role:admin"]
+          ApiKeyAuth: ["role:auditor"]
+`
+	if err := os.WriteFile(path, []byte(spec), 0o644); err != nil {
+		t.Fatalf("write spec: %v", err)
+	}
+
+	// Roles are alternatives, so requiring admin and auditor together
+	// cannot be expressed and must not become admin or auditor.
+	if _, err := ParseConfig(path); err == nil || !strings.Contains(err.Error(), "single scheme naming roles") {
+		t.Errorf("expected an error for roles from two schemes of one requirement, got %v", err)
+	}
+}
+
+func TestParseConfigWithOptions_BearerSchemes(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "custom_bearer.yaml")
+	key := model.RouteKey{Method: "DELETE", Path: "/admin"}
+
+	// By default JWT is just an apiKey scheme.
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+	if p := cfg.Policies[key]; len(p.Schemes) != 1 || p.Schemes[0] != model.SchemeAPIKey {
+		t.Errorf("expected apiKey scheme by default, got %+v", p)
+	}
+
+	cfg, err = ParseConfigWithOptions(path, Options{BearerSchemes: []string{"JWT"}})
+	if err != nil {
+		t.Fatalf("ParseConfigWithOptions error: %v", err)
+	}
+	p := cfg.Policies[key]
+	if len(p.Schemes) != 1 || p.Schemes[0] != model.SchemeBearer || p.APIKey != nil {
+		t.Errorf("expected JWT to be treated as bearer, got %+v", p)
+	}
+	if len(p.Roles) != 1 || p.Roles[0] != "admin" {
+		t.Errorf("expected admin role, got %+v", p.Roles)
+	}
+}
+
+func TestParseConfig_XAuthz(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "x_authz.yaml")
+
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	p := cfg.Policies[model.RouteKey{Method: "PUT", Path: "/users/{userId}"}]
+	if len(p.Scopes) != 1 || p.Scopes[0] != "profile:write" || len(p.Roles) != 1 || p.Roles[0] != "member" {
+		t.Errorf("expected x-authz to augment derived scopes, got %+v", p)
+	}
+	if p.OwnerParam != "userId" || len(p.Conditions) != 1 {
+		t.Errorf("expected owner and conditions from x-authz, got %+v", p)
+	}
+
+	p = cfg.Policies[model.RouteKey{Method: "DELETE", Path: "/admin"}]
+	if len(p.Scopes) != 0 || len(p.Roles) != 1 || p.Roles[0] != "admin" {
+		t.Errorf("expected x-authz to override derived scopes, got %+v", p)
+	}
+	if len(p.Schemes) != 1 || p.Schemes[0] != model.SchemeBearer {
+		t.Errorf("expected override to keep the credential scheme, got %+v", p.Schemes)
+	}
+
+	p = cfg.Policies[model.RouteKey{Method: "GET", Path: "/reports"}]
+	if !p.RequireAuth || len(p.Scopes) != 1 || p.Scopes[0] != "reports:read" {
+		t.Errorf("expected x-authz alone to require auth, got %+v", p)
+	}
+}
+
+func TestApplyAuthz_InvalidOwner(t *testing.T) {
+	policy := model.AuthPolicy{}
+	err := applyAuthz(&policy, &authzExtension{Owner: "id"}, "/users/{userId}")
+	if err == nil || !strings.Contains(err.Error(), "not a path parameter") {
+		t.Fatalf("expected owner parameter error, got %v", err)
+	}
+}
+
+func TestParseConfig_XRolesAndXScopes(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "x_roles_scopes.yaml")
+
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	p := cfg.Policies[model.RouteKey{Method: "POST", Path: "/vegetables"}]
+	if len(p.Roles) != 1 || p.Roles[0] != "gardener" {
+		t.Errorf("expected gardener role from x-roles, got %+v", p.Roles)
+	}
+	if len(p.Scopes) != 2 || p.Scopes[0] != "vegetable:write" || p.Scopes[1] != "vegetable:audit" {
+		t.Errorf("expected x-scopes to be merged with derived scopes, got %+v", p.Scopes)
+	}
+
+	p = cfg.Policies[model.RouteKey{Method: "GET", Path: "/reports"}]
+	if !p.RequireAuth || len(p.Roles) != 1 || p.Roles[0] != "analyst" {
+		t.Errorf("expected x-roles alone to require auth, got %+v", p)
+	}
+}
+
+func TestParseConfigWithOptions_ServerBasePath(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "servers.yaml")
+
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+	if _, ok := cfg.Policies[model.RouteKey{Method: "GET", Path: "/users"}]; !ok {
+		t.Errorf("expected unprefixed keys by default, got %+v", cfg.Policies)
+	}
+
+	cfg, err = ParseConfigWithOptions(path, Options{ServerBasePath: true})
+	if err != nil {
+		t.Fatalf("ParseConfigWithOptions error: %v", err)
+	}
+
+	want := []model.RouteKey{
+		{Method: "GET", Path: "/api/v1/users"},
+		{Method: "GET", Path: "/internal/users"},
+		{Method: "GET", Path: "/health"},
+	}
+	if len(cfg.Policies) != len(want) {
+		t.Fatalf("expected %d policies, got %+v", len(want), cfg.Policies)
+	}
+	for _, key := range want {
+		if _, ok := cfg.Policies[key]; !ok {
+			t.Errorf("missing policy for %s %s", key.Method, key.Path)
+		}
+	}
+	if p := cfg.Policies[model.RouteKey{Method: "GET", Path: "/api/v1/users"}]; !p.RequireAuth {
+		t.Errorf("expected prefixed route to keep its policy, got %+v", p)
+	}
+}
+
+func TestParseConfigWithOptions_ServerBasePathCollision(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "openapi.yaml")
+	spec := `openapi: 3.0.3
+servers:
+  - url: https://api.example.com/v1
+  - url: https://api.example.com/
+components:
+  securitySchemes:
+    BearerAuth:
+      type: http
+      scheme: bearer
+paths:
+  /users:
+    get:
+      security: []
+  /v1/users:
+    get:
+      security:
+        - BearerAuth: []
+`
+	if err := os.WriteFile(path, []byte(spec), 0o644); err != nil {
+		t.Fatalf("write spec: %v", err)
+	}
+
+	// GET /v1/users is both /users under the /v1 server and /v1/users
+	// under the / server, with different policies.
+	_, err := ParseConfigWithOptions(path, Options{ServerBasePath: true})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || conflict.Path != "/v1/users" || conflict.Sources != [2]string{"/users", "/v1/users"} {
+		t.Fatalf("expected a conflict for GET /v1/users, got %v", err)
+	}
+
+	cfg, err := ParseConfigWithOptions(path, Options{ServerBasePath: true, Mode: ModeLenient})
+	if err != nil {
+		t.Fatalf("ParseConfigWithOptions error: %v", err)
+	}
+	if p := cfg.Policies[model.RouteKey{Method: "GET", Path: "/v1/users"}]; p.RequireAuth {
+		t.Errorf("expected the first policy to be kept, got %+v", p)
+	}
+	if len(cfg.Warnings) != 1 || !strings.Contains(cfg.Warnings[0].Message, "conflicting security for GET /v1/users") {
+		t.Errorf("expected a warning for the collision, got %+v", cfg.Warnings)
+	}
+}
+
+func TestParseConfigWithOptions_Router(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "path_params.yaml")
+
+	tests := []struct {
+		router string
+		want   string
+	}{
+		{RouterChi, "/users/{userId}/orders/{orderId}"},
+		{RouterGorilla, "/users/{userId}/orders/{orderId}"},
+		{RouterServeMux, "/users/{userId}/orders/{orderId}"},
+		{RouterGin, "/users/:userId/orders/:orderId"},
+		{RouterEcho, "/users/:userId/orders/:orderId"},
+		{RouterFiber, "/users/:userId/orders/:orderId"},
+	}
+	for _, tt := range tests {
+		cfg, err := ParseConfigWithOptions(path, Options{Router: tt.router})
+		if err != nil {
+			t.Fatalf("%s: ParseConfigWithOptions error: %v", tt.router, err)
+		}
+		p, ok := cfg.Policies[model.RouteKey{Method: "GET", Path: tt.want}]
+		if !ok || !p.RequireAuth {
+			t.Errorf("%s: expected protected route %s, got %+v", tt.router, tt.want, cfg.Policies)
+		}
+		// Parameter names survive the router rewrite.
+		if !slices.Equal(p.PathParams, []string{"userId", "orderId"}) {
+			t.Errorf("%s: expected path params [userId orderId], got %v", tt.router, p.PathParams)
+		}
+		if p, ok := cfg.Policies[model.RouteKey{Method: "GET", Path: "/health"}]; !ok || p.PathParams != nil {
+			t.Errorf("%s: expected /health to be unchanged, got %+v", tt.router, p)
+		}
+	}
+
+	if _, err := ParseConfigWithOptions(path, Options{Router: "martini"}); err == nil {
+		t.Errorf("expected error for unknown router")
+	}
+}
+
+func TestParseConfig_TraceAndCustomMethods(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "methods.yaml")
+
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	if p := cfg.Policies[model.RouteKey{Method: "TRACE", Path: "/debug"}]; len(p.Roles) != 1 || p.Roles[0] != "sre" {
+		t.Errorf("expected sre role for TRACE /debug, got %+v", p)
+	}
+	if p, ok := cfg.Policies[model.RouteKey{Method: "PROPFIND", Path: "/files/{path}"}]; !ok || !p.RequireAuth {
+		t.Errorf("expected protected PROPFIND from x-methods, got %+v", p)
+	}
+	if p := cfg.Policies[model.RouteKey{Method: "PURGE", Path: "/files/{path}"}]; len(p.Roles) != 1 || p.Roles[0] != "admin" {
+		t.Errorf("expected admin role for PURGE, got %+v", p)
+	}
+	if _, ok := cfg.Policies[model.RouteKey{Method: "GET", Path: "/files/{path}"}]; !ok {
+		t.Errorf("expected standard GET alongside custom methods")
+	}
+}
+
+func TestPathItemOperations_DuplicateCustomMethod(t *testing.T) {
+	item := &pathItem{
+		Get:      &operation{},
+		XMethods: map[string]*operation{"get": {}},
+	}
+	if _, err := item.Operations(); err == nil {
+		t.Fatalf("expected error for x-methods redeclaring GET")
+	}
+}
+
+func TestParseConfig_PathItemExtensions(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "path_item_extensions.yaml")
+
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	p := cfg.Policies[model.RouteKey{Method: "GET", Path: "/tenants/{tenantId}/reports"}]
+	if len(p.Roles) != 1 || p.Roles[0] != "analyst" || p.OwnerParam != "tenantId" {
+		t.Errorf("expected GET to inherit path-level x-authz, got %+v", p)
+	}
+	if len(p.Scopes) != 1 || p.Scopes[0] != "reports:read" {
+		t.Errorf("expected GET to inherit path-level x-scopes, got %+v", p.Scopes)
+	}
+
+	p = cfg.Policies[model.RouteKey{Method: "POST", Path: "/tenants/{tenantId}/reports"}]
+	if len(p.Roles) != 1 || p.Roles[0] != "editor" || p.OwnerParam != "" {
+		t.Errorf("expected POST x-authz to replace the path-level one, got %+v", p)
+	}
+	if len(p.Scopes) != 0 {
+		t.Errorf("expected POST x-scopes to replace the path-level ones, got %+v", p.Scopes)
+	}
+}
+
+func TestParseConfig_Webhooks(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "openapi31.yaml")
+
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	p, ok := cfg.Webhooks[model.RouteKey{Method: "POST", Path: "newVegetable"}]
+	if !ok {
+		t.Fatalf("missing webhook policy for POST newVegetable, got %+v", cfg.Webhooks)
+	}
+	if !p.RequireAuth {
+		t.Errorf("expected webhook to inherit root security, got %+v", p)
+	}
+	if _, ok := cfg.Policies[model.RouteKey{Method: "POST", Path: "newVegetable"}]; ok {
+		t.Errorf("expected webhooks to be kept out of route policies")
+	}
+
+	// Specs without webhooks leave the section nil.
+	cfg, err = ParseConfig(filepath.Join("..", "..", "testdata", "basic.yaml"))
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+	if cfg.Webhooks != nil {
+		t.Errorf("expected no webhooks, got %+v", cfg.Webhooks)
+	}
+}
+
+func TestParseConfig_Callbacks(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "callbacks.yaml")
+
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	p, ok := cfg.Callbacks[model.RouteKey{Method: "POST", Path: "{$request.body#/callbackUrl}"}]
+	if !ok {
+		t.Fatalf("missing callback policy, got %+v", cfg.Callbacks)
+	}
+	if p.APIKey == nil || p.APIKey.Name != "X-Signature" {
+		t.Errorf("expected signature key on callback, got %+v", p)
+	}
+
+	// Nested callbacks are collected too.
+	if p, ok := cfg.Callbacks[model.RouteKey{Method: "PUT", Path: "{$request.body#/ackUrl}"}]; !ok || p.RequireAuth {
+		t.Errorf("expected public nested callback, got %+v (found=%t)", p, ok)
+	}
+
+	if len(cfg.Policies) != 1 {
+		t.Errorf("expected callbacks to be kept out of route policies, got %+v", cfg.Policies)
+	}
+}
+
+func TestParseConfigWithOptions_Deprecated(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "deprecated.yaml")
+	oldKey := model.RouteKey{Method: "GET", Path: "/v1/vegetables"}
+	newKey := model.RouteKey{Method: "GET", Path: "/v2/vegetables"}
+
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+	if p := cfg.Policies[oldKey]; !p.Deprecated || p.Deny || len(p.Scopes) != 1 {
+		t.Errorf("expected deprecated policy to be kept by default, got %+v", p)
+	}
+	if p := cfg.Policies[newKey]; p.Deprecated {
+		t.Errorf("expected current operation not to be deprecated, got %+v", p)
+	}
+
+	cfg, err = ParseConfigWithOptions(path, Options{DeprecatedMode: DeprecatedDeny})
+	if err != nil {
+		t.Fatalf("ParseConfigWithOptions error: %v", err)
+	}
+	if p := cfg.Policies[oldKey]; !p.Deny || len(p.Alternatives) != 0 {
+		t.Errorf("expected deprecated operation to be denied, got %+v", p)
+	}
+	if p := cfg.Policies[newKey]; p.Deny {
+		t.Errorf("expected current operation not to be denied, got %+v", p)
+	}
+
+	cfg, err = ParseConfigWithOptions(path, Options{DeprecatedMode: DeprecatedScope, DeprecatedScope: "legacy"})
+	if err != nil {
+		t.Fatalf("ParseConfigWithOptions error: %v", err)
+	}
+	p := cfg.Policies[oldKey]
+	if !slices.Equal(p.Scopes, []string{"vegetable:read", "legacy"}) {
+		t.Errorf("expected legacy scope to be required, got %+v", p.Scopes)
+	}
+	if len(p.Alternatives) != 1 || !slices.Equal(p.Alternatives[0].Scopes, []string{"legacy"}) {
+		t.Errorf("expected legacy scope on every alternative, got %+v", p.Alternatives)
+	}
+
+	if _, err := ParseConfigWithOptions(path, Options{DeprecatedMode: DeprecatedScope}); err == nil {
+		t.Errorf("expected error for scope mode without a scope")
+	}
+}
+
+func TestParseConfig_ErrorPosition(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "unknown_scheme.yaml")
+
+	_, err := ParseConfig(path)
+	if err == nil {
+		t.Fatalf("expected error for undeclared security scheme")
+	}
+	for _, want := range []string{"line 17, column 7", "POST /vegetables", "BaererAuth"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got %v", want, err)
+		}
+	}
+}
+
+func TestParseConfigWithOptions_Modes(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "parse_modes.yaml")
+
+	// By default the digest requirement is skipped silently, but an
+	// operation with no enforceable requirement is an error.
+	if _, err := ParseConfig(path); err == nil || !strings.Contains(err.Error(), "DELETE /users/{userId}") {
+		t.Errorf("expected error for DELETE /users/{userId}, got %v", err)
+	}
+
+	if _, err := ParseConfigWithOptions(path, Options{Mode: ModeStrict}); err == nil || !strings.Contains(err.Error(), "only differ in parameter names") {
+		t.Errorf("expected strict mode to reject duplicate paths, got %v", err)
+	}
+
+	cfg, err := ParseConfigWithOptions(path, Options{Mode: ModeLenient})
+	if err != nil {
+		t.Fatalf("ParseConfigWithOptions error: %v", err)
+	}
+	if p := cfg.Policies[model.RouteKey{Method: "DELETE", Path: "/users/{userId}"}]; !p.RequireAuth || len(p.Schemes) != 0 {
+		t.Errorf("expected lenient fallback to require auth, got %+v", p)
+	}
+	if len(cfg.Warnings) != 4 {
+		t.Fatalf("expected 4 warnings, got %+v", cfg.Warnings)
+	}
+	want := path + `:18:7: GET /users/{id}: security scheme "DigestAuth" uses unsupported http scheme "digest"; requirement skipped`
+	if got := cfg.Warnings[0].String(); got != want {
+		t.Errorf("unexpected first warning:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestParseConfigWithOptions_Fallback(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "parse_modes.yaml")
+	key := model.RouteKey{Method: "DELETE", Path: "/users/{userId}"}
+
+	if _, err := ParseConfigWithOptions(path, Options{Fallback: FallbackError}); err == nil {
+		t.Errorf("expected error with the error fallback")
+	}
+
+	tests := []struct {
+		fallback string
+		want     model.AuthMode
+	}{
+		{FallbackRequireAuth, model.AuthRequired},
+		{FallbackPublic, model.AuthPublic},
+	}
+	for _, tt := range tests {
+		cfg, err := ParseConfigWithOptions(path, Options{Fallback: tt.fallback})
+		if err != nil {
+			t.Fatalf("%s: ParseConfigWithOptions error: %v", tt.fallback, err)
+		}
+		if p := cfg.Policies[key]; p.Mode() != tt.want {
+			t.Errorf("%s: expected %s policy, got %+v", tt.fallback, tt.want, p)
+		}
+		if len(cfg.Warnings) != 1 || cfg.Warnings[0].Path != key.Path {
+			t.Errorf("%s: expected one warning for %s, got %v", tt.fallback, key.Path, cfg.Warnings)
+		}
+	}
+
+	if _, err := ParseConfigWithOptions(path, Options{Mode: ModeStrict, Fallback: FallbackPublic}); err == nil || !strings.Contains(err.Error(), "strict mode") {
+		t.Errorf("expected strict mode to reject the public fallback, got %v", err)
+	}
+	if _, err := ParseConfigWithOptions(path, Options{Fallback: "allow"}); err == nil {
+		t.Errorf("expected error for unknown fallback")
+	}
+}
+
+func TestDerivePolicy_StrictRequiresDeclaredSchemes(t *testing.T) {
+	root := &openapiRoot{}
+	op := &operation{Security: []securityRequirement{{"BearerAuth": nil}}}
+
+	if _, _, err := derivePolicy(root, op, Options{}); err != nil {
+		t.Fatalf("expected BearerAuth to be accepted by name, got %v", err)
+	}
+	if _, _, err := derivePolicy(root, op, Options{Mode: ModeStrict}); err == nil {
+		t.Errorf("expected strict mode to reject undeclared BearerAuth")
+	}
+}
+
+func TestParseConfigWithOptions_ClaimsMapping(t *testing.T) {
+	dir := filepath.Join("..", "..", "testdata", "claims")
+
+	mapping, err := LoadClaimsMapping(filepath.Join(dir, "mapping.yaml"))
+	if err != nil {
+		t.Fatalf("LoadClaimsMapping error: %v", err)
+	}
+	cfg, err := ParseConfigWithOptions(filepath.Join(dir, "openapi.yaml"), Options{ClaimsMapping: mapping})
+	if err != nil {
+		t.Fatalf("ParseConfigWithOptions error: %v", err)
+	}
+
+	if p := cfg.Policies[model.RouteKey{Method: "DELETE", Path: "/admin"}]; !slices.Equal(p.Roles, []string{"admin"}) {
+		t.Errorf("expected AdminAuth to imply the admin role, got %+v", p)
+	}
+	p := cfg.Policies[model.RouteKey{Method: "POST", Path: "/vegetables"}]
+	if !slices.Equal(p.Roles, []string{"admin"}) || !slices.Equal(p.Scopes, []string{"vegetable:read", "vegetable:write"}) {
+		t.Errorf("expected mapped roles and scopes, got %+v", p)
+	}
+}
+
+func TestParseConfigWithOptions_ScopeRewrite(t *testing.T) {
+	dir := filepath.Join("..", "..", "testdata", "claims")
+
+	mapping, err := LoadClaimsMapping(filepath.Join(dir, "rewrite.yaml"))
+	if err != nil {
+		t.Fatalf("LoadClaimsMapping error: %v", err)
+	}
+	cfg, err := ParseConfigWithOptions(filepath.Join(dir, "idp_scopes.yaml"), Options{ClaimsMapping: mapping})
+	if err != nil {
+		t.Fatalf("ParseConfigWithOptions error: %v", err)
+	}
+
+	p := cfg.Policies[model.RouteKey{Method: "POST", Path: "/vegetables"}]
+	// Rules must match the whole scope, so "vegetables.read.all" is kept.
+	if !slices.Equal(p.Scopes, []string{"vegetable:write", "vegetables.read.all"}) {
+		t.Errorf("expected rewritten scopes, got %+v", p.Scopes)
+	}
+	if len(p.Alternatives) != 1 || !slices.Equal(p.Alternatives[0].Scopes, []string{"vegetable:write"}) {
+		t.Errorf("expected alternatives to be rewritten too, got %+v", p.Alternatives)
+	}
+}
+
+func TestParseConfig_XPublic(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "x_public.yaml")
+
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	if p := cfg.Policies[model.RouteKey{Method: "GET", Path: "/health"}]; p.RequireAuth || !p.PublicOverride || len(p.Roles) != 0 {
+		t.Errorf("expected x-public to force a public policy, got %+v", p)
+	}
+	if p := cfg.Policies[model.RouteKey{Method: "GET", Path: "/vegetables"}]; !p.RequireAuth || p.PublicOverride {
+		t.Errorf("expected root security to apply, got %+v", p)
+	}
+
+	op := &operation{Public: true, Security: []securityRequirement{{"BearerAuth": nil}}}
+	if err := op.checkPublic(); err == nil {
+		t.Errorf("expected error for x-public combined with security")
+	}
+}
+
+func TestParseConfigWithOptions_Overlays(t *testing.T) {
+	dir := filepath.Join("..", "..", "testdata", "overlay")
+
+	cfg, err := ParseConfigWithOptions(filepath.Join(dir, "openapi.yaml"), Options{
+		Overlays: []string{filepath.Join(dir, "security.yaml")},
+	})
+	if err != nil {
+		t.Fatalf("ParseConfigWithOptions error: %v", err)
+	}
+
+	if p := cfg.Policies[model.RouteKey{Method: "GET", Path: "/vegetables"}]; !p.RequireAuth || !slices.Equal(p.Scopes, []string{"vegetable:read"}) {
+		t.Errorf("expected overlay to add security to GET /vegetables, got %+v", p)
+	}
+	if p := cfg.Policies[model.RouteKey{Method: "POST", Path: "/vegetables"}]; !slices.Equal(p.Roles, []string{"gardener"}) {
+		t.Errorf("expected overlay to add x-roles to POST /vegetables, got %+v", p)
+	}
+	if p := cfg.Policies[model.RouteKey{Method: "DELETE", Path: "/vegetables/{name}"}]; !slices.Equal(p.Roles, []string{"admin"}) {
+		t.Errorf("expected overlay to replace x-roles on DELETE /vegetables/{name}, got %+v", p)
+	}
+}
+
+func TestParseJSONPath(t *testing.T) {
+	segments, err := parseJSONPath(`$.paths['/users/{id}'].get.x-roles[0]`)
+	if err != nil {
+		t.Fatalf("parseJSONPath error: %v", err)
+	}
+	want := []jsonPathSegment{{name: "paths"}, {name: "/users/{id}"}, {name: "get"}, {name: "x-roles"}, {index: 0, isIndex: true}}
+	if !slices.Equal(segments, want) {
+		t.Errorf("unexpected segments %+v", segments)
+	}
+
+	for _, expr := range []string{"paths", "$..get", "$.paths[?(@.get)]", "$.paths['/users"} {
+		if _, err := parseJSONPath(expr); err == nil {
+			t.Errorf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestParseConfigFromReader(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "basic.json"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+
+	cfg, err := ParseConfigFromReader(strings.NewReader(string(data)), Options{})
+	if err != nil {
+		t.Fatalf("ParseConfigFromReader error: %v", err)
+	}
+	if p := cfg.Policies[model.RouteKey{Method: "DELETE", Path: "/admin"}]; !p.RequireAuth || !slices.Equal(p.Roles, []string{"admin"}) {
+		t.Errorf("expected admin policy for DELETE /admin, got %+v", p)
+	}
+}
+
+func TestParseConfig_Tags(t *testing.T) {
+	cfg, err := ParseConfig(filepath.Join("..", "..", "testdata", "tags.yaml"))
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+	for key, want := range map[model.RouteKey][]string{
+		{Method: "GET", Path: "/users"}:         {"Users"},
+		{Method: "DELETE", Path: "/users/{id}"}: {"Users", "Admin"},
+		{Method: "GET", Path: "/health"}:        nil,
+	} {
+		if got := cfg.Policies[key].Tags; !slices.Equal(got, want) {
+			t.Errorf("expected tags %q for %s %s, got %q", want, key.Method, key.Path, got)
+		}
+	}
+}
+
+func TestParseConfigWithOptions_TrailingSlash(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "trailing_slash.yaml")
+
+	cfg, err := ParseConfigWithOptions(path, Options{TrailingSlash: TrailingSlashStrip})
+	if err != nil {
+		t.Fatalf("ParseConfigWithOptions error: %v", err)
+	}
+	for _, key := range []model.RouteKey{
+		{Method: "GET", Path: "/"},
+		{Method: "GET", Path: "/users"},
+		{Method: "POST", Path: "/orders"},
+	} {
+		if _, ok := cfg.Policies[key]; !ok {
+			t.Errorf("missing policy for %s %s, got %+v", key.Method, key.Path, cfg.Policies)
+		}
+	}
+	if len(cfg.Policies) != 3 {
+		t.Errorf("expected /users and /users/ to be merged, got %+v", cfg.Policies)
+	}
+	// The merged route keeps the policy of /users whatever the map
+	// iteration order.
+	for i := 0; i < 20; i++ {
+		cfg, err := ParseConfigWithOptions(path, Options{TrailingSlash: TrailingSlashStrip})
+		if err != nil {
+			t.Fatalf("ParseConfigWithOptions error: %v", err)
+		}
+		if got := cfg.Policies[model.RouteKey{Method: "GET", Path: "/users"}].OperationID; got != "listUsers" {
+			t.Fatalf("expected GET /users to keep the operationId of /users, got %q", got)
+		}
+	}
+
+	_, err = ParseConfigWithOptions(path, Options{TrailingSlash: TrailingSlashStrip, Duplicates: DuplicatesError})
+	if err == nil || !strings.Contains(err.Error(), "declared as both /users and /users/") {
+		t.Errorf("expected duplicate route error, got %v", err)
+	}
+}
+
+func TestParseConfigWithOptions_TrailingSlashConflict(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "openapi.yaml")
+	spec := `openapi: 3.0.3
+components:
+  securitySchemes:
+    BearerAuth:
+      type: http
+      scheme: bearer
+paths:
+  /users:
+    get:
+      security: []
+  /users/:
+    get:
+      security:
+        - BearerAuth: []
+`
+	if err := os.WriteFile(path, []byte(spec), 0o644); err != nil {
+		t.Fatalf("write spec: %v", err)
+	}
+
+	_, err := ParseConfigWithOptions(path, Options{TrailingSlash: TrailingSlashStrip})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || conflict.Path != "/users" {
+		t.Fatalf("expected a conflict for GET /users, got %v", err)
+	}
+
+	cfg, err := ParseConfigWithOptions(path, Options{TrailingSlash: TrailingSlashStrip, Mode: ModeLenient})
+	if err != nil {
+		t.Fatalf("ParseConfigWithOptions error: %v", err)
+	}
+	if p := cfg.Policies[model.RouteKey{Method: "GET", Path: "/users"}]; p.RequireAuth {
+		t.Errorf("expected the policy of /users to be kept, got %+v", p)
+	}
+	if len(cfg.Warnings) != 1 || cfg.Warnings[0].Path != "/users/" || !strings.Contains(cfg.Warnings[0].Message, "conflicting security for GET /users") {
+		t.Errorf("expected a warning for the conflict, got %+v", cfg.Warnings)
+	}
+}
+
+func TestParseConfigWithOptions_CaseInsensitivePaths(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "mixed_case.yaml")
+
+	cfg, err := ParseConfigWithOptions(path, Options{CaseInsensitivePaths: true})
+	if err != nil {
+		t.Fatalf("ParseConfigWithOptions error: %v", err)
+	}
+	if !cfg.CaseInsensitivePaths {
+		t.Errorf("expected CaseInsensitivePaths to be recorded on the config")
+	}
+	if len(cfg.Policies) != 2 {
+		t.Errorf("expected /Users and /users to be merged, got %+v", cfg.Policies)
+	}
+	if p, ok := cfg.Policies[model.RouteKey{Method: "GET", Path: "/users/{userId}"}]; !ok || !p.RequireAuth {
+		t.Errorf("expected lower-cased protected route keeping its parameter name, got %+v", cfg.Policies)
+	}
+	if _, ok := cfg.Policies[model.RouteKey{Method: "GET", Path: "/reports"}]; !ok {
+		t.Errorf("expected lower-cased /reports, got %+v", cfg.Policies)
+	}
+}
+
+func TestParseConfig_ConflictDiagnostics(t *testing.T) {
+	cfg, err := ParseConfig(filepath.Join("..", "..", "testdata", "root_override.yaml"))
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	// Only GET /reports contradicts the root security; the explicit public
+	// override, the identical requirement and DELETE /users/{id}, which
+	// adds a scope to it, are not reported.
+	if len(cfg.Warnings) != 1 {
+		t.Fatalf("expected a single override warning, got %+v", cfg.Warnings)
+	}
+	w := cfg.Warnings[0]
+	if w.Method != "GET" || w.Path != "/reports" || !strings.Contains(w.Message, `header apiKey "X-API-Key"`) || !strings.Contains(w.Message, "bearer auth with roles [admin]") {
+		t.Errorf("unexpected warning %+v", w)
+	}
+
+	dir := filepath.Join("..", "..", "testdata", "merge")
+	_, err = ParseConfig(filepath.Join(dir, "users.yaml"), filepath.Join(dir, "conflict.yaml"))
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected a ConflictError, got %v", err)
+	}
+	if conflict.Method != "GET" || conflict.Path != "/users" || conflict.Sources[0] != filepath.Join(dir, "conflict.yaml") || conflict.Sources[1] != filepath.Join(dir, "users.yaml") {
+		t.Errorf("unexpected conflict %+v", conflict)
+	}
+}
+
+func TestParseConfigWithOptions_RootSecurityMerge(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "root_override.yaml")
+
+	cfg, err := ParseConfigWithOptions(path, Options{RootSecurity: RootSecurityMerge})
+	if err != nil {
+		t.Fatalf("ParseConfigWithOptions error: %v", err)
+	}
+	if len(cfg.Warnings) != 0 {
+		t.Errorf("expected no override warnings, got %+v", cfg.Warnings)
+	}
+
+	// The root bearer requirement comes first, then the operation's own.
+	p := cfg.Policies[model.RouteKey{Method: "GET", Path: "/reports"}]
+	if !slices.Equal(p.Roles, []string{"admin"}) || len(p.Alternatives) != 1 || p.Alternatives[0].APIKey == nil {
+		t.Errorf("expected root and operation requirements as alternatives, got %+v", p)
+	}
+	// Identical requirements are not repeated.
+	if p := cfg.Policies[model.RouteKey{Method: "GET", Path: "/users"}]; len(p.Alternatives) != 0 {
+		t.Errorf("expected a single requirement for GET /users, got %+v", p)
+	}
+	if p := cfg.Policies[model.RouteKey{Method: "POST", Path: "/login"}]; p.RequireAuth {
+		t.Errorf("expected security: [] to stay public, got %+v", p)
+	}
+
+	if _, err := ParseConfigWithOptions(path, Options{RootSecurity: "union"}); err == nil {
+		t.Errorf("expected error for unknown root security strategy")
+	}
+}
+
+func TestParseConfig_OptionalAuth(t *testing.T) {
+	cfg, err := ParseConfig(filepath.Join("..", "..", "testdata", "optional_auth.yaml"))
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	feed := cfg.Policies[model.RouteKey{Method: "GET", Path: "/feed"}]
+	if feed.Mode() != model.AuthOptional {
+		t.Errorf("expected optional auth for GET /feed, got %+v", feed)
+	}
+	if !slices.Equal(feed.Schemes, []model.SchemeType{model.SchemeBearer}) || len(feed.Alternatives) != 1 || feed.Alternatives[0].APIKey == nil {
+		t.Errorf("expected credentials to check when present, got %+v", feed)
+	}
+
+	if p := cfg.Policies[model.RouteKey{Method: "GET", Path: "/status"}]; p.Mode() != model.AuthPublic {
+		t.Errorf("expected GET /status to be public, got %+v", p)
+	}
+	if p := cfg.Policies[model.RouteKey{Method: "GET", Path: "/profile"}]; p.Mode() != model.AuthRequired {
+		t.Errorf("expected GET /profile to require auth, got %+v", p)
+	}
+}
+
+func TestParseConfig_SecuritySchemeMetadata(t *testing.T) {
+	cfg, err := ParseConfig(filepath.Join("..", "..", "testdata", "oauth2.yaml"))
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	want := model.SecurityScheme{
+		Type: "oauth2",
+		Flows: []model.OAuthFlow{
+			{Type: "clientCredentials", TokenURL: "https://auth.example.com/token", Scopes: []string{"role:admin"},
+				ScopeDescriptions: map[string]string{"role:admin": "Administrative access"}},
+			{Type: "authorizationCode", AuthorizationURL: "https://auth.example.com/authorize", TokenURL: "https://auth.example.com/token", Scopes: []string{"vegetable:read", "vegetable:write"},
+				ScopeDescriptions: map[string]string{"vegetable:read": "Read vegetables", "vegetable:write": "Modify vegetables"}},
+		},
+	}
+	if got := cfg.SecuritySchemes["OAuth"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected scheme metadata:\n got %+v\nwant %+v", got, want)
+	}
+
+	cfg, err = ParseConfig(filepath.Join("..", "..", "testdata", "basic.yaml"))
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+	if got := cfg.SecuritySchemes["BearerAuth"]; got.Type != "http" || got.Scheme != "bearer" || got.BearerFormat != "JWT" {
+		t.Errorf("unexpected bearer scheme metadata %+v", got)
+	}
+}
+
+func TestBundleSpec(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "multifile", "openapi.yaml")
+
+	bundled, err := BundleSpec(path, Options{}, false)
+	if err != nil {
+		t.Fatalf("BundleSpec error: %v", err)
+	}
+	if strings.Contains(string(bundled), "$ref") {
+		t.Errorf("expected every $ref to be expanded, got:\n%s", bundled)
+	}
+
+	// The bundle must derive the same policies as the multi-file spec.
+	want, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+	got, err := ParseConfigFromBytes(bundled, Options{})
+	if err != nil {
+		t.Fatalf("ParseConfigFromBytes error: %v", err)
+	}
+	for key, policy := range want.Policies {
+		if !samePolicy(got.Policies[key], policy) {
+			t.Errorf("%s %s: bundle derives %+v, want %+v", key.Method, key.Path, got.Policies[key], policy)
+		}
+	}
+
+	asJSON, err := BundleSpec(path, Options{}, true)
+	if err != nil {
+		t.Fatalf("BundleSpec JSON error: %v", err)
+	}
+	if _, err := ParseConfigFromBytes(asJSON, Options{}); err != nil {
+		t.Errorf("expected JSON bundle to parse, got %v", err)
+	}
+}
+
+func TestEffectiveSpec(t *testing.T) {
+	tests := []struct {
+		spec string
+		opts Options
+	}{
+		{"x_env.yaml", Options{}},
+		{"x_env.yaml", Options{Profile: "prod"}},
+		{"x_env.yaml", Options{Profile: "dev"}},
+		{"x_public.yaml", Options{}},
+		{"path_item_extensions.yaml", Options{}},
+		{"root_override.yaml", Options{RootSecurity: RootSecurityMerge}},
+		{"callbacks.yaml", Options{}},
+		{"swagger2.yaml", Options{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec+"/"+tt.opts.Profile+tt.opts.RootSecurity, func(t *testing.T) {
+			path := filepath.Join("..", "..", "testdata", tt.spec)
+			out, err := EffectiveSpec(path, tt.opts, false)
+			if err != nil {
+				t.Fatalf("EffectiveSpec error: %v", err)
+			}
+			for _, ext := range []string{"x-env:", "x-public:"} {
+				if strings.Contains(string(out), ext) {
+					t.Errorf("expected %s to be resolved, got:\n%s", ext, out)
+				}
+			}
+
+			// Without the options that resolved it, the spec must derive
+			// the same policies.
+			want, err := ParseConfigWithOptions(path, tt.opts)
+			if err != nil {
+				t.Fatalf("ParseConfig error: %v", err)
+			}
+			got, err := ParseConfigFromBytes(out, Options{})
+			if err != nil {
+				t.Fatalf("ParseConfigFromBytes error: %v\n%s", err, out)
+			}
+			for _, policies := range []struct {
+				got, want map[model.RouteKey]model.AuthPolicy
+			}{
+				{got.Policies, want.Policies}, {got.Webhooks, want.Webhooks}, {got.Callbacks, want.Callbacks},
+			} {
+				if len(policies.got) != len(policies.want) {
+					t.Errorf("got %d policies, want %d", len(policies.got), len(policies.want))
+				}
+				for key, policy := range policies.want {
+					if !samePolicy(policies.got[key], policy) {
+						t.Errorf("%s %s: derives %+v, want %+v", key.Method, key.Path, policies.got[key], policy)
+					}
+				}
+			}
+		})
+	}
+
+	if _, err := EffectiveSpec(filepath.Join("..", "..", "testdata", "basic.yaml"), Options{RootSecurity: "union"}, false); err == nil {
+		t.Errorf("expected unknown root security strategy to fail")
+	}
+}
+
+func TestParseConfig_YAMLAliases(t *testing.T) {
+	cfg, err := ParseConfig(filepath.Join("..", "..", "testdata", "anchors.yaml"))
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+
+	if p := cfg.Policies[model.RouteKey{Method: "GET", Path: "/admin"}]; !slices.Equal(p.Scopes, []string{"admin"}) {
+		t.Errorf("expected aliased security for GET /admin, got %+v", p)
+	}
+	// The merge key copies the anchored operation, x-roles included.
+	p := cfg.Policies[model.RouteKey{Method: "DELETE", Path: "/admin/legacy"}]
+	if !slices.Equal(p.Roles, []string{"owner"}) || !slices.Equal(p.Scopes, []string{"admin"}) || !p.Deprecated {
+		t.Errorf("expected merged policy for DELETE /admin/legacy, got %+v", p)
+	}
+
+	_, err = ParseConfig(filepath.Join("..", "..", "testdata", "recursive_alias.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "line 8, column 15") || !strings.Contains(err.Error(), "*loop") {
+		t.Errorf("expected recursive alias error, got %v", err)
+	}
+}
+
+func TestExpandAliases_Limits(t *testing.T) {
+	// Each level doubles the size of the expanded document.
+	var spec strings.Builder
+	spec.WriteString("openapi: 3.0.3\nx-bomb:\n  l0: &l0 [a, a]\n")
+	for i := 1; i <= 30; i++ {
+		fmt.Fprintf(&spec, "  l%d: &l%d [*l%d, *l%d]\n", i, i, i-1, i-1)
+	}
+	spec.WriteString("paths: {}\n")
+
+	_, err := ParseConfigFromBytes([]byte(spec.String()), Options{})
+	if err == nil || !strings.Contains(err.Error(), "more than") {
+		t.Errorf("expected alias expansion limit error, got %v", err)
+	}
+}
+
+func TestParseConfigWithOptions_PathFilters(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "path_filters.yaml")
+
+	// The internal path uses an undeclared scheme, so it fails unless excluded.
+	if _, err := ParseConfig(path); err == nil {
+		t.Fatalf("expected error for the internal path's undeclared scheme")
+	}
+
+	cfg, err := ParseConfigWithOptions(path, Options{
+		IncludePaths: []string{"/api/v1/**"},
+		ExcludePaths: []string{"/api/*/internal/**"},
+	})
+	if err != nil {
+		t.Fatalf("ParseConfigWithOptions error: %v", err)
+	}
+	var got []string
+	for key := range cfg.Policies {
+		got = append(got, key.Path)
+	}
+	slices.Sort(got)
+	if want := []string{"/api/v1", "/api/v1/users/{id}"}; !slices.Equal(got, want) {
+		t.Errorf("expected paths %v, got %v", want, got)
+	}
+
+	if _, err := ParseConfigWithOptions(path, Options{IncludePaths: []string{"/api/[v"}}); err == nil {
+		t.Errorf("expected error for malformed pattern")
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/api/v1/**", "/api/v1", true},
+		{"/api/v1/**", "/api/v1/users/{id}", true},
+		{"/api/v1/**", "/api/v2/users", false},
+		{"/users/*", "/users/{id}", true},
+		{"/users/*", "/users/{id}/orders", false},
+		{"/**/admin", "/tenants/{id}/admin", true},
+		{"/", "/", true},
+		{"/**", "/", true},
+	}
+	for _, tt := range tests {
+		if got := matchPath(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchPath(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseConfigWithOptions_Profile(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "x_env.yaml")
+	debug := model.RouteKey{Method: "GET", Path: "/debug/pprof"}
+	users := model.RouteKey{Method: "GET", Path: "/users"}
+
+	cfg, err := ParseConfig(path)
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+	if p := cfg.Policies[debug]; p.RequireAuth || !p.PublicOverride {
+		t.Errorf("expected public /debug/pprof without a profile, got %+v", p)
+	}
+	if p := cfg.Policies[users]; !p.RequireAuth {
+		t.Errorf("expected protected /users without a profile, got %+v", p)
+	}
+
+	// The path item's prod override applies to its operations.
+	cfg, err = ParseConfigWithOptions(path, Options{Profile: "prod"})
+	if err != nil {
+		t.Fatalf("ParseConfigWithOptions error: %v", err)
+	}
+	if p := cfg.Policies[debug]; !p.RequireAuth || !slices.Equal(p.Roles, []string{"sre"}) {
+		t.Errorf("expected /debug/pprof to require sre in prod, got %+v", p)
+	}
+
+	cfg, err = ParseConfigWithOptions(path, Options{Profile: "dev"})
+	if err != nil {
+		t.Fatalf("ParseConfigWithOptions error: %v", err)
+	}
+	if p := cfg.Policies[users]; p.RequireAuth || !p.PublicOverride {
+		t.Errorf("expected public /users in dev, got %+v", p)
+	}
+}
+
+func TestParseConfig_MultiDocumentStream(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "stream.yaml")
+
+	// The second document uses an undeclared scheme, and the error says so.
+	_, err := ParseConfig(path)
+	if err == nil || !strings.HasPrefix(err.Error(), "document 2: line 29, column 7:") {
+		t.Fatalf("expected error attributed to document 2, got %v", err)
+	}
+
+	cfg, err := ParseConfigWithOptions(path, Options{Mode: ModeLenient})
+	if err != nil {
+		t.Fatalf("ParseConfigWithOptions error: %v", err)
+	}
+	for _, key := range []model.RouteKey{
+		{Method: "GET", Path: "/users"},
+		{Method: "POST", Path: "/orders"},
+		{Method: "GET", Path: "/orders/{id}"},
+	} {
+		if p, ok := cfg.Policies[key]; !ok || !p.RequireAuth {
+			t.Errorf("expected protected %s %s from the stream, got %+v", key.Method, key.Path, p)
+		}
+	}
+	if len(cfg.Warnings) == 0 || cfg.Warnings[0].Spec != path || cfg.Warnings[0].Line != 29 {
+		t.Errorf("expected warnings positioned in the stream, got %v", cfg.Warnings)
+	}
+
+	bundled, err := BundleSpec(path, Options{}, false)
+	if err != nil {
+		t.Fatalf("BundleSpec error: %v", err)
+	}
+	if !strings.Contains(string(bundled), "\n---\n") {
+		t.Errorf("expected both documents in the bundle, got:\n%s", bundled)
+	}
+	if _, err := BundleSpec(path, Options{}, true); err == nil {
+		t.Errorf("expected JSON bundle of a stream to fail")
+	}
+}
+
+func TestParseConfig_GRPCMethod(t *testing.T) {
+	cfg, err := ParseConfig(filepath.Join("..", "..", "testdata", "grpc.yaml"))
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+	if p := cfg.Policies[model.RouteKey{Method: "GET", Path: "/v1/users/{id}"}]; p.GRPCMethod != "/users.v1.UserService/GetUser" {
+		t.Errorf("expected x-grpc-method on GET /v1/users/{id}, got %+v", p)
+	}
+
+	for _, name := range []string{"users.v1.UserService/GetUser", "/GetUser", "/users.v1.UserService/"} {
+		if err := checkGRPCMethod(name); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+}
+
+func TestParseConfig_GraphQLField(t *testing.T) {
+	cfg, err := ParseConfig(filepath.Join("..", "..", "testdata", "graphql.yaml"))
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+	if p := cfg.Policies[model.RouteKey{Method: "DELETE", Path: "/users/{id}"}]; p.GraphQLField != "Mutation.deleteUser" {
+		t.Errorf("expected x-graphql-field on DELETE /users/{id}, got %+v", p)
+	}
+
+	for _, name := range []string{"user", "Query.", ".user", "Query.user.name", "Query.1user"} {
+		if err := checkGraphQLField(name); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package parser
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// position is the location of a node in the spec, as reported by yaml.v3.
+// Nodes expanded from a `$ref` keep the position they have in the referenced
+// document.
+type position struct {
+	Line   int
+	Column int
+}
+
+func (p position) String() string {
+	return fmt.Sprintf("line %d, column %d", p.Line, p.Column)
+}
+
+// at prefixes err with p, if known.
+func (p position) at(err error) error {
+	if p.Line == 0 {
+		return err
+	}
+	return fmt.Errorf("%s: %w", p, err)
+}
+
+// UnmarshalYAML decodes a path item and records where it was declared.
+func (p *pathItem) UnmarshalYAML(n *yaml.Node) error {
+	type plain pathItem
+	if err := n.Decode((*plain)(p)); err != nil {
+		return err
+	}
+	p.pos = position{Line: n.Line, Column: n.Column}
+	return nil
+}
+
+// UnmarshalYAML decodes an operation and records where it was declared.
+func (o *operation) UnmarshalYAML(n *yaml.Node) error {
+	type plain operation
+	if err := n.Decode((*plain)(o)); err != nil {
+		return err
+	}
+	o.pos = position{Line: n.Line, Column: n.Column}
+	return nil
+}
@@ -0,0 +1,311 @@
+package parser
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// skipRefKeys lists mapping keys whose values never influence authorization.
+// Schemas in particular are frequently recursive, so we leave any $ref inside
+// them untouched rather than expanding them.
+var skipRefKeys = map[string]bool{
+	"schema":   true,
+	"schemas":  true,
+	"content":  true,
+	"example":  true,
+	"examples": true,
+}
+
+// refResolver replaces `$ref` mapping nodes with the node they point to so
+// that the resolved tree can be decoded as if it had been written inline.
+// References may point into the same document ("#/components/...") or into
+// other files relative to the referencing document ("paths/user.yaml#/get").
+type refResolver struct {
+	// docs caches every loaded document by its absolute location.
+	docs map[string]*yaml.Node
+
+	// resolving tracks references currently being expanded, to detect cycles.
+	resolving map[string]bool
+
+	// remote fetches http(s) references; nil when they are disabled.
+	remote *remoteFetcher
+
+	// full also expands references below skipRefKeys, for bundling. A
+	// reference that would recurse into itself is left in place instead of
+	// being reported as a cycle.
+	full bool
+}
+
+// resolveRefs expands every `$ref` reachable from doc, which must be the node
+// produced by unmarshalling a whole document. location is the path doc was
+// read from and is used to resolve relative file references; when empty,
+// they are resolved against the working directory.
+func resolveRefs(doc *yaml.Node, location string, opts Options) error {
+	return walkRefs(doc, location, opts, false)
+}
+
+// resolveAllRefs is like resolveRefs but also expands references inside
+// schemas and examples, except recursive ones, so the result can stand on
+// its own as a bundled spec.
+func resolveAllRefs(doc *yaml.Node, location string, opts Options) error {
+	return walkRefs(doc, location, opts, true)
+}
+
+func walkRefs(doc *yaml.Node, location string, opts Options, full bool) error {
+	if location != "" && !isRemote(location) {
+		abs, err := filepath.Abs(location)
+		if err != nil {
+			return fmt.Errorf("resolve spec location: %w", err)
+		}
+		location = abs
+	}
+
+	r := &refResolver{
+		docs:      map[string]*yaml.Node{location: doc},
+		resolving: make(map[string]bool),
+		full:      full,
+	}
+	// A spec loaded from a URL needs its relative references fetched too,
+	// but without the opt-in only those on its own origin.
+	if opts.AllowRemoteRefs {
+		r.remote = newRemoteFetcher(opts)
+	} else if isRemote(location) {
+		r.remote = newRemoteFetcher(opts)
+		r.remote.origin = urlOrigin(location)
+	}
+	return r.walk(doc, location)
+}
+
+// walk resolves references below n. base is the location of the document n
+// belongs to.
+func (r *refResolver) walk(n *yaml.Node, base string) error {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, c := range n.Content {
+			if err := r.walk(c, base); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		if ref, ok := refValue(n); ok {
+			return r.expand(n, ref, base)
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if skipRefKeys[n.Content[i].Value] && !r.full {
+				continue
+			}
+			if err := r.walk(n.Content[i+1], base); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expand resolves ref, recursively resolves the target, and replaces n with
+// the result. Any keys declared next to `$ref` take precedence over the
+// target's keys, matching the OpenAPI 3.1 semantics for summary/description.
+func (r *refResolver) expand(n *yaml.Node, ref, base string) error {
+	location, fragment := splitRef(ref)
+	if location == "" {
+		location = base
+	} else {
+		location = resolveLocation(base, location)
+	}
+
+	key := location + "#" + fragment
+	if r.resolving[key] {
+		if r.full {
+			return nil
+		}
+		return fmt.Errorf("circular $ref %q", ref)
+	}
+	r.resolving[key] = true
+	defer delete(r.resolving, key)
+
+	doc, err := r.load(location)
+	if err != nil {
+		return fmt.Errorf("resolve $ref %q: %w", ref, err)
+	}
+	target, err := resolvePointer(doc, fragment)
+	if err != nil {
+		return fmt.Errorf("resolve $ref %q: %w", ref, err)
+	}
+	if err := r.walk(target, location); err != nil {
+		return err
+	}
+
+	siblings := siblingPairs(n)
+	for i := 1; i < len(siblings); i += 2 {
+		if err := r.walk(siblings[i], base); err != nil {
+			return err
+		}
+	}
+
+	*n = *target
+	if len(siblings) > 0 && target.Kind == yaml.MappingNode {
+		n.Content = mergePairs(target.Content, siblings)
+	}
+	return nil
+}
+
+// load returns the document stored at location, reading and caching it on
+// first use.
+func (r *refResolver) load(location string) (*yaml.Node, error) {
+	if doc, ok := r.docs[location]; ok {
+		return doc, nil
+	}
+
+	var data []byte
+	var err error
+	if isRemote(location) {
+		if r.remote == nil {
+			return nil, fmt.Errorf("remote references are disabled")
+		}
+		data, err = r.remote.fetch(location)
+	} else {
+		data, err = os.ReadFile(location)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %w", location, err)
+	}
+	if err := expandAliases(&doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", location, err)
+	}
+	r.docs[location] = &doc
+	return &doc, nil
+}
+
+// splitRef splits a reference into its document location and JSON pointer
+// fragment. Local references have an empty location.
+func splitRef(ref string) (location, fragment string) {
+	location, fragment, _ = strings.Cut(ref, "#")
+	return location, fragment
+}
+
+// resolveLocation resolves a relative reference against the location of the
+// referencing document, which may itself be a file path or a URL.
+func resolveLocation(base, location string) string {
+	if isRemote(location) {
+		return location
+	}
+	if isRemote(base) {
+		baseURL, err := url.Parse(base)
+		if err != nil {
+			return location
+		}
+		ref, err := url.Parse(location)
+		if err != nil {
+			return location
+		}
+		return baseURL.ResolveReference(ref).String()
+	}
+	if filepath.IsAbs(location) {
+		return filepath.Clean(location)
+	}
+	dir := "."
+	if base != "" {
+		dir = filepath.Dir(base)
+	}
+	abs, err := filepath.Abs(filepath.Join(dir, filepath.FromSlash(location)))
+	if err != nil {
+		return filepath.Join(dir, location)
+	}
+	return abs
+}
+
+// resolvePointer walks a JSON pointer (RFC 6901) starting at doc.
+func resolvePointer(doc *yaml.Node, pointer string) (*yaml.Node, error) {
+	n := doc
+	if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	if pointer == "" {
+		return n, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+
+	for _, token := range strings.Split(pointer[1:], "/") {
+		if unescaped, err := url.PathUnescape(token); err == nil {
+			token = unescaped
+		}
+		token = strings.ReplaceAll(token, "~1", "/")
+		token = strings.ReplaceAll(token, "~0", "~")
+
+		if n.Kind == yaml.AliasNode {
+			n = n.Alias
+		}
+
+		switch n.Kind {
+		case yaml.MappingNode:
+			next := mappingValue(n, token)
+			if next == nil {
+				return nil, fmt.Errorf("%q not found", token)
+			}
+			n = next
+		case yaml.SequenceNode:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(n.Content) {
+				return nil, fmt.Errorf("invalid index %q", token)
+			}
+			n = n.Content[i]
+		default:
+			return nil, fmt.Errorf("cannot descend into scalar at %q", token)
+		}
+	}
+	return n, nil
+}
+
+// refValue reports the `$ref` string of a mapping node, if any.
+func refValue(n *yaml.Node) (string, bool) {
+	v := mappingValue(n, "$ref")
+	if v == nil || v.Kind != yaml.ScalarNode {
+		return "", false
+	}
+	return v.Value, true
+}
+
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// siblingPairs returns the key/value pairs of n other than `$ref`.
+func siblingPairs(n *yaml.Node) []*yaml.Node {
+	var pairs []*yaml.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value != "$ref" {
+			pairs = append(pairs, n.Content[i], n.Content[i+1])
+		}
+	}
+	return pairs
+}
+
+// mergePairs returns base with override's pairs applied on top of it. Neither
+// input is modified.
+func mergePairs(base, override []*yaml.Node) []*yaml.Node {
+	merged := make([]*yaml.Node, 0, len(base)+len(override))
+	for i := 0; i+1 < len(base); i += 2 {
+		if mappingValue(&yaml.Node{Content: override}, base[i].Value) == nil {
+			merged = append(merged, base[i], base[i+1])
+		}
+	}
+	return append(merged, override...)
+}
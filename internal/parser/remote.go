@@ -0,0 +1,205 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const defaultRemoteTimeout = 30 * time.Second
+
+// maxRemoteSize caps the size of a downloaded spec or referenced document.
+var maxRemoteSize int64 = 32 << 20
+
+// remoteFetcher downloads remote `$ref` targets, optionally backed by an
+// on-disk cache.
+type remoteFetcher struct {
+	client   *http.Client
+	cacheDir string
+	cacheTTL time.Duration
+
+	// origin, when set, is the scheme and host every fetched URL, and every
+	// redirect, must have.
+	origin string
+}
+
+func newRemoteFetcher(opts Options) *remoteFetcher {
+	timeout := opts.RemoteTimeout
+	if timeout <= 0 {
+		timeout = defaultRemoteTimeout
+	}
+	f := &remoteFetcher{
+		client:   &http.Client{Timeout: timeout},
+		cacheDir: opts.RemoteCacheDir,
+		cacheTTL: opts.RemoteCacheTTL,
+	}
+	f.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return f.checkOrigin(req.URL.String())
+	}
+	return f
+}
+
+// checkOrigin fails unless rawURL has the fetcher's origin, if it has one.
+func (f *remoteFetcher) checkOrigin(rawURL string) error {
+	if f.origin != "" && urlOrigin(rawURL) != f.origin {
+		return fmt.Errorf("%s is not on %s; use -allow-remote-refs to follow references to other hosts", rawURL, f.origin)
+	}
+	return nil
+}
+
+// urlOrigin returns the lower-cased scheme and host of rawURL, or "" when
+// it does not parse.
+func urlOrigin(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
+
+// readBody reads the body served at rawURL, failing once it exceeds
+// maxRemoteSize.
+func readBody(rawURL string, body io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(body, maxRemoteSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", rawURL, err)
+	}
+	if int64(len(data)) > maxRemoteSize {
+		return nil, fmt.Errorf("fetch %s: response exceeds %d bytes", rawURL, maxRemoteSize)
+	}
+	return data, nil
+}
+
+// fetch returns the body served at rawURL, consulting the cache first.
+func (f *remoteFetcher) fetch(rawURL string) ([]byte, error) {
+	if err := f.checkOrigin(rawURL); err != nil {
+		return nil, err
+	}
+	cachePath := f.cachePath(rawURL)
+	if cachePath != "" {
+		if data, ok := f.readCache(cachePath); ok {
+			return data, nil
+		}
+	}
+
+	resp, err := f.client.Get(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: unexpected status %s", rawURL, resp.Status)
+	}
+	data, err := readBody(rawURL, resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if cachePath != "" {
+		if err := os.MkdirAll(f.cacheDir, 0o755); err != nil {
+			return nil, fmt.Errorf("create remote cache: %w", err)
+		}
+		if err := os.WriteFile(cachePath, data, 0o644); err != nil {
+			return nil, fmt.Errorf("write remote cache: %w", err)
+		}
+	}
+	return data, nil
+}
+
+func (f *remoteFetcher) cachePath(rawURL string) string {
+	if f.cacheDir == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(f.cacheDir, hex.EncodeToString(sum[:]))
+}
+
+func (f *remoteFetcher) readCache(path string) ([]byte, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+	if f.cacheTTL > 0 && time.Since(info.ModTime()) > f.cacheTTL {
+		return nil, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// fetchSpec downloads the spec served at rawURL. authHeader is sent with the
+// request, and when a cache directory is configured the previous response's
+// ETag is used to avoid downloading an unchanged spec again.
+func (f *remoteFetcher) fetchSpec(rawURL, authHeader string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", rawURL, err)
+	}
+	if authHeader != "" {
+		name, value, ok := strings.Cut(authHeader, ":")
+		if !ok {
+			name, value = "Authorization", authHeader
+		}
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	cachePath := f.cachePath(rawURL)
+	var cached []byte
+	if cachePath != "" {
+		if etag, err := os.ReadFile(cachePath + ".etag"); err == nil {
+			if data, err := os.ReadFile(cachePath); err == nil {
+				cached = data
+				req.Header.Set("If-None-Match", string(etag))
+			}
+		}
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return cached, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: unexpected status %s", rawURL, resp.Status)
+	}
+	data, err := readBody(rawURL, resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if etag := resp.Header.Get("ETag"); cachePath != "" && etag != "" {
+		if err := os.MkdirAll(f.cacheDir, 0o755); err != nil {
+			return nil, fmt.Errorf("create remote cache: %w", err)
+		}
+		if err := os.WriteFile(cachePath, data, 0o644); err != nil {
+			return nil, fmt.Errorf("write remote cache: %w", err)
+		}
+		if err := os.WriteFile(cachePath+".etag", []byte(etag), 0o644); err != nil {
+			return nil, fmt.Errorf("write remote cache: %w", err)
+		}
+	}
+	return data, nil
+}
+
+// isRemote reports whether location is an http(s) URL.
+func isRemote(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
@@ -0,0 +1,353 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// defaultBearerSchemes are the security scheme names treated as bearer-token
+// auth when Options.BearerSchemes is empty.
+var defaultBearerSchemes = []string{"BearerAuth"}
+
+// schemeNames returns the schemes referenced by a requirement in a stable
+// order, so that the derived policy does not depend on map iteration.
+func (r securityRequirement) schemeNames() []string {
+	names := make([]string, 0, len(r))
+	for name := range r {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// requirementPolicy combines every scheme of a security requirement object
+// into a single policy, since all of them must be satisfied together. ok is
+// false when the requirement is empty or uses a scheme we cannot enforce:
+// dropping just that scheme would silently weaken the requirement.
+func requirementPolicy(root *openapiRoot, req securityRequirement, opts Options) (policy model.AuthPolicy, ok bool, err error) {
+	if len(req) == 0 {
+		return model.AuthPolicy{}, false, nil
+	}
+
+	for _, name := range req.schemeNames() {
+		scheme, ok, err := schemePolicy(root, name, req[name], opts)
+		if err != nil {
+			return model.AuthPolicy{}, false, fmt.Errorf("security scheme %s: %w", name, err)
+		}
+		if !ok {
+			return model.AuthPolicy{}, false, nil
+		}
+		if err := combinePolicy(&policy, scheme); err != nil {
+			return model.AuthPolicy{}, false, fmt.Errorf("security scheme %s: %w", name, err)
+		}
+	}
+	return policy, true, nil
+}
+
+// undeclaredSchemes returns the names referenced by sec that are neither
+// declared under components.securitySchemes nor listed in bearerNames.
+func undeclaredSchemes(root *openapiRoot, sec []securityRequirement, bearerNames []string) []string {
+	var undeclared []string
+	for _, req := range sec {
+		for _, name := range req.schemeNames() {
+			if root.Components.SecuritySchemes[name] == nil && !slices.Contains(bearerNames, name) {
+				undeclared = appendUnique(undeclared, name)
+			}
+		}
+	}
+	return undeclared
+}
+
+// skipReason explains why requirementPolicy could not enforce req, naming
+// the first scheme that is undeclared or of an unsupported type.
+func skipReason(root *openapiRoot, req securityRequirement, opts Options) string {
+	for _, name := range req.schemeNames() {
+		def := root.Components.SecuritySchemes[name]
+		if def == nil && !slices.Contains(opts.bearerSchemes(), name) {
+			return fmt.Sprintf("undeclared security scheme %q", name)
+		}
+		if _, ok, _ := schemePolicy(root, name, req[name], opts); !ok {
+			if def.Type == "http" {
+				return fmt.Sprintf("security scheme %q uses unsupported http scheme %q", name, def.Scheme)
+			}
+			return fmt.Sprintf("security scheme %q has unsupported type %q", name, def.Type)
+		}
+	}
+	return "empty security requirement"
+}
+
+// effectiveSecurity returns the security requirements that apply to op. Its
+// own security replaces the root security, or with RootSecurityMerge is
+// added to it as further alternatives. Either way an explicit `security: []`
+// makes the operation public.
+func effectiveSecurity(root *openapiRoot, op *operation, opts Options) []securityRequirement {
+	switch {
+	case op.Security == nil:
+		return root.Security
+	case len(op.Security) == 0 || opts.RootSecurity != RootSecurityMerge:
+		return op.Security
+	}
+
+	sec := append([]securityRequirement(nil), root.Security...)
+	for _, req := range op.Security {
+		if !slices.ContainsFunc(sec, func(r securityRequirement) bool { return reflect.DeepEqual(r, req) }) {
+			sec = append(sec, req)
+		}
+	}
+	return sec
+}
+
+// overrideDiagnostic describes how op's own security contradicts the root
+// security it replaces, so the override is reported rather than applied
+// silently. Refining the root security, such as by adding a scope, is the
+// usual reason for an override and is not reported, and neither is an
+// explicit `security: []`, a deliberate way of making an operation public.
+// A contradiction is an override that loosens the root security: making
+// authentication optional, or letting callers in with a requirement set
+// that does not refine any of the root's.
+func overrideDiagnostic(root *openapiRoot, op *operation, policy model.AuthPolicy, opts Options) string {
+	if len(op.Security) == 0 || len(root.Security) == 0 || opts.RootSecurity == RootSecurityMerge {
+		return ""
+	}
+	rootPolicy, _, err := derivePolicy(root, &operation{}, opts)
+	if err != nil || !loosens(policy, rootPolicy) {
+		return ""
+	}
+	return fmt.Sprintf("operation security (%s) overrides root security (%s)", describePolicy(policy), describePolicy(rootPolicy))
+}
+
+// loosens reports whether a caller could satisfy policy without satisfying
+// rootPolicy: policy makes authentication optional where rootPolicy
+// requires it, or one of its requirement sets refines none of rootPolicy's.
+func loosens(policy, rootPolicy model.AuthPolicy) bool {
+	if rootPolicy.RequireAuth && !policy.RequireAuth {
+		return true
+	}
+	rootReqs := append([]model.AuthPolicy{rootPolicy}, rootPolicy.Alternatives...)
+	for _, req := range append([]model.AuthPolicy{policy}, policy.Alternatives...) {
+		if !slices.ContainsFunc(rootReqs, func(rootReq model.AuthPolicy) bool { return refines(req, rootReq) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// refines reports whether the requirement set req asks for at least what
+// rootReq does: every scheme and scope of rootReq, and only roles among
+// rootReq's, which are alternatives.
+func refines(req, rootReq model.AuthPolicy) bool {
+	for _, scheme := range rootReq.Schemes {
+		if !slices.Contains(req.Schemes, scheme) {
+			return false
+		}
+	}
+	for _, scope := range rootReq.Scopes {
+		if !slices.Contains(req.Scopes, scope) {
+			return false
+		}
+	}
+	if len(rootReq.Roles) == 0 {
+		return true
+	}
+	if len(req.Roles) == 0 {
+		return false
+	}
+	for _, role := range req.Roles {
+		if !slices.Contains(rootReq.Roles, role) {
+			return false
+		}
+	}
+	return true
+}
+
+// combinePolicy adds the requirements of scheme to policy. A policy's roles
+// are alternatives, so the roles of schemes that must all be satisfied
+// cannot be combined: {a: [role:admin], b: [role:auditor]} would become
+// admin or auditor.
+func combinePolicy(policy *model.AuthPolicy, scheme model.AuthPolicy) error {
+	if len(policy.Roles) > 0 && len(scheme.Roles) > 0 {
+		return fmt.Errorf("a requirement may only combine a single scheme naming roles")
+	}
+	policy.RequireAuth = policy.RequireAuth || scheme.RequireAuth
+	policy.Roles = appendUnique(policy.Roles, scheme.Roles...)
+	policy.Scopes = appendUnique(policy.Scopes, scheme.Scopes...)
+	policy.Schemes = append(policy.Schemes, scheme.Schemes...)
+	policy.MutualTLS = policy.MutualTLS || scheme.MutualTLS
+	policy.SessionCookie = policy.SessionCookie || scheme.SessionCookie
+
+	if scheme.APIKey != nil {
+		if policy.APIKey != nil {
+			return fmt.Errorf("a requirement may only combine a single apiKey scheme")
+		}
+		policy.APIKey = scheme.APIKey
+	}
+	if scheme.OpenIDConnectURL != "" {
+		if policy.OpenIDConnectURL != "" && policy.OpenIDConnectURL != scheme.OpenIDConnectURL {
+			return fmt.Errorf("a requirement may only combine a single openIdConnect provider")
+		}
+		policy.OpenIDConnectURL = scheme.OpenIDConnectURL
+	}
+	return nil
+}
+
+func appendUnique(dst []string, items ...string) []string {
+	for _, item := range items {
+		if !slices.Contains(dst, item) {
+			dst = append(dst, item)
+		}
+	}
+	return dst
+}
+
+// schemePolicy builds the policy implied by a single scheme of a security
+// requirement. ok is false when the scheme is not one we know how to enforce.
+// Schemes named in opts.BearerSchemes are treated as bearer-token auth
+// whatever type they are declared with.
+func schemePolicy(root *openapiRoot, name string, scopes []string, opts Options) (policy model.AuthPolicy, ok bool, err error) {
+	def := root.Components.SecuritySchemes[name]
+
+	switch {
+	case slices.Contains(opts.bearerSchemes(), name), def != nil && def.isHTTP("bearer"):
+		policy = model.AuthPolicy{Schemes: []model.SchemeType{model.SchemeBearer}}
+	case def != nil && def.isHTTP("basic"):
+		policy = model.AuthPolicy{Schemes: []model.SchemeType{model.SchemeBasic}}
+	case def != nil && def.Type == "apiKey":
+		switch def.In {
+		case "header", "query", "cookie":
+		default:
+			return model.AuthPolicy{}, false, fmt.Errorf("apiKey scheme must be in header, query or cookie, got %q", def.In)
+		}
+		if def.Name == "" {
+			return model.AuthPolicy{}, false, fmt.Errorf("apiKey scheme is missing a parameter name")
+		}
+		policy = model.AuthPolicy{
+			Schemes:       []model.SchemeType{model.SchemeAPIKey},
+			APIKey:        &model.APIKey{Name: def.Name, In: def.In},
+			SessionCookie: def.In == "cookie",
+		}
+	case def != nil && def.Type == "oauth2":
+		declared := def.Flows.declaredScopes()
+		for _, scope := range scopes {
+			if !declared[scope] {
+				return model.AuthPolicy{}, false, fmt.Errorf("scope %q is not declared by any oauth2 flow", scope)
+			}
+		}
+		policy = model.AuthPolicy{Schemes: []model.SchemeType{model.SchemeOAuth2}}
+	case def != nil && def.Type == "openIdConnect":
+		if def.OpenIDConnectURL == "" {
+			return model.AuthPolicy{}, false, fmt.Errorf("openIdConnect scheme is missing openIdConnectUrl")
+		}
+		policy = model.AuthPolicy{
+			Schemes:          []model.SchemeType{model.SchemeOpenIDConnect},
+			OpenIDConnectURL: def.OpenIDConnectURL,
+		}
+	case def != nil && def.Type == "mutualTLS":
+		policy = model.AuthPolicy{
+			Schemes:   []model.SchemeType{model.SchemeMutualTLS},
+			MutualTLS: true,
+		}
+	default:
+		return model.AuthPolicy{}, false, nil
+	}
+
+	policy.RequireAuth = true
+	splitRolesAndScopes(&policy, opts.ClaimsMapping.claims(name, scopes))
+	return policy, true, nil
+}
+
+// schemeMetadata converts declared security schemes into their model form.
+func schemeMetadata(schemes map[string]*securityScheme) map[string]model.SecurityScheme {
+	meta := make(map[string]model.SecurityScheme, len(schemes))
+	for name, def := range schemes {
+		if def == nil {
+			continue
+		}
+		meta[name] = model.SecurityScheme{
+			Type:             def.Type,
+			Description:      def.Description,
+			Scheme:           def.Scheme,
+			BearerFormat:     def.BearerFormat,
+			Name:             def.Name,
+			In:               def.In,
+			Flows:            def.Flows.metadata(),
+			OpenIDConnectURL: def.OpenIDConnectURL,
+		}
+	}
+	return meta
+}
+
+// metadata returns the declared flows in a fixed order.
+func (f oauthFlows) metadata() []model.OAuthFlow {
+	var flows []model.OAuthFlow
+	for _, named := range []struct {
+		name string
+		flow *oauthFlow
+	}{
+		{"implicit", f.Implicit},
+		{"password", f.Password},
+		{"clientCredentials", f.ClientCredentials},
+		{"authorizationCode", f.AuthorizationCode},
+	} {
+		if named.flow == nil {
+			continue
+		}
+		scopes := make([]string, 0, len(named.flow.Scopes))
+		var descriptions map[string]string
+		for scope, description := range named.flow.Scopes {
+			scopes = append(scopes, scope)
+			if description != "" {
+				if descriptions == nil {
+					descriptions = make(map[string]string)
+				}
+				descriptions[scope] = description
+			}
+		}
+		sort.Strings(scopes)
+		flows = append(flows, model.OAuthFlow{
+			Type:              named.name,
+			AuthorizationURL:  named.flow.AuthorizationURL,
+			TokenURL:          named.flow.TokenURL,
+			RefreshURL:        named.flow.RefreshURL,
+			Scopes:            scopes,
+			ScopeDescriptions: descriptions,
+		})
+	}
+	return flows
+}
+
+// isHTTP reports whether s is an `http` scheme using the given
+// authentication scheme. HTTP auth scheme names are case-insensitive.
+func (s *securityScheme) isHTTP(scheme string) bool {
+	return s.Type == "http" && strings.EqualFold(s.Scheme, scheme)
+}
+
+// splitRolesAndScopes applies the naming convention for requirement entries:
+// strings starting with "role:" are roles; others are scopes.
+func splitRolesAndScopes(policy *model.AuthPolicy, scopes []string) {
+	for _, s := range scopes {
+		if role, ok := strings.CutPrefix(s, "role:"); ok && role != "" {
+			policy.Roles = append(policy.Roles, role)
+		} else {
+			policy.Scopes = append(policy.Scopes, s)
+		}
+	}
+}
+
+// declaredScopes returns the union of the scopes declared by every flow.
+func (f oauthFlows) declaredScopes() map[string]bool {
+	declared := make(map[string]bool)
+	for _, flow := range []*oauthFlow{f.Implicit, f.Password, f.ClientCredentials, f.AuthorizationCode} {
+		if flow == nil {
+			continue
+		}
+		for scope := range flow.Scopes {
+			declared[scope] = true
+		}
+	}
+	return declared
+}
@@ -0,0 +1,51 @@
+package parser
+
+import (
+	"net/url"
+	"strings"
+)
+
+type server struct {
+	URL       string                    `yaml:"url"`
+	Variables map[string]serverVariable `yaml:"variables"`
+}
+
+type serverVariable struct {
+	Default string `yaml:"default"`
+}
+
+// basePath returns the path component of the server URL with variables
+// replaced by their defaults, without a trailing slash. A server at the root
+// yields "".
+func (s server) basePath() string {
+	raw := s.URL
+	for name, v := range s.Variables {
+		raw = strings.ReplaceAll(raw, "{"+name+"}", v.Default)
+	}
+
+	path := raw
+	if u, err := url.Parse(raw); err == nil {
+		path = u.Path
+	}
+	return strings.TrimRight(path, "/")
+}
+
+// basePaths returns the distinct base paths declared by servers, in
+// declaration order. With no servers it returns a single empty base path, so
+// that callers can always iterate the result.
+func basePaths(servers []server) []string {
+	if len(servers) == 0 {
+		return []string{""}
+	}
+
+	var paths []string
+	seen := make(map[string]bool)
+	for _, s := range servers {
+		p := s.basePath()
+		if !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
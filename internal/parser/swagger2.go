@@ -0,0 +1,83 @@
+package parser
+
+// swagger2Root is a minimal representation of a Swagger 2.0 document. Only
+// the sections that influence authorization are modelled; they are mapped
+// onto openapiRoot by convertSwagger2.
+type swagger2Root struct {
+	Swagger             string                     `yaml:"swagger"`
+	BasePath            string                     `yaml:"basePath"`
+	Security            []securityRequirement      `yaml:"security"`
+	SecurityDefinitions map[string]*swagger2Scheme `yaml:"securityDefinitions"`
+	Paths               map[string]*pathItem       `yaml:"paths"`
+}
+
+// swagger2Scheme is a Swagger 2.0 securityDefinitions entry. OAuth2 schemes
+// declare a single flow inline rather than under a `flows` object.
+type swagger2Scheme struct {
+	Type             string            `yaml:"type"`
+	Description      string            `yaml:"description"`
+	Name             string            `yaml:"name"`
+	In               string            `yaml:"in"`
+	Flow             string            `yaml:"flow"`
+	AuthorizationURL string            `yaml:"authorizationUrl"`
+	TokenURL         string            `yaml:"tokenUrl"`
+	Scopes           map[string]string `yaml:"scopes"`
+}
+
+// convertSwagger2 maps a Swagger 2.0 document onto the OpenAPI 3.0 shape used
+// by the rest of the parser. Path items and security requirements have the
+// same structure in both versions and are carried over unchanged.
+func convertSwagger2(doc *swagger2Root) *openapiRoot {
+	root := &openapiRoot{
+		OpenAPI:  "3.0.0",
+		Security: doc.Security,
+		Paths:    doc.Paths,
+	}
+
+	if doc.BasePath != "" && doc.BasePath != "/" {
+		root.Servers = []server{{URL: doc.BasePath}}
+	}
+
+	if len(doc.SecurityDefinitions) > 0 {
+		root.Components.SecuritySchemes = make(map[string]*securityScheme, len(doc.SecurityDefinitions))
+	}
+	for name, def := range doc.SecurityDefinitions {
+		if def == nil {
+			continue
+		}
+		scheme := convertSwagger2Scheme(def)
+		scheme.Description = def.Description
+		root.Components.SecuritySchemes[name] = scheme
+	}
+
+	return root
+}
+
+func convertSwagger2Scheme(def *swagger2Scheme) *securityScheme {
+	switch def.Type {
+	case "basic":
+		return &securityScheme{Type: "http", Scheme: "basic"}
+	case "apiKey":
+		return &securityScheme{Type: "apiKey", Name: def.Name, In: def.In}
+	case "oauth2":
+		flow := &oauthFlow{
+			AuthorizationURL: def.AuthorizationURL,
+			TokenURL:         def.TokenURL,
+			Scopes:           def.Scopes,
+		}
+		scheme := &securityScheme{Type: "oauth2"}
+		switch def.Flow {
+		case "implicit":
+			scheme.Flows.Implicit = flow
+		case "password":
+			scheme.Flows.Password = flow
+		case "application":
+			scheme.Flows.ClientCredentials = flow
+		case "accessCode":
+			scheme.Flows.AuthorizationCode = flow
+		}
+		return scheme
+	default:
+		return &securityScheme{Type: def.Type}
+	}
+}
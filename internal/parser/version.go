@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// checkOpenAPIVersion reports a root `openapi` field declaring a version
+// other than 3.0.x or 3.1.x, so that fields we do not understand are never
+// silently dropped. Both are parsed alike, webhooks and components.pathItems
+// included. Documents without a version are accepted here and diagnosed by
+// missingVersion. Errors say how to fix the document.
+func checkOpenAPIVersion(raw string) error {
+	raw = strings.TrimSpace(raw)
+	switch {
+	case raw == "":
+		return nil
+	case raw == "3.0" || strings.HasPrefix(raw, "3.0."):
+		return nil
+	case raw == "3.1" || strings.HasPrefix(raw, "3.1."):
+		return nil
+	case raw == "2" || strings.HasPrefix(raw, "2."):
+		return fmt.Errorf("unsupported OpenAPI version %q: Swagger 2.0 documents declare `swagger: \"2.0\"` instead of `openapi`", raw)
+	default:
+		return fmt.Errorf("unsupported OpenAPI version %q: supported versions are 3.0.x and 3.1.x, and Swagger 2.0 declared as `swagger: \"2.0\"`", raw)
+	}
+}
+
+// checkSwaggerVersion reports a `swagger` field other than "2.0".
+func checkSwaggerVersion(raw string) error {
+	if raw == "2.0" {
+		return nil
+	}
+	return fmt.Errorf("unsupported Swagger version %q: only \"2.0\" is supported; OpenAPI 3 documents declare `openapi: 3.0.3` or `openapi: 3.1.0` instead", raw)
+}
+
+// missingVersion diagnoses a document that declares neither `openapi` nor
+// `swagger`. One without paths or webhooks is most likely not a spec at all,
+// so that is an error, as is any missing version in strict mode. Otherwise
+// the document is parsed as 3.0 and the returned warning asks for the
+// version to be declared.
+func missingVersion(doc *yaml.Node, opts Options) (string, error) {
+	hint := "add `openapi: 3.0.3` (or `openapi: 3.1.0`) at the top of the document"
+	switch {
+	case len(doc.Content) == 0 || !hasAnyKey(doc.Content[0], "paths", "webhooks"):
+		return "", fmt.Errorf("no `openapi` or `swagger` field and no paths or webhooks; is this an OpenAPI document? If so, %s", hint)
+	case opts.Mode == ModeStrict:
+		return "", fmt.Errorf("no `openapi` version field; %s", hint)
+	}
+	return "no `openapi` version field; assuming OpenAPI 3.0. To silence this, " + hint, nil
+}
+
+func hasAnyKey(n *yaml.Node, keys ...string) bool {
+	if n.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if slices.Contains(keys, n.Content[i].Value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,415 @@
+// Package reverse derives OpenAPI security from a hand-written Go policy
+// map, so that services which already enforce one can move its contents
+// into their spec and generate the map from there instead.
+package reverse
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+)
+
+// DefaultScheme is the security scheme requirements name when none is
+// given. The parser treats it as a bearer scheme even when the spec does not
+// declare it.
+const DefaultScheme = "BearerAuth"
+
+// ParsePolicies reads the policy map declared as the package-level variable
+// varName of the Go source src, or the only map literal declared at package
+// level when varName is empty. The map must be written like the one
+// openapi-authz generates: keys are RouteKey literals, and values AuthPolicy
+// literals with named fields. Of these, RequireAuth, OptionalAuth, Deny,
+// Roles, Scopes, Conditions, OwnerParam and Alternatives are read; the
+// others describe the spec rather than its security and are ignored.
+// filename is used in errors and warnings.
+func ParsePolicies(filename string, src []byte, varName string) (*model.Config, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+
+	lit, err := findMap(file, varName)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	p := &policyParser{fset: fset}
+	cfg := &model.Config{Policies: make(map[model.RouteKey]model.AuthPolicy)}
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			return nil, p.errorf(elt, "map element is not a key: value pair")
+		}
+		key, err := p.routeKey(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := cfg.Policies[key]; ok {
+			return nil, p.errorf(kv.Key, "duplicate route %s %s", key.Method, key.Path)
+		}
+		policy, err := p.policy(kv.Value)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Policies[key] = policy
+
+		if policy.Deny {
+			pos := fset.Position(kv.Pos())
+			cfg.Warnings = append(cfg.Warnings, model.Warning{
+				Spec:    filename,
+				Line:    pos.Line,
+				Column:  pos.Column,
+				Method:  key.Method,
+				Path:    key.Path,
+				Message: "OpenAPI security cannot deny a route; left out",
+			})
+		}
+	}
+	return cfg, nil
+}
+
+// findMap returns the map literal of the package-level variable name, or of
+// the only one when name is empty.
+func findMap(file *ast.File, name string) (*ast.CompositeLit, error) {
+	var names []string
+	var found []*ast.CompositeLit
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, ident := range vs.Names {
+				if i >= len(vs.Values) {
+					break
+				}
+				lit, ok := vs.Values[i].(*ast.CompositeLit)
+				if !ok {
+					continue
+				}
+				if _, ok := lit.Type.(*ast.MapType); !ok {
+					continue
+				}
+				if ident.Name == name {
+					return lit, nil
+				}
+				names = append(names, ident.Name)
+				found = append(found, lit)
+			}
+		}
+	}
+
+	switch {
+	case name != "":
+		return nil, fmt.Errorf("no map literal named %s", name)
+	case len(found) == 0:
+		return nil, fmt.Errorf("no package-level map literal")
+	case len(found) > 1:
+		return nil, fmt.Errorf("several package-level maps (%s); name the policy map", strings.Join(names, ", "))
+	}
+	return found[0], nil
+}
+
+type policyParser struct {
+	fset *token.FileSet
+}
+
+func (p *policyParser) errorf(n ast.Node, format string, args ...any) error {
+	return fmt.Errorf("%s: %s", p.fset.Position(n.Pos()), fmt.Sprintf(format, args...))
+}
+
+// routeKey reads a RouteKey literal, with named or positional fields.
+func (p *policyParser) routeKey(e ast.Expr) (model.RouteKey, error) {
+	lit, ok := e.(*ast.CompositeLit)
+	if !ok {
+		return model.RouteKey{}, p.errorf(e, "route key is not a RouteKey literal")
+	}
+
+	var key model.RouteKey
+	for i, elt := range lit.Elts {
+		field, value := "", elt
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			ident, _ := kv.Key.(*ast.Ident)
+			if ident == nil {
+				return model.RouteKey{}, p.errorf(kv.Key, "route key field is not a name")
+			}
+			field, value = ident.Name, kv.Value
+		} else if i < 2 {
+			field = []string{"Method", "Path"}[i]
+		}
+
+		s, err := p.stringValue(value)
+		if err != nil {
+			return model.RouteKey{}, err
+		}
+		switch field {
+		case "Method":
+			key.Method = strings.ToUpper(s)
+		case "Path":
+			key.Path = s
+		default:
+			return model.RouteKey{}, p.errorf(elt, "unknown route key field %s", field)
+		}
+	}
+	if key.Method == "" || key.Path == "" {
+		return model.RouteKey{}, p.errorf(e, "route key needs a method and a path")
+	}
+	return key, nil
+}
+
+// policy reads an AuthPolicy literal.
+func (p *policyParser) policy(e ast.Expr) (model.AuthPolicy, error) {
+	lit, ok := e.(*ast.CompositeLit)
+	if !ok {
+		return model.AuthPolicy{}, p.errorf(e, "policy is not an AuthPolicy literal")
+	}
+
+	var policy model.AuthPolicy
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			return model.AuthPolicy{}, p.errorf(elt, "policy fields must be named")
+		}
+		ident, _ := kv.Key.(*ast.Ident)
+		if ident == nil {
+			return model.AuthPolicy{}, p.errorf(kv.Key, "policy field is not a name")
+		}
+
+		var err error
+		switch ident.Name {
+		case "RequireAuth":
+			policy.RequireAuth, err = p.boolValue(kv.Value)
+		case "OptionalAuth":
+			policy.OptionalAuth, err = p.boolValue(kv.Value)
+		case "Deny":
+			policy.Deny, err = p.boolValue(kv.Value)
+		case "Roles":
+			policy.Roles, err = p.stringsValue(kv.Value)
+		case "Scopes":
+			policy.Scopes, err = p.stringsValue(kv.Value)
+		case "Conditions":
+			policy.Conditions, err = p.stringsValue(kv.Value)
+		case "OwnerParam":
+			policy.OwnerParam, err = p.stringValue(kv.Value)
+		case "Alternatives":
+			policy.Alternatives, err = p.alternatives(kv.Value)
+		}
+		if err != nil {
+			return model.AuthPolicy{}, err
+		}
+	}
+	return policy, nil
+}
+
+func (p *policyParser) alternatives(e ast.Expr) ([]model.AuthPolicy, error) {
+	if isNil(e) {
+		return nil, nil
+	}
+	lit, ok := e.(*ast.CompositeLit)
+	if !ok {
+		return nil, p.errorf(e, "Alternatives is not a []AuthPolicy literal")
+	}
+	alternatives := make([]model.AuthPolicy, 0, len(lit.Elts))
+	for _, elt := range lit.Elts {
+		alt, err := p.policy(elt)
+		if err != nil {
+			return nil, err
+		}
+		alternatives = append(alternatives, alt)
+	}
+	return alternatives, nil
+}
+
+func (p *policyParser) boolValue(e ast.Expr) (bool, error) {
+	if ident, ok := e.(*ast.Ident); ok && (ident.Name == "true" || ident.Name == "false") {
+		return ident.Name == "true", nil
+	}
+	return false, p.errorf(e, "not true or false")
+}
+
+// stringValue reads a string literal, or a net/http method constant such as
+// http.MethodGet.
+func (p *policyParser) stringValue(e ast.Expr) (string, error) {
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		if e.Kind == token.STRING {
+			return strconv.Unquote(e.Value)
+		}
+	case *ast.SelectorExpr:
+		if pkg, ok := e.X.(*ast.Ident); ok && pkg.Name == "http" {
+			if method, ok := strings.CutPrefix(e.Sel.Name, "Method"); ok && method != "" {
+				return strings.ToUpper(method), nil
+			}
+		}
+	}
+	return "", p.errorf(e, "not a string literal")
+}
+
+func (p *policyParser) stringsValue(e ast.Expr) ([]string, error) {
+	if isNil(e) {
+		return nil, nil
+	}
+	lit, ok := e.(*ast.CompositeLit)
+	if !ok {
+		return nil, p.errorf(e, "not a []string literal")
+	}
+	items := make([]string, 0, len(lit.Elts))
+	for _, elt := range lit.Elts {
+		s, err := p.stringValue(elt)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, s)
+	}
+	return items, nil
+}
+
+func isNil(e ast.Expr) bool {
+	ident, ok := e.(*ast.Ident)
+	return ok && ident.Name == "nil"
+}
+
+// Overlay returns an OpenAPI Overlay that replaces the security of the
+// operation of every route in cfg with the requirements its policy states,
+// each naming scheme, or DefaultScheme when empty. Roles are listed with the
+// `role:` prefix, and conditions and owner parameters go into x-authz.
+// Denied routes are left out, and routes the spec does not declare are not
+// matched by any action. source names the policy file in the overlay's
+// title.
+func Overlay(cfg *model.Config, scheme, source string) ([]byte, error) {
+	if scheme == "" {
+		scheme = DefaultScheme
+	}
+
+	actions := seq(0)
+	keys := make([]model.RouteKey, 0, len(cfg.Policies))
+	for key := range cfg.Policies {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b model.RouteKey) int {
+		if a.Path != b.Path {
+			return strings.Compare(a.Path, b.Path)
+		}
+		return strings.Compare(a.Method, b.Method)
+	})
+	for _, key := range keys {
+		policy := cfg.Policies[key]
+		if policy.Deny {
+			continue
+		}
+		target := operationTarget(key)
+		update := mapping(pair("security", security(policy, scheme)))
+		if len(policy.Conditions) > 0 || policy.OwnerParam != "" {
+			authz := mapping()
+			if len(policy.Conditions) > 0 {
+				authz.Content = append(authz.Content, pair("conditions", strs(policy.Conditions))...)
+			}
+			if policy.OwnerParam != "" {
+				authz.Content = append(authz.Content, pair("owner", str(policy.OwnerParam))...)
+			}
+			update.Content = append(update.Content, pair("x-authz", authz)...)
+		}
+
+		// Overlay updates append to arrays, so the operation's own
+		// security is removed first.
+		remove := mapping(pair("target", str(target+".security")), pair("remove", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"}))
+		remove.HeadComment = key.Method + " " + key.Path
+		actions.Content = append(actions.Content, remove, mapping(pair("target", str(target)), pair("update", update)))
+	}
+
+	title := "Security derived from " + filepath.Base(source)
+	doc := mapping(
+		pair("overlay", str("1.0.0")),
+		pair("info", mapping(pair("title", str(title)), pair("version", str("1.0.0")))),
+		pair("actions", actions),
+	)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("encode overlay: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("encode overlay: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// standardMethods are the methods a path item declares directly; any other
+// lives under x-methods.
+var standardMethods = []string{"GET", "PUT", "POST", "DELETE", "OPTIONS", "HEAD", "PATCH", "TRACE"}
+
+// operationTarget returns the JSONPath of the operation of key.
+func operationTarget(key model.RouteKey) string {
+	quote := "'"
+	if strings.Contains(key.Path, quote) {
+		quote = `"`
+	}
+	target := "$.paths[" + quote + key.Path + quote + "]"
+	if !slices.Contains(standardMethods, key.Method) {
+		return target + "['x-methods']." + key.Method
+	}
+	return target + "." + strings.ToLower(key.Method)
+}
+
+// security returns the security requirements stating policy: one per
+// alternative, after an empty one when authentication is optional.
+func security(policy model.AuthPolicy, scheme string) *yaml.Node {
+	reqs := seq(0)
+	if policy.Mode() == model.AuthPublic {
+		reqs.Style = yaml.FlowStyle
+		return reqs
+	}
+	if policy.Mode() == model.AuthOptional {
+		reqs.Content = append(reqs.Content, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Style: yaml.FlowStyle})
+	}
+	for _, p := range append([]model.AuthPolicy{policy}, policy.Alternatives...) {
+		var names []string
+		for _, role := range p.Roles {
+			names = append(names, "role:"+role)
+		}
+		reqs.Content = append(reqs.Content, mapping(pair(scheme, strs(append(names, p.Scopes...)))))
+	}
+	return reqs
+}
+
+func mapping(pairs ...[]*yaml.Node) *yaml.Node {
+	n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, p := range pairs {
+		n.Content = append(n.Content, p...)
+	}
+	return n
+}
+
+func pair(key string, value *yaml.Node) []*yaml.Node {
+	return []*yaml.Node{str(key), value}
+}
+
+func seq(style yaml.Style) *yaml.Node {
+	return &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: style}
+}
+
+func str(s string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s}
+}
+
+func strs(items []string) *yaml.Node {
+	n := seq(yaml.FlowStyle)
+	for _, s := range items {
+		n.Content = append(n.Content, str(s))
+	}
+	return n
+}
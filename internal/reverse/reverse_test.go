@@ -0,0 +1,94 @@
+package reverse
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chr1sbest/openapi-authz/internal/model"
+	"github.com/chr1sbest/openapi-authz/internal/parser"
+)
+
+func TestOverlay_RoundTrip(t *testing.T) {
+	path := filepath.Join("..", "..", "testdata", "reverse", "policies.go")
+	src, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParsePolicies(path, src, ""); err == nil || !strings.Contains(err.Error(), "routePolicies, timeouts") {
+		t.Errorf("expected an error naming both maps, got %v", err)
+	}
+	want, err := ParsePolicies(path, src, "routePolicies")
+	if err != nil {
+		t.Fatalf("ParsePolicies error: %v", err)
+	}
+	if len(want.Warnings) != 1 || want.Warnings[0].Path != "/legacy" || want.Warnings[0].Line != 41 {
+		t.Errorf("expected a warning for the denied GET /legacy, got %v", want.Warnings)
+	}
+
+	data, err := Overlay(want, "", path)
+	if err != nil {
+		t.Fatalf("Overlay error: %v", err)
+	}
+	overlay := filepath.Join(t.TempDir(), "overlay.yaml")
+	if err := os.WriteFile(overlay, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The spec with the overlay applied must derive the hand-written
+	// policies, whatever security it declared before.
+	got, err := parser.ParseConfigWithOptions(filepath.Join("..", "..", "testdata", "reverse", "openapi.yaml"), parser.Options{Overlays: []string{overlay}})
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v\n%s", err, data)
+	}
+	for key, policy := range want.Policies {
+		if policy.Deny {
+			continue
+		}
+		if g := got.Policies[key]; !sameSecurity(g, policy) {
+			t.Errorf("%s %s: derives %+v, want %+v", key.Method, key.Path, g, policy)
+		}
+	}
+}
+
+// sameSecurity compares the fields a policy map states about security.
+func sameSecurity(a, b model.AuthPolicy) bool {
+	if a.RequireAuth != b.RequireAuth || a.OptionalAuth != b.OptionalAuth || a.OwnerParam != b.OwnerParam ||
+		len(a.Alternatives) != len(b.Alternatives) {
+		return false
+	}
+	for _, pair := range [][2][]string{{a.Roles, b.Roles}, {a.Scopes, b.Scopes}, {a.Conditions, b.Conditions}} {
+		if len(pair[0]) != 0 || len(pair[1]) != 0 {
+			if !reflect.DeepEqual(pair[0], pair[1]) {
+				return false
+			}
+		}
+	}
+	for i := range a.Alternatives {
+		if !sameSecurity(a.Alternatives[i], b.Alternatives[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParsePolicies_Errors(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{`var m = map[string]int{1}`, "map element is not a key: value pair"},
+		{`var x = 1`, "no package-level map literal"},
+		{`var m = map[RouteKey]AuthPolicy{{"GET", "/a"}: {true}}`, "policy.go:2:49: policy fields must be named"},
+		{`var m = map[RouteKey]AuthPolicy{{"GET", "/a"}: {Roles: roles}}`, "not a []string literal"},
+		{`var m = map[RouteKey]AuthPolicy{{"GET", "/a"}: {}, {Method: "get", Path: "/a"}: {}}`, "duplicate route GET /a"},
+		{`var m = map[RouteKey]AuthPolicy{{Method: "GET"}: {}}`, "needs a method and a path"},
+	}
+	for _, tt := range tests {
+		_, err := ParsePolicies("policy.go", []byte("package p\n"+tt.src), "")
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.src, tt.want, err)
+		}
+	}
+}
@@ -7,15 +7,67 @@ type RouteKey struct {
 }
 
 type AuthPolicy struct {
-	RequireAuth bool
-	Roles       []string
-	Scopes      []string
+	RequireAuth      bool
+	OptionalAuth     bool
+	Roles            []string
+	Scopes           []string
+	Schemes          []string
+	APIKey           *APIKey
+	SessionCookie    bool
+	OpenIDConnectURL string
+	MutualTLS        bool
+	Conditions       []string
+	OwnerParam       string
+	OperationID      string
+	Summary          string
+	Description      string
+	PathParams       []string
+	PublicOverride   bool
+	Deprecated       bool
+	Deny             bool
+	Alternatives     []AuthPolicy
+}
+
+// AuthMode says whether an operation needs authentication.
+type AuthMode string
+
+const (
+	AuthPublic   AuthMode = "public"
+	AuthOptional AuthMode = "optional"
+	AuthRequired AuthMode = "required"
+)
+
+// Mode reports whether p is public, accepts optional authentication, or requires it.
+func (p AuthPolicy) Mode() AuthMode {
+	switch {
+	case p.RequireAuth:
+		return AuthRequired
+	case p.OptionalAuth:
+		return AuthOptional
+	default:
+		return AuthPublic
+	}
+}
+
+// APIKey locates an API key credential: In is "header", "query" or "cookie".
+type APIKey struct {
+	Name string
+	In   string
 }
 
 // Policies is derived from OpenAPI security requirements; see openapi-authz docs.
 var Policies = map[RouteKey]AuthPolicy{
-	{Method: "DELETE", Path: "/admin"}: {RequireAuth: true, Roles: []string{"admin"}},
-	{Method: "GET", Path: "/public"}:   {RequireAuth: false},
-	{Method: "POST", Path: "/scoped"}:  {RequireAuth: true, Scopes: []string{"vegetable:write"}},
-	{Method: "GET", Path: "/user"}:     {RequireAuth: true},
+	{Method: "DELETE", Path: "/admin"}:       {RequireAuth: true, Roles: []string{"admin"}, Schemes: []string{"bearer"}},
+	{Method: "GET", Path: "/dashboard"}:      {RequireAuth: true, Schemes: []string{"apiKey"}, APIKey: &APIKey{Name: "session", In: "cookie"}, SessionCookie: true},
+	{Method: "GET", Path: "/feed"}:           {RequireAuth: false, OptionalAuth: true, Schemes: []string{"bearer"}},
+	{Method: "GET", Path: "/legacy"}:         {RequireAuth: true, Schemes: []string{"basic"}, Deprecated: true, Deny: true},
+	{Method: "POST", Path: "/payments"}:      {RequireAuth: true, Schemes: []string{"mutualTLS"}, MutualTLS: true},
+	{Method: "GET", Path: "/profile"}:        {RequireAuth: true, Schemes: []string{"openIdConnect"}, OpenIDConnectURL: "https://id.example.com/.well-known/openid-configuration"},
+	{Method: "GET", Path: "/public"}:         {RequireAuth: false, PublicOverride: true},
+	{Method: "GET", Path: "/reports"}:        {RequireAuth: true, Schemes: []string{"apiKey"}, APIKey: &APIKey{Name: "X-API-Key", In: "header"}},
+	{Method: "GET", Path: "/reports/{id}"}:   {RequireAuth: true, Schemes: []string{"bearer"}, Alternatives: []AuthPolicy{{RequireAuth: true, Schemes: []string{"apiKey"}, APIKey: &APIKey{Name: "X-API-Key", In: "header"}}}},
+	{Method: "POST", Path: "/scoped"}:        {RequireAuth: true, Scopes: []string{"vegetable:write"}, Schemes: []string{"bearer"}},
+	{Method: "GET", Path: "/user"}:           {RequireAuth: true, Schemes: []string{"bearer"}, OperationID: "getUser", Summary: "Get the current user"},
+	{Method: "PUT", Path: "/users/{userId}"}: {RequireAuth: true, Roles: []string{"member"}, Schemes: []string{"bearer"}, Conditions: []string{"tenant == claims.tenant"}, OwnerParam: "userId", PathParams: []string{"userId"}},
 }
+
@@ -0,0 +1,44 @@
+package httpapi
+
+import "net/http"
+
+type RouteKey struct {
+	Method string
+	Path   string
+}
+
+type AuthPolicy struct {
+	RequireAuth  bool
+	OptionalAuth bool
+	Deny         bool
+	Roles        []string
+	Scopes       []string
+	Conditions   []string
+	OwnerParam   string
+	Alternatives []AuthPolicy
+	Summary      string
+}
+
+// routePolicies was written by hand before the service had a spec.
+var routePolicies = map[RouteKey]AuthPolicy{
+	{Method: http.MethodGet, Path: "/health"}: {},
+	{"GET", "/vegetables"}:                    {OptionalAuth: true, Scopes: []string{"vegetables:read"}},
+	{Method: "POST", Path: "/vegetables"}: {
+		RequireAuth: true,
+		Roles:       []string{"admin", "gardener"},
+		Scopes:      []string{"vegetables:write"},
+		Summary:     "Plant a vegetable",
+	},
+	{Method: "DELETE", Path: "/vegetables/{name}"}: {
+		RequireAuth: true,
+		Roles:       []string{"admin"},
+		Alternatives: []AuthPolicy{
+			{RequireAuth: true, Scopes: []string{"vegetables:admin"}},
+		},
+	},
+	{Method: "GET", Path: "/users/{userId}"}: {RequireAuth: true, Conditions: []string{"tenant == claims.tenant"}, OwnerParam: "userId"},
+	{Method: "PURGE", Path: "/cache"}:        {RequireAuth: true, Roles: []string{"sre"}},
+	{Method: "GET", Path: "/legacy"}:         {Deny: true},
+}
+
+var timeouts = map[string]int{"default": 30}